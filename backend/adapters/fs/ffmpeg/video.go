@@ -1,6 +1,7 @@
 package ffmpeg
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
@@ -9,6 +10,7 @@ import (
 )
 
 type VideoConverter struct {
+	ctx        context.Context
 	inputPath  string
 	outputPath string
 	options    map[string]interface{}
@@ -25,6 +27,7 @@ func NewVideoConverter(inputPath, outputPath string, options map[string]interfac
 	}
 
 	return &VideoConverter{
+		ctx:        context.Background(),
 		inputPath:  inputPath,
 		outputPath: outputPath,
 		options:    options,
@@ -38,6 +41,12 @@ func ProcessVideoConversion(inputPath string, outputPath string, options map[str
 	return converter.Execute()
 }
 
+// WithContext makes the conversion stop when ctx is canceled.
+func (vc *VideoConverter) WithContext(ctx context.Context) *VideoConverter {
+	vc.ctx = ctx
+	return vc
+}
+
 func (vc *VideoConverter) GetVideoInfo() (map[string]interface{}, error) {
 	if err := vc.analyzeSourceVideo(); err != nil {
 		return nil, err
@@ -170,7 +179,7 @@ func (vc *VideoConverter) finalizeArguments() {
 }
 
 func (vc *VideoConverter) runConversion() error {
-	cmd := exec.Command("ffmpeg", vc.ffmpegArgs...)
+	cmd := exec.CommandContext(vc.ctx, "ffmpeg", vc.ffmpegArgs...)
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
@@ -0,0 +1,539 @@
+package files
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Archives can be browsed like folders without extracting them. The entries
+// of an archive are indexed once and the index is kept in the cache dir by
+// version of the archive: for zips the data offsets from the central
+// directory, for tars the offsets of the entries in the uncompressed stream.
+
+const (
+	ArchiveZip    = "zip"
+	ArchiveTar    = "tar"
+	ArchiveTarGz  = "tar.gz"
+	ArchiveTarXz  = "tar.xz"
+	ArchiveTarZst = "tar.zst"
+)
+
+const (
+	archiveIndexDir     = "archives"
+	archiveIndexTTL     = 7 * 24 * time.Hour
+	maxLoadedArchives   = 16
+	archiveIndexVersion = 1
+	archiveReadBuffer   = 256 << 10
+)
+
+var (
+	loadedArchivesMu   sync.Mutex
+	loadedArchives     = map[string]*archiveIndex{}
+	archiveCleanupMu   sync.Mutex
+	lastArchiveCleanup time.Time
+)
+
+// ArchiveEntry is a file or folder inside an archive.
+type ArchiveEntry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"` // path inside the archive, folders end with a slash
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modified"`
+	IsDir   bool      `json:"isDir"`
+}
+
+// archiveEntry is an entry of an archive index.
+type archiveEntry struct {
+	ArchiveEntry
+	Offset         int64  `json:"offset"`                   // start of the data, in the uncompressed stream for compressed tars
+	CompressedSize int64  `json:"compressedSize,omitempty"` // zip only
+	Method         uint16 `json:"method,omitempty"`         // zip only
+	CRC32          uint32 `json:"crc32,omitempty"`          // zip only
+}
+
+type archiveIndex struct {
+	Version int            `json:"version"`
+	Format  string         `json:"format"`
+	Entries []archiveEntry `json:"entries"` // sorted by path, including implied folders
+	byPath  map[string]int
+}
+
+// ArchiveFormat returns the format of an archive by its name, or an empty
+// string if it isn't a supported archive.
+func ArchiveFormat(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return ArchiveZip
+	case strings.HasSuffix(name, ".tar"):
+		return ArchiveTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ArchiveTarGz
+	case strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"):
+		return ArchiveTarXz
+	case strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tar.zstd"), strings.HasSuffix(name, ".tzst"):
+		return ArchiveTarZst
+	}
+	return ""
+}
+
+// ListArchive returns the entries directly inside the folder dir of an
+// archive, the root for an empty dir.
+func ListArchive(source, archivePath, dir string) ([]ArchiveEntry, error) {
+	index, err := loadArchiveIndex(source, archivePath)
+	if err != nil {
+		return nil, err
+	}
+	dir = strings.Trim(dir, "/")
+	if dir != "" {
+		dir += "/"
+		if i, ok := index.byPath[dir]; !ok || !index.Entries[i].IsDir {
+			return nil, errors.ErrNotExist
+		}
+	}
+	result := []ArchiveEntry{}
+	// entries are sorted, so the children of dir follow it
+	start := sort.Search(len(index.Entries), func(i int) bool { return index.Entries[i].Path > dir })
+	for _, entry := range index.Entries[start:] {
+		if !strings.HasPrefix(entry.Path, dir) {
+			break
+		}
+		rest := strings.TrimSuffix(strings.TrimPrefix(entry.Path, dir), "/")
+		if !strings.Contains(rest, "/") {
+			result = append(result, entry.ArchiveEntry)
+		}
+	}
+	return result, nil
+}
+
+// OpenArchiveEntry returns the content of a file inside an archive.
+func OpenArchiveEntry(source, archivePath, entryPath string) (io.ReadCloser, ArchiveEntry, error) {
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return nil, ArchiveEntry{}, fmt.Errorf("could not get index: %v ", source)
+	}
+	index, err := loadArchiveIndex(source, archivePath)
+	if err != nil {
+		return nil, ArchiveEntry{}, err
+	}
+	i, ok := index.byPath[strings.TrimLeft(entryPath, "/")]
+	if !ok || index.Entries[i].IsDir {
+		return nil, ArchiveEntry{}, errors.ErrNotExist
+	}
+	entry := index.Entries[i]
+	reader, err := openArchiveEntry(idx.FS, archivePath, index.Format, entry)
+	if err != nil {
+		return nil, ArchiveEntry{}, err
+	}
+	return reader, entry.ArchiveEntry, nil
+}
+
+func openArchiveEntry(fsys sources.FS, archivePath, format string, entry archiveEntry) (io.ReadCloser, error) {
+	// reading a range of length 0 would read to the end of the archive
+	if entry.Size == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+	switch format {
+	case ArchiveZip:
+		raw, err := fsys.ReadRange(archivePath, entry.Offset, entry.CompressedSize)
+		if err != nil {
+			return nil, err
+		}
+		var data io.ReadCloser
+		switch entry.Method {
+		case zip.Store:
+			data = raw
+		case zip.Deflate:
+			data = &readCloser{Reader: flate.NewReader(raw), closers: []io.Closer{raw}}
+		default:
+			raw.Close()
+			return nil, fmt.Errorf("compression method %d of %s is not supported", entry.Method, entry.Path)
+		}
+		// one byte more than the size is read to notice entries that are
+		// larger than their header says
+		limited := &readCloser{Reader: io.LimitReader(data, entry.Size+1), closers: []io.Closer{data}}
+		return &checksumReader{ReadCloser: limited, hash: crc32.NewIEEE(), want: entry.CRC32, remaining: entry.Size}, nil
+	case ArchiveTar:
+		return fsys.ReadRange(archivePath, entry.Offset, entry.Size)
+	}
+	// compressed streams can't seek, so everything before the entry is
+	// decompressed and discarded
+	file, err := fsys.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := decompressTar(file, format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err = io.CopyN(io.Discard, stream, entry.Offset); err != nil {
+		stream.Close()
+		file.Close()
+		return nil, fmt.Errorf("could not seek to %s: %v", entry.Path, err)
+	}
+	return &readCloser{Reader: io.LimitReader(stream, entry.Size), closers: []io.Closer{stream, file}}, nil
+}
+
+// decompressTar returns the uncompressed stream of a tar.
+func decompressTar(r io.Reader, format string) (io.ReadCloser, error) {
+	switch format {
+	case ArchiveTar:
+		return io.NopCloser(r), nil
+	case ArchiveTarGz:
+		return gzip.NewReader(bufio.NewReaderSize(r, archiveReadBuffer))
+	case ArchiveTarXz:
+		reader, err := xz.NewReader(bufio.NewReaderSize(r, archiveReadBuffer))
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(reader), nil
+	case ArchiveTarZst:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	}
+	return nil, errors.ErrUnsupportedArchive
+}
+
+func loadArchiveIndex(source, archivePath string) (*archiveIndex, error) {
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return nil, fmt.Errorf("could not get index: %v ", source)
+	}
+	format := ArchiveFormat(archivePath)
+	if format == "" {
+		return nil, errors.ErrUnsupportedArchive
+	}
+	info, err := idx.FS.Stat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(idx.Path + "\x00" + archivePath + "\x00" + fileutils.VersionTag(info)))
+	key := hex.EncodeToString(sum[:])
+
+	loadedArchivesMu.Lock()
+	index, ok := loadedArchives[key]
+	loadedArchivesMu.Unlock()
+	if ok {
+		return index, nil
+	}
+
+	cachePath := ""
+	if settings.Config.Server.CacheDir != "" {
+		cachePath = filepath.Join(settings.Config.Server.CacheDir, archiveIndexDir, key+".json")
+		index = readArchiveIndex(cachePath)
+	}
+	if index == nil {
+		file, err := idx.FS.Open(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		index, err = buildArchiveIndex(file, info.Size(), format)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read archive %s: %v", archivePath, err)
+		}
+		if cachePath != "" {
+			writeArchiveIndex(cachePath, index)
+		}
+	}
+	index.byPath = make(map[string]int, len(index.Entries))
+	for i, entry := range index.Entries {
+		index.byPath[entry.Path] = i
+	}
+
+	loadedArchivesMu.Lock()
+	if len(loadedArchives) >= maxLoadedArchives {
+		for k := range loadedArchives {
+			delete(loadedArchives, k)
+			break
+		}
+	}
+	loadedArchives[key] = index
+	loadedArchivesMu.Unlock()
+	return index, nil
+}
+
+func readArchiveIndex(cachePath string) *archiveIndex {
+	var index archiveIndex
+	if err := readCacheJSON(cachePath, &index); err != nil || index.Version != archiveIndexVersion {
+		return nil
+	}
+	// keep used indexes from expiring
+	now := time.Now()
+	os.Chtimes(cachePath, now, now)
+	return &index
+}
+
+func writeArchiveIndex(cachePath string, index *archiveIndex) {
+	if err := writeCacheJSON(cachePath, index); err != nil {
+		slog.Debug("could not save archive index", "path", cachePath, "err", err)
+		return
+	}
+	go cleanupArchiveIndexes(filepath.Dir(cachePath))
+}
+
+// cleanupArchiveIndexes removes indexes that weren't used for a while, at
+// most once an hour.
+func cleanupArchiveIndexes(dir string) {
+	archiveCleanupMu.Lock()
+	defer archiveCleanupMu.Unlock()
+	if time.Since(lastArchiveCleanup) < time.Hour {
+		return
+	}
+	lastArchiveCleanup = time.Now()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && time.Since(info.ModTime()) > archiveIndexTTL {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// buildArchiveIndex reads the entries of an archive.
+func buildArchiveIndex(file sources.File, size int64, format string) (*archiveIndex, error) {
+	index := &archiveIndex{Version: archiveIndexVersion, Format: format}
+	var err error
+	if format == ArchiveZip {
+		index.Entries, err = zipEntries(file, size)
+	} else {
+		index.Entries, err = tarEntries(file, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	index.Entries = withImpliedDirs(index.Entries)
+	return index, nil
+}
+
+func zipEntries(r io.ReaderAt, size int64) ([]archiveEntry, error) {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]archiveEntry, 0, len(reader.File))
+	for _, f := range reader.File {
+		name, ok := cleanEntryPath(f.Name, f.FileInfo().IsDir())
+		if !ok {
+			continue
+		}
+		entry := archiveEntry{
+			ArchiveEntry: ArchiveEntry{
+				Name:    path.Base(name),
+				Path:    name,
+				ModTime: f.Modified,
+				IsDir:   strings.HasSuffix(name, "/"),
+			},
+		}
+		if !entry.IsDir {
+			entry.Size = int64(f.UncompressedSize64)
+			entry.CompressedSize = int64(f.CompressedSize64)
+			entry.Method = f.Method
+			entry.CRC32 = f.CRC32
+			if entry.Offset, err = f.DataOffset(); err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func tarEntries(file io.ReadSeeker, format string) ([]archiveEntry, error) {
+	var counter *offsetReader
+	var reader *tar.Reader
+	if format == ArchiveTar {
+		// tar seeks over the data of uncompressed entries
+		counter = &offsetReader{r: file}
+		reader = tar.NewReader(&offsetReadSeeker{offsetReader: counter, s: file})
+	} else {
+		stream, err := decompressTar(file, format)
+		if err != nil {
+			return nil, err
+		}
+		defer stream.Close()
+		counter = &offsetReader{r: stream}
+		reader = tar.NewReader(counter)
+	}
+	entries := []archiveEntry{}
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeDir {
+			continue
+		}
+		name, ok := cleanEntryPath(header.Name, header.Typeflag == tar.TypeDir)
+		if !ok {
+			continue
+		}
+		entry := archiveEntry{
+			ArchiveEntry: ArchiveEntry{
+				Name:    path.Base(name),
+				Path:    name,
+				ModTime: header.ModTime,
+				IsDir:   header.Typeflag == tar.TypeDir,
+			},
+		}
+		if !entry.IsDir {
+			// tar reads exactly the header blocks, so the data starts here
+			entry.Size = header.Size
+			entry.Offset = counter.offset
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// cleanEntryPath returns the path of an entry relative to the archive root,
+// with a trailing slash for folders. Entries outside the root are skipped.
+func cleanEntryPath(name string, isDir bool) (string, bool) {
+	name = path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	if name == "/" {
+		return "", false
+	}
+	name = strings.TrimPrefix(name, "/")
+	if isDir {
+		name += "/"
+	}
+	return name, true
+}
+
+// withImpliedDirs adds the folders that only exist as parents of other
+// entries and sorts the entries by path. Later duplicates win, like when
+// extracting.
+func withImpliedDirs(entries []archiveEntry) []archiveEntry {
+	byPath := make(map[string]int, len(entries))
+	result := make([]archiveEntry, 0, len(entries))
+	for _, entry := range entries {
+		if i, ok := byPath[entry.Path]; ok {
+			result[i] = entry
+			continue
+		}
+		byPath[entry.Path] = len(result)
+		result = append(result, entry)
+	}
+	for _, entry := range entries {
+		for dir := path.Dir(strings.TrimSuffix(entry.Path, "/")); dir != "."; dir = path.Dir(dir) {
+			if _, ok := byPath[dir+"/"]; ok {
+				break
+			}
+			byPath[dir+"/"] = len(result)
+			result = append(result, archiveEntry{ArchiveEntry: ArchiveEntry{
+				Name:    path.Base(dir),
+				Path:    dir + "/",
+				ModTime: entry.ModTime,
+				IsDir:   true,
+			}})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result
+}
+
+// offsetReader counts the bytes read.
+type offsetReader struct {
+	r      io.Reader
+	offset int64
+}
+
+func (r *offsetReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// offsetReadSeeker counts the bytes read or skipped by seeking.
+type offsetReadSeeker struct {
+	*offsetReader
+	s io.Seeker
+}
+
+func (r *offsetReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.s.Seek(offset, whence)
+	if err == nil {
+		r.offset = pos
+	}
+	return pos, err
+}
+
+// checksumReader verifies the size and checksum of a zip entry. Nothing
+// beyond the declared size is passed on.
+type checksumReader struct {
+	io.ReadCloser
+	hash      hash.Hash32
+	want      uint32
+	remaining int64
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if int64(n) > r.remaining {
+		n = int(max(r.remaining, 0))
+		r.hash.Write(p[:n])
+		r.remaining = -1
+		return n, fmt.Errorf("%w: entry is larger than its declared size", zip.ErrFormat)
+	}
+	r.hash.Write(p[:n])
+	r.remaining -= int64(n)
+	if err == io.EOF {
+		if r.remaining != 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		if r.hash.Sum32() != r.want {
+			return n, zip.ErrChecksum
+		}
+	}
+	return n, err
+}
+
+// readCloser closes several readers, eg. a decompressor and its file.
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
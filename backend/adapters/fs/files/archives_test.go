@@ -0,0 +1,288 @@
+package files
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
+)
+
+func TestCleanEntryPath(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		isDir bool
+		want  string
+		ok    bool
+	}{
+		{"a/b.txt", false, "a/b.txt", true},
+		{"a/b", true, "a/b/", true},
+		{"a/b/", true, "a/b/", true},
+		{"./a/./b.txt", false, "a/b.txt", true},
+		{"/etc/passwd", false, "etc/passwd", true},
+		{"../../etc/passwd", false, "etc/passwd", true},
+		{"a/../../b.txt", false, "b.txt", true},
+		{"a\\..\\..\\b.txt", false, "b.txt", true},
+		{"C:\\dir\\b.txt", false, "C:/dir/b.txt", true},
+		{"..", true, "", false},
+		{"/", true, "", false},
+		{"", false, "", false},
+	} {
+		got, ok := cleanEntryPath(tc.name, tc.isDir)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("cleanEntryPath(%q, %v) = %q, %v; want %q, %v", tc.name, tc.isDir, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestWithImpliedDirs(t *testing.T) {
+	entry := func(path string, size int64) archiveEntry {
+		return archiveEntry{ArchiveEntry: ArchiveEntry{Path: path, Size: size, IsDir: strings.HasSuffix(path, "/")}}
+	}
+	entries := withImpliedDirs([]archiveEntry{
+		entry("b/c/d.txt", 1),
+		entry("a.txt", 1),
+		entry("b/", 0),
+		entry("a.txt", 2), // a later duplicate replaces the first
+	})
+	var paths []string
+	for _, e := range entries {
+		paths = append(paths, e.Path)
+	}
+	if got, want := strings.Join(paths, ","), "a.txt,b/,b/c/,b/c/d.txt"; got != want {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if entries[0].Size != 2 {
+		t.Errorf("expected the later duplicate to win, got size %d", entries[0].Size)
+	}
+	if implied := entries[2]; !implied.IsDir || implied.Name != "c" {
+		t.Errorf("expected an implied folder c, got %+v", implied)
+	}
+}
+
+// testArchiveFiles are the files of the test archives, folders end with a
+// slash.
+var testArchiveFiles = []struct{ name, content string }{
+	{"docs/", ""},
+	{"docs/a.txt", "a"},
+	{"docs/big.bin", strings.Repeat("0123456789", 1000)},
+	{"docs/empty.txt", ""},
+	{"other/sub/b.txt", "b"}, // without entries for its folders
+	{"../escape.txt", "escape"},
+}
+
+func writeTestTar(t *testing.T, w io.Writer) {
+	t.Helper()
+	tw := tar.NewWriter(w)
+	for _, f := range testArchiveFiles {
+		header := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.content)), ModTime: time.Unix(1700000000, 0), Typeflag: tar.TypeReg}
+		if strings.HasSuffix(f.name, "/") {
+			header.Typeflag = tar.TypeDir
+			header.Mode = 0755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestZip(t *testing.T, w io.Writer, method uint16) {
+	t.Helper()
+	zw := zip.NewWriter(w)
+	for _, f := range testArchiveFiles {
+		header := &zip.FileHeader{Name: f.name, Method: method, Modified: time.Unix(1700000000, 0)}
+		if strings.HasSuffix(f.name, "/") {
+			header.Method = zip.Store
+		}
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = writer.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestArchive writes a test archive of the format to a temp dir and
+// returns the source and the name of the archive in it.
+func writeTestArchive(t *testing.T, format string, method uint16) (sources.FS, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch format {
+	case ArchiveZip:
+		writeTestZip(t, &buf, method)
+	case ArchiveTar:
+		writeTestTar(t, &buf)
+	case ArchiveTarGz:
+		w = gzip.NewWriter(&buf)
+	case ArchiveTarXz:
+		var err error
+		if w, err = xz.NewWriter(&buf); err != nil {
+			t.Fatal(err)
+		}
+	case ArchiveTarZst:
+		var err error
+		if w, err = zstd.NewWriter(&buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w != nil {
+		writeTestTar(t, w)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	root := t.TempDir()
+	name := "/test." + format
+	if err := os.WriteFile(filepath.Join(root, name), buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return sources.NewLocal(root), name
+}
+
+func buildTestIndex(t *testing.T, fsys sources.FS, name, format string) *archiveIndex {
+	t.Helper()
+	file, err := fsys.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := buildArchiveIndex(file, info.Size(), format)
+	if err != nil {
+		t.Fatalf("failed to index %v: %v", name, err)
+	}
+	return index
+}
+
+func readTestEntry(fsys sources.FS, name, format string, entry archiveEntry) (string, error) {
+	reader, err := openArchiveEntry(fsys, name, format, entry)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	return string(data), err
+}
+
+func TestArchiveEntries(t *testing.T) {
+	for _, tc := range []struct {
+		format string
+		method uint16
+	}{
+		{ArchiveTar, 0},
+		{ArchiveTarGz, 0},
+		{ArchiveTarXz, 0},
+		{ArchiveTarZst, 0},
+		{ArchiveZip, zip.Store},
+		{ArchiveZip, zip.Deflate},
+	} {
+		fsys, name := writeTestArchive(t, tc.format, tc.method)
+		index := buildTestIndex(t, fsys, name, tc.format)
+
+		var paths []string
+		for _, entry := range index.Entries {
+			paths = append(paths, entry.Path)
+		}
+		want := "docs/,docs/a.txt,docs/big.bin,docs/empty.txt,escape.txt,other/,other/sub/,other/sub/b.txt"
+		if got := strings.Join(paths, ","); got != want {
+			t.Errorf("%v %d: expected entries %v, got %v", tc.format, tc.method, want, got)
+			continue
+		}
+		for _, f := range testArchiveFiles {
+			path, _ := cleanEntryPath(f.name, strings.HasSuffix(f.name, "/"))
+			entry := index.Entries[indexOfEntry(index, path)]
+			if entry.IsDir {
+				continue
+			}
+			got, err := readTestEntry(fsys, name, tc.format, entry)
+			if err != nil || got != f.content {
+				t.Errorf("%v %d: expected content of %v to match, got %d bytes and %v", tc.format, tc.method, path, len(got), err)
+			}
+		}
+	}
+}
+
+func indexOfEntry(index *archiveIndex, path string) int {
+	for i, entry := range index.Entries {
+		if entry.Path == path {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestZipEntryChecks(t *testing.T) {
+	for _, method := range []uint16{zip.Store, zip.Deflate} {
+		fsys, name := writeTestArchive(t, ArchiveZip, method)
+		index := buildTestIndex(t, fsys, name, ArchiveZip)
+		entry := index.Entries[indexOfEntry(index, "docs/big.bin")]
+
+		corrupted := entry
+		corrupted.CRC32 ^= 1
+		if _, err := readTestEntry(fsys, name, ArchiveZip, corrupted); !errors.Is(err, zip.ErrChecksum) {
+			t.Errorf("method %d: expected a checksum error, got %v", method, err)
+		}
+
+		// the data is longer than the declared size
+		larger := entry
+		larger.Size--
+		got, err := readTestEntry(fsys, name, ArchiveZip, larger)
+		if !errors.Is(err, zip.ErrFormat) {
+			t.Errorf("method %d: expected an error for an entry larger than its size, got %v", method, err)
+		}
+		if int64(len(got)) > larger.Size {
+			t.Errorf("method %d: expected at most %d bytes to be passed on, got %d", method, larger.Size, len(got))
+		}
+	}
+}
+
+func TestArchiveIndexCache(t *testing.T) {
+	fsys, name := writeTestArchive(t, ArchiveZip, zip.Deflate)
+	index := buildTestIndex(t, fsys, name, ArchiveZip)
+	cachePath := filepath.Join(t.TempDir(), archiveIndexDir, "key.json")
+
+	writeArchiveIndex(cachePath, index)
+	cached := readArchiveIndex(cachePath)
+	if cached == nil {
+		t.Fatal("expected the index to be read from the cache")
+	}
+	want, _ := json.Marshal(index)
+	got, _ := json.Marshal(cached)
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected the cached index to match:\n%s\n%s", want, got)
+	}
+
+	// indexes of another version are built again
+	index.Version = archiveIndexVersion + 1
+	writeArchiveIndex(cachePath, index)
+	if readArchiveIndex(cachePath) != nil {
+		t.Error("expected an index of another version to be ignored")
+	}
+}
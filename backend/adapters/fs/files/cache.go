@@ -0,0 +1,61 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+)
+
+// sourceCachePath returns the cache file of a source in a folder of the
+// cache dir, empty without a cache dir.
+func sourceCachePath(dir, sourcePath string) string {
+	if settings.Config.Server.CacheDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(sourcePath))
+	return filepath.Join(settings.Config.Server.CacheDir, dir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// readCacheJSON decodes a json file of the cache dir into v.
+func readCacheJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeCacheJSON writes v as json to a file of the cache dir. The file is
+// replaced at once, so readers never see a partial file.
+func writeCacheJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), fileutils.PermDir); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fileutils.PermFile)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
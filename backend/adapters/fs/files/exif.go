@@ -0,0 +1,176 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+	"github.com/gtsteffaniak/go-cache/cache"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+const (
+	// tiff based raw files are read up to this size for their exif data
+	maxExifTiffRead = 32 << 20
+	// other formats, like heic, are searched for an exif block in this range
+	maxExifScan = 4 << 20
+)
+
+// exifCache holds the exif data of images by version, nil if an image has
+// none.
+var exifCache = cache.NewCache[*iteminfo.Exif](24*time.Hour, time.Hour)
+
+var exifExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".tif": true, ".tiff": true, ".heic": true, ".heif": true,
+	".dng": true, ".cr2": true, ".nef": true, ".nrw": true, ".arw": true, ".orf": true,
+	".rw2": true, ".raf": true, ".pef": true, ".srw": true,
+}
+
+// HasExif reports whether a file is an image that can carry exif data.
+func HasExif(name string) bool {
+	return exifExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// extractImageMetadata sets the exif metadata of an image item.
+func extractImageMetadata(idx *indexing.Index, item *iteminfo.ExtendedItemInfo, name, realPath string) error {
+	data, err := ImageExif(idx, name, realPath)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		item.Metadata = &iteminfo.MediaMetadata{Exif: data}
+	}
+	return nil
+}
+
+// ImageExif returns the exif data of an image, nil if it has none.
+func ImageExif(idx *indexing.Index, name, realPath string) (*iteminfo.Exif, error) {
+	file, err := openItem(idx, name, realPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	key := idx.Path + "\x00" + name + "\x00" + fileutils.VersionTag(info)
+	if data, ok := exifCache.Get(key); ok {
+		return data, nil
+	}
+	data, err := readExif(file)
+	if err != nil {
+		return nil, err
+	}
+	exifCache.Set(key, data)
+	return data, nil
+}
+
+// readExif reads the exif data of a jpeg, tiff, tiff based raw or heic
+// image, nil if it has none.
+func readExif(r io.Reader) (*iteminfo.Exif, error) {
+	var header [4]byte
+	n, err := io.ReadFull(r, header[:])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	r = io.MultiReader(bytes.NewReader(header[:n]), r)
+	var x *exif.Exif
+	switch {
+	case bytes.HasPrefix(header[:n], []byte{0xff, 0xd8}):
+		x, err = exif.Decode(r)
+	case string(header[:n]) == "II*\x00" || string(header[:n]) == "MM\x00*":
+		x, err = exif.Decode(io.LimitReader(r, maxExifTiffRead))
+	default:
+		// heic and other containers embed a raw exif block
+		data, readErr := io.ReadAll(io.LimitReader(r, maxExifScan))
+		if readErr != nil {
+			return nil, readErr
+		}
+		i := bytes.Index(data, []byte("Exif\x00\x00"))
+		if i < 0 {
+			return nil, nil
+		}
+		x, err = exif.Decode(bytes.NewReader(data[i:]))
+	}
+	if err != nil {
+		if exif.IsCriticalError(err) {
+			// images without exif data end up here too
+			return nil, nil
+		}
+		if x == nil {
+			return nil, err
+		}
+	}
+	return exifValues(x), nil
+}
+
+// exifValues picks the fields of interest, missing or malformed ones are
+// left empty.
+func exifValues(x *exif.Exif) *iteminfo.Exif {
+	data := &iteminfo.Exif{
+		Make:  exifString(x, exif.Make),
+		Model: exifString(x, exif.Model),
+		Lens:  exifString(x, exif.LensModel),
+	}
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && num > 0 && den > 0 {
+			if num < den {
+				data.ExposureTime = fmt.Sprintf("1/%d", (den+num/2)/num)
+			} else {
+				data.ExposureTime = fmt.Sprintf("%g", float64(num)/float64(den))
+			}
+		}
+	}
+	data.FNumber = exifFloat(x, exif.FNumber)
+	data.FocalLength = exifFloat(x, exif.FocalLength)
+	if tag, err := x.Get(exif.ISOSpeedRatings); err == nil {
+		if iso, err := tag.Int(0); err == nil {
+			data.ISO = iso
+		}
+	}
+	if tag, err := x.Get(exif.Orientation); err == nil {
+		if orientation, err := tag.Int(0); err == nil && orientation >= 1 && orientation <= 8 {
+			data.Orientation = orientation
+		}
+	}
+	if takenAt, err := x.DateTime(); err == nil && !takenAt.IsZero() {
+		data.TakenAt = &takenAt
+	}
+	if lat, long, err := x.LatLong(); err == nil && (lat != 0 || long != 0) {
+		data.Latitude = &lat
+		data.Longitude = &long
+	}
+	return data
+}
+
+func exifString(x *exif.Exif, name exif.FieldName) string {
+	tag, err := x.Get(name)
+	if err != nil || tag.Format() != tiff.StringVal {
+		return ""
+	}
+	value, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(value, "\x00"))
+}
+
+func exifFloat(x *exif.Exif, name exif.FieldName) float64 {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0
+	}
+	num, den, err := tag.Rat2(0)
+	if err != nil || den == 0 {
+		return 0
+	}
+	return float64(num) / float64(den)
+}
@@ -0,0 +1,167 @@
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// exifField is a tag of a test exif block.
+type exifField struct {
+	tag   uint16
+	value any // string, uint16, a [2]uint32 rational or a [][2]uint32 of rationals
+}
+
+// testExif returns a little endian tiff block with the camera fields, an exif
+// sub ifd and a gps ifd.
+func testExif() []byte {
+	ifd0 := []exifField{
+		{0x010f, "Canon"},
+		{0x0110, "EOS R5"},
+		{0x0112, uint16(6)},
+	}
+	exifIfd := []exifField{
+		{0x829a, [2]uint32{1, 250}},
+		{0x829d, [2]uint32{28, 10}},
+		{0x8827, uint16(400)},
+		{0x9003, "2024:05:06 07:08:09"},
+		{0x920a, [2]uint32{50, 1}},
+		{0xa434, "RF50mm F1.8 STM"},
+	}
+	gpsIfd := []exifField{
+		{0x0001, "N"},
+		{0x0002, [][2]uint32{{52, 1}, {30, 1}, {0, 1}}},
+		{0x0003, "E"},
+		{0x0004, [][2]uint32{{13, 1}, {24, 1}, {36, 1}}},
+	}
+	buf := []byte("II*\x00\x08\x00\x00\x00")
+	// the pointers to the sub ifds are filled in once their offsets are known
+	ifd0 = append(ifd0, exifField{0x8769, uint32(0)}, exifField{0x8825, uint32(0)})
+	ifd0At := len(buf)
+	buf = writeTestIfd(buf, ifd0)
+	exifAt := len(buf)
+	buf = writeTestIfd(buf, exifIfd)
+	gpsAt := len(buf)
+	buf = writeTestIfd(buf, gpsIfd)
+	// the pointers are the last two entries of ifd0
+	pointers := ifd0At + 2 + 12*(len(ifd0)-2) + 8
+	binary.LittleEndian.PutUint32(buf[pointers:], uint32(exifAt))
+	binary.LittleEndian.PutUint32(buf[pointers+12:], uint32(gpsAt))
+	return buf
+}
+
+// writeTestIfd appends an ifd with its values after it.
+func writeTestIfd(buf []byte, fields []exifField) []byte {
+	le := binary.LittleEndian
+	start := len(buf)
+	dataAt := start + 2 + 12*len(fields) + 4
+	var data []byte
+	buf = le.AppendUint16(buf, uint16(len(fields)))
+	for _, f := range fields {
+		buf = le.AppendUint16(buf, f.tag)
+		var typ uint16
+		var count uint32
+		var value []byte
+		switch v := f.value.(type) {
+		case string:
+			typ, count, value = 2, uint32(len(v)+1), append([]byte(v), 0)
+		case uint16:
+			typ, count, value = 3, 1, le.AppendUint16(nil, v)
+		case uint32:
+			typ, count, value = 4, 1, le.AppendUint32(nil, v)
+		case [2]uint32:
+			typ, count, value = 5, 1, le.AppendUint32(le.AppendUint32(nil, v[0]), v[1])
+		case [][2]uint32:
+			typ, count = 5, uint32(len(v))
+			for _, r := range v {
+				value = le.AppendUint32(le.AppendUint32(value, r[0]), r[1])
+			}
+		}
+		buf = le.AppendUint16(buf, typ)
+		buf = le.AppendUint32(buf, count)
+		if len(value) <= 4 {
+			buf = append(buf, append(value, make([]byte, 4-len(value))...)...)
+			continue
+		}
+		buf = le.AppendUint32(buf, uint32(dataAt+len(data)))
+		data = append(data, value...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	buf = le.AppendUint32(buf, 0) // no next ifd
+	return append(buf, data...)
+}
+
+// testJpeg wraps an exif block in an APP1 segment of a jpeg.
+func testJpeg(tiff []byte) []byte {
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	buf := []byte{0xff, 0xd8, 0xff, 0xe1}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(app1)+2))
+	buf = append(buf, app1...)
+	return append(buf, 0xff, 0xd9)
+}
+
+// testHeic embeds an exif block in heic like boxes.
+func testHeic(tiff []byte) []byte {
+	buf := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+	buf = append(buf, "\x00\x00\x00\x10meta\x00\x00\x00\x00iinf"...)
+	return append(append(buf, "\x00\x00\x00\x06Exif\x00\x00"...), tiff...)
+}
+
+func TestReadExif(t *testing.T) {
+	tiff := testExif()
+	for name, data := range map[string][]byte{
+		"jpeg": testJpeg(tiff),
+		"tiff": tiff,
+		"heic": testHeic(tiff),
+	} {
+		x, err := readExif(bytes.NewReader(data))
+		if err != nil || x == nil {
+			t.Errorf("%v: expected exif data, got %v %v", name, x, err)
+			continue
+		}
+		if x.Make != "Canon" || x.Model != "EOS R5" || x.Lens != "RF50mm F1.8 STM" {
+			t.Errorf("%v: unexpected camera %q %q %q", name, x.Make, x.Model, x.Lens)
+		}
+		if x.ExposureTime != "1/250" || x.FNumber != 2.8 || x.FocalLength != 50 || x.ISO != 400 || x.Orientation != 6 {
+			t.Errorf("%v: unexpected exposure %+v", name, x)
+		}
+		if want := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local); x.TakenAt == nil || !x.TakenAt.Equal(want) {
+			t.Errorf("%v: expected to be taken at %v, got %v", name, want, x.TakenAt)
+		}
+		if x.Latitude == nil || x.Longitude == nil || *x.Latitude != 52.5 || *x.Longitude < 13.40999 || *x.Longitude > 13.41001 {
+			t.Errorf("%v: unexpected position %v %v", name, x.Latitude, x.Longitude)
+		}
+	}
+}
+
+func TestReadExifWithoutData(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":     nil,
+		"jpeg":      {0xff, 0xd8, 0xff, 0xd9},
+		"heic":      []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"),
+		"truncated": testExif()[:20],
+	} {
+		if x, err := readExif(bytes.NewReader(data)); x != nil {
+			t.Errorf("%v: expected no exif data, got %+v %v", name, x, err)
+		}
+	}
+}
+
+func TestExifValuesSkipsMalformedFields(t *testing.T) {
+	tiff := writeTestIfd([]byte("II*\x00\x08\x00\x00\x00"), []exifField{
+		{0x010f, uint16(1)},       // make as a number
+		{0x0112, uint16(9)},       // no valid orientation
+		{0x829a, [2]uint32{1, 0}}, // exposure divided by zero
+		{0x829d, [2]uint32{0, 0}}, // f-number without a denominator
+	})
+	x, err := readExif(bytes.NewReader(tiff))
+	if err != nil || x == nil {
+		t.Fatalf("expected exif data, got %v %v", x, err)
+	}
+	if x.Make != "" || x.Orientation != 0 || x.ExposureTime != "" || x.FNumber != 0 || x.TakenAt != nil || x.Latitude != nil {
+		t.Errorf("expected malformed fields to be left empty, got %+v", x)
+	}
+}
@@ -15,7 +15,7 @@ import (
 	"path/filepath"
 	"strings"
 
-	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
 	"github.com/SlepoyShaman/FileStorage/common/settings"
 	"github.com/SlepoyShaman/FileStorage/common/utils"
 	"github.com/SlepoyShaman/FileStorage/database/access"
@@ -91,8 +91,11 @@ func FileInfoFaster(opts utils.FileOptions, access *access.Storage) (*iteminfo.E
 			fileItem := &response.Files[i]
 			isItemAudio := strings.HasPrefix(fileItem.Type, "audio")
 			isItemVideo := strings.HasPrefix(fileItem.Type, "video")
+			// reading the exif of every photo in a listing is too slow
+			// for remote sources, single files still report it
+			isItemImage := HasExif(fileItem.Name) && index.FS.IsLocal()
 
-			if isItemAudio || isItemVideo {
+			if isItemAudio || isItemVideo || isItemImage {
 				itemRealPath, _, err := index.GetRealPath(opts.Path, fileItem.Name)
 				if err != nil {
 					slog.Debug("failed to get real path for file: "+fileItem.Name, err)
@@ -100,13 +103,20 @@ func FileInfoFaster(opts utils.FileOptions, access *access.Storage) (*iteminfo.E
 				}
 
 				if isItemAudio {
-					err := extractAudioMetadata(ctx, fileItem, itemRealPath, opts.AlbumArt || opts.Content, opts.Metadata)
+					err := extractAudioMetadata(ctx, index, fileItem, opts.Path+fileItem.Name, itemRealPath, opts.AlbumArt || opts.Content, opts.Metadata)
 					if err != nil {
 						slog.Debug("failed to extract metadata for file: "+fileItem.Name, err)
 					} else {
 						metadataCount++
 					}
-				} else if isItemVideo {
+				} else if isItemImage {
+					err := extractImageMetadata(index, fileItem, opts.Path+fileItem.Name, itemRealPath)
+					if err != nil {
+						slog.Debug("failed to extract image metadata for file: "+fileItem.Name, err)
+					} else {
+						metadataCount++
+					}
+				} else if isItemVideo && index.FS.IsLocal() {
 					err := extractVideoMetadata(ctx, fileItem, itemRealPath)
 					if err != nil {
 						slog.Debug("failed to extract video metadata for file: "+fileItem.Name, err)
@@ -142,14 +152,12 @@ func WriteDirectory(opts utils.FileOptions) error {
 	if idx == nil {
 		return fmt.Errorf("could not get index: %v ", opts.Source)
 	}
-	realPath, _, _ := idx.GetRealPath(opts.Path)
-
 	var stat os.FileInfo
 	var err error
 	// Check if the destination exists and is a file
-	if stat, err = os.Stat(realPath); err == nil && !stat.IsDir() {
+	if stat, err = idx.FS.Stat(opts.Path); err == nil && !stat.IsDir() {
 		// If it's a file and we're trying to create a directory, remove the file first
-		err = os.Remove(realPath)
+		err = idx.FS.RemoveAll(opts.Path)
 		if err != nil {
 			return fmt.Errorf("could not remove existing file to create directory: %v", err)
 		}
@@ -157,7 +165,7 @@ func WriteDirectory(opts utils.FileOptions) error {
 
 	// Ensure the parent directories exist
 	// Permissions are set by MkdirAll (subject to umask, which is usually acceptable)
-	err = os.MkdirAll(realPath, fileutils.PermDir)
+	err = idx.FS.MkdirAll(opts.Path)
 	if err != nil {
 		return err
 	}
@@ -189,61 +197,45 @@ func RefreshIndex(source string, path string, isDir bool, recursive bool) error
 	// For directories, check if the path exists on disk
 	// If it doesn't exist, remove it from the index
 	if isDir {
-		realPath, _, err := idx.GetRealPath(path)
-		if err == nil {
-			// Check if the directory exists on disk
-			if !Exists(realPath) {
-				// Directory no longer exists, remove it from the index
-				// This clears both Directories and DirectoriesLedger maps
-				idx.DeleteMetadata(path, true, false)
-				return nil
-			}
+		if _, err := idx.FS.Stat(path); os.IsNotExist(err) {
+			// Directory no longer exists, remove it from the index
+			// This clears both Directories and DirectoriesLedger maps
+			idx.DeleteMetadata(path, true, false)
+			idx.UpdateFullText(path, true, true)
+			return nil
 		}
 	}
 
 	err := idx.RefreshFileInfo(utils.FileOptions{Path: path, IsDir: isDir, Recursive: recursive})
-	return err
-}
-
-func WriteFile(source, path string, in io.Reader) error {
-	// Strip trailing slash from realPath if it's meant to be a file
-	realPath := strings.TrimRight(path, "/")
-	// Ensure the parent directories exist
-	parentDir := filepath.Dir(realPath)
-	err := os.MkdirAll(parentDir, fileutils.PermDir)
 	if err != nil {
 		return err
 	}
-	var stat os.FileInfo
-	// Check if the destination exists and is a directory
-	if stat, err = os.Stat(realPath); err == nil && stat.IsDir() {
-		// If it's a directory and we're trying to create a file, remove the directory first
-		err = os.RemoveAll(realPath)
-		if err != nil {
-			return fmt.Errorf("could not remove existing directory to create file: %v", err)
-		}
-	}
+	idx.UpdateFullText(path, isDir, recursive)
+	return nil
+}
 
-	// Open the file for writing (create if it doesn't exist, truncate if it does)
-	file, err := os.OpenFile(realPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileutils.PermFile)
-	if err != nil {
-		return err
+// WriteFile creates or replaces the file at path, relative to the root of
+// source, with the contents of in.
+func WriteFile(source, path string, in io.Reader) error {
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return fmt.Errorf("could not get index: %v ", source)
 	}
-	defer file.Close()
+	// Strip trailing slash if it's meant to be a file
+	return idx.FS.WriteFile(strings.TrimRight(path, "/"), in)
+}
 
-	// Copy the contents from the reader to the file
-	_, err = io.Copy(file, in)
-	if err != nil {
-		return err
+// openItem opens a file to read its content. Remote and encrypted sources
+// are read through the source filesystem, their real paths can't be opened.
+func openItem(idx *indexing.Index, name, realPath string) (sources.File, error) {
+	if idx.FS.IsLocal() {
+		return os.Open(realPath)
 	}
-
-	// Explicitly set file permissions to bypass umask
-	err = os.Chmod(realPath, fileutils.PermFile)
-	return err
+	return idx.FS.Open(name)
 }
 
 // getContent reads and returns the file content if it's considered an editable text file.
-func getContent(realPath string) (string, error) {
+func getContent(idx *indexing.Index, name, realPath string) (string, error) {
 	const headerSize = 4096
 	// Thresholds for detecting binary-like content (these can be tuned)
 	const maxNullBytesInHeaderAbs = 10    // Max absolute null bytes in header
@@ -252,7 +244,7 @@ func getContent(realPath string) (string, error) {
 	const maxNonPrintableRuneRatio = 0.05 // Max 5% non-printable runes in the entire file
 
 	// Open file
-	f, err := os.Open(realPath)
+	f, err := openItem(idx, name, realPath)
 	if err != nil {
 		return "", err
 	}
@@ -311,7 +303,10 @@ func getContent(realPath string) (string, error) {
 	// --- End of new heuristic checks for header ---
 
 	// Now read the full file (original logic)
-	content, err := os.ReadFile(realPath)
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	content, err := io.ReadAll(f)
 	if err != nil {
 		return "", err
 	}
@@ -387,8 +382,8 @@ func Exists(path string) bool {
 
 // extractAudioMetadata extracts metadata from an audio file using dhowden/tag
 // and optionally extracts duration using the ffmpeg service with concurrency control
-func extractAudioMetadata(ctx context.Context, item *iteminfo.ExtendedItemInfo, realPath string, getArt bool, getDuration bool) error {
-	file, err := os.Open(realPath)
+func extractAudioMetadata(ctx context.Context, idx *indexing.Index, item *iteminfo.ExtendedItemInfo, name, realPath string, getArt bool, getDuration bool) error {
+	file, err := openItem(idx, name, realPath)
 	if err != nil {
 		return err
 	}
@@ -425,7 +420,8 @@ func extractAudioMetadata(ctx context.Context, item *iteminfo.ExtendedItemInfo,
 
 	// Extract duration ONLY if explicitly requested using the ffmpeg VideoService
 	// This respects concurrency limits and gracefully handles missing ffmpeg
-	if getDuration {
+	// ffmpeg reads the real path, which only exists for local sources
+	if getDuration && idx.FS.IsLocal() {
 		ffmpegService := ffmpeg.NewFFmpegService(5, false, "")
 		if ffmpegService != nil {
 			startTime := time.Now()
@@ -465,6 +461,10 @@ func processContent(info *iteminfo.ExtendedFileInfo, idx *indexing.Index, opts u
 	}
 
 	if isVideo {
+		if !idx.FS.IsLocal() {
+			// ffmpeg can't read files of remote and encrypted sources
+			return
+		}
 		// Extract duration for video
 		extItem := &iteminfo.ExtendedItemInfo{
 			ItemInfo: info.ItemInfo,
@@ -491,12 +491,25 @@ func processContent(info *iteminfo.ExtendedFileInfo, idx *indexing.Index, opts u
 		return
 	}
 
+	if opts.Metadata && HasExif(info.Name) {
+		extItem := &iteminfo.ExtendedItemInfo{
+			ItemInfo: info.ItemInfo,
+		}
+		err := extractImageMetadata(idx, extItem, opts.Path, info.RealPath)
+		if err != nil {
+			slog.Debug("failed to extract image metadata for file: "+info.RealPath, info.Name, err)
+		} else {
+			info.Metadata = extItem.Metadata
+		}
+		return
+	}
+
 	if isAudio {
 		// Create an ExtendedItemInfo to hold the metadata
 		extItem := &iteminfo.ExtendedItemInfo{
 			ItemInfo: info.ItemInfo,
 		}
-		err := extractAudioMetadata(context.Background(), extItem, info.RealPath, opts.AlbumArt || opts.Content, opts.Metadata || opts.Content)
+		err := extractAudioMetadata(context.Background(), idx, extItem, opts.Path, info.RealPath, opts.AlbumArt || opts.Content, opts.Metadata || opts.Content)
 		if err != nil {
 			slog.Debug("failed to extract audio metadata for file: "+info.RealPath, info.Name, err)
 		} else {
@@ -509,7 +522,7 @@ func processContent(info *iteminfo.ExtendedFileInfo, idx *indexing.Index, opts u
 
 	// Process text content for non-video, non-audio files
 	if info.Size < 20*1024*1024 { // 20 megabytes in bytes
-		content, err := getContent(info.RealPath)
+		content, err := getContent(idx, opts.Path, info.RealPath)
 		if err != nil {
 			slog.Debug("could not get content for file: "+info.RealPath, info.Name, err)
 			return
@@ -0,0 +1,380 @@
+package files
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/dhowden/tag"
+)
+
+// The music library holds the tags of the audio files of a source. It
+// follows the file index: each request reads the tags of the files that
+// were added or changed since the last one and drops the removed ones, the
+// rest is served from the library kept in the cache dir by source.
+
+const (
+	libraryDir        = "library"
+	libraryVersion    = 1
+	maxLibraryTagRead = 300 << 20
+)
+
+var (
+	librariesMu sync.Mutex
+	libraries   = map[string]*musicLibrary{}
+)
+
+// Track is an audio file of the music library.
+type Track struct {
+	Path        string    `json:"path"`
+	Name        string    `json:"name"`
+	Title       string    `json:"title,omitempty"`
+	Artist      string    `json:"artist,omitempty"`
+	AlbumArtist string    `json:"albumArtist,omitempty"`
+	Album       string    `json:"album,omitempty"`
+	Genre       string    `json:"genre,omitempty"`
+	Year        int       `json:"year,omitempty"`
+	Track       int       `json:"track,omitempty"`
+	Disc        int       `json:"disc,omitempty"`
+	HasArt      bool      `json:"hasArt"` // whether the file has embedded album art
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"modified"`
+}
+
+// LibraryArtist is an artist of the music library.
+type LibraryArtist struct {
+	Name   string `json:"name"` // empty for tracks without an artist
+	Albums int    `json:"albums"`
+	Tracks int    `json:"tracks"`
+}
+
+// LibraryAlbum is an album of the music library.
+type LibraryAlbum struct {
+	Name   string   `json:"name"` // empty for tracks without an album
+	Artist string   `json:"artist"`
+	Year   int      `json:"year,omitempty"`
+	Genres []string `json:"genres,omitempty"`
+	Tracks int      `json:"tracks"`
+	Art    string   `json:"art,omitempty"` // path of a track with album art
+}
+
+// LibraryGenre is a genre of the music library.
+type LibraryGenre struct {
+	Name   string `json:"name"`
+	Tracks int    `json:"tracks"`
+}
+
+// LibraryQuery selects tracks of the music library. Nil filters match all
+// tracks, an empty one matches the tracks without that tag.
+type LibraryQuery struct {
+	Scope   string // index path to list below
+	Artist  *string
+	Album   *string
+	Genre   *string
+	Allowed func(path string) bool // files for which it returns false are left out
+}
+
+type musicLibrary struct {
+	mu      sync.Mutex
+	path    string           // cache file, empty without a cache dir
+	Version int              `json:"version"`
+	Tracks  map[string]Track `json:"tracks"`
+}
+
+// ArtistName returns the artist a track is listed under, the album artist
+// if it has one so compilations stay together.
+func (t Track) ArtistName() string {
+	if t.AlbumArtist != "" {
+		return t.AlbumArtist
+	}
+	return t.Artist
+}
+
+func (q LibraryQuery) matches(t Track) bool {
+	if q.Artist != nil && t.ArtistName() != *q.Artist {
+		return false
+	}
+	if q.Album != nil && t.Album != *q.Album {
+		return false
+	}
+	if q.Genre != nil && t.Genre != *q.Genre {
+		return false
+	}
+	return q.Allowed == nil || q.Allowed(t.Path)
+}
+
+// LibraryTracks returns the tracks matching the query, sorted by artist,
+// album, disc and track number.
+func LibraryTracks(idx *indexing.Index, query LibraryQuery) []Track {
+	tracks := []Track{}
+	for _, t := range syncLibrary(idx, query.Scope) {
+		if query.matches(t) {
+			tracks = append(tracks, t)
+		}
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		a, b := tracks[i], tracks[j]
+		if a.ArtistName() != b.ArtistName() {
+			return lessFold(a.ArtistName(), b.ArtistName())
+		}
+		if a.Album != b.Album {
+			return lessFold(a.Album, b.Album)
+		}
+		if a.Disc != b.Disc {
+			return a.Disc < b.Disc
+		}
+		if a.Track != b.Track {
+			return a.Track < b.Track
+		}
+		return a.Path < b.Path
+	})
+	return tracks
+}
+
+// LibraryArtists returns the artists of the tracks matching the query.
+func LibraryArtists(idx *indexing.Index, query LibraryQuery) []LibraryArtist {
+	byName := map[string]*LibraryArtist{}
+	albums := map[string]map[string]struct{}{}
+	for _, t := range LibraryTracks(idx, query) {
+		name := t.ArtistName()
+		artist, ok := byName[name]
+		if !ok {
+			artist = &LibraryArtist{Name: name}
+			byName[name] = artist
+			albums[name] = map[string]struct{}{}
+		}
+		artist.Tracks++
+		albums[name][t.Album] = struct{}{}
+	}
+	artists := make([]LibraryArtist, 0, len(byName))
+	for name, artist := range byName {
+		artist.Albums = len(albums[name])
+		artists = append(artists, *artist)
+	}
+	sort.Slice(artists, func(i, j int) bool { return lessFold(artists[i].Name, artists[j].Name) })
+	return artists
+}
+
+// LibraryAlbums returns the albums of the tracks matching the query.
+func LibraryAlbums(idx *indexing.Index, query LibraryQuery) []LibraryAlbum {
+	type albumKey struct{ artist, name string }
+	byKey := map[albumKey]*LibraryAlbum{}
+	var albums []*LibraryAlbum
+	for _, t := range LibraryTracks(idx, query) {
+		key := albumKey{t.ArtistName(), t.Album}
+		album, ok := byKey[key]
+		if !ok {
+			album = &LibraryAlbum{Name: t.Album, Artist: key.artist}
+			byKey[key] = album
+			albums = append(albums, album)
+		}
+		album.Tracks++
+		album.Year = max(album.Year, t.Year)
+		if t.Genre != "" && !containsString(album.Genres, t.Genre) {
+			album.Genres = append(album.Genres, t.Genre)
+		}
+		if album.Art == "" && t.HasArt {
+			album.Art = t.Path
+		}
+	}
+	// tracks are sorted by artist and album already
+	result := make([]LibraryAlbum, len(albums))
+	for i, album := range albums {
+		result[i] = *album
+	}
+	return result
+}
+
+// LibraryGenres returns the genres of the tracks matching the query.
+func LibraryGenres(idx *indexing.Index, query LibraryQuery) []LibraryGenre {
+	byName := map[string]int{}
+	for _, t := range LibraryTracks(idx, query) {
+		byName[t.Genre]++
+	}
+	genres := make([]LibraryGenre, 0, len(byName))
+	for name, count := range byName {
+		genres = append(genres, LibraryGenre{Name: name, Tracks: count})
+	}
+	sort.Slice(genres, func(i, j int) bool { return lessFold(genres[i].Name, genres[j].Name) })
+	return genres
+}
+
+// AlbumArt returns the embedded album art of an audio file. The mimetype in
+// the tags is not trusted, callers detect it from the data.
+func AlbumArt(idx *indexing.Index, path string) ([]byte, error) {
+	realPath, _, err := idx.GetRealPath(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := openItem(idx, path, realPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	m, err := tag.ReadFrom(file)
+	if err == tag.ErrNoTagsFound {
+		return nil, errors.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	picture := m.Picture()
+	if picture == nil || len(picture.Data) == 0 {
+		return nil, errors.ErrNotExist
+	}
+	return picture.Data, nil
+}
+
+// syncLibrary brings the library of a source in line with the index below
+// scope and returns the tracks there. Tags are read without holding the
+// library, so other requests aren't blocked while a collection is read.
+func syncLibrary(idx *indexing.Index, scope string) []Track {
+	library := loadLibrary(idx)
+	files := idx.AudioFiles(scope)
+	indexed := make(map[string]struct{}, len(files))
+	var missing []indexing.MediaFile
+
+	library.mu.Lock()
+	for _, file := range files {
+		indexed[file.Path] = struct{}{}
+		cached, ok := library.Tracks[file.Path]
+		if !ok || !cached.ModTime.Equal(file.ModTime) || cached.Size != file.Size {
+			missing = append(missing, file)
+		}
+	}
+	changed := false
+	scope = idx.MakeIndexPath(scope)
+	for path := range library.Tracks {
+		if _, ok := indexed[path]; !ok && strings.HasPrefix(path, scope) {
+			delete(library.Tracks, path)
+			changed = true
+		}
+	}
+	library.mu.Unlock()
+
+	read := make(map[string]Track, len(missing))
+	if len(missing) > 0 {
+		startTime := time.Now()
+		tracks := make([]Track, len(missing))
+		readConcurrently(len(missing), func(n int) {
+			tracks[n] = readTrack(idx, missing[n])
+		})
+		for _, t := range tracks {
+			read[t.Path] = t
+		}
+		slog.Debug("read tags", "source", idx.Name, "files", len(missing), "elapsed", time.Since(startTime))
+	}
+
+	library.mu.Lock()
+	defer library.mu.Unlock()
+	for path, t := range read {
+		// a request that started later may have read a newer version
+		if cached, ok := library.Tracks[path]; !ok || !cached.ModTime.After(t.ModTime) {
+			library.Tracks[path] = t
+			changed = true
+		}
+	}
+	if changed {
+		library.save()
+	}
+
+	tracks := make([]Track, 0, len(files))
+	for _, file := range files {
+		if t, ok := read[file.Path]; ok {
+			tracks = append(tracks, t)
+		} else {
+			tracks = append(tracks, library.Tracks[file.Path])
+		}
+	}
+	return tracks
+}
+
+// readTrack reads the tags of an audio file, files that can't be read are
+// kept with their name only so they aren't read again until they change.
+func readTrack(idx *indexing.Index, file indexing.MediaFile) Track {
+	t := Track{Path: file.Path, Name: file.Name, Size: file.Size, ModTime: file.ModTime}
+	if file.Size > maxLibraryTagRead {
+		return t
+	}
+	err := func() error {
+		realPath, _, err := idx.GetRealPath(file.Path)
+		if err != nil {
+			return err
+		}
+		f, err := openItem(idx, file.Path, realPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		m, err := tag.ReadFrom(f)
+		if err != nil {
+			return err
+		}
+		t.Title = tagString(m.Title())
+		t.Artist = tagString(m.Artist())
+		t.AlbumArtist = tagString(m.AlbumArtist())
+		t.Album = tagString(m.Album())
+		t.Genre = tagString(m.Genre())
+		t.Year = m.Year()
+		t.Track, _ = m.Track()
+		t.Disc, _ = m.Disc()
+		t.HasArt = m.Picture() != nil && len(m.Picture().Data) > 0
+		return nil
+	}()
+	if err != nil && err != tag.ErrNoTagsFound {
+		slog.Debug("could not read tags", "path", file.Path, "err", err)
+	}
+	return t
+}
+
+func tagString(value string) string {
+	return strings.TrimSpace(strings.Trim(value, "\x00"))
+}
+
+func lessFold(a, b string) bool {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	if la != lb {
+		return la < lb
+	}
+	return a < b
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// loadLibrary returns the music library of a source, read from the cache
+// dir the first time.
+func loadLibrary(idx *indexing.Index) *musicLibrary {
+	librariesMu.Lock()
+	defer librariesMu.Unlock()
+	if library, ok := libraries[idx.Path]; ok {
+		return library
+	}
+	library := &musicLibrary{path: sourceCachePath(libraryDir, idx.Path), Version: libraryVersion, Tracks: map[string]Track{}}
+	var stored musicLibrary
+	if library.path != "" && readCacheJSON(library.path, &stored) == nil && stored.Version == libraryVersion && stored.Tracks != nil {
+		library.Tracks = stored.Tracks
+	}
+	libraries[idx.Path] = library
+	return library
+}
+
+// save writes the library to the cache dir, l.mu must be held.
+func (l *musicLibrary) save() {
+	if l.path == "" {
+		return
+	}
+	if err := writeCacheJSON(l.path, l); err != nil {
+		slog.Debug("could not save music library", "path", l.path, "err", err)
+	}
+}
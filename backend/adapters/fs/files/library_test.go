@@ -0,0 +1,198 @@
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+)
+
+var testArt = []byte("\x89PNG\r\n\x1a\n fake picture")
+
+// testMp3 returns an mp3 with an id3v2.3 tag of the text frames and
+// optionally a picture.
+func testMp3(frames map[string]string, art []byte) []byte {
+	var body []byte
+	frame := func(id string, data []byte) {
+		body = append(body, id...)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(data)))
+		body = append(body, 0, 0)
+		body = append(body, data...)
+	}
+	for id, value := range frames {
+		frame(id, append([]byte{0}, value...))
+	}
+	if art != nil {
+		frame("APIC", append([]byte("\x00image/png\x00\x03\x00"), art...))
+	}
+	size := len(body)
+	header := []byte{'I', 'D', '3', 3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	// followed by some audio
+	return append(append(header, body...), bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x00}, 32)...)
+}
+
+// newLibraryTestIndex creates an index of a temp dir without files.
+func newLibraryTestIndex(t *testing.T) *indexing.Index {
+	t.Helper()
+	root := t.TempDir()
+	return &indexing.Index{
+		Source:      settings.Source{Name: "test", Path: root},
+		FS:          sources.NewLocal(root),
+		Directories: map[string]*iteminfo.FileInfo{},
+	}
+}
+
+// putTestTrack writes an audio file and adds or updates it in the index.
+func putTestTrack(t *testing.T, idx *indexing.Index, name string, data []byte, modTime time.Time) {
+	t.Helper()
+	realPath := filepath.Join(idx.Path, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(realPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(realPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dir := indexDirOf(name)
+	if idx.Directories[dir] == nil {
+		idx.Directories[dir] = &iteminfo.FileInfo{}
+	}
+	item := iteminfo.ExtendedItemInfo{ItemInfo: iteminfo.ItemInfo{Name: path.Base(name), Size: int64(len(data)), ModTime: modTime, Type: "audio/mpeg"}}
+	files := idx.Directories[dir].Files
+	for i := range files {
+		if files[i].Name == item.Name {
+			files[i] = item
+			return
+		}
+	}
+	idx.Directories[dir].Files = append(files, item)
+}
+
+func removeTestTrack(idx *indexing.Index, name string) {
+	dir := indexDirOf(name)
+	files := idx.Directories[dir].Files
+	for i := range files {
+		if files[i].Name == path.Base(name) {
+			idx.Directories[dir].Files = append(files[:i], files[i+1:]...)
+			return
+		}
+	}
+}
+
+// indexDirOf returns the index path of the folder of a file.
+func indexDirOf(name string) string {
+	dir := path.Dir(name)
+	if dir != "/" {
+		dir += "/"
+	}
+	return dir
+}
+
+func trackPaths(tracks []Track) string {
+	var paths []string
+	for _, t := range tracks {
+		paths = append(paths, t.Path)
+	}
+	return strings.Join(paths, " ")
+}
+
+func TestLibraryTracks(t *testing.T) {
+	settings.Config.Server.CacheDir = ""
+	idx := newLibraryTestIndex(t)
+	modTime := time.Unix(1700000000, 0)
+	putTestTrack(t, idx, "/music/b2.mp3", testMp3(map[string]string{"TIT2": "Second", "TPE1": "Band", "TALB": "Album", "TRCK": "2/9", "TCON": "Rock", "TYER": "2001"}, nil), modTime)
+	putTestTrack(t, idx, "/music/b1.mp3", testMp3(map[string]string{"TIT2": "First", "TPE1": "Band", "TALB": "Album", "TRCK": "1/9", "TCON": "Rock"}, testArt), modTime)
+	putTestTrack(t, idx, "/music/mix.mp3", testMp3(map[string]string{"TIT2": "Guest", "TPE1": "guest", "TPE2": "Various", "TALB": "Hits", "TCON": "Pop"}, nil), modTime)
+	putTestTrack(t, idx, "/music/untagged.mp3", []byte("no tags"), modTime)
+	putTestTrack(t, idx, "/other/x.mp3", testMp3(map[string]string{"TPE1": "Elsewhere"}, nil), modTime)
+
+	tracks := LibraryTracks(idx, LibraryQuery{Scope: "/music/"})
+	if got, want := trackPaths(tracks), "/music/untagged.mp3 /music/b1.mp3 /music/b2.mp3 /music/mix.mp3"; got != want {
+		t.Fatalf("expected tracks %v, got %v", want, got)
+	}
+	first := tracks[1]
+	if first.Title != "First" || first.Artist != "Band" || first.Album != "Album" || first.Track != 1 || first.Genre != "Rock" || !first.HasArt {
+		t.Errorf("unexpected tags %+v", first)
+	}
+	if tracks[2].Year != 2001 || tracks[2].HasArt {
+		t.Errorf("unexpected tags %+v", tracks[2])
+	}
+	if tracks[0].Name != "untagged.mp3" || tracks[0].Title != "" {
+		t.Errorf("expected a track without tags to be kept by name, got %+v", tracks[0])
+	}
+
+	artist, none := "Band", ""
+	if got := trackPaths(LibraryTracks(idx, LibraryQuery{Scope: "/", Artist: &artist})); got != "/music/b1.mp3 /music/b2.mp3" {
+		t.Errorf("expected the tracks of the artist, got %v", got)
+	}
+	if got := trackPaths(LibraryTracks(idx, LibraryQuery{Scope: "/", Album: &none})); got != "/music/untagged.mp3 /other/x.mp3" {
+		t.Errorf("expected the tracks without an album, got %v", got)
+	}
+	allowed := func(path string) bool { return path != "/music/b2.mp3" }
+	if got := trackPaths(LibraryTracks(idx, LibraryQuery{Scope: "/music/", Artist: &artist, Allowed: allowed})); got != "/music/b1.mp3" {
+		t.Errorf("expected denied tracks to be left out, got %v", got)
+	}
+
+	albums := LibraryAlbums(idx, LibraryQuery{Scope: "/music/"})
+	if len(albums) != 3 || albums[1].Name != "Album" || albums[1].Tracks != 2 || albums[1].Year != 2001 || albums[1].Art != "/music/b1.mp3" {
+		t.Errorf("unexpected albums %+v", albums)
+	}
+	// compilations are listed under the album artist
+	artists := LibraryArtists(idx, LibraryQuery{Scope: "/music/"})
+	if len(artists) != 3 || artists[2].Name != "Various" || artists[2].Tracks != 1 || artists[1].Albums != 1 {
+		t.Errorf("unexpected artists %+v", artists)
+	}
+	genres := LibraryGenres(idx, LibraryQuery{Scope: "/"})
+	if len(genres) != 3 || genres[0].Name != "" || genres[0].Tracks != 2 || genres[2].Name != "Rock" || genres[2].Tracks != 2 {
+		t.Errorf("unexpected genres %+v", genres)
+	}
+
+	art, err := AlbumArt(idx, "/music/b1.mp3")
+	if err != nil || !bytes.Equal(art, testArt) {
+		t.Errorf("expected the album art, got %q %v", art, err)
+	}
+	if _, err = AlbumArt(idx, "/music/b2.mp3"); err != errors.ErrNotExist {
+		t.Errorf("expected no album art, got %v", err)
+	}
+}
+
+func TestLibraryFollowsIndex(t *testing.T) {
+	settings.Config.Server.CacheDir = t.TempDir()
+	idx := newLibraryTestIndex(t)
+	modTime := time.Unix(1700000000, 0)
+	putTestTrack(t, idx, "/a.mp3", testMp3(map[string]string{"TIT2": "Old"}, nil), modTime)
+	putTestTrack(t, idx, "/b.mp3", testMp3(map[string]string{"TIT2": "Removed"}, nil), modTime)
+	LibraryTracks(idx, LibraryQuery{Scope: "/"})
+
+	putTestTrack(t, idx, "/a.mp3", testMp3(map[string]string{"TIT2": "New"}, nil), modTime.Add(time.Hour))
+	removeTestTrack(idx, "/b.mp3")
+	tracks := LibraryTracks(idx, LibraryQuery{Scope: "/"})
+	if len(tracks) != 1 || tracks[0].Title != "New" {
+		t.Fatalf("expected the changed track to be read again and the removed one dropped, got %+v", tracks)
+	}
+
+	// the library is kept in the cache dir, unchanged files aren't read again
+	librariesMu.Lock()
+	delete(libraries, idx.Path)
+	librariesMu.Unlock()
+	if err := os.WriteFile(filepath.Join(idx.Path, "a.mp3"), []byte("replaced without a new index entry"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tracks = LibraryTracks(idx, LibraryQuery{Scope: "/"})
+	if len(tracks) != 1 || tracks[0].Title != "New" {
+		t.Errorf("expected the track from the cached library, got %+v", tracks)
+	}
+	library := loadLibrary(idx)
+	if _, ok := library.Tracks["/b.mp3"]; ok {
+		t.Error("expected the removed track not to be cached")
+	}
+}
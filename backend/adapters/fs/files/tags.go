@@ -0,0 +1,50 @@
+package files
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/database/tags"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+)
+
+// Extended attributes tags and metadata are mirrored to, so other tools
+// on the host can read them.
+const (
+	tagsXattr     = "user.filestorage.tags"
+	metadataXattr = "user.filestorage.metadata"
+)
+
+// MirrorTags writes the tags and metadata of the item at path to its
+// extended attributes if the source enables it. A nil entry removes them.
+func MirrorTags(source, path string, entry *tags.Entry) error {
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return fmt.Errorf("could not get index: %v ", source)
+	}
+	if !idx.Config.TagXattrs || !idx.FS.IsLocal() {
+		return nil
+	}
+	realPath, _, err := idx.GetRealPath(path)
+	if err != nil {
+		return err
+	}
+	var tagList, metadata []byte
+	if entry != nil {
+		tagList = []byte(strings.Join(entry.Tags, ","))
+		if len(entry.Metadata) > 0 {
+			if metadata, err = json.Marshal(entry.Metadata); err != nil {
+				return err
+			}
+		}
+	}
+	if err = fileutils.SetXattr(realPath, tagsXattr, tagList); err != nil {
+		return fmt.Errorf("could not set tags of %v: %w", path, err)
+	}
+	if err = fileutils.SetXattr(realPath, metadataXattr, metadata); err != nil {
+		return fmt.Errorf("could not set metadata of %v: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package files
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+)
+
+// The timeline lists the images and videos of the index by capture date.
+// Capture dates are read from the exif data once per file version and kept
+// in the cache dir by source, files without one use their mod time. Only
+// new and changed files are read again, so later requests are served from
+// the index and the cached dates.
+
+const (
+	TimelineYear  = "year"
+	TimelineMonth = "month"
+	TimelineDay   = "day"
+)
+
+const (
+	captureDatesDir     = "timeline"
+	captureDatesVersion = 1
+	fileReadWorkers     = 8
+)
+
+var (
+	captureDatesMu sync.Mutex
+	captureDates   = map[string]*captureDateIndex{}
+)
+
+// TimelineItem is an image or video of the timeline.
+type TimelineItem struct {
+	Path     string    `json:"path"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"modified"`
+	TakenAt  time.Time `json:"takenAt"`
+	FromExif bool      `json:"fromExif"` // false if takenAt is the mod time
+}
+
+// TimelineGroup holds the items of a year, month or day.
+type TimelineGroup struct {
+	Date  string         `json:"date"`  // eg. "2024", "2024-05" or "2024-05-17"
+	Count int            `json:"count"` // items of the group in the whole range, not only this page
+	Items []TimelineItem `json:"items"`
+}
+
+// TimelinePage is a page of the timeline, newest first. A group can
+// continue on the next page.
+type TimelinePage struct {
+	Groups []TimelineGroup `json:"groups"`
+	Total  int             `json:"total"`          // items in the whole range
+	Next   string          `json:"next,omitempty"` // cursor of the next page, empty on the last page
+}
+
+// TimelineQuery selects a page of the timeline.
+type TimelineQuery struct {
+	Scope   string    // index path to list below
+	GroupBy string    // TimelineYear, TimelineMonth or TimelineDay
+	From    time.Time // earliest capture date, zero for no limit
+	To      time.Time // capture dates before this, zero for no limit
+	Cursor  string    // Next of the previous page
+	Limit   int
+	Allowed func(path string) bool // files for which it returns false are left out
+}
+
+// captureDate is the capture date of a file version, TakenAt is nil if the
+// file has no exif date.
+type captureDate struct {
+	ModTime time.Time  `json:"modTime"`
+	Size    int64      `json:"size"`
+	TakenAt *time.Time `json:"takenAt,omitempty"`
+}
+
+type captureDateIndex struct {
+	mu      sync.Mutex
+	path    string                 // cache file, empty without a cache dir
+	Version int                    `json:"version"`
+	Dates   map[string]captureDate `json:"dates"`
+}
+
+// groupKey returns the group of a capture date.
+func groupKey(t time.Time, groupBy string) string {
+	switch groupBy {
+	case TimelineYear:
+		return t.Format("2006")
+	case TimelineMonth:
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+// Timeline returns a page of the images and videos of an index, grouped by
+// capture date.
+func Timeline(idx *indexing.Index, query TimelineQuery) (TimelinePage, error) {
+	afterTime, afterPath, err := parseTimelineCursor(query.Cursor)
+	if err != nil {
+		return TimelinePage{}, err
+	}
+	media := idx.MediaFiles(query.Scope)
+	indexed := make(map[string]struct{}, len(media))
+	items := make([]TimelineItem, 0, len(media))
+	for _, file := range media {
+		indexed[file.Path] = struct{}{}
+		if query.Allowed != nil && !query.Allowed(file.Path) {
+			continue
+		}
+		items = append(items, TimelineItem{
+			Path:    file.Path,
+			Name:    file.Name,
+			Type:    file.Type,
+			Size:    file.Size,
+			ModTime: file.ModTime,
+		})
+	}
+	resolveCaptureDates(idx, query.Scope, items, indexed)
+
+	// keep the range, newest first
+	inRange := items[:0]
+	for _, item := range items {
+		if !query.From.IsZero() && item.TakenAt.Before(query.From) {
+			continue
+		}
+		if !query.To.IsZero() && !item.TakenAt.Before(query.To) {
+			continue
+		}
+		inRange = append(inRange, item)
+	}
+	items = inRange
+	sort.Slice(items, func(i, j int) bool {
+		if !items[i].TakenAt.Equal(items[j].TakenAt) {
+			return items[i].TakenAt.After(items[j].TakenAt)
+		}
+		return items[i].Path < items[j].Path
+	})
+
+	counts := map[string]int{}
+	for _, item := range items {
+		counts[groupKey(item.TakenAt, query.GroupBy)]++
+	}
+	start := 0
+	if query.Cursor != "" {
+		start = sort.Search(len(items), func(i int) bool {
+			if !items[i].TakenAt.Equal(afterTime) {
+				return items[i].TakenAt.Before(afterTime)
+			}
+			return items[i].Path > afterPath
+		})
+	}
+	end := min(start+query.Limit, len(items))
+
+	page := TimelinePage{Groups: []TimelineGroup{}, Total: len(items)}
+	for _, item := range items[start:end] {
+		key := groupKey(item.TakenAt, query.GroupBy)
+		if n := len(page.Groups); n == 0 || page.Groups[n-1].Date != key {
+			page.Groups = append(page.Groups, TimelineGroup{Date: key, Count: counts[key]})
+		}
+		group := &page.Groups[len(page.Groups)-1]
+		group.Items = append(group.Items, item)
+	}
+	if end < len(items) {
+		last := items[end-1]
+		page.Next = timelineCursor(last.TakenAt, last.Path)
+	}
+	return page, nil
+}
+
+// timelineCursor points after an item, so pages stay stable while files are
+// added or removed.
+func timelineCursor(takenAt time.Time, path string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(takenAt.UnixNano(), 10) + ":" + path))
+}
+
+func parseTimelineCursor(cursor string) (time.Time, string, error) {
+	if cursor == "" {
+		return time.Time{}, "", nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errors.ErrInvalidCursor
+	}
+	nanos, path, ok := strings.Cut(string(data), ":")
+	if !ok {
+		return time.Time{}, "", errors.ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, "", errors.ErrInvalidCursor
+	}
+	return time.Unix(0, n), path, nil
+}
+
+// resolveCaptureDates sets the capture dates of the items, reading the exif
+// data of the files not yet cached. Cached files below scope that are no
+// longer indexed are dropped.
+func resolveCaptureDates(idx *indexing.Index, scope string, items []TimelineItem, indexed map[string]struct{}) {
+	dates := loadCaptureDates(idx)
+	var missing []int
+
+	dates.mu.Lock()
+	for i := range items {
+		item := &items[i]
+		cached, ok := dates.Dates[item.Path]
+		if ok && cached.ModTime.Equal(item.ModTime) && cached.Size == item.Size {
+			setCaptureDate(item, cached)
+			continue
+		}
+		if !HasExif(item.Name) {
+			setCaptureDate(item, captureDate{})
+			continue
+		}
+		missing = append(missing, i)
+	}
+	changed := false
+	scope = idx.MakeIndexPath(scope)
+	for path := range dates.Dates {
+		if _, ok := indexed[path]; !ok && strings.HasPrefix(path, scope) {
+			delete(dates.Dates, path)
+			changed = true
+		}
+	}
+	dates.mu.Unlock()
+
+	read := make([]captureDate, len(missing))
+	if len(missing) > 0 {
+		startTime := time.Now()
+		readConcurrently(len(missing), func(n int) {
+			item := items[missing[n]]
+			read[n] = captureDate{ModTime: item.ModTime, Size: item.Size}
+			realPath, _, err := idx.GetRealPath(item.Path)
+			if err == nil {
+				var data *iteminfo.Exif
+				data, err = ImageExif(idx, item.Path, realPath)
+				if data != nil && data.TakenAt != nil {
+					read[n].TakenAt = data.TakenAt
+				}
+			}
+			if err != nil {
+				slog.Debug("could not read exif", "path", item.Path, "err", err)
+			}
+		})
+		for n, i := range missing {
+			setCaptureDate(&items[i], read[n])
+		}
+		slog.Debug("read capture dates", "source", idx.Name, "files", len(missing), "elapsed", time.Since(startTime))
+	}
+
+	dates.mu.Lock()
+	defer dates.mu.Unlock()
+	for n, i := range missing {
+		// a request that started later may have read a newer version
+		path := items[i].Path
+		if cached, ok := dates.Dates[path]; !ok || !cached.ModTime.After(read[n].ModTime) {
+			dates.Dates[path] = read[n]
+			changed = true
+		}
+	}
+	if changed {
+		dates.save()
+	}
+}
+
+// readConcurrently calls read for 0 to count-1 on a few workers.
+func readConcurrently(count int, read func(n int)) {
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(fileReadWorkers, count); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range work {
+				read(n)
+			}
+		}()
+	}
+	for n := 0; n < count; n++ {
+		work <- n
+	}
+	close(work)
+	wg.Wait()
+}
+
+func setCaptureDate(item *TimelineItem, date captureDate) {
+	if date.TakenAt != nil {
+		item.TakenAt = *date.TakenAt
+		item.FromExif = true
+		return
+	}
+	item.TakenAt = item.ModTime
+	item.FromExif = false
+}
+
+// loadCaptureDates returns the capture dates of a source, read from the
+// cache dir the first time.
+func loadCaptureDates(idx *indexing.Index) *captureDateIndex {
+	captureDatesMu.Lock()
+	defer captureDatesMu.Unlock()
+	if dates, ok := captureDates[idx.Path]; ok {
+		return dates
+	}
+	dates := &captureDateIndex{path: sourceCachePath(captureDatesDir, idx.Path), Version: captureDatesVersion, Dates: map[string]captureDate{}}
+	var stored captureDateIndex
+	if dates.path != "" && readCacheJSON(dates.path, &stored) == nil && stored.Version == captureDatesVersion && stored.Dates != nil {
+		dates.Dates = stored.Dates
+	}
+	captureDates[idx.Path] = dates
+	return dates
+}
+
+// save writes the capture dates to the cache dir, d.mu must be held.
+func (d *captureDateIndex) save() {
+	if d.path == "" {
+		return
+	}
+	if err := writeCacheJSON(d.path, d); err != nil {
+		slog.Debug("could not save capture dates", "path", d.path, "err", err)
+	}
+}
@@ -0,0 +1,171 @@
+package files
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+)
+
+// newTimelineTestIndex creates an index of a temp dir with files by their
+// index path and mod time. Only files with exif data are written to disk.
+func newTimelineTestIndex(t *testing.T, media map[string]time.Time) *indexing.Index {
+	t.Helper()
+	settings.Config.Server.CacheDir = ""
+	root := t.TempDir()
+	idx := &indexing.Index{
+		Source:      settings.Source{Name: "test", Path: root},
+		FS:          sources.NewLocal(root),
+		Directories: map[string]*iteminfo.FileInfo{},
+	}
+	for name, modTime := range media {
+		dir := indexDirOf(name)
+		if idx.Directories[dir] == nil {
+			idx.Directories[dir] = &iteminfo.FileInfo{}
+		}
+		item := iteminfo.ExtendedItemInfo{ItemInfo: iteminfo.ItemInfo{Name: path.Base(name), ModTime: modTime, Type: "image/png"}}
+		if HasExif(name) {
+			data := testJpeg(testExif())
+			realPath := filepath.Join(root, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(realPath), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(realPath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			item.Type = "image/jpeg"
+			item.Size = int64(len(data))
+		}
+		idx.Directories[dir].Files = append(idx.Directories[dir].Files, item)
+	}
+	return idx
+}
+
+func day(date string) time.Time {
+	t, err := time.ParseInLocation(time.DateOnly, date, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t.Add(12 * time.Hour)
+}
+
+// timelinePaths returns the paths of a page by group, like
+// "2024-05: /a.png /b.png".
+func timelinePaths(page TimelinePage) []string {
+	var groups []string
+	for _, group := range page.Groups {
+		var paths []string
+		for _, item := range group.Items {
+			paths = append(paths, item.Path)
+		}
+		groups = append(groups, group.Date+": "+strings.Join(paths, " "))
+	}
+	return groups
+}
+
+func TestTimelineGroups(t *testing.T) {
+	idx := newTimelineTestIndex(t, map[string]time.Time{
+		"/a.png":            day("2024-05-01"),
+		"/b.png":            day("2024-05-20"),
+		"/trip/c.png":       day("2024-06-02"),
+		"/trip/d.png":       day("2023-12-31"),
+		"/camera/photo.jpg": day("2025-01-01"), // taken 2024-05-06 by its exif
+	})
+
+	for _, tc := range []struct {
+		groupBy string
+		want    string
+	}{
+		{TimelineYear, "2024: /trip/c.png /b.png /camera/photo.jpg /a.png|2023: /trip/d.png"},
+		{TimelineMonth, "2024-06: /trip/c.png|2024-05: /b.png /camera/photo.jpg /a.png|2023-12: /trip/d.png"},
+		{TimelineDay, "2024-06-02: /trip/c.png|2024-05-20: /b.png|2024-05-06: /camera/photo.jpg|2024-05-01: /a.png|2023-12-31: /trip/d.png"},
+	} {
+		page, err := Timeline(idx, TimelineQuery{Scope: "/", GroupBy: tc.groupBy, Limit: 10})
+		if err != nil {
+			t.Fatalf("failed to get timeline: %v", err)
+		}
+		if got := strings.Join(timelinePaths(page), "|"); got != tc.want {
+			t.Errorf("%v: expected %v, got %v", tc.groupBy, tc.want, got)
+		}
+		if page.Total != 5 || page.Next != "" {
+			t.Errorf("%v: expected a single page of 5 items, got %d and %q", tc.groupBy, page.Total, page.Next)
+		}
+	}
+
+	page, _ := Timeline(idx, TimelineQuery{Scope: "/camera/", GroupBy: TimelineDay, Limit: 10})
+	if len(page.Groups) != 1 || !page.Groups[0].Items[0].FromExif {
+		t.Errorf("expected the exif date of the photo to be used, got %+v", page.Groups)
+	}
+}
+
+func TestTimelinePages(t *testing.T) {
+	media := map[string]time.Time{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		// files taken at the same time are ordered by path
+		media["/same/"+name+".png"] = day("2024-05-01")
+	}
+	media["/new.png"] = day("2024-06-01")
+	media["/old.png"] = day("2024-04-01")
+	idx := newTimelineTestIndex(t, media)
+
+	var pages []string
+	cursor := ""
+	for i := 0; i < 10; i++ {
+		page, err := Timeline(idx, TimelineQuery{Scope: "/", GroupBy: TimelineMonth, Cursor: cursor, Limit: 3})
+		if err != nil {
+			t.Fatalf("failed to get page %d: %v", i, err)
+		}
+		for _, group := range page.Groups {
+			if group.Date == "2024-05" && group.Count != 5 {
+				t.Errorf("expected the count of the whole group on every page, got %d", group.Count)
+			}
+		}
+		pages = append(pages, strings.Join(timelinePaths(page), "|"))
+		if cursor = page.Next; cursor == "" {
+			break
+		}
+	}
+	want := []string{
+		"2024-06: /new.png|2024-05: /same/a.png /same/b.png",
+		"2024-05: /same/c.png /same/d.png /same/e.png",
+		"2024-04: /old.png",
+	}
+	if strings.Join(pages, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected pages\n%v\ngot\n%v", strings.Join(want, "\n"), strings.Join(pages, "\n"))
+	}
+
+	if _, err := Timeline(idx, TimelineQuery{Scope: "/", Cursor: "not a cursor", Limit: 3}); err != errors.ErrInvalidCursor {
+		t.Errorf("expected an invalid cursor error, got %v", err)
+	}
+}
+
+func TestTimelineRangeAndAccess(t *testing.T) {
+	idx := newTimelineTestIndex(t, map[string]time.Time{
+		"/a.png":         day("2024-05-01"),
+		"/b.png":         day("2024-05-31"),
+		"/c.png":         day("2024-06-01"),
+		"/private/d.png": day("2024-05-15"),
+	})
+	allowed := func(path string) bool { return !strings.HasPrefix(path, "/private/") }
+
+	page, err := Timeline(idx, TimelineQuery{Scope: "/", GroupBy: TimelineDay, From: day("2024-05-01").Add(-12 * time.Hour), To: day("2024-06-01").Add(-12 * time.Hour), Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(timelinePaths(page), "|"); got != "2024-05-31: /b.png|2024-05-15: /private/d.png|2024-05-01: /a.png" {
+		t.Errorf("expected the items of May, got %v", got)
+	}
+
+	page, _ = Timeline(idx, TimelineQuery{Scope: "/", GroupBy: TimelineMonth, Limit: 10, Allowed: allowed})
+	if got := strings.Join(timelinePaths(page), "|"); got != "2024-06: /c.png|2024-05: /b.png /a.png" || page.Total != 3 {
+		t.Errorf("expected denied items to be left out, got %v of %d", got, page.Total)
+	}
+}
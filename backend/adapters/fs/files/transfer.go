@@ -0,0 +1,220 @@
+package files
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
+	"github.com/SlepoyShaman/FileStorage/database/access"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+)
+
+// The functions below change files without refreshing the index, callers
+// refresh the affected directories with RefreshIndex when they are done.
+
+// CopyItem copies a file or folder with its contents. Source and
+// destination may be on different sources, an existing file at the
+// destination is replaced.
+func CopyItem(fromSource, from, toSource, to string) error {
+	src, dst, err := transferIndexes(fromSource, toSource)
+	if err != nil {
+		return err
+	}
+	return copyTree(src.FS, dst.FS, strings.TrimSuffix(from, "/"), strings.TrimSuffix(to, "/"))
+}
+
+// MoveItem moves a file or folder. Within a source it is renamed, between
+// sources it is copied and then removed.
+func MoveItem(fromSource, from, toSource, to string) error {
+	src, dst, err := transferIndexes(fromSource, toSource)
+	if err != nil {
+		return err
+	}
+	from = strings.TrimSuffix(from, "/")
+	to = strings.TrimSuffix(to, "/")
+	if src == dst {
+		return src.FS.Rename(from, to)
+	}
+	if err = copyTree(src.FS, dst.FS, from, to); err != nil {
+		return err
+	}
+	return src.FS.RemoveAll(from)
+}
+
+// ReplaceItem copies or moves an item over an existing one. The item is
+// transferred to a temporary sibling of the destination first and then
+// takes its place, the existing item is only removed after that, so it is
+// kept if the transfer fails.
+func ReplaceItem(fromSource, from, toSource, to string, move bool) error {
+	src, dst, err := transferIndexes(fromSource, toSource)
+	if err != nil {
+		return err
+	}
+	from = strings.TrimSuffix(from, "/")
+	rename := move && src == dst
+	if err = replaceTree(src.FS, dst.FS, from, strings.TrimSuffix(to, "/"), rename); err != nil || !move || rename {
+		return err
+	}
+	return src.FS.RemoveAll(from)
+}
+
+// replaceTree replaces to with a copy of from, or with from itself if
+// rename is set. Items moved between sources are copied, the caller
+// removes them once they were replaced.
+func replaceTree(src, dst sources.FS, from, to string, rename bool) error {
+	tmp, err := tempSibling(to, "new")
+	if err != nil {
+		return err
+	}
+	old, err := tempSibling(to, "old")
+	if err != nil {
+		return err
+	}
+	// undo puts the transferred item back, the destination is unchanged
+	undo := func() {
+		var undoErr error
+		if rename {
+			undoErr = src.Rename(tmp, from)
+		} else {
+			undoErr = dst.RemoveAll(tmp)
+		}
+		if undoErr != nil {
+			slog.Error("could not undo replacing "+to, "err", undoErr)
+		}
+	}
+	if rename {
+		err = src.Rename(from, tmp)
+	} else {
+		err = copyTree(src, dst, from, tmp)
+	}
+	if err != nil {
+		if !rename {
+			dst.RemoveAll(tmp) //nolint:errcheck
+		}
+		return err
+	}
+	if err = dst.Rename(to, old); err != nil {
+		undo()
+		return err
+	}
+	if err = dst.Rename(tmp, to); err != nil {
+		if restoreErr := dst.Rename(old, to); restoreErr != nil {
+			slog.Error("could not restore "+to, "err", restoreErr)
+		}
+		undo()
+		return err
+	}
+	if err = dst.RemoveAll(old); err != nil {
+		// the item was replaced, only the old one is left behind
+		slog.Error("could not remove replaced item "+old, "err", err)
+	}
+	return nil
+}
+
+// tempSibling returns a hidden, unused name next to name.
+func tempSibling(name, kind string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return path.Join(path.Dir(name), "."+path.Base(name)+"."+kind+"-"+hex.EncodeToString(suffix)), nil
+}
+
+// CheckTreeAccess returns an error if username is denied an item inside the
+// folder at path. Copying, moving or deleting a folder affects all of
+// them, not just the folder.
+func CheckTreeAccess(source, path, username string, access *access.Storage) error {
+	if access == nil {
+		return nil
+	}
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return fmt.Errorf("could not get index: %v ", source)
+	}
+	path = strings.TrimSuffix(path, "/")
+	if info, err := idx.FS.Stat(path); err != nil || !info.IsDir() {
+		// files are checked by the caller, missing items have nothing to check
+		return nil
+	}
+	return checkTreeAccess(idx.FS, path, func(name string) bool {
+		return access.Permitted(idx.Path, name, username)
+	})
+}
+
+func checkTreeAccess(fsys sources.FS, name string, permitted func(name string) bool) error {
+	entries, err := fsys.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		child := path.Join(name, entry.Name())
+		if !entry.IsDir() {
+			if !permitted(child) {
+				return fmt.Errorf("access denied to path %s", child)
+			}
+			continue
+		}
+		if !permitted(child + "/") {
+			return fmt.Errorf("access denied to path %s", child)
+		}
+		if err = checkTreeAccess(fsys, child, permitted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteItem removes a file or a folder with its contents.
+func DeleteItem(source, path string) error {
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return fmt.Errorf("could not get index: %v ", source)
+	}
+	return idx.FS.RemoveAll(strings.TrimSuffix(path, "/"))
+}
+
+func transferIndexes(fromSource, toSource string) (*indexing.Index, *indexing.Index, error) {
+	src := indexing.GetIndex(fromSource)
+	if src == nil {
+		return nil, nil, fmt.Errorf("could not get index: %v ", fromSource)
+	}
+	dst := indexing.GetIndex(toSource)
+	if dst == nil {
+		return nil, nil, fmt.Errorf("could not get index: %v ", toSource)
+	}
+	return src, dst, nil
+}
+
+// copyTree copies a file or folder through the source filesystems, so it
+// works for remote and encrypted sources alike.
+func copyTree(src, dst sources.FS, from, to string) error {
+	info, err := src.Stat(from)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		file, err := src.Open(from)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		return dst.WriteFile(to, file)
+	}
+	if err = dst.MkdirAll(to); err != nil {
+		return err
+	}
+	entries, err := src.ReadDir(from)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err = copyTree(src, dst, path.Join(from, entry.Name()), path.Join(to, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
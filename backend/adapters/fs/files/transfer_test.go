@@ -0,0 +1,133 @@
+package files
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
+)
+
+// failingFS fails to write files with the given name.
+type failingFS struct {
+	sources.FS
+	failName string
+}
+
+func (f failingFS) WriteFile(name string, in io.Reader) error {
+	if filepath.Base(name) == f.failName {
+		return fmt.Errorf("disk full")
+	}
+	return f.FS.WriteFile(name, in)
+}
+
+// writeTree creates the files of a tree, names ending with a slash are
+// created as folders.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTree returns the files of a tree by their slash separated path.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		tree[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestReplaceTreeCopiesOverExisting(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"src/a.txt": "new a", "src/sub/b.txt": "new b", "dst/old.txt": "old"})
+	fsys := sources.NewLocal(root)
+	if err := replaceTree(fsys, fsys, "/src", "/dst", false); err != nil {
+		t.Fatalf("failed to replace: %v", err)
+	}
+	want := map[string]string{"src/a.txt": "new a", "src/sub/b.txt": "new b", "dst/a.txt": "new a", "dst/sub/b.txt": "new b"}
+	if got := readTree(t, root); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestReplaceTreeRenamesOverExisting(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"a.txt": "new", "dir/b.txt": "old"})
+	fsys := sources.NewLocal(root)
+	// a folder is replaced by a file
+	if err := replaceTree(fsys, fsys, "/a.txt", "/dir", true); err != nil {
+		t.Fatalf("failed to replace: %v", err)
+	}
+	want := map[string]string{"dir": "new"}
+	if got := readTree(t, root); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestReplaceTreeKeepsExistingOnFailure(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"src/a.txt": "new a", "src/b.txt": "new b", "dst/old.txt": "old"})
+	local := sources.NewLocal(root)
+	dst := failingFS{FS: local, failName: "b.txt"}
+	if err := replaceTree(local, dst, "/src", "/dst", false); err == nil {
+		t.Fatal("expected the failed copy to be reported")
+	}
+	want := map[string]string{"src/a.txt": "new a", "src/b.txt": "new b", "dst/old.txt": "old"}
+	if got := readTree(t, root); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected the destination to be kept and the partial copy removed, got %v", got)
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 2 {
+		t.Errorf("expected no temporary items to be left, got %v", entries)
+	}
+}
+
+func TestCheckTreeAccess(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"docs/a.txt": "a", "docs/private/b.txt": "b", "docs/empty/": ""})
+	fsys := sources.NewLocal(root)
+	denied := map[string]bool{}
+	permitted := func(name string) bool { return !denied[name] }
+
+	if err := checkTreeAccess(fsys, "/docs", permitted); err != nil {
+		t.Errorf("expected all items to be permitted, got %v", err)
+	}
+	denied["/docs/private/"] = true
+	if err := checkTreeAccess(fsys, "/docs", permitted); err == nil || !strings.Contains(err.Error(), "/docs/private") {
+		t.Errorf("expected a denied folder to be reported, got %v", err)
+	}
+	denied = map[string]bool{"/docs/private/b.txt": true}
+	if err := checkTreeAccess(fsys, "/docs", permitted); err == nil || !strings.Contains(err.Error(), "/docs/private/b.txt") {
+		t.Errorf("expected a denied file in a subfolder to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/common/utils"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+)
+
+// The content of text files handed out for editing is kept in the cache dir
+// by version, so a save based on an outdated version can be merged with the
+// current file instead of overwriting it.
+
+const (
+	mergeBaseTTL  = 24 * time.Hour
+	maxMergeSize  = 4 << 20
+	mergeBasesDir = "merge"
+)
+
+var (
+	mergeCleanupMu   sync.Mutex
+	lastMergeCleanup time.Time
+)
+
+// FileVersion returns the version tag of a file, see fileutils.VersionTag.
+func FileVersion(source, path string) (string, os.FileInfo, error) {
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return "", nil, fmt.Errorf("could not get index: %v ", source)
+	}
+	info, err := idx.FS.Stat(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return fileutils.VersionTag(info), info, nil
+}
+
+func mergeBasePath(idx *indexing.Index, path, version string) string {
+	sum := sha256.Sum256([]byte(idx.Path + "\x00" + path + "\x00" + version))
+	return filepath.Join(settings.Config.Server.CacheDir, mergeBasesDir, hex.EncodeToString(sum[:]))
+}
+
+// SaveMergeBase keeps the content of a version of a text file, so it can
+// be used by MergeFile.
+func SaveMergeBase(source, path, version, content string) {
+	idx := indexing.GetIndex(source)
+	if idx == nil || settings.Config.Server.CacheDir == "" || len(content) > maxMergeSize {
+		return
+	}
+	basePath := mergeBasePath(idx, path, version)
+	if err := os.MkdirAll(filepath.Dir(basePath), fileutils.PermDir); err != nil {
+		slog.Debug("could not create merge base dir", "path", path, "err", err)
+		return
+	}
+	if err := os.WriteFile(basePath, []byte(content), fileutils.PermFile); err != nil {
+		slog.Debug("could not save merge base", "path", path, "err", err)
+		return
+	}
+	go cleanupMergeBases(filepath.Dir(basePath))
+}
+
+// cleanupMergeBases removes expired merge bases, at most once an hour.
+func cleanupMergeBases(dir string) {
+	mergeCleanupMu.Lock()
+	defer mergeCleanupMu.Unlock()
+	if time.Since(lastMergeCleanup) < time.Hour {
+		return
+	}
+	lastMergeCleanup = time.Now()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && time.Since(info.ModTime()) > mergeBaseTTL {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// MergeFile merges ours, an edit of the version baseVersion of a text file,
+// with the current content of the file. ok is false if the base version is
+// no longer known, the file isn't text or the changes conflict.
+func MergeFile(source, path, baseVersion string, ours []byte) (merged []byte, ok bool, err error) {
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return nil, false, fmt.Errorf("could not get index: %v ", source)
+	}
+	if settings.Config.Server.CacheDir == "" || len(ours) > maxMergeSize || !utf8.Valid(ours) {
+		return nil, false, nil
+	}
+	base, err := os.ReadFile(mergeBasePath(idx, path, baseVersion))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	file, err := idx.FS.Open(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	defer file.Close()
+	theirs, err := io.ReadAll(io.LimitReader(file, maxMergeSize+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if len(theirs) > maxMergeSize || !utf8.Valid(theirs) {
+		return nil, false, nil
+	}
+	text, ok := utils.MergeText(string(base), string(ours), string(theirs))
+	if !ok {
+		return nil, false, nil
+	}
+	return []byte(text), true, nil
+}
@@ -0,0 +1,18 @@
+package fileutils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// VersionTag returns a strong ETag for the current version of a file. Files
+// of sources that keep a version of their own, like the ETag of S3 objects,
+// use it. Otherwise it is derived from the mod time, size and, where
+// available, inode, saving the file changes at least one of them.
+func VersionTag(info os.FileInfo) string {
+	if versioned, ok := info.(interface{ ETag() string }); ok && versioned.ETag() != "" {
+		return `"` + strings.Trim(versioned.ETag(), `"`) + `"`
+	}
+	return fmt.Sprintf(`"%x-%x-%x"`, info.ModTime().UnixNano(), info.Size(), inode(info))
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package fileutils
+
+import (
+	"os"
+	"syscall"
+)
+
+func inode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino) //nolint:unconvert // the type of Ino differs per platform
+	}
+	return 0
+}
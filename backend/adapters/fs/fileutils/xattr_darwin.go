@@ -0,0 +1,6 @@
+package fileutils
+
+import "golang.org/x/sys/unix"
+
+// errNoAttr is returned for attributes that are not set.
+const errNoAttr = unix.ENOATTR
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package fileutils
+
+import "errors"
+
+var errXattrUnsupported = errors.New("extended attributes are not supported on this platform")
+
+// SetXattr sets an extended attribute of the file at path, an empty value
+// removes the attribute.
+func SetXattr(path, name string, value []byte) error {
+	return errXattrUnsupported
+}
+
+// GetXattr returns an extended attribute of the file at path, nil if it is
+// not set.
+func GetXattr(path, name string) ([]byte, error) {
+	return nil, errXattrUnsupported
+}
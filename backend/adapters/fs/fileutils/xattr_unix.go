@@ -0,0 +1,40 @@
+//go:build linux || darwin
+
+package fileutils
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetXattr sets an extended attribute of the file at path, an empty value
+// removes the attribute.
+func SetXattr(path, name string, value []byte) error {
+	if len(value) == 0 {
+		err := unix.Removexattr(path, name)
+		if errors.Is(err, errNoAttr) {
+			return nil
+		}
+		return err
+	}
+	return unix.Setxattr(path, name, value, 0)
+}
+
+// GetXattr returns an extended attribute of the file at path, nil if it is
+// not set.
+func GetXattr(path, name string) ([]byte, error) {
+	size, err := unix.Getxattr(path, name, nil)
+	if errors.Is(err, errNoAttr) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	size, err = unix.Getxattr(path, name, value)
+	if err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
@@ -0,0 +1,186 @@
+package sources
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+)
+
+const testSecret = "bXkgdGVzdCBrZXkgb2YgdGhpcnR5IHR3byBieXRlcyE=" // base64 of a 32 byte key
+
+func newTestEncrypted(t *testing.T, base FS, config settings.EncryptionConfig) *Encrypted {
+	t.Helper()
+	fsys, err := NewEncrypted(base, config)
+	if err != nil {
+		t.Fatalf("failed to create encrypted source: %v", err)
+	}
+	return fsys
+}
+
+// diskContents returns all files below root by their path on disk.
+func diskContents(t *testing.T, root string) map[string][]byte {
+	t.Helper()
+	files := map[string][]byte{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		files[strings.TrimPrefix(path, root)] = data
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestEncryptedAtRest(t *testing.T) {
+	root := t.TempDir()
+	fsys := newTestEncrypted(t, NewLocal(root), settings.EncryptionConfig{Secret: testSecret, EncryptNames: true})
+	if err := fsys.WriteFile("/secret plans/notes.txt", strings.NewReader("attack at dawn")); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	for name, data := range diskContents(t, root) {
+		if strings.Contains(name, "plans") || strings.Contains(name, "notes") {
+			t.Errorf("expected encrypted names on disk, got %v", name)
+		}
+		if bytes.Contains(data, []byte("dawn")) {
+			t.Errorf("expected ciphertext on disk, got %q", data)
+		}
+	}
+
+	// a passphrase derives another key, which can't read the files
+	other := newTestEncrypted(t, NewLocal(root), settings.EncryptionConfig{Secret: "passphrase", EncryptNames: true})
+	if entries, err := other.ReadDir("/"); err != nil || len(entries) != 0 {
+		t.Errorf("expected names of another key to be hidden, got %v (%v)", names(entries), err)
+	}
+}
+
+func TestEncryptedChunks(t *testing.T) {
+	root := t.TempDir()
+	fsys := newTestEncrypted(t, NewLocal(root), settings.EncryptionConfig{Secret: testSecret})
+	data := make([]byte, 3*encryptedChunkSize+100)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, encryptedChunkSize, len(data)} {
+		if err := fsys.WriteFile("/data.bin", bytes.NewReader(data[:size])); err != nil {
+			t.Fatalf("failed to write %d bytes: %v", size, err)
+		}
+		info, err := fsys.Stat("/data.bin")
+		if err != nil || info.Size() != int64(size) {
+			t.Fatalf("expected size %d, got %+v (%v)", size, info, err)
+		}
+		r, err := fsys.ReadRange("/data.bin", 0, 0)
+		if got := readAll(t, r, err); got != string(data[:size]) {
+			t.Errorf("content of %d byte file does not match", size)
+		}
+	}
+
+	// ranges across chunk boundaries only decrypt the chunks they cover
+	offset := int64(encryptedChunkSize - 10)
+	r, err := fsys.ReadRange("/data.bin", offset, encryptedChunkSize+20)
+	if got := readAll(t, r, err); got != string(data[offset:offset+encryptedChunkSize+20]) {
+		t.Error("ranged read across chunks returned wrong bytes")
+	}
+
+	// any change of the ciphertext fails authentication
+	ciphertext, err := os.ReadFile(filepath.Join(root, "data.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext[encryptedHeaderSize+encryptedChunkSize+encryptedOverhead+5] ^= 1
+	if err = os.WriteFile(filepath.Join(root, "data.bin"), ciphertext, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err = fsys.ReadRange("/data.bin", encryptedChunkSize, 10)
+	if err == nil {
+		_, err = r.Read(make([]byte, 10))
+		r.Close()
+	}
+	if err == nil {
+		t.Error("expected tampered chunk to fail authentication")
+	}
+	// dropping the last chunk is detected as well
+	truncated := ciphertext[:len(ciphertext)-100-encryptedOverhead]
+	if err = os.WriteFile(filepath.Join(root, "data.bin"), truncated, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err = fsys.ReadRange("/data.bin", 2*encryptedChunkSize, 10)
+	if err == nil {
+		_, err = r.Read(make([]byte, 10))
+		r.Close()
+	}
+	if err == nil {
+		t.Error("expected truncated file to fail authentication")
+	}
+	// files cut to their header would read as empty
+	for _, size := range []int{encryptedHeaderSize, encryptedHeaderSize + 5, encryptedHeaderSize + encryptedOverhead, encryptedHeaderSize + encryptedChunkSize + encryptedOverhead + 5} {
+		if err = os.WriteFile(filepath.Join(root, "data.bin"), ciphertext[:size], 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if r, err = fsys.ReadRange("/data.bin", 0, 0); err == nil {
+			r.Close()
+			t.Errorf("expected a file cut to %d bytes to be rejected", size)
+		}
+	}
+}
+
+func TestEncryptedRotate(t *testing.T) {
+	const newSecret = "a new passphrase"
+	for _, encryptNames := range []bool{false, true} {
+		root := t.TempDir()
+		old := newTestEncrypted(t, NewLocal(root), settings.EncryptionConfig{Secret: testSecret, EncryptNames: encryptNames})
+		for _, name := range []string{"/a.txt", "/docs/b.txt", "/docs/deep/c.txt"} {
+			if err := old.WriteFile(name, strings.NewReader("content of "+name)); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+		}
+
+		rotating := newTestEncrypted(t, NewLocal(root), settings.EncryptionConfig{
+			Secret:          newSecret,
+			PreviousSecrets: []string{testSecret},
+			EncryptNames:    encryptNames,
+		})
+		// files stay readable before they are rotated, new files use the new key
+		r, err := rotating.ReadRange("/docs/b.txt", 0, 0)
+		if got := readAll(t, r, err); got != "content of /docs/b.txt" {
+			t.Errorf("expected file of the previous key to be readable, got %q", got)
+		}
+		if err = rotating.WriteFile("/docs/new.txt", strings.NewReader("new")); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+
+		var rotated []string
+		report, err := rotating.Rotate(func(name string) { rotated = append(rotated, name) })
+		if err != nil {
+			t.Fatalf("rotation failed: %v", err)
+		}
+		if report.Files != 3 || len(report.Skipped) != 0 {
+			t.Errorf("unexpected rotation report %+v, rotated %v", report, rotated)
+		}
+		if encryptNames && report.Renamed != 5 {
+			t.Errorf("expected 5 renamed items, got %d", report.Renamed)
+		}
+		if report, err = rotating.Rotate(nil); err != nil || report.Files != 0 || report.Renamed != 0 {
+			t.Errorf("expected a second rotation to change nothing, got %+v (%v)", report, err)
+		}
+
+		current := newTestEncrypted(t, NewLocal(root), settings.EncryptionConfig{Secret: newSecret, EncryptNames: encryptNames})
+		for _, name := range []string{"/a.txt", "/docs/b.txt", "/docs/deep/c.txt"} {
+			r, err := current.ReadRange(name, 0, 0)
+			if got := readAll(t, r, err); got != "content of "+name {
+				t.Errorf("expected rotated file %v to be readable with the new key, got %q", name, got)
+			}
+		}
+		if entries, err := current.ReadDir("/docs"); err != nil || strings.Join(names(entries), ",") != "b.txt,deep/,new.txt" {
+			t.Errorf("unexpected listing after rotation %v (%v)", names(entries), err)
+		}
+	}
+}
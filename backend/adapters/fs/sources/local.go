@@ -0,0 +1,108 @@
+package sources
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/SlepoyShaman/FileStorage/backend/adapters/fs/fileutils"
+)
+
+// Local is a source stored in a directory on the local disk.
+type Local struct {
+	root string
+}
+
+// NewLocal creates a Local filesystem rooted at root.
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+// RealPath returns the path of name on the local disk.
+func (l *Local) RealPath(name string) string {
+	return filepath.Join(l.root, filepath.FromSlash(clean(name)))
+}
+
+func (l *Local) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(l.RealPath(name))
+}
+
+func (l *Local) ReadDir(name string) ([]os.FileInfo, error) {
+	dir, err := os.Open(l.RealPath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	// Readdir keeps the platform specific stat, used to detect hard links
+	return dir.Readdir(-1)
+}
+
+func (l *Local) Open(name string) (File, error) {
+	return os.Open(l.RealPath(name))
+}
+
+func (l *Local) ReadRange(name string, offset, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(l.RealPath(name))
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 {
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(file, offset, length), file}, nil
+}
+
+func (l *Local) WriteFile(name string, in io.Reader) error {
+	realPath := l.RealPath(name)
+	err := os.MkdirAll(filepath.Dir(realPath), fileutils.PermDir)
+	if err != nil {
+		return err
+	}
+	// a directory in the way of the file is replaced
+	if stat, err := os.Stat(realPath); err == nil && stat.IsDir() {
+		if err = os.RemoveAll(realPath); err != nil {
+			return fmt.Errorf("could not remove existing directory to create file: %v", err)
+		}
+	}
+	file, err := os.OpenFile(realPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fileutils.PermFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err = io.Copy(file, in); err != nil {
+		return err
+	}
+	// Explicitly set file permissions to bypass umask
+	return os.Chmod(realPath, fileutils.PermFile)
+}
+
+func (l *Local) MkdirAll(name string) error {
+	return os.MkdirAll(l.RealPath(name), fileutils.PermDir)
+}
+
+func (l *Local) RemoveAll(name string) error {
+	if clean(name) == "/" {
+		return fmt.Errorf("cannot remove the source root")
+	}
+	return os.RemoveAll(l.RealPath(name))
+}
+
+func (l *Local) Rename(oldName, newName string) error {
+	newPath := l.RealPath(newName)
+	if err := os.MkdirAll(filepath.Dir(newPath), fileutils.PermDir); err != nil {
+		return err
+	}
+	return os.Rename(l.RealPath(oldName), newPath)
+}
+
+func (l *Local) IsLocal() bool {
+	return true
+}
@@ -0,0 +1,321 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+)
+
+const (
+	defaultS3Endpoint = "s3.amazonaws.com"
+	defaultPartSizeMB = 16
+	minPartSizeMB     = 5 // smallest part size accepted by S3
+)
+
+// S3 is a source stored in an S3 compatible bucket. Objects are files and
+// key prefixes ending in a slash are directories. Empty directories are kept
+// as zero sized marker objects named like the prefix. Directories have no
+// modification time, so changes in them are picked up by full scans.
+type S3 struct {
+	client   *minio.Client
+	bucket   string
+	prefix   string
+	partSize uint64
+}
+
+// NewS3 connects to the bucket of an S3 source. Keys of the source start
+// with prefix, which is empty or ends with a slash.
+func NewS3(config settings.S3Config, bucket, prefix string) (*S3, error) {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = defaultS3Endpoint
+	}
+	var creds *credentials.Credentials
+	if config.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, "")
+	} else {
+		creds = credentials.NewEnvAWS()
+	}
+	lookup := minio.BucketLookupAuto
+	if config.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       !config.DisableSSL,
+		Region:       config.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	partSize := config.PartSizeMB
+	if partSize == 0 {
+		partSize = defaultPartSizeMB
+	}
+	if partSize < minPartSizeMB {
+		return nil, fmt.Errorf("s3 part size must be at least %d MB", minPartSizeMB)
+	}
+	return &S3{
+		client:   client,
+		bucket:   bucket,
+		prefix:   prefix,
+		partSize: partSize << 20,
+	}, nil
+}
+
+// key returns the object key of a file.
+func (s *S3) key(name string) string {
+	return s.prefix + strings.TrimPrefix(clean(name), "/")
+}
+
+// dirKey returns the key prefix of the children of a directory.
+func (s *S3) dirKey(name string) string {
+	if clean(name) == "/" {
+		return s.prefix
+	}
+	return s.key(name) + "/"
+}
+
+func notExist(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+}
+
+func isNotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func (s *S3) Stat(name string) (os.FileInfo, error) {
+	ctx := context.Background()
+	base := path.Base(clean(name))
+	if clean(name) != "/" {
+		info, err := s.client.StatObject(ctx, s.bucket, s.key(name), minio.StatObjectOptions{})
+		if err == nil {
+			return &objectInfo{name: base, size: info.Size, modTime: info.LastModified, etag: info.ETag}, nil
+		}
+		if !isNotFound(err) {
+			return nil, err
+		}
+	}
+	// directories only exist as the prefix of other keys
+	if clean(name) != "/" {
+		isDir, err := s.hasChildren(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if !isDir {
+			return nil, notExist("stat", name)
+		}
+	}
+	return newDirInfo(base, time.Time{}), nil
+}
+
+// hasChildren reports whether any key starts with the prefix of a
+// directory, its marker included. Only the first key is listed.
+func (s *S3) hasChildren(ctx context.Context, name string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// stops the listing after the first key
+	defer cancel()
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.dirKey(name), MaxKeys: 1}) {
+		if object.Err != nil {
+			return false, object.Err
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+func (s *S3) ReadDir(name string) ([]os.FileInfo, error) {
+	ctx := context.Background()
+	dirKey := s.dirKey(name)
+	var infos []os.FileInfo
+	found := false
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: dirKey}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		found = true
+		childName := strings.TrimPrefix(object.Key, dirKey)
+		if childName == "" {
+			// the marker of the directory itself
+			continue
+		}
+		if strings.HasSuffix(childName, "/") {
+			infos = append(infos, newDirInfo(strings.TrimSuffix(childName, "/"), time.Time{}))
+			continue
+		}
+		infos = append(infos, &objectInfo{name: childName, size: object.Size, modTime: object.LastModified, etag: object.ETag})
+	}
+	if !found && clean(name) != "/" {
+		return nil, notExist("readdir", name)
+	}
+	return infos, nil
+}
+
+func (s *S3) Open(name string) (File, error) {
+	object, err := s.client.GetObject(context.Background(), s.bucket, s.key(name), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// the request is only sent on first use, so stat to report missing files here
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		if isNotFound(err) {
+			return nil, notExist("open", name)
+		}
+		return nil, err
+	}
+	return &s3File{
+		Object: object,
+		info:   &objectInfo{name: path.Base(clean(name)), size: info.Size, modTime: info.LastModified},
+	}, nil
+}
+
+func (s *S3) ReadRange(name string, offset, length int64) (io.ReadCloser, error) {
+	opts := minio.GetObjectOptions{}
+	end := int64(0) // zero reads to the end of the object
+	if length > 0 {
+		end = offset + length - 1
+	}
+	if offset > 0 || end > 0 {
+		if err := opts.SetRange(offset, end); err != nil {
+			return nil, err
+		}
+	}
+	// errors are returned by the first read, stat would drop the range
+	return s.client.GetObject(context.Background(), s.bucket, s.key(name), opts)
+}
+
+// WriteFile streams the file to the bucket. Files larger than the part
+// size are sent as a multipart upload, so memory use stays bounded.
+func (s *S3) WriteFile(name string, in io.Reader) error {
+	if clean(name) == "/" {
+		return fmt.Errorf("cannot write to the source root")
+	}
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.key(name), in, -1, minio.PutObjectOptions{
+		PartSize: s.partSize,
+		// streaming signatures over plain http are not supported by all servers
+		DisableContentSha256: true,
+	})
+	return err
+}
+
+func (s *S3) MkdirAll(name string) error {
+	if clean(name) == "/" {
+		return nil
+	}
+	_, err := s.client.PutObject(context.Background(), s.bucket, s.dirKey(name), bytes.NewReader(nil), 0, minio.PutObjectOptions{
+		DisableContentSha256: true,
+	})
+	return err
+}
+
+func (s *S3) RemoveAll(name string) error {
+	if clean(name) == "/" {
+		return fmt.Errorf("cannot remove the source root")
+	}
+	ctx := context.Background()
+	err := s.client.RemoveObject(ctx, s.bucket, s.key(name), minio.RemoveObjectOptions{})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	objects := s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: s.dirKey(name), Recursive: true})
+	for result := range s.client.RemoveObjects(ctx, s.bucket, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil {
+			return fmt.Errorf("could not remove %v: %w", result.ObjectName, result.Err)
+		}
+	}
+	return nil
+}
+
+// Rename copies the objects to their new keys and removes the old ones,
+// S3 has no rename.
+func (s *S3) Rename(oldName, newName string) error {
+	if clean(oldName) == "/" || clean(newName) == "/" {
+		return fmt.Errorf("cannot rename the source root")
+	}
+	ctx := context.Background()
+	info, err := s.Stat(oldName)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if err = s.copyObject(ctx, s.key(oldName), s.key(newName)); err != nil {
+			return err
+		}
+		return s.client.RemoveObject(ctx, s.bucket, s.key(oldName), minio.RemoveObjectOptions{})
+	}
+	oldKey, newKey := s.dirKey(oldName), s.dirKey(newName)
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: oldKey, Recursive: true}) {
+		if object.Err != nil {
+			return object.Err
+		}
+		if err = s.copyObject(ctx, object.Key, newKey+strings.TrimPrefix(object.Key, oldKey)); err != nil {
+			return err
+		}
+	}
+	return s.RemoveAll(oldName)
+}
+
+func (s *S3) copyObject(ctx context.Context, from, to string) error {
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: to},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: from})
+	return err
+}
+
+func (s *S3) IsLocal() bool {
+	return false
+}
+
+type s3File struct {
+	*minio.Object
+	info os.FileInfo
+}
+
+func (f *s3File) Stat() (os.FileInfo, error) {
+	return f.info, nil
+}
+
+// objectInfo describes a file or directory of an S3 source.
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	etag    string // changes with the content, unlike the mod time in seconds
+}
+
+// newDirInfo describes a directory. Prefixes have no modification time of
+// their own, so it is derived from their files or left zero.
+func newDirInfo(name string, modTime time.Time) *objectInfo {
+	return &objectInfo{name: name, modTime: modTime, dir: true}
+}
+
+func (i *objectInfo) Name() string       { return i.name }
+func (i *objectInfo) Size() int64        { return i.size }
+func (i *objectInfo) ModTime() time.Time { return i.modTime }
+func (i *objectInfo) IsDir() bool        { return i.dir }
+func (i *objectInfo) Sys() any           { return nil }
+
+// ETag is used as the version of the object, see fileutils.VersionTag.
+func (i *objectInfo) ETag() string { return i.etag }
+
+func (i *objectInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
@@ -0,0 +1,379 @@
+package sources
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+)
+
+const (
+	defaultSFTPConnections = 4
+	sftpDialTimeout        = 10 * time.Second
+)
+
+// SFTP is a source in a directory of an SFTP server. Connections are
+// pooled, broken connections are dropped and operations that failed because
+// of them are retried once on a new connection. A connection is only taken
+// from the pool while a request is made, open files share connections with
+// other requests, so reading a file while writing another one of the source
+// never waits for a connection the reader holds.
+type SFTP struct {
+	root   string
+	dial   func() (*ssh.Client, error)
+	idle   chan *sftpConn
+	tokens chan struct{} // one token per open connection
+}
+
+type sftpConn struct {
+	ssh    *ssh.Client
+	client *sftp.Client
+	closed atomic.Bool
+}
+
+func (c *sftpConn) close() {
+	c.client.Close()
+	c.ssh.Close()
+}
+
+// NewSFTP creates an SFTP source for root on the server at addr. No
+// connection is made until the source is used.
+func NewSFTP(config settings.SFTPConfig, addr, user, root string) (*SFTP, error) {
+	clientConfig, err := sshClientConfig(config, user)
+	if err != nil {
+		return nil, err
+	}
+	maxConnections := config.MaxConnections
+	if maxConnections <= 0 {
+		maxConnections = defaultSFTPConnections
+	}
+	return &SFTP{
+		root: path.Clean("/" + root),
+		dial: func() (*ssh.Client, error) {
+			return ssh.Dial("tcp", addr, clientConfig)
+		},
+		idle:   make(chan *sftpConn, maxConnections),
+		tokens: make(chan struct{}, maxConnections),
+	}, nil
+}
+
+func sshClientConfig(config settings.SFTPConfig, user string) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if config.PrivateKeyFile != "" {
+		key, err := os.ReadFile(config.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read sftp private key: %w", err)
+		}
+		var signer ssh.Signer
+		if config.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(config.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse sftp private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if config.Password != "" {
+		auth = append(auth, ssh.Password(config.Password))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("sftp source needs a password or private key")
+	}
+
+	var hostKeyCallback ssh.HostKeyCallback
+	switch {
+	case config.HostKey != "":
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(config.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse sftp host key: %w", err)
+		}
+		hostKeyCallback = ssh.FixedHostKey(hostKey)
+	case config.InsecureIgnoreHostKey:
+		hostKeyCallback = ssh.InsecureIgnoreHostKey() //nolint:gosec // explicitly configured
+	default:
+		return nil, fmt.Errorf("sftp source needs a host key, or insecureIgnoreHostKey to skip verification")
+	}
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         sftpDialTimeout,
+	}, nil
+}
+
+// acquire returns an idle connection or opens a new one, waiting while all
+// connections are in use.
+func (s *SFTP) acquire() (*sftpConn, error) {
+	for {
+		select {
+		case conn := <-s.idle:
+			if conn.closed.Load() {
+				s.discard(conn)
+				continue
+			}
+			return conn, nil
+		case s.tokens <- struct{}{}:
+			conn, err := s.connect()
+			if err != nil {
+				<-s.tokens
+				return nil, err
+			}
+			return conn, nil
+		}
+	}
+}
+
+func (s *SFTP) connect() (*sftpConn, error) {
+	sshClient, err := s.dial()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to sftp server: %w", err)
+	}
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("could not start sftp session: %w", err)
+	}
+	conn := &sftpConn{ssh: sshClient, client: client}
+	go func() {
+		// mark the connection so it is not handed out after the server went away
+		sshClient.Wait() //nolint:errcheck
+		conn.closed.Store(true)
+	}()
+	return conn, nil
+}
+
+// release returns a connection to the pool, or closes it if err shows it
+// is broken.
+func (s *SFTP) release(conn *sftpConn, err error) {
+	if isConnectionLost(err) || conn.closed.Load() {
+		s.discard(conn)
+		return
+	}
+	s.idle <- conn
+}
+
+func (s *SFTP) discard(conn *sftpConn) {
+	conn.close()
+	<-s.tokens
+}
+
+func isConnectionLost(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr)
+}
+
+// do runs fn with a pooled client. It is retried once on a new connection
+// if the connection was lost, so fn must be safe to repeat.
+func (s *SFTP) do(fn func(client *sftp.Client) error) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var conn *sftpConn
+		conn, err = s.acquire()
+		if err != nil {
+			return err
+		}
+		err = fn(conn.client)
+		s.release(conn, err)
+		if !isConnectionLost(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// remotePath returns the path of name on the server.
+func (s *SFTP) remotePath(name string) string {
+	return path.Join(s.root, clean(name))
+}
+
+func (s *SFTP) Stat(name string) (os.FileInfo, error) {
+	var info os.FileInfo
+	err := s.do(func(client *sftp.Client) error {
+		var err error
+		info, err = client.Stat(s.remotePath(name))
+		return err
+	})
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return info, nil
+}
+
+func (s *SFTP) ReadDir(name string) ([]os.FileInfo, error) {
+	var infos []os.FileInfo
+	err := s.do(func(client *sftp.Client) error {
+		var err error
+		infos, err = client.ReadDir(s.remotePath(name))
+		return err
+	})
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+	return infos, nil
+}
+
+// openFile opens a file on a pooled connection and returns the connection
+// to the pool right away, the file keeps using it.
+func (s *SFTP) openFile(target string, flags int) (*sftpFile, error) {
+	conn, err := s.acquire()
+	if err != nil {
+		return nil, err
+	}
+	file, err := conn.client.OpenFile(target, flags)
+	s.release(conn, err)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFile{File: file, conn: conn}, nil
+}
+
+func (s *SFTP) Open(name string) (File, error) {
+	for attempt := 0; ; attempt++ {
+		file, err := s.openFile(s.remotePath(name), os.O_RDONLY)
+		if err == nil {
+			return file, nil
+		}
+		if !isConnectionLost(err) || attempt > 0 {
+			return nil, pathError("open", name, err)
+		}
+	}
+}
+
+func (s *SFTP) ReadRange(name string, offset, length int64) (io.ReadCloser, error) {
+	file, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if length <= 0 {
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(file, offset, length), file}, nil
+}
+
+// WriteFile uploads the file. It is not retried after the upload started,
+// the reader can only be consumed once.
+func (s *SFTP) WriteFile(name string, in io.Reader) error {
+	if clean(name) == "/" {
+		return fmt.Errorf("cannot write to the source root")
+	}
+	target := s.remotePath(name)
+	err := s.do(func(client *sftp.Client) error {
+		if err := client.MkdirAll(path.Dir(target)); err != nil {
+			return err
+		}
+		// a directory in the way of the file is replaced
+		if stat, err := client.Stat(target); err == nil && stat.IsDir() {
+			return client.RemoveAll(target)
+		}
+		return nil
+	})
+	if err != nil {
+		return pathError("write", name, err)
+	}
+	file, err := s.openFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err == nil {
+		_, err = io.Copy(file, in)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return pathError("write", name, err)
+	}
+	return nil
+}
+
+func (s *SFTP) MkdirAll(name string) error {
+	return s.do(func(client *sftp.Client) error {
+		return client.MkdirAll(s.remotePath(name))
+	})
+}
+
+func (s *SFTP) RemoveAll(name string) error {
+	if clean(name) == "/" {
+		return fmt.Errorf("cannot remove the source root")
+	}
+	return s.do(func(client *sftp.Client) error {
+		err := client.RemoveAll(s.remotePath(name))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+func (s *SFTP) Rename(oldName, newName string) error {
+	if clean(oldName) == "/" || clean(newName) == "/" {
+		return fmt.Errorf("cannot rename the source root")
+	}
+	target := s.remotePath(newName)
+	err := s.do(func(client *sftp.Client) error {
+		if err := client.MkdirAll(path.Dir(target)); err != nil {
+			return err
+		}
+		// plain sftp rename fails if the target exists
+		return client.PosixRename(s.remotePath(oldName), target)
+	})
+	if err != nil {
+		return pathError("rename", oldName, err)
+	}
+	return nil
+}
+
+func (s *SFTP) IsLocal() bool {
+	return false
+}
+
+// Close closes all idle connections.
+func (s *SFTP) Close() {
+	for {
+		select {
+		case conn := <-s.idle:
+			s.discard(conn)
+		default:
+			return
+		}
+	}
+}
+
+// pathError reports errors with the source relative name instead of the
+// path on the server.
+func pathError(op, name string, err error) error {
+	if errors.Is(err, os.ErrNotExist) {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+// sftpFile marks its connection as broken if it was lost while the file
+// was open, so the pool drops it.
+type sftpFile struct {
+	*sftp.File
+	conn *sftpConn
+}
+
+func (f *sftpFile) Close() error {
+	err := f.File.Close()
+	if isConnectionLost(err) {
+		f.conn.closed.Store(true)
+	}
+	return err
+}
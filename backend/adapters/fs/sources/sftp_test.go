@@ -0,0 +1,259 @@
+package sources
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+)
+
+const testSFTPPassword = "secret"
+
+// testSFTPServer is an in-process SFTP server serving the local disk.
+type testSFTPServer struct {
+	addr    string
+	hostKey string // authorized_keys format
+
+	mu    sync.Mutex
+	conns []net.Conn
+	dials int
+}
+
+func newTestSFTPServer(t *testing.T) *testSFTPServer {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == "test" && string(password) == testSFTPPassword {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &testSFTPServer{
+		addr:    listener.Addr().String(),
+		hostKey: string(ssh.MarshalAuthorizedKey(signer.PublicKey())),
+	}
+	t.Cleanup(func() {
+		listener.Close()
+		server.dropConnections()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.conns = append(server.conns, conn)
+			server.dials++
+			server.mu.Unlock()
+			go serveSFTP(conn, config)
+		}
+	}()
+	return server
+}
+
+func serveSFTP(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type") //nolint:errcheck
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range requests {
+				req.Reply(req.Type == "subsystem" && string(req.Payload[4:]) == "sftp", nil) //nolint:errcheck
+			}
+		}()
+		go func() {
+			defer channel.Close()
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve() //nolint:errcheck
+		}()
+	}
+}
+
+// dropConnections closes all client connections, like a server restart.
+func (s *testSFTPServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testSFTPServer) dialCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials
+}
+
+func newTestSFTP(t *testing.T, server *testSFTPServer, maxConnections int) *SFTP {
+	t.Helper()
+	fsys, err := NewSFTP(settings.SFTPConfig{
+		Password:       testSFTPPassword,
+		HostKey:        server.hostKey,
+		MaxConnections: maxConnections,
+	}, server.addr, "test", t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create sftp source: %v", err)
+	}
+	t.Cleanup(fsys.Close)
+	return fsys
+}
+
+func TestSFTPReconnect(t *testing.T) {
+	server := newTestSFTPServer(t)
+	fsys := newTestSFTP(t, server, 1)
+	if err := fsys.WriteFile("/a.txt", strings.NewReader("hello")); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	server.dropConnections()
+	info, err := fsys.Stat("/a.txt")
+	if err != nil || info.Size() != 5 {
+		t.Fatalf("expected stat to succeed after reconnect, got %+v (%v)", info, err)
+	}
+	r, err := fsys.ReadRange("/a.txt", 1, 3)
+	if got := readAll(t, r, err); got != "ell" {
+		t.Errorf("expected ranged read to return ell, got %q", got)
+	}
+	if dials := server.dialCount(); dials != 2 {
+		t.Errorf("expected one reconnect, got %d connections", dials)
+	}
+}
+
+func TestSFTPPool(t *testing.T) {
+	server := newTestSFTPServer(t)
+	fsys := newTestSFTP(t, server, 2)
+	if err := fsys.WriteFile("/a.txt", strings.NewReader("hello")); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := fsys.ReadRange("/a.txt", 0, 0)
+			if got := readAll(t, r, err); got != "hello" {
+				t.Errorf("unexpected content %q", got)
+			}
+			if _, err = fsys.ReadDir("/"); err != nil {
+				t.Errorf("failed to list: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if dials := server.dialCount(); dials > 2 {
+		t.Errorf("expected at most 2 connections, got %d", dials)
+	}
+}
+
+func TestSFTPCopyInSource(t *testing.T) {
+	server := newTestSFTPServer(t)
+	// open files don't hold the only connection while another file is written
+	fsys := newTestSFTP(t, server, 1)
+	if err := fsys.WriteFile("/a.txt", strings.NewReader("hello")); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				file, err := fsys.Open("/a.txt")
+				if err != nil {
+					t.Errorf("failed to open file: %v", err)
+					return
+				}
+				defer file.Close()
+				if err = fsys.WriteFile(fmt.Sprintf("/copies/%d.txt", i), file); err != nil {
+					t.Errorf("failed to copy file: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("copies within the source did not finish")
+	}
+
+	for i := 0; i < 4; i++ {
+		r, err := fsys.ReadRange(fmt.Sprintf("/copies/%d.txt", i), 0, 0)
+		if got := readAll(t, r, err); got != "hello" {
+			t.Errorf("unexpected copy %q", got)
+		}
+	}
+	if dials := server.dialCount(); dials != 1 {
+		t.Errorf("expected a single connection, got %d", dials)
+	}
+}
+
+func TestSFTPHostKey(t *testing.T) {
+	server := newTestSFTPServer(t)
+	other := newTestSFTPServer(t)
+	fsys, err := NewSFTP(settings.SFTPConfig{Password: testSFTPPassword, HostKey: other.hostKey}, server.addr, "test", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fsys.Stat("/"); err == nil {
+		t.Error("expected connecting to a server with another host key to fail")
+	}
+	if _, err = NewSFTP(settings.SFTPConfig{Password: testSFTPPassword}, server.addr, "test", "/"); err == nil {
+		t.Error("expected a missing host key to be rejected")
+	}
+}
+
+func TestSFTPLocation(t *testing.T) {
+	source := &settings.Source{Path: "sftp://alice@files.example.com/srv/data/"}
+	addr, user, root, err := source.SFTPLocation()
+	if err != nil || !source.IsSFTP() || addr != "files.example.com:22" || user != "alice" || root != "/srv/data" {
+		t.Errorf("unexpected location %q %q %q (%v)", addr, user, root, err)
+	}
+	source = &settings.Source{Path: "sftp://files.example.com:2222", Config: settings.SourceConfig{SFTP: settings.SFTPConfig{User: "bob"}}}
+	if addr, user, root, err = source.SFTPLocation(); err != nil || addr != "files.example.com:2222" || user != "bob" || root != "/" {
+		t.Errorf("unexpected location %q %q %q (%v)", addr, user, root, err)
+	}
+}
@@ -0,0 +1,139 @@
+// Package sources abstracts the storage a source is served from, so local
+// directories, object storage buckets and SFTP servers can be indexed and
+// browsed alike.
+package sources
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+)
+
+// FS is the storage of a source. Names are slash separated and relative to
+// the source root, "/" is the root itself.
+type FS interface {
+	Stat(name string) (os.FileInfo, error)
+	// ReadDir lists the direct children of a directory.
+	ReadDir(name string) ([]os.FileInfo, error)
+	Open(name string) (File, error)
+	// ReadRange reads length bytes starting at offset, or everything after
+	// offset if length is not positive.
+	ReadRange(name string, offset, length int64) (io.ReadCloser, error)
+	// WriteFile creates or replaces a file, missing parents are created.
+	WriteFile(name string, in io.Reader) error
+	MkdirAll(name string) error
+	// RemoveAll removes a file or a directory with all its contents.
+	RemoveAll(name string) error
+	// Rename moves a file or directory, an existing file at newName is
+	// replaced. Missing parents of newName are created.
+	Rename(oldName, newName string) error
+	// IsLocal reports whether names map to paths on the local disk.
+	IsLocal() bool
+}
+
+// File is an open file of a source.
+type File interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	Stat() (os.FileInfo, error)
+}
+
+var (
+	filesystems   = map[string]FS{}
+	filesystemsMu sync.Mutex
+)
+
+// For returns the filesystem of a source, it is created on first use.
+func For(source *settings.Source) (FS, error) {
+	filesystemsMu.Lock()
+	defer filesystemsMu.Unlock()
+	if fsys, ok := filesystems[source.Path]; ok {
+		return fsys, nil
+	}
+	var fsys FS
+	if source.IsS3() {
+		bucket, prefix := source.S3Location()
+		s3, err := NewS3(source.Config.S3, bucket, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to source %v: %w", source.Name, err)
+		}
+		fsys = s3
+	} else if source.IsSFTP() {
+		addr, user, root, err := source.SFTPLocation()
+		if err != nil {
+			return nil, err
+		}
+		sftp, err := NewSFTP(source.Config.SFTP, addr, user, root)
+		if err != nil {
+			return nil, fmt.Errorf("could not connect to source %v: %w", source.Name, err)
+		}
+		fsys = sftp
+	} else {
+		fsys = NewLocal(source.Path)
+	}
+	if source.IsEncrypted() {
+		encrypted, err := NewEncrypted(fsys, source.Config.Encryption)
+		if err != nil {
+			return nil, fmt.Errorf("could not set up encryption of source %v: %w", source.Name, err)
+		}
+		fsys = encrypted
+	}
+	filesystems[source.Path] = fsys
+	return fsys, nil
+}
+
+// WalkFunc is called by Walk for every item, name is relative to the source
+// root. Returning filepath.SkipDir for a directory skips its contents, for a
+// file it skips the remaining items of the directory.
+type WalkFunc func(name string, info os.FileInfo) error
+
+// Walk calls fn for name and everything below it in lexical order,
+// directories before their contents. Symlinks are not followed.
+func Walk(fsys FS, name string, fn WalkFunc) error {
+	info, err := fsys.Stat(name)
+	if err != nil {
+		return err
+	}
+	err = walk(fsys, clean(name), info, fn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walk(fsys FS, name string, info os.FileInfo, fn WalkFunc) error {
+	err := fn(name, info)
+	if err != nil || !info.IsDir() {
+		if err == filepath.SkipDir && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+	entries, err := fsys.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	for _, entry := range entries {
+		err = walk(fsys, path.Join(name, entry.Name()), entry, fn)
+		if err == filepath.SkipDir {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clean returns name as an absolute slash separated path, so it can never
+// point outside of the source root.
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
@@ -0,0 +1,234 @@
+package sources
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+)
+
+const testBucket = "files"
+
+// newTestS3 starts a local S3 stand-in server with an empty bucket.
+func newTestS3(t *testing.T, prefix string) *S3 {
+	t.Helper()
+	backend := s3mem.New()
+	if err := backend.CreateBucket(testBucket); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(server.Close)
+	s3, err := NewS3(settings.S3Config{
+		Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+		Region:          "us-east-1",
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		DisableSSL:      true,
+		PathStyle:       true,
+		PartSizeMB:      minPartSizeMB,
+	}, testBucket, prefix)
+	if err != nil {
+		t.Fatalf("failed to create s3 source: %v", err)
+	}
+	return s3
+}
+
+func testFilesystems(t *testing.T) map[string]FS {
+	return map[string]FS{
+		"local":     NewLocal(t.TempDir()),
+		"s3":        newTestS3(t, ""),
+		"s3-prefix": newTestS3(t, "data/"),
+		"sftp":      newTestSFTP(t, newTestSFTPServer(t), 0),
+		"encrypted": newTestEncrypted(t, NewLocal(t.TempDir()), settings.EncryptionConfig{Secret: testSecret}),
+		"encrypted-names": newTestEncrypted(t, NewLocal(t.TempDir()), settings.EncryptionConfig{
+			Secret:       testSecret,
+			EncryptNames: true,
+		}),
+	}
+}
+
+func readAll(t *testing.T, r io.ReadCloser, err error) string {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	return string(data)
+}
+
+func names(infos []os.FileInfo) []string {
+	var list []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() {
+			name += "/"
+		}
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func TestFilesystems(t *testing.T) {
+	for name, fsys := range testFilesystems(t) {
+		t.Run(name, func(t *testing.T) {
+			if err := fsys.WriteFile("/docs/notes/a.txt", strings.NewReader("hello world")); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			if err := fsys.WriteFile("/b.txt", strings.NewReader("b")); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			if err := fsys.MkdirAll("/empty"); err != nil {
+				t.Fatalf("failed to create directory: %v", err)
+			}
+
+			entries, err := fsys.ReadDir("/")
+			if err != nil {
+				t.Fatalf("failed to list root: %v", err)
+			}
+			if got := strings.Join(names(entries), ","); got != "b.txt,docs/,empty/" {
+				t.Errorf("unexpected root listing: %v", got)
+			}
+			// quick scans compare the time of a folder from its parent with
+			// the one of the folder itself
+			for _, dir := range []string{"/", "/docs"} {
+				listed, err := fsys.ReadDir(dir)
+				if err != nil {
+					t.Fatalf("failed to list %v: %v", dir, err)
+				}
+				for _, entry := range listed {
+					if !entry.IsDir() {
+						continue
+					}
+					name := path.Join(dir, entry.Name())
+					if info, err := fsys.Stat(name); err != nil || !info.ModTime().Equal(entry.ModTime()) {
+						t.Errorf("expected the same time for %v, got %v and %+v (%v)", name, entry.ModTime(), info, err)
+					}
+				}
+			}
+			if entries, err = fsys.ReadDir("/empty"); err != nil || len(entries) != 0 {
+				t.Errorf("expected empty directory, got %v (%v)", names(entries), err)
+			}
+			if _, err = fsys.ReadDir("/missing"); !os.IsNotExist(err) {
+				t.Errorf("expected not exist error, got %v", err)
+			}
+
+			info, err := fsys.Stat("/docs/notes/a.txt")
+			if err != nil || info.IsDir() || info.Size() != 11 || info.Name() != "a.txt" {
+				t.Fatalf("unexpected file info: %+v (%v)", info, err)
+			}
+			if info, err = fsys.Stat("/docs"); err != nil || !info.IsDir() {
+				t.Errorf("expected directory info for prefix, got %+v (%v)", info, err)
+			}
+			if _, err = fsys.Stat("/docs/missing.txt"); !os.IsNotExist(err) {
+				t.Errorf("expected not exist error, got %v", err)
+			}
+
+			r, err := fsys.ReadRange("/docs/notes/a.txt", 6, 5)
+			if got := readAll(t, r, err); got != "world" {
+				t.Errorf("expected ranged read to return world, got %q", got)
+			}
+			r, err = fsys.ReadRange("/docs/notes/a.txt", 6, 0)
+			if got := readAll(t, r, err); got != "world" {
+				t.Errorf("expected open ended ranged read to return world, got %q", got)
+			}
+			file, err := fsys.Open("/docs/notes/a.txt")
+			if err != nil {
+				t.Fatalf("failed to open file: %v", err)
+			}
+			buf := make([]byte, 5)
+			if _, err = file.ReadAt(buf, 6); err != nil && err != io.EOF || string(buf) != "world" {
+				t.Errorf("unexpected ReadAt result %q (%v)", buf, err)
+			}
+			file.Close()
+			if _, err = fsys.Open("/missing.txt"); !os.IsNotExist(err) {
+				t.Errorf("expected not exist error, got %v", err)
+			}
+
+			var walked []string
+			err = Walk(fsys, "/", func(name string, info os.FileInfo) error {
+				walked = append(walked, name)
+				if name == "/empty" {
+					return filepath.SkipDir
+				}
+				return nil
+			})
+			if got := strings.Join(walked, ","); err != nil || got != "/,/b.txt,/docs,/docs/notes,/docs/notes/a.txt,/empty" {
+				t.Errorf("unexpected walk order %v (%v)", got, err)
+			}
+
+			if err = fsys.RemoveAll("/docs"); err != nil {
+				t.Fatalf("failed to remove directory: %v", err)
+			}
+			if _, err = fsys.Stat("/docs/notes/a.txt"); !os.IsNotExist(err) {
+				t.Errorf("expected removed file to be gone, got %v", err)
+			}
+
+			if err = fsys.Rename("/b.txt", "/moved/c.txt"); err != nil {
+				t.Fatalf("failed to rename file: %v", err)
+			}
+			r, err = fsys.ReadRange("/moved/c.txt", 0, 0)
+			if got := readAll(t, r, err); got != "b" {
+				t.Errorf("expected renamed file to keep its content, got %q", got)
+			}
+			if _, err = fsys.Stat("/b.txt"); !os.IsNotExist(err) {
+				t.Errorf("expected renamed file to be gone, got %v", err)
+			}
+			if err = fsys.Rename("/moved", "/renamed"); err != nil {
+				t.Fatalf("failed to rename directory: %v", err)
+			}
+			if info, err = fsys.Stat("/renamed/c.txt"); err != nil || info.Size() != 1 {
+				t.Errorf("expected file in renamed directory, got %+v (%v)", info, err)
+			}
+			if err = fsys.RemoveAll("/"); err == nil {
+				t.Error("expected removing the source root to fail")
+			}
+		})
+	}
+}
+
+func TestS3MultipartUpload(t *testing.T) {
+	fsys := newTestS3(t, "")
+	// larger than two parts, so the upload is split
+	data := make([]byte, (2*minPartSizeMB<<20)+1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("/large.bin", bytes.NewReader(data)); err != nil {
+		t.Fatalf("multipart upload failed: %v", err)
+	}
+	r, err := fsys.ReadRange("/large.bin", int64(len(data))-2048, 2048)
+	if got := readAll(t, r, err); got != string(data[len(data)-2048:]) {
+		t.Error("ranged read returned wrong bytes after multipart upload")
+	}
+	info, err := fsys.Stat("/large.bin")
+	if err != nil || info.Size() != int64(len(data)) {
+		t.Errorf("expected size %d, got %+v (%v)", len(data), info, err)
+	}
+}
+
+func TestS3Location(t *testing.T) {
+	source := &settings.Source{Path: "s3://files/data/archive/"}
+	bucket, prefix := source.S3Location()
+	if !source.IsS3() || bucket != "files" || prefix != "data/archive/" {
+		t.Errorf("unexpected location %q %q", bucket, prefix)
+	}
+	if bucket, prefix = (&settings.Source{Path: "s3://files"}).S3Location(); bucket != "files" || prefix != "" {
+		t.Errorf("unexpected location %q %q", bucket, prefix)
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"strings"
 
 	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
 	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+	"github.com/gtsteffaniak/go-logger/logger"
 )
 
 // JSONAuth is a json implementation of an Auther.
@@ -19,6 +21,21 @@ type JSONAuth struct {
 
 // Auth authenticates the user via a json in content body.
 func (auther JSONAuth) Auth(r *http.Request, userStore *users.Storage) (*users.User, error) {
+	user, err := auther.VerifyCredentials(r, userStore)
+	if err != nil {
+		return nil, err
+	}
+	maxAgeDays := settings.Config.Auth.Methods.PasswordAuth.Policy.MaxAgeDays
+	if users.PasswordChangeRequired(user, maxAgeDays) {
+		return nil, errors.ErrPasswordChangeRequired
+	}
+	return user, nil
+}
+
+// VerifyCredentials checks the username, password and OTP code of the request
+// without applying the password expiry rules, so an expired password can still
+// be used to set a new one.
+func (auther JSONAuth) VerifyCredentials(r *http.Request, userStore *users.Storage) (*users.User, error) {
 	username := r.URL.Query().Get("username")
 	recaptcha := r.URL.Query().Get("recaptcha")
 	password := r.Header.Get("X-Password")
@@ -41,9 +58,18 @@ func (auther JSONAuth) Auth(r *http.Request, userStore *users.Storage) (*users.U
 	if err != nil {
 		return nil, fmt.Errorf("unable to get user from store: %v", err)
 	}
+	if user.IsLocked() {
+		return nil, errors.ErrAccountLocked
+	}
 	err = users.CheckPwd(password, user.Password)
 	if err != nil {
-		return nil, err
+		return nil, registerFailedLogin(user, userStore, err)
+	}
+	if user.LoginMethod == users.LoginMethodPassword && users.NeedsRehash(user.Password) {
+		// upgrade hashes made with an outdated algorithm or cost, login still succeeds if this fails
+		if err = userStore.RehashPassword(user, password); err != nil {
+			logger.Errorf("failed to upgrade password hash for user %v: %v", user.Username, err)
+		}
 	}
 
 	// check for OTP for password
@@ -53,7 +79,7 @@ func (auther JSONAuth) Auth(r *http.Request, userStore *users.Storage) (*users.U
 		}
 		err = VerifyTotpCode(user, totpCode, userStore)
 		if err != nil {
-			return nil, err
+			return nil, registerFailedLogin(user, userStore, err)
 		}
 	}
 
@@ -61,8 +87,25 @@ func (auther JSONAuth) Auth(r *http.Request, userStore *users.Storage) (*users.U
 		return nil, errors.ErrWrongLoginMethod
 	}
 
+	if err = userStore.ResetFailedLogins(user); err != nil {
+		logger.Errorf("failed to reset failed login attempts for user %v: %v", user.Username, err)
+	}
 	return user, nil
+}
 
+// registerFailedLogin counts a failed password or OTP attempt against the
+// lockout policy and returns the error to report to the client.
+func registerFailedLogin(user *users.User, userStore *users.Storage, authErr error) error {
+	locked, err := userStore.RegisterFailedLogin(user, settings.Config.Auth.Methods.PasswordAuth.Lockout)
+	if err != nil {
+		logger.Errorf("failed to record failed login attempt for user %v: %v", user.Username, err)
+		return authErr
+	}
+	if locked {
+		logger.Warningf("user %v has been locked out after too many failed login attempts", user.Username)
+		return errors.ErrAccountLocked
+	}
+	return authErr
 }
 
 const reCaptchaAPI = "/recaptcha/api/siteverify"
@@ -0,0 +1,120 @@
+// Command dbbackup backs up a running server and restores backups.
+//
+// Download a consistent snapshot from a running server with an admin api key:
+//
+//	go run ./cmd/dbbackup backup -url http://localhost:80 -token <api key> -out backup.db
+//
+// Restore a backup while the server is stopped:
+//
+//	go run ./cmd/dbbackup restore -from backup.db -to database.db
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "backup":
+		err = backup(os.Args[2:])
+	case "restore":
+		err = restore(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v failed: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dbbackup backup|restore [flags]")
+	os.Exit(2)
+}
+
+func backup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	url := fs.String("url", "http://localhost:80", "url of the running server including the base url")
+	token := fs.String("token", os.Getenv("FILEBROWSER_API_TOKEN"), "admin api key (default: $FILEBROWSER_API_TOKEN)")
+	out := fs.String("out", "", "file to write the backup to (default: name suggested by the server)")
+	_ = fs.Parse(args)
+	if *token == "" {
+		return fmt.Errorf("an admin api key is required")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(*url, "/")+"/api/database/backup", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+*token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("server responded with %v: %s", resp.Status, body)
+	}
+
+	path := *out
+	if path == "" {
+		path = "backup.db"
+		if name := filenameFromDisposition(resp.Header.Get("Content-Disposition")); name != "" {
+			path = name
+		}
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d bytes to %v\n", n, path)
+	return nil
+}
+
+func filenameFromDisposition(header string) string {
+	_, name, ok := strings.Cut(header, "filename=")
+	if !ok {
+		return ""
+	}
+	return filepath.Base(strings.Trim(name, `"`))
+}
+
+func restore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	from := fs.String("from", "", "backup file to restore")
+	to := fs.String("to", "database.db", "database file to replace, the current file is kept with a .bak suffix and the time of the restore")
+	_ = fs.Parse(args)
+	if *from == "" {
+		return fmt.Errorf("-from is required")
+	}
+	if err := storage.RestoreDatabase(*from, *to); err != nil {
+		return err
+	}
+	fmt.Printf("restored %v from %v\n", *to, *from)
+	return nil
+}
@@ -0,0 +1,31 @@
+// Command migratedb copies an existing bolt database into a new sqlite
+// database. Point server.database at the new file afterwards.
+//
+//	go run ./cmd/migratedb -from database.db -to database.sqlite
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage"
+)
+
+func main() {
+	from := flag.String("from", "database.db", "path to the bolt database to copy")
+	to := flag.String("to", "database.sqlite", "path of the sqlite database to create")
+	flag.Parse()
+
+	if storage.DatabaseEngine(*to) != storage.EngineSQLite {
+		fmt.Fprintf(os.Stderr, "target %v must have a .sqlite or .sqlite3 extension\n", *to)
+		os.Exit(1)
+	}
+	report, err := storage.MigrateBoltToSQLite(*from, *to)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migration failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("copied %d users, %d shares, %d invitations, %d tagged items, %d favorite lists, %d jobs and %d config entries to %v\n",
+		report.Users, report.Shares, report.Invitations, report.Tags, report.Favorites, report.Jobs, report.Config, *to)
+}
@@ -0,0 +1,60 @@
+// Command rotatekeys encrypts the files of an encrypted source again with
+// its current key. Set the new secret as encryption.secret and move the old
+// one to encryption.previousSecrets, then run it while the server is stopped:
+//
+//	go run ./cmd/rotatekeys -config config.yaml -source files
+//
+// When it finished without errors the previous secrets can be removed from
+// the config. An interrupted rotation is resumed by running it again.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/SlepoyShaman/FileStorage/backend/adapters/fs/sources"
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+)
+
+func main() {
+	configFile := flag.String("config", "config.yaml", "path to the server config")
+	sourceName := flag.String("source", "", "name of the encrypted source to rotate")
+	verbose := flag.Bool("v", false, "print every file that is encrypted again")
+	flag.Parse()
+
+	settings.Initialize(*configFile)
+	var source *settings.Source
+	for _, s := range settings.Config.Server.Sources {
+		if s.Name == *sourceName {
+			source = s
+		}
+	}
+	if source == nil {
+		fmt.Fprintf(os.Stderr, "source %q is not configured\n", *sourceName)
+		os.Exit(1)
+	}
+	if !source.IsEncrypted() {
+		fmt.Fprintf(os.Stderr, "source %q is not encrypted\n", *sourceName)
+		os.Exit(1)
+	}
+	fsys, err := sources.For(source)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	report, err := fsys.(*sources.Encrypted).Rotate(func(name string) {
+		if *verbose {
+			fmt.Println(name)
+		}
+	})
+	fmt.Printf("encrypted %d files and %d names with the current key\n", report.Files, report.Renamed)
+	for _, skipped := range report.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped %v: not encrypted with a configured key\n", skipped)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rotation failed: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -3,6 +3,46 @@ package errors
 import "errors"
 
 var (
-	ErrInvalidOption = errors.New("invalid option")
-	ErrNotIndexed    = errors.New("directory or item excluded from indexing")
+	ErrInvalidOption           = errors.New("invalid option")
+	ErrNotIndexed              = errors.New("directory or item excluded from indexing")
+	ErrPasswordChangeRequired  = errors.New("password has expired and must be changed")
+	ErrPasswordPolicyViolation = errors.New("password does not meet the password policy")
+	ErrAccountLocked           = errors.New("account is locked due to too many failed login attempts")
+	ErrInvitationInvalid       = errors.New("invitation is invalid, expired or has already been used")
+	ErrFullTextDisabled        = errors.New("full-text search is not enabled for this source")
+	ErrInvalidTag              = errors.New("invalid tag or metadata")
+	ErrFavoritesLimit          = errors.New("favorites limit reached")
+	ErrLocked                  = errors.New("file is locked")
+	ErrNotLocked               = errors.New("file is not locked")
+	ErrJobQueueFull            = errors.New("too many queued jobs")
+	ErrJobFinished             = errors.New("job has already finished")
+	ErrUnsupportedArchive      = errors.New("unsupported archive format")
+	ErrInvalidCursor           = errors.New("invalid cursor")
 )
+
+// LocalizedError is an error that carries a translation key so the
+// frontend can show the message in the user's language.
+type LocalizedError struct {
+	Key     string         // i18n key, eg. "passwordPolicy.tooShort"
+	Params  map[string]any // values interpolated into the translated message
+	Message string         // english message used in logs and as a fallback
+	Wrapped error          // optional sentinel error for errors.Is checks
+}
+
+func (e *LocalizedError) Error() string {
+	return e.Message
+}
+
+func (e *LocalizedError) Unwrap() error {
+	return e.Wrapped
+}
+
+// NewLocalized creates a LocalizedError wrapping the given sentinel error.
+func NewLocalized(wrapped error, key, message string, params map[string]any) *LocalizedError {
+	return &LocalizedError{
+		Key:     key,
+		Params:  params,
+		Message: message,
+		Wrapped: wrapped,
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"net/http"
 
 	"github.com/SlepoyShaman/FileStorage/backend/common/version"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+	"github.com/SlepoyShaman/FileStorage/backend/sevices/password_hash"
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gtsteffaniak/go-logger/logger"
 )
@@ -47,11 +49,14 @@ type LoginMethods struct {
 }
 
 type PasswordAuthConfig struct {
-	Enabled     bool      `json:"enabled"`
-	MinLength   int       `json:"minLength" validate:"omitempty"` // minimum pasword length required, default is 5.
-	Signup      bool      `json:"signup" validate:"omitempty"`    // allow signups on login page if enabled -- not secure.
-	Recaptcha   Recaptcha `json:"recaptcha" validate:"omitempty"` // recaptcha config, only used if signup is enabled
-	EnforcedOtp bool      `json:"enforcedOtp"`                    // if set to true, TOTP is enforced for all password users users. Otherwise, users can choose to enable TOTP.
+	Enabled     bool                 `json:"enabled"`
+	MinLength   int                  `json:"minLength" validate:"omitempty"` // minimum pasword length required, default is 5.
+	Signup      bool                 `json:"signup" validate:"omitempty"`    // allow signups on login page if enabled -- not secure.
+	Recaptcha   Recaptcha            `json:"recaptcha" validate:"omitempty"` // recaptcha config, only used if signup is enabled
+	EnforcedOtp bool                 `json:"enforcedOtp"`                    // if set to true, TOTP is enforced for all password users users. Otherwise, users can choose to enable TOTP.
+	Policy      users.PasswordPolicy `json:"policy" validate:"omitempty"`    // password complexity, reuse and expiry rules
+	Hashing     password_hash.Config `json:"hashing" validate:"omitempty"`   // algorithm and cost used to hash new passwords, outdated hashes are upgraded at login
+	Lockout     users.LockoutPolicy  `json:"lockout" validate:"omitempty"`   // lock accounts after repeated failed password or OTP attempts
 }
 
 type ProxyAuthConfig struct {
@@ -14,6 +14,7 @@ import (
 
 	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
 	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+	"github.com/SlepoyShaman/FileStorage/backend/sevices/password_hash"
 	"github.com/SlepoyShaman/FileStorage/common/utils"
 	"github.com/go-playground/validator/v10"
 	"github.com/goccy/go-yaml"
@@ -201,13 +202,25 @@ func setupSources(generate bool) {
 			if source.Config.Disabled {
 				continue
 			}
-			realPath, err := filepath.Abs(source.Path)
-			if err != nil {
-				logger.Fatalf("error getting real path for source %v: %v", source.Path, err)
-			}
-			exists := utils.CheckPathExists(realPath)
-			if !exists {
-				logger.Warningf("source path %v is currently not available", realPath)
+			realPath := strings.TrimRight(source.Path, "/")
+			if source.IsS3() {
+				if bucket, _ := source.S3Location(); bucket == "" {
+					logger.Fatalf("source path %v is missing the bucket name", source.Path)
+				}
+			} else if source.IsSFTP() {
+				if _, _, _, err := source.SFTPLocation(); err != nil {
+					logger.Fatalf("invalid sftp source path %v: %v", source.Path, err)
+				}
+			} else {
+				var err error
+				realPath, err = filepath.Abs(source.Path)
+				if err != nil {
+					logger.Fatalf("error getting real path for source %v: %v", source.Path, err)
+				}
+				exists := utils.CheckPathExists(realPath)
+				if !exists {
+					logger.Warningf("source path %v is currently not available", realPath)
+				}
 			}
 			name := filepath.Base(realPath)
 			if name == "\\" {
@@ -312,6 +325,12 @@ func setupAuth(generate bool) {
 		logger.Info("OIDC Auth configured successfully")
 	}
 
+	hasher, err := password_hash.NewStrategyFromConfig(Config.Auth.Methods.PasswordAuth.Hashing)
+	if err != nil {
+		logger.Fatalf("invalid auth.methods.password.hashing.algorithm %q: %v", Config.Auth.Methods.PasswordAuth.Hashing.Algorithm, err)
+	}
+	users.SetPasswordHasher(hasher)
+
 	// use password auth as default if no auth methods are set
 	if len(Config.Auth.AuthMethods) == 0 {
 		Config.Auth.Methods.PasswordAuth.Enabled = true
@@ -775,7 +794,7 @@ func modifyExcludeInclude(config *Source) {
 		}
 		normalized := "/" + strings.Trim(value, "/")
 		// check if file/folder exists
-		if checkExists {
+		if checkExists && !config.IsS3() && !config.IsSFTP() {
 			realPath, err := filepath.Abs(config.Path + normalized)
 			if err != nil {
 				logger.Warningf("could not get absolute path for %v: %v", normalized, err)
@@ -2,6 +2,9 @@ package settings
 
 import (
 	"fmt"
+	"net"
+	"net/url"
+	"path"
 	"strings"
 
 	"github.com/gtsteffaniak/go-logger/logger"
@@ -163,3 +166,52 @@ func GetSources(u *users.User) []string {
 	}
 	return sources
 }
+
+// IsS3 reports whether the source is stored in an S3 bucket.
+func (s *Source) IsS3() bool {
+	return strings.HasPrefix(s.Path, "s3://")
+}
+
+// S3Location returns the bucket and key prefix of an s3:// source path.
+// The prefix is empty or ends with a slash.
+func (s *Source) S3Location() (bucket, prefix string) {
+	location := strings.Trim(strings.TrimPrefix(s.Path, "s3://"), "/")
+	bucket, prefix, _ = strings.Cut(location, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return bucket, prefix
+}
+
+// IsEncrypted reports whether the files of the source are encrypted at rest.
+func (s *Source) IsEncrypted() bool {
+	return s.Config.Encryption.Secret != ""
+}
+
+// IsSFTP reports whether the source is stored on an SFTP server.
+func (s *Source) IsSFTP() bool {
+	return strings.HasPrefix(s.Path, "sftp://")
+}
+
+// SFTPLocation returns the address, user and remote directory of an
+// sftp:// source path. The port defaults to 22 and the user to the one set
+// in the source config.
+func (s *Source) SFTPLocation() (addr, user, root string, err error) {
+	u, err := url.Parse(s.Path)
+	if err != nil {
+		return "", "", "", err
+	}
+	if u.Hostname() == "" {
+		return "", "", "", fmt.Errorf("source path %v is missing the host", s.Path)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	user = s.Config.SFTP.User
+	if u.User != nil && u.User.Username() != "" {
+		user = u.User.Username()
+	}
+	root = path.Clean("/" + u.Path)
+	return net.JoinHostPort(u.Hostname(), port), user, root, nil
+}
@@ -50,14 +50,17 @@ type Server struct {
 	ListenAddress                string      `json:"listen"`                                 // address to listen on (default: 0.0.0.0)
 	BaseURL                      string      `json:"baseURL"`                                // base URL for the server, the subpath that the server is running on.
 	Logging                      []LogConfig `json:"logging" yaml:"logging"`
-	Database                     string      `json:"database"` // path to the database file
+	Database                     string      `json:"database"` // path to the database file, a .sqlite or .sqlite3 extension uses sqlite instead of bolt
 	Sources                      []*Source   `json:"sources" validate:"required,dive"`
-	ExternalUrl                  string      `json:"externalUrl"`     // used by share links if set (eg. http://mydomain.com)
-	InternalUrl                  string      `json:"internalUrl"`     // used by integrations if set, this is the base domain that an integration service will use to communicate with filebrowser (eg. http://localhost:8080)
-	CacheDir                     string      `json:"cacheDir"`        // path to the cache directory, used for thumbnails and other cached files
-	CacheDirCleanup              *bool       `json:"cacheDirCleanup"` // whether to automatically cleanup the cache directory. Note: docker must also mount a persistent volume to persist the cache (default: true)
-	MaxArchiveSizeGB             int64       `json:"maxArchiveSize"`  // max pre-archive combined size of files/folder that are allowed to be archived (in GB)
-	Filesystem                   Filesystem  `json:"filesystem"`      // filesystem settings
+	ExternalUrl                  string      `json:"externalUrl"`          // used by share links if set (eg. http://mydomain.com)
+	InternalUrl                  string      `json:"internalUrl"`          // used by integrations if set, this is the base domain that an integration service will use to communicate with filebrowser (eg. http://localhost:8080)
+	CacheDir                     string      `json:"cacheDir"`             // path to the cache directory, used for thumbnails and other cached files
+	CacheDirCleanup              *bool       `json:"cacheDirCleanup"`      // whether to automatically cleanup the cache directory. Note: docker must also mount a persistent volume to persist the cache (default: true)
+	MaxArchiveSizeGB             int64       `json:"maxArchiveSize"`       // max pre-archive combined size of files/folder that are allowed to be archived (in GB)
+	Filesystem                   Filesystem  `json:"filesystem"`           // filesystem settings
+	Backup                       Backup      `json:"backup"`               // scheduled database backups
+	IndexSnapshotMinutes         int         `json:"indexSnapshotMinutes"` // minutes between snapshots of the indexes in the cache dir, loaded at startup instead of indexing from scratch (default: 15, -1 disables)
+	JobWorkers                   int         `json:"jobWorkers"`           // number of background jobs (archives, conversions, batches) that run at the same time (default: 2)
 	// not exposed to config
 	SourceMap    map[string]*Source `json:"-" validate:"omitempty"` // uses realpath as key
 	NameToSource map[string]*Source `json:"-" validate:"omitempty"` // uses name as key
@@ -68,6 +71,12 @@ type Filesystem struct {
 	CreateDirectoryPermission string `json:"createDirectoryPermission" validate:"required,file_permission"` // Unix permissions like 755, 2755, 1777 (default: 755)
 }
 
+type Backup struct {
+	Directory     string `json:"directory"`     // directory scheduled backups are written to, scheduled backups are disabled if empty
+	IntervalHours int    `json:"intervalHours"` // hours between scheduled backups (default: 24)
+	Keep          int    `json:"keep"`          // number of scheduled backups to keep, older ones are deleted (default: 7)
+}
+
 type Integrations struct {
 	OnlyOffice OnlyOffice `json:"office" validate:"omitempty"`
 	Media      Media      `json:"media" validate:"omitempty"`
@@ -170,7 +179,7 @@ type LogConfig struct {
 }
 
 type Source struct {
-	Path   string       `json:"path" validate:"required"` // file system path. (Can be relative)
+	Path   string       `json:"path" validate:"required"` // file system path. (Can be relative), s3://bucket/prefix for an S3 bucket or sftp://host:port/path for an SFTP server
 	Name   string       `json:"name"`                     // display name
 	Config SourceConfig `json:"config,omitempty"`
 }
@@ -181,14 +190,60 @@ type SourceConfig struct {
 	Disabled         bool              `json:"disabled,omitempty"`                // disable the source, this is useful so you don't need to remove it from the config file
 	IndexingInterval uint32            `json:"indexingIntervalMinutes,omitempty"` // (optional) not recommended: manual overide interval in minutes to re-index the source
 	DisableIndexing  bool              `json:"disableIndexing,omitempty"`         // (optional) not recommended: disable the indexing of this source
+	Watch            bool              `json:"watch,omitempty"`                   // (optional) apply changes to the index as they happen using inotify (linux, local sources only), scanners keep running less often to catch up on missed changes
 	Conditionals     ConditionalFilter `json:"conditionals"`                      // conditional rules to apply when indexing to include/exclude certain items
 	DefaultUserScope string            `json:"defaultUserScope"`                  // defaults to root of index "/" should match folders under path
 	DefaultEnabled   bool              `json:"defaultEnabled"`                    // should be added as a default source for new users?
 	CreateUserDir    bool              `json:"createUserDir"`                     // create a user directory for each user under defaultUserScope + username
+	S3               S3Config          `json:"s3,omitempty"`                      // connection settings for s3:// source paths
+	SFTP             SFTPConfig        `json:"sftp,omitempty"`                    // connection settings for sftp:// source paths
+	Encryption       EncryptionConfig  `json:"encryption,omitempty"`              // encrypt the files of the source at rest
+	FullText         FullTextConfig    `json:"fullText,omitempty"`                // search the contents of files
+	TagXattrs        bool              `json:"tagXattrs,omitempty"`               // (optional) mirror tags and metadata to extended attributes of the files, local sources on linux and macos only
 	// hidden but used internally - optimized map lookups for conditional rules
 	ResolvedConditionals *ResolvedConditionalsConfig `json:"-"`
 }
 
+// S3Config configures a source stored in an S3 compatible bucket. The bucket
+// and key prefix are taken from the source path.
+type S3Config struct {
+	Endpoint        string `json:"endpoint"`        // host[:port] of the S3 api (default: s3.amazonaws.com)
+	Region          string `json:"region"`          // bucket region, required by some providers
+	AccessKeyID     string `json:"accessKeyId"`     // defaults to the AWS_ACCESS_KEY_ID environment variable
+	SecretAccessKey string `json:"secretAccessKey"` // secret: defaults to the AWS_SECRET_ACCESS_KEY environment variable
+	DisableSSL      bool   `json:"disableSSL"`      // use plain http, only for local test servers
+	PathStyle       bool   `json:"pathStyle"`       // use path style requests, needed by most self hosted servers
+	PartSizeMB      uint64 `json:"partSizeMB"`      // part size of multipart uploads (default: 16, minimum: 5)
+}
+
+// SFTPConfig configures a source on an SFTP server. The host and remote
+// directory are taken from the source path.
+type SFTPConfig struct {
+	User                  string `json:"user"`                  // login user, can also be set in the path as sftp://user@host/path
+	Password              string `json:"password"`              // secret: password authentication
+	PrivateKeyFile        string `json:"privateKeyFile"`        // path to a private key for public key authentication
+	PrivateKeyPassphrase  string `json:"privateKeyPassphrase"`  // secret: passphrase of an encrypted private key
+	HostKey               string `json:"hostKey"`               // expected server public key in authorized_keys format, eg. "ssh-ed25519 AAAA..."
+	InsecureIgnoreHostKey bool   `json:"insecureIgnoreHostKey"` // accept any server key, only for testing
+	MaxConnections        int    `json:"maxConnections"`        // maximum number of pooled connections (default: 4)
+}
+
+// EncryptionConfig stores every file of a source as authenticated
+// ciphertext. Files are decrypted transparently when read through the api.
+type EncryptionConfig struct {
+	Secret          string   `json:"secret"`          // secret: enables encryption, a base64 encoded 32 byte key or a passphrase to derive one from. Generate with 'openssl rand -base64 32'
+	PreviousSecrets []string `json:"previousSecrets"` // secret: secrets used before a key rotation, files encrypted with them stay readable until rotated
+	EncryptNames    bool     `json:"encryptNames"`    // also encrypt file and folder names
+}
+
+// FullTextConfig indexes the contents of files so they can be searched.
+// The index is kept in the cache dir and updated with the file index.
+type FullTextConfig struct {
+	Enabled       bool `json:"enabled"`       // index the contents of text files
+	Documents     bool `json:"documents"`     // also index text extracted from office documents and pdfs, pdfs require a build with mupdf
+	MaxFileSizeMB int  `json:"maxFileSizeMB"` // larger files are not indexed (default: 10)
+}
+
 type ConditionalFilter struct {
 	Hidden          bool                     `json:"hidden"`                // deprecated: use ignoreHidden instead to exclude hidden files and folders.
 	IgnoreHidden    bool                     `json:"ignoreHidden"`          // exclude hidden files and folders.
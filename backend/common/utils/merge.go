@@ -0,0 +1,115 @@
+package utils
+
+import "strings"
+
+// maxMergeCells limits the size of the line matching table of MergeText,
+// so merging two heavily changed large files gives up instead of using a
+// lot of memory.
+const maxMergeCells = 1 << 22
+
+// MergeText merges two edited versions of the text base line by line, like
+// diff3. ok is false when both versions changed the same lines differently.
+func MergeText(base, ours, theirs string) (merged string, ok bool) {
+	b, o, t := splitLines(base), splitLines(ours), splitLines(theirs)
+	mo, ok := matchLines(b, o)
+	if !ok {
+		return "", false
+	}
+	mt, ok := matchLines(b, t)
+	if !ok {
+		return "", false
+	}
+
+	var out strings.Builder
+	i, j, k := 0, 0, 0
+	for {
+		if i < len(b) && mo[i] == j && mt[i] == k {
+			out.WriteString(b[i])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+		// find the next base line kept by both versions
+		next, nextO, nextT := len(b), len(o), len(t)
+		for n := i; n < len(b); n++ {
+			if mo[n] >= 0 && mt[n] >= 0 {
+				next, nextO, nextT = n, mo[n], mt[n]
+				break
+			}
+		}
+		baseChunk := strings.Join(b[i:next], "")
+		oursChunk := strings.Join(o[j:nextO], "")
+		theirsChunk := strings.Join(t[k:nextT], "")
+		switch {
+		case oursChunk == baseChunk:
+			out.WriteString(theirsChunk)
+		case theirsChunk == baseChunk, oursChunk == theirsChunk:
+			out.WriteString(oursChunk)
+		default:
+			return "", false
+		}
+		if next == len(b) {
+			return out.String(), true
+		}
+		i, j, k = next, nextO, nextT
+	}
+}
+
+// splitLines splits text after each newline.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines returns for each line of a the index of the matching line of
+// b in a longest common subsequence, or -1 for lines not in b.
+func matchLines(a, b []string) ([]int, bool) {
+	match := make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		match[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		match[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(midA) == 0 || len(midB) == 0 {
+		return match, true
+	}
+	if (len(midA)+1)*(len(midB)+1) > maxMergeCells {
+		return nil, false
+	}
+
+	// lengths[x][y] is the length of the LCS of midA[x:] and midB[y:]
+	width := len(midB) + 1
+	lengths := make([]int32, (len(midA)+1)*width)
+	for x := len(midA) - 1; x >= 0; x-- {
+		for y := len(midB) - 1; y >= 0; y-- {
+			if midA[x] == midB[y] {
+				lengths[x*width+y] = lengths[(x+1)*width+y+1] + 1
+			} else {
+				lengths[x*width+y] = max(lengths[(x+1)*width+y], lengths[x*width+y+1])
+			}
+		}
+	}
+	for x, y := 0, 0; x < len(midA) && y < len(midB); {
+		switch {
+		case midA[x] == midB[y]:
+			match[prefix+x] = prefix + y
+			x, y = x+1, y+1
+		case lengths[(x+1)*width+y] >= lengths[x*width+y+1]:
+			x++
+		default:
+			y++
+		}
+	}
+	return match, true
+}
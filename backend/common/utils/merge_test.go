@@ -0,0 +1,57 @@
+package utils
+
+import "testing"
+
+func TestMergeText(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\nfive\n"
+	tests := []struct {
+		name   string
+		ours   string
+		theirs string
+		merged string
+		ok     bool
+	}{
+		{
+			name:   "separate changes",
+			ours:   "one\n2\nthree\nfour\nfive\n",
+			theirs: "one\ntwo\nthree\nfour\n5\n",
+			merged: "one\n2\nthree\nfour\n5\n",
+			ok:     true,
+		},
+		{
+			name:   "insert and delete",
+			ours:   "zero\none\ntwo\nthree\nfour\nfive\n",
+			theirs: "one\ntwo\nfour\nfive\n",
+			merged: "zero\none\ntwo\nfour\nfive\n",
+			ok:     true,
+		},
+		{
+			name:   "same change",
+			ours:   "one\ntwo\n3\nfour\nfive\n",
+			theirs: "one\ntwo\n3\nfour\nfive\n",
+			merged: "one\ntwo\n3\nfour\nfive\n",
+			ok:     true,
+		},
+		{
+			name:   "append without trailing newline",
+			ours:   "one\ntwo\nthree\nfour\nfive\nsix",
+			theirs: "ONE\ntwo\nthree\nfour\nfive\n",
+			merged: "ONE\ntwo\nthree\nfour\nfive\nsix",
+			ok:     true,
+		},
+		{
+			name:   "conflict",
+			ours:   "one\ntwo\nthree!\nfour\nfive\n",
+			theirs: "one\ntwo\nthree?\nfour\nfive\n",
+			ok:     false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, ok := MergeText(base, test.ours, test.theirs)
+			if ok != test.ok || merged != test.merged {
+				t.Errorf("expected %q, %v, got %q, %v", test.merged, test.ok, merged, ok)
+			}
+		})
+	}
+}
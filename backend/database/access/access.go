@@ -14,7 +14,6 @@ import (
 	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
 	"github.com/SlepoyShaman/FileStorage/backend/common/utils"
 	"github.com/SlepoyShaman/FileStorage/backend/database/users"
-	"github.com/asdine/storm/v3"
 	"github.com/gtsteffaniak/go-cache/cache"
 	"github.com/gtsteffaniak/go-logger/logger"
 )
@@ -26,8 +25,6 @@ var (
 	rulesCache      = cache.NewCache[map[string]FrontendAccessRule](1 * time.Minute) // for rules
 )
 
-const accessRulesBucket = "access_rules"
-const accessRulesKey = "rules"
 const accessChangedKey = "newRule:"
 
 type RuleMap map[string]*AccessRule
@@ -65,6 +62,12 @@ type FrontendAccessRule struct {
 	SourceDenyDefault bool            `json:"sourceDenyDefault"`
 }
 
+// RulesBackend persists the serialized access rules and groups.
+type RulesBackend interface {
+	GetRules() ([]byte, error)
+	SaveRules(data []byte) error
+}
+
 // GroupMap maps group names to a set of usernames.
 type GroupMap map[string]StringSet
 
@@ -73,7 +76,7 @@ type Storage struct {
 	mux      sync.RWMutex
 	AllRules SourceRuleMap  // AllRules[sourcePath][indexPath] - in-memory authoritative state
 	Groups   GroupMap       // key: group name, value: set of usernames - in-memory authoritative state
-	DB       *storm.DB      // Optional: DB for persistence
+	DB       RulesBackend   // Optional: backend for persistence
 	Users    *users.Storage // Reference to users storage
 }
 
@@ -89,7 +92,7 @@ func (s *Storage) SaveToDB() error {
 	if err != nil {
 		return err
 	}
-	return s.DB.Set(accessRulesBucket, accessRulesKey, data)
+	return s.DB.SaveRules(data)
 }
 
 // Flush persists the current in-memory state to the backing store.
@@ -103,8 +106,7 @@ func (s *Storage) LoadFromDB() error {
 	if s.DB == nil {
 		return nil
 	}
-	var data []byte
-	err := s.DB.Get(accessRulesBucket, accessRulesKey, &data)
+	data, err := s.DB.GetRules()
 	if err != nil {
 		return err
 	}
@@ -125,14 +127,14 @@ func (s *Storage) LoadFromDB() error {
 	return nil
 }
 
-// NewStorage creates a new Storage instance. Optionally pass a DB for persistence and users storage.
-// After creating Storage with a DB, call LoadFromDB() to load rules from the database on startup.
+// NewStorage creates a new Storage instance. Optionally pass a backend for persistence and users storage.
+// After creating Storage with a backend, call LoadFromDB() to load rules from the database on startup.
 // Example:
 //
 //	store := NewStorage(db, usersStore)
 //	err := store.LoadFromDB()
 //	if err != nil { /* handle error */ }
-func NewStorage(db *storm.DB, usersStore *users.Storage) *Storage {
+func NewStorage(db RulesBackend, usersStore *users.Storage) *Storage {
 	var s = &Storage{
 		AllRules: make(SourceRuleMap),
 		Groups:   make(GroupMap),
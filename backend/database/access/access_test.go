@@ -20,7 +20,7 @@ func createTestStorage(t *testing.T) (*access.Storage, *users.Storage) {
 		t.Fatalf("failed to open storm db: %v", err)
 	}
 	userStore := users.NewStorage(boltusers.NewUsersBackend(db))
-	return access.NewStorage(db, userStore), userStore
+	return access.NewStorage(boltusers.NewAccessBackend(db), userStore), userStore
 }
 
 func createTestUser(t *testing.T, userStore *users.Storage, username string) {
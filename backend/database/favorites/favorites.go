@@ -0,0 +1,61 @@
+// Package favorites stores the favorite and recently used files and folders
+// of each user.
+package favorites
+
+import "strings"
+
+const (
+	maxFavorites = 200
+	maxRecents   = 50
+)
+
+// Actions recorded for recently used items.
+const (
+	ActionOpened = "opened"
+	ActionEdited = "edited"
+)
+
+// Item is a file or folder in a list. Folder paths end with a slash.
+type Item struct {
+	Source string `json:"source"`           // path of the source
+	Path   string `json:"path"`             // index path of the item
+	Time   int64  `json:"time"`             // when the item was added or last used
+	Action string `json:"action,omitempty"` // how a recent item was used
+}
+
+// List holds the favorites and recent items of a user.
+type List struct {
+	Username  string `json:"username" storm:"id"`
+	Favorites []Item `json:"favorites"`
+	Recents   []Item `json:"recents"`
+}
+
+func (l *List) clone() *List {
+	c := *l
+	c.Favorites = append([]Item{}, l.Favorites...)
+	c.Recents = append([]Item{}, l.Recents...)
+	return &c
+}
+
+// is reports whether the item is the given item.
+func (i Item) is(source, path string) bool {
+	return i.Source == source && strings.TrimSuffix(i.Path, "/") == strings.TrimSuffix(path, "/")
+}
+
+// below reports whether the item is the given item or, for folders,
+// anything inside it.
+func (i Item) below(source, path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	return i.Source == source && (strings.TrimSuffix(i.Path, "/") == path || strings.HasPrefix(i.Path, path+"/"))
+}
+
+// filter returns the items for which keep returns true.
+func filter(items []Item, keep func(Item) bool) []Item {
+	kept := items[:0]
+	for _, item := range items {
+		if keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
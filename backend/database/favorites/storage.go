@@ -0,0 +1,223 @@
+package favorites
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+)
+
+type StorageBackend interface {
+	All() ([]*List, error)
+	Get(username string) (*List, error)
+	Save(l *List) error
+	Delete(username string) error
+}
+
+// Storage is the favorites storage. Lists are cached in memory once read,
+// since the recent items of a user change on every file they open.
+type Storage struct {
+	back   StorageBackend
+	mu     sync.Mutex
+	lists  map[string]*List
+	loaded bool // whether lists holds the lists of all users
+}
+
+// NewStorage creates a favorites storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{
+		back:  back,
+		lists: map[string]*List{},
+	}
+}
+
+// list returns the list of a user, s.mu must be held.
+func (s *Storage) list(username string) (*List, error) {
+	if list, ok := s.lists[username]; ok {
+		return list, nil
+	}
+	list, err := s.back.Get(username)
+	if err == errors.ErrNotExist {
+		list, err = &List{Username: username}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.lists[username] = list
+	return list, nil
+}
+
+// all returns the lists of all users, s.mu must be held.
+func (s *Storage) all() (map[string]*List, error) {
+	if s.loaded {
+		return s.lists, nil
+	}
+	lists, err := s.back.All()
+	if err != nil && err != errors.ErrNotExist {
+		return nil, err
+	}
+	for _, list := range lists {
+		if _, ok := s.lists[list.Username]; !ok {
+			s.lists[list.Username] = list
+		}
+	}
+	s.loaded = true
+	return s.lists, nil
+}
+
+// save stores a changed list, s.mu must be held.
+func (s *Storage) save(list *List) error {
+	var err error
+	if len(list.Favorites) == 0 && len(list.Recents) == 0 {
+		err = s.back.Delete(list.Username)
+	} else {
+		err = s.back.Save(list)
+	}
+	if err != nil {
+		return err
+	}
+	s.lists[list.Username] = list
+	return nil
+}
+
+// update applies change to a copy of the list of a user and saves it if
+// change reports that it changed the list.
+func (s *Storage) update(username string, change func(*List) (bool, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.list(username)
+	if err != nil {
+		return err
+	}
+	list = list.clone()
+	changed, err := change(list)
+	if err != nil || !changed {
+		return err
+	}
+	return s.save(list)
+}
+
+// Get returns the favorites and recent items of a user, most recent first.
+func (s *Storage) Get(username string) (*List, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, err := s.list(username)
+	if err != nil {
+		return nil, err
+	}
+	return list.clone(), nil
+}
+
+// AddFavorite adds an item to the favorites of a user. Adding an item that
+// is already a favorite does nothing.
+func (s *Storage) AddFavorite(username, source, path string) error {
+	return s.update(username, func(list *List) (bool, error) {
+		for _, item := range list.Favorites {
+			if item.is(source, path) {
+				return false, nil
+			}
+		}
+		if len(list.Favorites) >= maxFavorites {
+			return false, errors.ErrFavoritesLimit
+		}
+		list.Favorites = append(list.Favorites, Item{Source: source, Path: path, Time: time.Now().Unix()})
+		return true, nil
+	})
+}
+
+// RemoveFavorite removes an item from the favorites of a user.
+func (s *Storage) RemoveFavorite(username, source, path string) error {
+	return s.update(username, func(list *List) (bool, error) {
+		count := len(list.Favorites)
+		list.Favorites = filter(list.Favorites, func(item Item) bool {
+			return !item.is(source, path)
+		})
+		return len(list.Favorites) != count, nil
+	})
+}
+
+// Touch records that a user opened or edited an item. The item moves to
+// the front of the recent items, the oldest item is dropped once there are
+// more than maxRecents.
+func (s *Storage) Touch(username, source, path, action string) error {
+	return s.update(username, func(list *List) (bool, error) {
+		recents := []Item{{Source: source, Path: path, Time: time.Now().Unix(), Action: action}}
+		for _, item := range list.Recents {
+			if !item.is(source, path) && len(recents) < maxRecents {
+				recents = append(recents, item)
+			}
+		}
+		list.Recents = recents
+		return true, nil
+	})
+}
+
+// Prune removes the items of a user for which keep returns false.
+func (s *Storage) Prune(username string, keep func(Item) bool) error {
+	return s.update(username, func(list *List) (bool, error) {
+		count := len(list.Favorites) + len(list.Recents)
+		list.Favorites = filter(list.Favorites, keep)
+		list.Recents = filter(list.Recents, keep)
+		return len(list.Favorites)+len(list.Recents) != count, nil
+	})
+}
+
+// forAll applies change to the items of all users and saves the lists that
+// changed.
+func (s *Storage) forAll(change func(Item) (Item, bool)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lists, err := s.all()
+	if err != nil {
+		return err
+	}
+	for _, list := range lists {
+		changed := false
+		apply := func(items []Item) []Item {
+			kept := make([]Item, 0, len(items))
+			for _, item := range items {
+				updated, keep := change(item)
+				if updated != item || !keep {
+					changed = true
+				}
+				if keep {
+					kept = append(kept, updated)
+				}
+			}
+			return kept
+		}
+		updated := list.clone()
+		updated.Favorites = apply(updated.Favorites)
+		updated.Recents = apply(updated.Recents)
+		if !changed {
+			continue
+		}
+		if err = s.save(updated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove drops a deleted file or folder, including all items inside the
+// folder, from the lists of all users.
+func (s *Storage) Remove(source, path string) error {
+	return s.forAll(func(item Item) (Item, bool) {
+		return item, !item.below(source, path)
+	})
+}
+
+// Move updates the lists of all users after a file or folder moved. The
+// new location may be on another source.
+func (s *Storage) Move(fromSource, from, toSource, to string) error {
+	from = strings.TrimSuffix(from, "/")
+	to = strings.TrimSuffix(to, "/")
+	return s.forAll(func(item Item) (Item, bool) {
+		if item.below(fromSource, from) {
+			item.Source = toSource
+			item.Path = to + item.Path[len(from):]
+		}
+		return item, true
+	})
+}
@@ -0,0 +1,72 @@
+package invitation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRevoked  = "revoked"
+	StatusExpired  = "expired"
+)
+
+// Invitation is an admin created, single use link that lets a new user
+// pick their own username and password. The user is created with the
+// scopes, permissions and groups preset on the invitation.
+type Invitation struct {
+	ID          string              `json:"id" storm:"id"` // sha256 of the token, the token itself is never stored
+	Scopes      []users.SourceScope `json:"scopes"`
+	Permissions users.Permissions   `json:"permissions"`
+	Groups      []string            `json:"groups"`
+	Note        string              `json:"note,omitempty"`
+	Expires     int64               `json:"expires"` // unix time, 0 never expires
+	CreatedAt   int64               `json:"createdAt"`
+	CreatedBy   string              `json:"createdBy"`
+	CreatedByID uint                `json:"createdByID"`
+	// audit of the invitation outcome
+	AcceptedAt     int64  `json:"acceptedAt,omitempty"`
+	AcceptedBy     string `json:"acceptedBy,omitempty"` // username chosen by the invitee
+	AcceptedUserID uint   `json:"acceptedUserID,omitempty"`
+	RevokedAt      int64  `json:"revokedAt,omitempty"`
+	RevokedBy      string `json:"revokedBy,omitempty"`
+}
+
+// CreateBody is the request body used by admins to create an invitation.
+type CreateBody struct {
+	Scopes      []users.SourceScope `json:"scopes"`
+	Permissions users.Permissions   `json:"permissions"`
+	Groups      []string            `json:"groups"`
+	Note        string              `json:"note"`
+	Expires     string              `json:"expires"`
+	Unit        string              `json:"unit"`
+}
+
+// Status returns the current state of the invitation.
+func (i *Invitation) Status() string {
+	switch {
+	case i.AcceptedAt != 0:
+		return StatusAccepted
+	case i.RevokedAt != 0:
+		return StatusRevoked
+	case i.IsExpired():
+		return StatusExpired
+	default:
+		return StatusPending
+	}
+}
+
+// IsExpired reports whether the invitation is past its expiry time.
+func (i *Invitation) IsExpired() bool {
+	return i.Expires != 0 && i.Expires <= time.Now().Unix()
+}
+
+// HashToken returns the id under which the invitation for a token is stored.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,144 @@
+package invitation
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/crud"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+type StorageBackend interface {
+	All() ([]*Invitation, error)
+	Get(id string) (*Invitation, error)
+	Save(i *Invitation) error
+	Delete(id string) error
+}
+
+type crudBackend struct {
+	back StorageBackend
+}
+
+func (c *crudBackend) GetByID(id any) (*Invitation, error) {
+	v, ok := id.(string)
+	if !ok {
+		return nil, errors.ErrInvalidDataType
+	}
+	return c.back.Get(v)
+}
+
+func (c *crudBackend) GetAll() ([]*Invitation, error) {
+	return c.back.All()
+}
+
+func (c *crudBackend) Save(obj *Invitation) error {
+	return c.back.Save(obj)
+}
+
+func (c *crudBackend) DeleteByID(id any) error {
+	v, ok := id.(string)
+	if !ok {
+		return errors.ErrInvalidDataType
+	}
+	return c.back.Delete(v)
+}
+
+// Storage is a invitation storage.
+type Storage struct {
+	Generic *crud.Storage[Invitation]
+	back    StorageBackend
+	// serializes accept and revoke so a token can only be used once
+	mu sync.Mutex
+}
+
+// NewStorage creates a invitation storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{
+		Generic: crud.NewStorage[Invitation](&crudBackend{back: back}),
+		back:    back,
+	}
+}
+
+// Create stores a new invitation and returns its token. The token is only
+// available at this point, the storage keeps a hash of it.
+func (s *Storage) Create(inv *Invitation) (string, error) {
+	tokenBuffer := make([]byte, 32)
+	if _, err := rand.Read(tokenBuffer); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBuffer)
+	inv.ID = HashToken(token)
+	inv.CreatedAt = time.Now().Unix()
+	if err := s.back.Save(inv); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// All returns all invitations, including accepted, revoked and expired
+// ones so they can serve as an audit log.
+func (s *Storage) All() ([]*Invitation, error) {
+	return s.back.All()
+}
+
+// Get returns an invitation by its id.
+func (s *Storage) Get(id string) (*Invitation, error) {
+	return s.back.Get(id)
+}
+
+// GetByToken returns the pending invitation matching a token. Accepted,
+// revoked or expired invitations return ErrInvitationInvalid.
+func (s *Storage) GetByToken(token string) (*Invitation, error) {
+	if token == "" {
+		return nil, errors.ErrInvitationInvalid
+	}
+	inv, err := s.back.Get(HashToken(token))
+	if err != nil {
+		if err == errors.ErrNotExist {
+			return nil, errors.ErrInvitationInvalid
+		}
+		return nil, err
+	}
+	if inv.Status() != StatusPending {
+		return nil, errors.ErrInvitationInvalid
+	}
+	return inv, nil
+}
+
+// Consume accepts the invitation for a token. The accept function creates
+// the user, the invitation is only marked as accepted if it succeeds.
+func (s *Storage) Consume(token string, accept func(inv *Invitation) (*users.User, error)) (*Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, err := s.GetByToken(token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := accept(inv)
+	if err != nil {
+		return nil, err
+	}
+	inv.AcceptedAt = time.Now().Unix()
+	inv.AcceptedBy = user.Username
+	inv.AcceptedUserID = user.ID
+	return inv, s.back.Save(inv)
+}
+
+// Revoke invalidates a pending invitation. The record is kept for auditing.
+func (s *Storage) Revoke(id, actor string) (*Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, err := s.back.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Status() == StatusAccepted || inv.Status() == StatusRevoked {
+		return nil, errors.ErrInvitationInvalid
+	}
+	inv.RevokedAt = time.Now().Unix()
+	inv.RevokedBy = actor
+	return inv, s.back.Save(inv)
+}
@@ -0,0 +1,32 @@
+// Package jobs stores the records of background jobs, so their state
+// survives the request that started them and a restart of the server.
+package jobs
+
+const (
+	StatusQueued   = "queued"
+	StatusRunning  = "running"
+	StatusDone     = "done"
+	StatusFailed   = "failed"
+	StatusCanceled = "canceled"
+)
+
+// Job is the record of a background job.
+type Job struct {
+	ID         string            `json:"id" storm:"id"`
+	Type       string            `json:"type"` // kind of work, eg. "archive"
+	Owner      string            `json:"owner" storm:"index"`
+	Status     string            `json:"status"`
+	Progress   float64           `json:"progress"` // 0 to 1
+	Message    string            `json:"message,omitempty"`
+	Params     map[string]string `json:"params,omitempty"` // input of the job, used to run it again after a restart
+	Result     string            `json:"result,omitempty"` // link to the result, if the job produces one
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  int64             `json:"createdAt"`
+	StartedAt  int64             `json:"startedAt,omitempty"`
+	FinishedAt int64             `json:"finishedAt,omitempty"`
+}
+
+// Finished reports whether the job is done, failed or canceled.
+func (j *Job) Finished() bool {
+	return j.Status == StatusDone || j.Status == StatusFailed || j.Status == StatusCanceled
+}
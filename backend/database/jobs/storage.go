@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"sort"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+)
+
+type StorageBackend interface {
+	All() ([]*Job, error)
+	Get(id string) (*Job, error)
+	Save(j *Job) error
+	Delete(id string) error
+}
+
+// Storage is the job record storage.
+type Storage struct {
+	back StorageBackend
+}
+
+// NewStorage creates a job storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{back: back}
+}
+
+// All returns all jobs, newest first.
+func (s *Storage) All() ([]*Job, error) {
+	list, err := s.back.All()
+	if err != nil && err != errors.ErrNotExist {
+		return nil, err
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt > list[j].CreatedAt
+	})
+	return list, nil
+}
+
+// Get returns a job by its id.
+func (s *Storage) Get(id string) (*Job, error) {
+	return s.back.Get(id)
+}
+
+// Save stores a job.
+func (s *Storage) Save(j *Job) error {
+	return s.back.Save(j)
+}
+
+// Delete removes a job.
+func (s *Storage) Delete(id string) error {
+	return s.back.Delete(id)
+}
@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	storm "github.com/asdine/storm/v3"
+	"github.com/gtsteffaniak/go-logger/logger"
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/SlepoyShaman/FileStorage/backend/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/sqlite"
+)
+
+const backupPrefix = "filebrowser-backup-"
+
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Backup flushes the in-memory share and access state and writes a
+// consistent snapshot of the database to w.
+func (s *Store) Backup(w io.Writer) (int64, error) {
+	if s.snapshot == nil {
+		return 0, fmt.Errorf("backups are not supported by the %v engine", s.Engine)
+	}
+	if err := s.Share.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to flush share storage: %w", err)
+	}
+	if err := s.Access.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to flush access storage: %w", err)
+	}
+	return s.snapshot.Snapshot(w)
+}
+
+// BackupFileName returns the file name used for a backup taken at t.
+func (s *Store) BackupFileName(t time.Time) string {
+	return backupFileName(s.Engine, t)
+}
+
+func backupFileName(engine string, t time.Time) string {
+	ext := ".db"
+	if engine == EngineSQLite {
+		ext = ".sqlite"
+	}
+	return backupPrefix + t.UTC().Format("20060102-150405") + ext
+}
+
+// BackupToFile writes a backup into dir and returns its path.
+func (s *Store) BackupToFile(dir string) (string, error) {
+	return writeBackupFile(dir, s.BackupFileName(time.Now()), s.Backup)
+}
+
+// writeBackupFile writes a backup named name into dir. The file is written
+// under a temporary name first so partial backups are never left behind.
+func writeBackupFile(dir, name string, backup func(w io.Writer) (int64, error)) (string, error) {
+	if err := os.MkdirAll(dir, fileutils.PermDir); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	tmp, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = backup(tmp); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err = tmp.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// ScheduleBackups writes a backup to the configured directory on every
+// interval and rotates old backups, until ctx is done.
+func ScheduleBackups(ctx context.Context, store *Store, config settings.Backup) {
+	if config.Directory == "" {
+		return
+	}
+	interval := time.Duration(config.IntervalHours) * time.Hour
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	keep := config.Keep
+	if keep <= 0 {
+		keep = 7
+	}
+	logger.Infof("scheduled database backups every %v into %v", interval, config.Directory)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path, err := store.BackupToFile(config.Directory)
+			if err != nil {
+				logger.Errorf("scheduled database backup failed: %v", err)
+				continue
+			}
+			logger.Infof("database backup written to %v", path)
+			if err = RotateBackups(config.Directory, keep); err != nil {
+				logger.Errorf("failed to rotate database backups: %v", err)
+			}
+		}
+	}
+}
+
+// RotateBackups deletes all but the newest keep backups in dir.
+func RotateBackups(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), backupPrefix) {
+			backups = append(backups, entry.Name())
+		}
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+	// names contain the timestamp, so they sort from oldest to newest
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-keep] {
+		if err = os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupEngine detects the database engine of a backup file.
+func backupEngine(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	header := make([]byte, len(sqliteHeader))
+	if _, err = io.ReadFull(f, header); err != nil {
+		return "", fmt.Errorf("backup %v is not a database file", path)
+	}
+	if bytes.Equal(header, sqliteHeader) {
+		return EngineSQLite, nil
+	}
+	return EngineBolt, nil
+}
+
+// backupVersion reads the schema version stored in a backup.
+func backupVersion(path, engine string) (int, error) {
+	var version int
+	if engine == EngineSQLite {
+		db, err := sqlite.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer db.Close()
+		return version, sqlite.Get(db, "version", &version)
+	}
+	db, err := storm.Open(path, storm.BoltOptions(0600, &bbolt.Options{Timeout: time.Second}))
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	return version, db.Get("config", "version", &version)
+}
+
+// RestoreDatabase replaces the database at dbPath with a backup. The
+// backup is validated on a copy first: it must use the same engine as
+// dbPath and a schema version this build can read, older backups are
+// migrated on the next start. The current database is kept next to it with
+// a .bak suffix and the time of the restore, so earlier ones are never
+// overwritten. The server must be stopped.
+func RestoreDatabase(backupPath, dbPath string) error {
+	engine, err := backupEngine(backupPath)
+	if err != nil {
+		return err
+	}
+	if engine != DatabaseEngine(dbPath) {
+		return fmt.Errorf("backup is a %v database but %v uses %v", engine, dbPath, DatabaseEngine(dbPath))
+	}
+	// opening a missing bolt database would create it, there is nothing to
+	// lock then
+	_, statErr := os.Stat(dbPath)
+	exists := statErr == nil
+	if exists && engine == EngineBolt {
+		// bolt locks the file, so this fails while the server is running
+		db, err := storm.Open(dbPath, storm.BoltOptions(0600, &bbolt.Options{Timeout: time.Second}))
+		if err != nil {
+			return fmt.Errorf("could not open %v, make sure the server is stopped: %w", dbPath, err)
+		}
+		db.Close()
+	} else if exists {
+		// the server keeps the database open, so this fails while it is running
+		db, err := sqlite.OpenExclusive(dbPath)
+		if err != nil {
+			return fmt.Errorf("could not lock %v, make sure the server is stopped: %w", dbPath, err)
+		}
+		db.Close()
+	}
+
+	// validate and swap a copy, opening the backup could modify it
+	tmp, err := os.CreateTemp(filepath.Dir(dbPath), ".restore-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	src, err := os.Open(backupPath)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	_, err = io.Copy(tmp, src)
+	src.Close()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	version, err := backupVersion(tmpPath, engine)
+	if err != nil {
+		return fmt.Errorf("could not read schema version of backup: %w", err)
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("backup has schema version %d, this build supports up to version %d", version, SchemaVersion)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(tmpPath + suffix)
+	}
+
+	if exists {
+		stamp := time.Now().UTC().Format("20060102-150405")
+		backupOfCurrent := dbPath + ".bak-" + stamp
+		for i := 2; ; i++ {
+			if _, err = os.Lstat(backupOfCurrent); err != nil {
+				break
+			}
+			backupOfCurrent = fmt.Sprintf("%v.bak-%v-%d", dbPath, stamp, i)
+		}
+		if err = os.Rename(dbPath, backupOfCurrent); err != nil {
+			return err
+		}
+		logger.Infof("previous database moved to %v", backupOfCurrent)
+	}
+	// a stale write ahead log would be replayed into the restored database
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(dbPath + suffix)
+	}
+	return os.Rename(tmpPath, dbPath)
+}
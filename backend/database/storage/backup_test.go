@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/sqlite"
+)
+
+func TestRotateBackups(t *testing.T) {
+	dir := t.TempDir()
+	store := &Store{Engine: EngineBolt}
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		name := store.BackupFileName(start.Add(time.Duration(i) * time.Hour))
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// unrelated files are never removed
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := RotateBackups(dir, 2); err != nil {
+		t.Fatalf("failed to rotate backups: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{
+		"filebrowser-backup-20250101-030000.db",
+		"filebrowser-backup-20250101-040000.db",
+		"notes.txt",
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, names)
+		}
+	}
+}
+
+func TestRestoreRejectsEngineMismatch(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "backup.sqlite")
+	if err := os.WriteFile(backup, append([]byte(nil), sqliteHeader...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreDatabase(backup, filepath.Join(dir, "database.db")); err == nil {
+		t.Error("expected sqlite backup to be rejected for a bolt database")
+	}
+}
+
+func TestRestoreRejectsDatabaseInUse(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "database.sqlite")
+	db, err := sqlite.Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sqlite.Save(db, "version", SchemaVersion); err != nil {
+		t.Fatal(err)
+	}
+	backup := filepath.Join(dir, "backup.sqlite")
+	if _, err = db.Exec(`VACUUM INTO ?`, backup); err != nil {
+		t.Fatal(err)
+	}
+	if err = RestoreDatabase(backup, dbPath); err == nil {
+		t.Error("expected restore to be refused while the database is open")
+	}
+	db.Close()
+	if err = RestoreDatabase(backup, dbPath); err != nil {
+		t.Errorf("expected restore to succeed once the database is closed: %v", err)
+	}
+}
+
+func TestRestoreKeepsEveryPreviousDatabase(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "database.sqlite")
+	backup := filepath.Join(dir, "backup.sqlite")
+	for i, path := range []string{dbPath, backup} {
+		db, err := sqlite.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sqlite.Save(db, "version", SchemaVersion); err == nil {
+			err = sqlite.Save(db, "origin", i)
+		}
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := RestoreDatabase(backup, dbPath); err != nil {
+			t.Fatalf("restore %d failed: %v", i, err)
+		}
+	}
+	previous, _ := filepath.Glob(dbPath + ".bak-*")
+	if len(previous) != 2 {
+		t.Fatalf("expected both replaced databases to be kept, got %v", previous)
+	}
+	// the database from before the first restore is still there
+	found := false
+	for _, path := range previous {
+		db, err := sqlite.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var origin int
+		if sqlite.Get(db, "origin", &origin) == nil && origin == 0 {
+			found = true
+		}
+		db.Close()
+	}
+	if !found {
+		t.Errorf("expected the original database in %v", previous)
+	}
+}
+
+func TestRestoreBoltToMissingDatabase(t *testing.T) {
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "backup.db")
+	db, err := storm.Open(backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Set("config", "version", SchemaVersion)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := filepath.Join(dir, "database.db")
+	if err = RestoreDatabase(backup, dbPath); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	if previous, _ := filepath.Glob(dbPath + ".bak*"); len(previous) != 0 {
+		t.Errorf("expected no previous database to be kept, got %v", previous)
+	}
+	if version, err := backupVersion(dbPath, EngineBolt); err != nil || version != SchemaVersion {
+		t.Errorf("expected the restored database, got version %d %v", version, err)
+	}
+}
@@ -0,0 +1,28 @@
+package bolt
+
+import (
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/access"
+)
+
+const accessRulesKey = "rules"
+
+type accessBackend struct {
+	db *storm.DB
+}
+
+// NewAccessBackend returns a access.RulesBackend backed by storm DB.
+func NewAccessBackend(db *storm.DB) access.RulesBackend {
+	return accessBackend{db: db}
+}
+
+func (s accessBackend) GetRules() ([]byte, error) {
+	var data []byte
+	err := GetAccessRules(s.db, accessRulesKey, &data)
+	return data, err
+}
+
+func (s accessBackend) SaveRules(data []byte) error {
+	return SaveAccessRules(s.db, accessRulesKey, data)
+}
@@ -0,0 +1,30 @@
+package bolt
+
+import (
+	"io"
+
+	storm "github.com/asdine/storm/v3"
+	bbolt "go.etcd.io/bbolt"
+)
+
+// Snapshotter writes consistent copies of the database while it is in use.
+type Snapshotter struct {
+	db *storm.DB
+}
+
+// NewSnapshotter creates a Snapshotter for a storm DB.
+func NewSnapshotter(db *storm.DB) *Snapshotter {
+	return &Snapshotter{db: db}
+}
+
+// Snapshot writes a consistent copy of the database from a read
+// transaction, so the server keeps running while it is written.
+func (s *Snapshotter) Snapshot(w io.Writer) (int64, error) {
+	var n int64
+	err := s.db.Bolt.View(func(tx *bbolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
@@ -5,33 +5,26 @@ import (
 
 	"github.com/SlepoyShaman/FileStorage/backend/auth"
 	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
-	"github.com/SlepoyShaman/FileStorage/backend/database/access"
+	"github.com/SlepoyShaman/FileStorage/backend/database/invitation"
 	"github.com/SlepoyShaman/FileStorage/backend/database/share"
-	"github.com/SlepoyShaman/FileStorage/backend/database/users"
 )
 
-// Storage is a storage powered by a Backend which makes the necessary
-// verifications when fetching and saving data to ensure consistency.
-type BoltStore struct {
-	Users    *users.Storage
-	Share    *share.Storage
-	Auth     *auth.Storage
-	Settings *settings.Storage
-	Access   *access.Storage
+// NewShareBackend returns a share.StorageBackend backed by storm DB.
+func NewShareBackend(db *storm.DB) share.StorageBackend {
+	return shareBackend{db: db}
 }
 
-// NewStorage creates a storage.Storage based on Bolt DB.
-func NewStorage(db *storm.DB) (*BoltStore, error) {
-	userStore := users.NewStorage(usersBackend{db: db})
-	authStore, err := auth.NewStorage(authBackend{db: db}, userStore)
-	if err != nil {
-		return nil, err
-	}
-	return &BoltStore{
-		Users:    userStore,
-		Share:    share.NewStorage(shareBackend{db: db}, userStore),
-		Auth:     authStore,
-		Settings: settings.NewStorage(settingsBackend{db: db}),
-		Access:   access.NewStorage(db, userStore),
-	}, nil
+// NewAuthBackend returns a auth.StorageBackend backed by storm DB.
+func NewAuthBackend(db *storm.DB) auth.StorageBackend {
+	return authBackend{db: db}
+}
+
+// NewSettingsBackend returns a settings.StorageBackend backed by storm DB.
+func NewSettingsBackend(db *storm.DB) settings.StorageBackend {
+	return settingsBackend{db: db}
+}
+
+// NewInvitationBackend returns a invitation.StorageBackend backed by storm DB.
+func NewInvitationBackend(db *storm.DB) invitation.StorageBackend {
+	return invitationBackend{db: db}
 }
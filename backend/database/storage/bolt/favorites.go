@@ -0,0 +1,47 @@
+package bolt
+
+import (
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/favorites"
+)
+
+type favoritesBackend struct {
+	db *storm.DB
+}
+
+// NewFavoritesBackend returns a favorites.StorageBackend backed by storm DB.
+func NewFavoritesBackend(db *storm.DB) favorites.StorageBackend {
+	return favoritesBackend{db: db}
+}
+
+func (s favoritesBackend) All() ([]*favorites.List, error) {
+	var v []*favorites.List
+	err := s.db.All(&v)
+	if err == storm.ErrNotFound {
+		return v, errors.ErrNotExist
+	}
+	return v, err
+}
+
+func (s favoritesBackend) Get(username string) (*favorites.List, error) {
+	var v favorites.List
+	err := s.db.One("Username", username, &v)
+	if err == storm.ErrNotFound {
+		return nil, errors.ErrNotExist
+	}
+	return &v, err
+}
+
+func (s favoritesBackend) Save(l *favorites.List) error {
+	return s.db.Save(l)
+}
+
+func (s favoritesBackend) Delete(username string) error {
+	err := s.db.DeleteStruct(&favorites.List{Username: username})
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package bolt
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/favorites"
+)
+
+// recentsLimit is the number of recents the favorites storage keeps.
+const recentsLimit = 50
+
+func favoritePaths(items []favorites.Item) []string {
+	var v []string
+	for _, item := range items {
+		v = append(v, item.Path)
+	}
+	return v
+}
+
+func TestFavoritesIgnoreDuplicates(t *testing.T) {
+	s := favorites.NewStorage(NewFavoritesBackend(createTestDB(t)))
+	_ = s.AddFavorite("alice", "/src", "/docs/")
+	_ = s.AddFavorite("alice", "/src", "/docs")
+	list, err := s.Get("alice")
+	if err != nil {
+		t.Fatalf("failed to get list: %v", err)
+	}
+	if len(list.Favorites) != 1 {
+		t.Errorf("expected 1 favorite, got %v", favoritePaths(list.Favorites))
+	}
+	if err = s.RemoveFavorite("alice", "/src", "/docs"); err != nil {
+		t.Fatalf("failed to remove favorite: %v", err)
+	}
+	list, _ = s.Get("alice")
+	if len(list.Favorites) != 0 {
+		t.Errorf("expected no favorites, got %v", favoritePaths(list.Favorites))
+	}
+}
+
+func TestFavoritesTouchOrdersAndLimitsRecents(t *testing.T) {
+	s := favorites.NewStorage(NewFavoritesBackend(createTestDB(t)))
+	for i := 0; i < recentsLimit+5; i++ {
+		_ = s.Touch("alice", "/src", fmt.Sprintf("/file%d", i), favorites.ActionOpened)
+	}
+	_ = s.Touch("alice", "/src", "/file0", favorites.ActionEdited)
+	list, _ := s.Get("alice")
+	if len(list.Recents) != recentsLimit {
+		t.Fatalf("expected %d recents, got %d", recentsLimit, len(list.Recents))
+	}
+	if list.Recents[0].Path != "/file0" || list.Recents[0].Action != favorites.ActionEdited {
+		t.Errorf("expected last touched file first, got %+v", list.Recents[0])
+	}
+	for _, item := range list.Recents[1:] {
+		if item.Path == "/file0" {
+			t.Errorf("expected touched file only once")
+		}
+	}
+}
+
+func TestFavoritesMoveAndRemoveUpdateAllUsers(t *testing.T) {
+	back := NewFavoritesBackend(createTestDB(t))
+	s := favorites.NewStorage(back)
+	_ = s.AddFavorite("alice", "/src", "/docs/")
+	_ = s.Touch("alice", "/src", "/docs/a.txt", favorites.ActionOpened)
+	_ = s.AddFavorite("bob", "/src", "/docs/sub/")
+	_ = s.AddFavorite("bob", "/src", "/docsother/")
+
+	// a fresh storage has to find the lists of all users in the backend
+	s = favorites.NewStorage(back)
+	if err := s.Move("/src", "/docs/", "/other", "/archive/"); err != nil {
+		t.Fatalf("failed to move: %v", err)
+	}
+	alice, _ := s.Get("alice")
+	if got := favoritePaths(alice.Favorites); len(got) != 1 || got[0] != "/archive/" || alice.Favorites[0].Source != "/other" {
+		t.Errorf("unexpected favorites of alice: %+v", alice.Favorites)
+	}
+	if got := favoritePaths(alice.Recents); len(got) != 1 || got[0] != "/archive/a.txt" {
+		t.Errorf("unexpected recents of alice: %v", got)
+	}
+	bob, _ := s.Get("bob")
+	if got := favoritePaths(bob.Favorites); len(got) != 2 || got[0] != "/archive/sub/" || got[1] != "/docsother/" {
+		t.Errorf("unexpected favorites of bob: %v", got)
+	}
+
+	if err := s.Remove("/other", "/archive"); err != nil {
+		t.Fatalf("failed to remove: %v", err)
+	}
+	if _, err := back.Get("alice"); err != errors.ErrNotExist {
+		t.Errorf("expected empty list of alice to be deleted")
+	}
+	bob, _ = s.Get("bob")
+	if got := favoritePaths(bob.Favorites); len(got) != 1 || got[0] != "/docsother/" {
+		t.Errorf("unexpected favorites of bob after remove: %v", got)
+	}
+}
+
+func TestFavoritesPrune(t *testing.T) {
+	s := favorites.NewStorage(NewFavoritesBackend(createTestDB(t)))
+	_ = s.AddFavorite("alice", "/src", "/a")
+	_ = s.AddFavorite("alice", "/src", "/b")
+	_ = s.Touch("alice", "/src", "/a", favorites.ActionOpened)
+	err := s.Prune("alice", func(item favorites.Item) bool { return item.Path != "/a" })
+	if err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	list, _ := s.Get("alice")
+	if got := favoritePaths(list.Favorites); len(got) != 1 || got[0] != "/b" || len(list.Recents) != 0 {
+		t.Errorf("unexpected list after prune: %+v", list)
+	}
+}
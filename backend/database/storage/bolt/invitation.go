@@ -0,0 +1,44 @@
+package bolt
+
+import (
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/invitation"
+)
+
+type invitationBackend struct {
+	db *storm.DB
+}
+
+func (s invitationBackend) All() ([]*invitation.Invitation, error) {
+	var v []*invitation.Invitation
+	err := s.db.All(&v)
+	if err == storm.ErrNotFound {
+		return v, errors.ErrNotExist
+	}
+
+	return v, err
+}
+
+func (s invitationBackend) Get(id string) (*invitation.Invitation, error) {
+	var v invitation.Invitation
+	err := s.db.One("ID", id, &v)
+	if err == storm.ErrNotFound {
+		return nil, errors.ErrNotExist
+	}
+
+	return &v, err
+}
+
+func (s invitationBackend) Save(i *invitation.Invitation) error {
+	return s.db.Save(i)
+}
+
+func (s invitationBackend) Delete(id string) error {
+	err := s.db.DeleteStruct(&invitation.Invitation{ID: id})
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package bolt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/invitation"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+func acceptAs(username string, id uint) func(*invitation.Invitation) (*users.User, error) {
+	return func(*invitation.Invitation) (*users.User, error) {
+		return &users.User{ID: id, Username: username}, nil
+	}
+}
+
+func TestInvitationConsumeIsSingleUse(t *testing.T) {
+	s := invitation.NewStorage(NewInvitationBackend(createTestDB(t)))
+	token, err := s.Create(&invitation.Invitation{CreatedBy: "admin"})
+	if err != nil {
+		t.Fatalf("failed to create invitation: %v", err)
+	}
+	inv, err := s.Consume(token, acceptAs("alice", 2))
+	if err != nil {
+		t.Fatalf("expected invitation to be accepted: %v", err)
+	}
+	if inv.Status() != invitation.StatusAccepted || inv.AcceptedBy != "alice" || inv.AcceptedUserID != 2 {
+		t.Errorf("unexpected accepted invitation: %+v", inv)
+	}
+	if _, err = s.Consume(token, acceptAs("bob", 3)); err != errors.ErrInvitationInvalid {
+		t.Errorf("expected second use to fail with ErrInvitationInvalid, got %v", err)
+	}
+}
+
+func TestInvitationConsumeFailureKeepsInvitation(t *testing.T) {
+	s := invitation.NewStorage(NewInvitationBackend(createTestDB(t)))
+	token, _ := s.Create(&invitation.Invitation{})
+	_, err := s.Consume(token, func(*invitation.Invitation) (*users.User, error) {
+		return nil, fmt.Errorf("username taken")
+	})
+	if err == nil {
+		t.Fatal("expected accept error to be returned")
+	}
+	if _, err = s.GetByToken(token); err != nil {
+		t.Errorf("expected invitation to still be pending: %v", err)
+	}
+}
+
+func TestInvitationRevokeAndExpiry(t *testing.T) {
+	s := invitation.NewStorage(NewInvitationBackend(createTestDB(t)))
+	token, _ := s.Create(&invitation.Invitation{})
+	inv, err := s.Revoke(invitation.HashToken(token), "admin")
+	if err != nil {
+		t.Fatalf("failed to revoke invitation: %v", err)
+	}
+	if inv.Status() != invitation.StatusRevoked || inv.RevokedBy != "admin" {
+		t.Errorf("unexpected revoked invitation: %+v", inv)
+	}
+	if _, err = s.Consume(token, acceptAs("alice", 2)); err != errors.ErrInvitationInvalid {
+		t.Errorf("expected revoked invitation to be rejected, got %v", err)
+	}
+
+	expired, _ := s.Create(&invitation.Invitation{Expires: time.Now().Add(-time.Minute).Unix()})
+	if _, err = s.GetByToken(expired); err != errors.ErrInvitationInvalid {
+		t.Errorf("expected expired invitation to be rejected, got %v", err)
+	}
+	if _, err = s.GetByToken("unknown"); err != errors.ErrInvitationInvalid {
+		t.Errorf("expected unknown token to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package bolt
+
+import (
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/jobs"
+)
+
+type jobsBackend struct {
+	db *storm.DB
+}
+
+// NewJobsBackend returns a jobs.StorageBackend backed by storm DB.
+func NewJobsBackend(db *storm.DB) jobs.StorageBackend {
+	return jobsBackend{db: db}
+}
+
+func (s jobsBackend) All() ([]*jobs.Job, error) {
+	var v []*jobs.Job
+	err := s.db.All(&v)
+	if err == storm.ErrNotFound {
+		return v, errors.ErrNotExist
+	}
+	return v, err
+}
+
+func (s jobsBackend) Get(id string) (*jobs.Job, error) {
+	var v jobs.Job
+	err := s.db.One("ID", id, &v)
+	if err == storm.ErrNotFound {
+		return nil, errors.ErrNotExist
+	}
+	return &v, err
+}
+
+func (s jobsBackend) Save(j *jobs.Job) error {
+	return s.db.Save(j)
+}
+
+func (s jobsBackend) Delete(id string) error {
+	err := s.db.DeleteStruct(&jobs.Job{ID: id})
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package bolt
+
+import (
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/share"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+// Records gives schema migrations raw access to the stored records,
+// without the validation done by the regular backends.
+type Records struct {
+	db *storm.DB
+}
+
+// NewRecords creates Records for a storm DB.
+func NewRecords(db *storm.DB) *Records {
+	return &Records{db: db}
+}
+
+func (r *Records) Users() ([]*users.User, error) {
+	var v []*users.User
+	err := r.db.All(&v)
+	if err == storm.ErrNotFound {
+		return nil, nil
+	}
+	return v, err
+}
+
+func (r *Records) PutUser(user *users.User) error {
+	return r.db.Save(user)
+}
+
+func (r *Records) Shares() ([]*share.Link, error) {
+	var v []*share.Link
+	err := r.db.All(&v)
+	if err == storm.ErrNotFound {
+		return nil, nil
+	}
+	return v, err
+}
+
+func (r *Records) PutShare(link *share.Link) error {
+	return r.db.Save(link)
+}
+
+// Version returns the stored schema version, or errors.ErrNotExist if the
+// database has none.
+func (r *Records) Version() (int, error) {
+	var version int
+	return version, get(r.db, "version", &version)
+}
+
+func (r *Records) SetVersion(version int) error {
+	return Save(r.db, "version", version)
+}
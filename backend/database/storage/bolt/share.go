@@ -45,6 +45,14 @@ func (s shareBackend) GetByHash(hash string) (*share.Link, error) {
 	return &v, err
 }
 
+func (s shareBackend) GetCommonShareByHash(hash string) (*share.CommonShare, error) {
+	link, err := s.GetByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &link.CommonShare, nil
+}
+
 func (s shareBackend) GetPermanent(path, source string, id uint) (*share.Link, error) {
 	var v share.Link
 	// TODO remove legacy and return notfound errors
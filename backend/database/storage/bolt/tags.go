@@ -0,0 +1,47 @@
+package bolt
+
+import (
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/tags"
+)
+
+type tagsBackend struct {
+	db *storm.DB
+}
+
+// NewTagsBackend returns a tags.StorageBackend backed by storm DB.
+func NewTagsBackend(db *storm.DB) tags.StorageBackend {
+	return tagsBackend{db: db}
+}
+
+func (s tagsBackend) All() ([]*tags.Entry, error) {
+	var v []*tags.Entry
+	err := s.db.All(&v)
+	if err == storm.ErrNotFound {
+		return v, errors.ErrNotExist
+	}
+	return v, err
+}
+
+func (s tagsBackend) BySource(source string) ([]*tags.Entry, error) {
+	var v []*tags.Entry
+	err := s.db.Find("Source", source, &v)
+	if err == storm.ErrNotFound {
+		return v, errors.ErrNotExist
+	}
+	return v, err
+}
+
+func (s tagsBackend) Save(e *tags.Entry) error {
+	return s.db.Save(e)
+}
+
+func (s tagsBackend) Delete(id string) error {
+	err := s.db.DeleteStruct(&tags.Entry{ID: id})
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package bolt
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/tags"
+)
+
+func TestTagsUpdateNormalizesTags(t *testing.T) {
+	s := tags.NewStorage(NewTagsBackend(createTestDB(t)))
+	entries, err := s.Update("/src", []string{"/a.txt"}, tags.Change{AddTags: []string{"Approved ", "draft", "approved"}}, "alice")
+	if err != nil {
+		t.Fatalf("failed to update tags: %v", err)
+	}
+	if want := []string{"approved", "draft"}; !reflect.DeepEqual(entries[0].Tags, want) {
+		t.Errorf("expected tags %v, got %v", want, entries[0].Tags)
+	}
+	if entries[0].UpdatedBy != "alice" {
+		t.Errorf("expected updatedBy alice, got %q", entries[0].UpdatedBy)
+	}
+	for _, tag := range []string{"", "a,b", "x\ny"} {
+		if _, err = s.Update("/src", []string{"/a.txt"}, tags.Change{AddTags: []string{tag}}, "alice"); err == nil {
+			t.Errorf("expected tag %q to be rejected", tag)
+		}
+	}
+}
+
+func TestTagsUpdateRemovesEmptyEntries(t *testing.T) {
+	back := NewTagsBackend(createTestDB(t))
+	s := tags.NewStorage(back)
+	_, _ = s.Update("/src", []string{"/a.txt"}, tags.Change{AddTags: []string{"x"}, Metadata: map[string]string{"owner": "bob"}}, "alice")
+	if _, err := s.Update("/src", []string{"/a.txt"}, tags.Change{RemoveTags: []string{"x"}, RemoveMetadata: []string{"owner"}}, "alice"); err != nil {
+		t.Fatalf("failed to update tags: %v", err)
+	}
+	if _, err := s.Get("/src", "/a.txt"); err != errors.ErrNotExist {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	if stored, _ := back.All(); len(stored) != 0 {
+		t.Errorf("expected backend to be empty, got %d entries", len(stored))
+	}
+}
+
+func TestTagsMoveFolderMovesNestedEntries(t *testing.T) {
+	back := NewTagsBackend(createTestDB(t))
+	s := tags.NewStorage(back)
+	change := tags.Change{AddTags: []string{"x"}}
+	_, _ = s.Update("/src", []string{"/docs/", "/docs/a.txt", "/docs/sub/b.txt", "/docsother.txt"}, change, "alice")
+	if err := s.Move("/src", "/docs/", "/src", "/archive/docs/"); err != nil {
+		t.Fatalf("failed to move tags: %v", err)
+	}
+	found, _ := s.Find("/src", "/", []string{"x"})
+	var paths []string
+	for _, e := range found {
+		paths = append(paths, e.Path)
+	}
+	want := []string{"/archive/docs/", "/archive/docs/a.txt", "/archive/docs/sub/b.txt", "/docsother.txt"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected paths %v, got %v", want, paths)
+	}
+	if stored, _ := back.All(); len(stored) != len(want) {
+		t.Errorf("expected %d stored entries, got %d", len(want), len(stored))
+	}
+
+	// a fresh storage sees the moved entries
+	fresh := tags.NewStorage(back)
+	if _, err := fresh.Get("/src", "/archive/docs/sub/b.txt"); err != nil {
+		t.Errorf("expected moved entry to be persisted: %v", err)
+	}
+}
+
+func TestTagsRemoveAndChildren(t *testing.T) {
+	s := tags.NewStorage(NewTagsBackend(createTestDB(t)))
+	_, _ = s.Update("/src", []string{"/docs/", "/docs/a.txt", "/docs/sub/", "/docs/sub/b.txt"}, tags.Change{AddTags: []string{"x"}}, "alice")
+	children, err := s.Children("/src", "/docs/")
+	if err != nil {
+		t.Fatalf("failed to get children: %v", err)
+	}
+	if len(children) != 2 || children["a.txt"] == nil || children["sub"] == nil {
+		t.Errorf("unexpected children: %v", children)
+	}
+	if err = s.Remove("/src", "/docs/sub/"); err != nil {
+		t.Fatalf("failed to remove tags: %v", err)
+	}
+	found, _ := s.Find("/src", "/", nil)
+	if len(found) != 2 {
+		t.Errorf("expected 2 entries left, got %d", len(found))
+	}
+}
@@ -2,21 +2,18 @@ package bolt
 
 import (
 	"fmt"
-	"reflect"
-	"slices"
-	"strings"
 
 	storm "github.com/asdine/storm/v3"
-	"github.com/gtsteffaniak/go-logger/logger"
 
-	"github.com/SlepoyShaman/FileStorage/backend/adapters/fs/files"
-	"github.com/SlepoyShaman/FileStorage/backend/auth"
 	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
-	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
-	"github.com/SlepoyShaman/FileStorage/backend/common/utils"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/userfields"
 	"github.com/SlepoyShaman/FileStorage/backend/database/users"
 )
 
+// passwordHistoryBucket holds the previous password hashes of users by id,
+// apart from the users so they never end up in serialized users.
+const passwordHistoryBucket = "password_history"
+
 type usersBackend struct {
 	db *storm.DB
 }
@@ -53,7 +50,10 @@ func (st usersBackend) GetBy(i interface{}) (user *users.User, err error) {
 		}
 		return nil, err
 	}
-
+	user.PasswordHistory, err = getPasswordHistory(st.db, user.ID)
+	if err != nil {
+		return nil, err
+	}
 	return
 }
 
@@ -66,6 +66,11 @@ func (st usersBackend) Gets() ([]*users.User, error) {
 	if err != nil {
 		return allUsers, err
 	}
+	for _, user := range allUsers {
+		if user.PasswordHistory, err = getPasswordHistory(st.db, user.ID); err != nil {
+			return nil, err
+		}
+	}
 	return allUsers, err
 }
 
@@ -74,122 +79,66 @@ func (st usersBackend) Update(user *users.User, actorIsAdmin bool, fields ...str
 	if err != nil {
 		return err
 	}
-	passwordUser := existingUser.LoginMethod == users.LoginMethodPassword
-	enforcedOtp := settings.Config.Auth.Methods.PasswordAuth.EnforcedOtp
-	if passwordUser && enforcedOtp && !user.OtpEnabled {
-		return errors.ErrNoTotpConfigured
-	}
-	fields, err = parseFields(user, fields, actorIsAdmin)
+	fields, err = userfields.PrepareUpdate(user, existingUser, actorIsAdmin, fields)
 	if err != nil {
 		return err
 	}
-
-	if !slices.Contains(fields, "Password") {
-		user.Password = existingUser.Password
-	} else {
-		if existingUser.LockPassword && !actorIsAdmin {
-			return fmt.Errorf("password cannot be changed when lock password is enabled")
-		}
-	}
-
-	if !actorIsAdmin {
-		fields = filterRestrictedFields(fields)
-	}
-
-	if len(fields) == 0 {
-		return fmt.Errorf("no fields to update")
+	// the password and its history are changed together or not at all
+	tx, err := st.db.Begin(true)
+	if err != nil {
+		return err
 	}
-
-	// converting scopes to map of paths intead of names (names can change)
-	if slices.Contains(fields, "Scopes") {
-		adjustedScopes, err := settings.ConvertToBackendScopes(user.Scopes)
-		if err != nil {
-			return err
+	defer tx.Rollback() //nolint:errcheck
+	for _, field := range fields {
+		if field == "PasswordHistory" {
+			if err := setPasswordHistory(tx, user.ID, user.PasswordHistory); err != nil {
+				return fmt.Errorf("failed to update user field: %s, error: %v", field, err)
+			}
+			continue
 		}
-		user.Scopes = adjustedScopes
-		err = files.MakeUserDirs(user, true)
+		name, val, err := userfields.FieldValue(user, field)
 		if err != nil {
 			return err
 		}
-	}
-	// Use reflection to access struct fields
-	userFields := reflect.ValueOf(user).Elem() // Get struct value
-	for _, field := range fields {
-		// Get the corresponding field using reflection
-		fieldValue := userFields.FieldByName(field)
-		if !fieldValue.IsValid() {
-			return fmt.Errorf("invalid field: %s", field)
-		}
-
-		// Ensure the field is settable
-		if !fieldValue.CanSet() {
-			return fmt.Errorf("cannot set value of field: %s", field)
-		}
-
-		// Get the value to be stored
-		val := fieldValue.Interface()
-		if field == "OtpEnabled" {
-			otpEnabled, _ := val.(bool)
-			if !otpEnabled {
-				field = "TOTPSecret" // if otp is disabled, we also want to clear the TOTPSecret
-				val = ""             // clear the TOTPSecret
-			}
-			// If otpEnabled is true, continue with normal field update
-		}
 		// Update the database
-		if err := st.db.UpdateField(existingUser, field, val); err != nil {
-			return fmt.Errorf("failed to update user field: %s, error: %v", field, err)
+		if err := tx.UpdateField(existingUser, name, val); err != nil {
+			return fmt.Errorf("failed to update user field: %s, error: %v", name, err)
 		}
 	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
 
 	// last revoke api keys if needed.
-	if existingUser.Permissions.Api && !user.Permissions.Api && slices.Contains(fields, "Permissions") {
-		for _, key := range existingUser.ApiKeys {
-			auth.RevokeAPIKey(key.Key) // add to blacklist
-		}
-	}
+	userfields.RevokeRemovedApiKeys(user, existingUser, fields)
 	return nil
 }
 
 func (st usersBackend) Save(user *users.User, changePass, disableScopeChange bool) error {
-	if user.LoginMethod == "" {
-		user.LoginMethod = users.LoginMethodPassword
-	}
-	if user.Username == "anonymous" {
-		return fmt.Errorf("username cannot be 'anonymous'")
-	}
-	logger.Debugf("Saving user [%s] changepass: %v", user.Username, changePass)
-	if user.LoginMethod == users.LoginMethodPassword && changePass {
-		err := checkPassword(user.Password)
-		if err != nil {
-			return err
-		}
-		pass, err := users.HashPwd(user.Password)
-		if err != nil {
-			return err
-		}
-		user.Password = pass
-	}
-
-	// converting scopes to map of paths intead of names (names can change)
-	adjustedScopes, err := settings.ConvertToBackendScopes(user.Scopes)
+	err := userfields.PrepareSave(user, changePass, disableScopeChange)
 	if err != nil {
 		return err
 	}
-	user.Scopes = adjustedScopes
-	err = files.MakeUserDirs(user, disableScopeChange)
+	tx, err := st.db.Begin(true)
 	if err != nil {
-		logger.Error(err.Error())
+		return err
 	}
-	err = st.db.Save(user)
+	defer tx.Rollback() //nolint:errcheck
+	err = tx.Save(user)
 	if err == storm.ErrAlreadyExists {
 		return fmt.Errorf("user with provided username already exists")
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	if err = setPasswordHistory(tx, user.ID, user.PasswordHistory); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (st usersBackend) DeleteByID(id uint) error {
-	return st.db.DeleteStruct(&users.User{ID: id})
+	return st.delete(&users.User{ID: id})
 }
 
 func (st usersBackend) DeleteByUsername(username string) error {
@@ -198,109 +147,58 @@ func (st usersBackend) DeleteByUsername(username string) error {
 		return err
 	}
 
-	return st.db.DeleteStruct(user)
+	return st.delete(user)
 }
 
-// Define a function to filter out restricted fields for non-admin users
-func filterRestrictedFields(fields []string) []string {
-	// Get a list of allowed fields from NonAdminEditable
-	allowed := getNonAdminEditableFieldNames()
-	var filteredFields []string
-
-	for _, field := range fields {
-		if slices.Contains(allowed, field) {
-			filteredFields = append(filteredFields, field)
-		}
+// delete removes a user along with its password history.
+func (st usersBackend) delete(user *users.User) error {
+	tx, err := st.db.Begin(true)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback() //nolint:errcheck
+	if err = tx.DeleteStruct(user); err != nil {
+		return err
+	}
+	if err = setPasswordHistory(tx, user.ID, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-	return filteredFields
+// SetPasswordHash stores an already hashed password without running the
+// password policy, used to upgrade hashes transparently on login.
+func (st usersBackend) SetPasswordHash(id uint, hash string) error {
+	return st.db.UpdateField(&users.User{ID: id}, "Password", hash)
 }
 
-// Helper to return list of field names from NonAdminEditable struct
-func getNonAdminEditableFieldNames() []string {
-	var names []string
-	t := reflect.TypeOf(users.NonAdminEditable{})
-	for i := 0; i < t.NumField(); i++ {
-		names = append(names, t.Field(i).Name)
+// SetLoginAttempts stores the failed login counter and lockout time of a user.
+func (st usersBackend) SetLoginAttempts(id uint, failedAttempts int, lockedUntil int64) error {
+	user := &users.User{ID: id}
+	if err := st.db.UpdateField(user, "FailedLoginAttempts", failedAttempts); err != nil {
+		return err
 	}
-	return names
+	return st.db.UpdateField(user, "LockedUntil", lockedUntil)
 }
 
-func parseFields(user *users.User, fields []string, actorIsAdmin bool) ([]string, error) {
-	// If `Which` is not specified, default to updating all fields
-	if len(fields) == 0 || fields[0] == "all" {
-		fields = []string{}
-		v := reflect.ValueOf(user)
-		if v.Kind() == reflect.Ptr {
-			v = v.Elem()
-		}
-		t := v.Type()
-
-		// Dynamically populate fields to update
-		for i := 0; i < t.NumField(); i++ {
-			field := t.Field(i)
-			// which=all can't update password
-			switch strings.ToLower(field.Name) {
-			case "id", "username", "password", "apikeys", "totpsecret", "totpnonce":
-				// Skip these fields
-				continue
-			}
-
-			// Handle embedded structs (like NonAdminEditable)
-			if field.Anonymous {
-				// Get the embedded struct type
-				embeddedType := field.Type
-				if embeddedType.Kind() == reflect.Ptr {
-					embeddedType = embeddedType.Elem()
-				}
-
-				// Add all fields from the embedded struct
-				for j := 0; j < embeddedType.NumField(); j++ {
-					embeddedField := embeddedType.Field(j)
-					fields = append(fields, embeddedField.Name)
-				}
-			} else {
-				fields = append(fields, field.Name)
-			}
-		}
-	}
-	newfields := []string{}
-	for _, field := range fields {
-		capitalField := utils.CapitalizeFirst(field)
-		if capitalField == "Scopes" {
-			if !actorIsAdmin {
-				continue
-			}
-		}
-		if capitalField == "Password" {
-			// Only process password if it's actually being updated (not empty)
-			if user.Password != "" {
-				if user.LoginMethod != users.LoginMethodPassword {
-					return nil, fmt.Errorf("password cannot be changed when login method is not password")
-				}
-				err := checkPassword(user.Password)
-				if err != nil {
-					return nil, fmt.Errorf("password does not meet complexity requirements")
-				}
-				value, err := users.HashPwd(user.Password)
-				if err != nil {
-					logger.Error(err.Error())
-				}
-				user.Password = value
-			} else {
-				// Skip password field if it's empty
-				continue
-			}
-		}
-		newfields = append(newfields, capitalField)
+func getPasswordHistory(db storm.Node, id uint) ([]string, error) {
+	var history []string
+	err := db.Get(passwordHistoryBucket, id, &history)
+	if err == storm.ErrNotFound {
+		return nil, nil
 	}
-
-	return newfields, nil
+	return history, err
 }
 
-func checkPassword(password string) error {
-	if len(password) < settings.Config.Auth.Methods.PasswordAuth.MinLength {
-		return fmt.Errorf("password must be at least %d characters long", settings.Config.Auth.Methods.PasswordAuth.MinLength)
+// setPasswordHistory stores the previous password hashes of a user, an
+// empty history is removed.
+func setPasswordHistory(db storm.Node, id uint, history []string) error {
+	if len(history) > 0 {
+		return db.Set(passwordHistoryBucket, id, history)
 	}
-	return nil
+	err := db.Delete(passwordHistoryBucket, id)
+	if err == storm.ErrNotFound {
+		return nil
+	}
+	return err
 }
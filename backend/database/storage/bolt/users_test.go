@@ -1,21 +1,30 @@
 package bolt
 
 import (
+	"encoding/json"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
 	"github.com/SlepoyShaman/FileStorage/backend/database/users"
 	"github.com/asdine/storm/v3"
 )
 
-func createTestUsersBackend(t *testing.T) users.StorageBackend {
-	dir := t.TempDir()
-	dbPath := filepath.Join(dir, "test.db")
-	db, err := storm.Open(dbPath)
+// createTestDB opens an empty storm DB in a temp dir, it is closed when the
+// test ends.
+func createTestDB(t *testing.T) *storm.DB {
+	t.Helper()
+	db, err := storm.Open(filepath.Join(t.TempDir(), "test.db"))
 	if err != nil {
 		t.Fatalf("failed to open storm db: %v", err)
 	}
-	return NewUsersBackend(db)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func createTestUsersBackend(t *testing.T) users.StorageBackend {
+	return NewUsersBackend(createTestDB(t))
 }
 
 func createTestUser(t *testing.T, backend users.StorageBackend, username string, isAdmin bool) *users.User {
@@ -456,48 +465,100 @@ func TestUpdate_EmptyFieldsAfterFiltering(t *testing.T) {
 	}
 }
 
-func TestFilterRestrictedFields(t *testing.T) {
-	// Test the filterRestrictedFields function directly
-	testCases := []struct {
-		name     string
-		fields   []string
-		expected []string
-	}{
-		{
-			name:     "all allowed fields",
-			fields:   []string{"DarkMode", "OtpEnabled", "Locale", "ViewMode"},
-			expected: []string{"DarkMode", "OtpEnabled", "Locale", "ViewMode"},
-		},
-		{
-			name:     "mixed allowed and restricted",
-			fields:   []string{"DarkMode", "Permissions", "Scopes", "OtpEnabled"},
-			expected: []string{"DarkMode", "OtpEnabled"},
-		},
-		{
-			name:     "all restricted fields",
-			fields:   []string{"Permissions", "Scopes", "Username", "ID"},
-			expected: []string{},
-		},
-		{
-			name:     "empty fields",
-			fields:   []string{},
-			expected: []string{},
-		},
+func TestRegisterFailedLogin_LocksAfterThreshold(t *testing.T) {
+	backend := createTestUsersBackend(t)
+	store := users.NewStorage(backend)
+	user := createTestUser(t, backend, "locked", false)
+	policy := users.LockoutPolicy{Threshold: 3, DurationMinutes: 5}
+
+	for i := 1; i < policy.Threshold; i++ {
+		locked, err := store.RegisterFailedLogin(user, policy)
+		if err != nil {
+			t.Fatalf("failed to register failed login: %v", err)
+		}
+		if locked {
+			t.Fatalf("account should not be locked after %d attempts", i)
+		}
+	}
+	locked, err := store.RegisterFailedLogin(user, policy)
+	if err != nil {
+		t.Fatalf("failed to register failed login: %v", err)
+	}
+	if !locked {
+		t.Fatal("account should be locked once the threshold is reached")
+	}
+
+	stored, err := backend.GetBy(user.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if !stored.IsLocked() {
+		t.Error("lockout should be persisted on the user record")
+	}
+
+	if err := store.Unlock(user.ID); err != nil {
+		t.Fatalf("failed to unlock user: %v", err)
+	}
+	stored, err = backend.GetBy(user.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if stored.IsLocked() || stored.FailedLoginAttempts != 0 {
+		t.Errorf("user should be unlocked, got lockedUntil=%d attempts=%d", stored.LockedUntil, stored.FailedLoginAttempts)
+	}
+}
+
+func TestRegisterFailedLogin_DisabledWithoutThreshold(t *testing.T) {
+	backend := createTestUsersBackend(t)
+	store := users.NewStorage(backend)
+	user := createTestUser(t, backend, "unlimited", false)
+
+	for i := 0; i < 10; i++ {
+		locked, err := store.RegisterFailedLogin(user, users.LockoutPolicy{})
+		if err != nil || locked {
+			t.Fatalf("lockout should be disabled, locked=%v err=%v", locked, err)
+		}
+	}
+}
+
+func TestPasswordHistoryStoredApart(t *testing.T) {
+	settings.Config.Auth.Methods.PasswordAuth.Policy.HistoryCount = 3
+	t.Cleanup(func() { settings.Config.Auth.Methods.PasswordAuth.Policy.HistoryCount = 0 })
+	backend := createTestUsersBackend(t)
+	user := createTestUser(t, backend, "alice", false)
+	update := &users.User{ID: user.ID, Username: "alice", LoginMethod: users.LoginMethodPassword}
+	update.Password = "secondpass123"
+	if err := backend.Update(update, true, "Password"); err != nil {
+		t.Fatalf("failed to change password: %v", err)
 	}
 
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			result := filterRestrictedFields(tc.fields)
+	got, err := backend.GetBy("alice")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if len(got.PasswordHistory) != 1 || users.CheckPwd("testpass123", got.PasswordHistory[0]) != nil {
+		t.Fatalf("unexpected password history: %v", got.PasswordHistory)
+	}
+	encoded, _ := json.Marshal(got)
+	if strings.Contains(string(encoded), got.PasswordHistory[0]) {
+		t.Error("expected password history to be left out of serialized users")
+	}
 
-			if len(result) != len(tc.expected) {
-				t.Errorf("Expected %d fields, got %d", len(tc.expected), len(result))
-			}
+	// a repeated password is rejected with the stored history
+	update.Password = "testpass123"
+	if err = backend.Update(update, true, "Password"); err == nil {
+		t.Error("expected a reused password to be rejected")
+	}
+	if got, _ = backend.GetBy("alice"); len(got.PasswordHistory) != 1 || users.CheckPwd("secondpass123", got.Password) != nil {
+		t.Errorf("expected the rejected change to leave the password and history alone, got %v", got.PasswordHistory)
+	}
 
-			for i, field := range result {
-				if field != tc.expected[i] {
-					t.Errorf("Expected field %s at position %d, got %s", tc.expected[i], i, field)
-				}
-			}
-		})
+	// the history goes along with the user
+	if err = backend.DeleteByID(user.ID); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	history, err := getPasswordHistory(backend.(*usersBackend).db, user.ID)
+	if err != nil || history != nil {
+		t.Errorf("expected the history to be removed, got %v %v", history, err)
 	}
 }
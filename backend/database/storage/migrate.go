@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	storm "github.com/asdine/storm/v3"
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/bolt"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/sqlite"
+)
+
+// MigrationReport counts the records copied by MigrateBoltToSQLite.
+type MigrationReport struct {
+	Users       int
+	Shares      int
+	Invitations int
+	Tags        int
+	Favorites   int
+	Jobs        int
+	Config      int
+}
+
+// MigrateBoltToSQLite copies all data of a bolt database into a new sqlite
+// database. Records are copied as they are stored, so password hashes,
+// user ids and share hashes stay valid. The server must be stopped, the
+// bolt database is only read from.
+func MigrateBoltToSQLite(boltPath, sqlitePath string) (MigrationReport, error) {
+	var report MigrationReport
+	exists, err := dbExists(sqlitePath)
+	if err != nil {
+		return report, err
+	}
+	if exists {
+		return report, fmt.Errorf("target database %v already exists", sqlitePath)
+	}
+	src, err := storm.Open(boltPath, storm.BoltOptions(0600, &bbolt.Options{Timeout: time.Second}))
+	if err != nil {
+		return report, fmt.Errorf("could not open bolt database %v: %w", boltPath, err)
+	}
+	defer src.Close()
+	dst, err := sqlite.Open(sqlitePath)
+	if err != nil {
+		return report, fmt.Errorf("could not create sqlite database %v: %w", sqlitePath, err)
+	}
+	report, err = copyBoltToSQLite(src, dst)
+	dst.Close()
+	if err != nil {
+		// do not leave a partial database behind
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			os.Remove(sqlitePath + suffix)
+		}
+	}
+	return report, err
+}
+
+func copyBoltToSQLite(src *storm.DB, dst *sqlite.DB) (MigrationReport, error) {
+	var report MigrationReport
+	// settings, server config, auth method and version are stored as json
+	for _, name := range []string{"settings", "server", "auther", "version"} {
+		var raw json.RawMessage
+		err := src.Get("config", name, &raw)
+		if err == storm.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to read %v: %w", name, err)
+		}
+		if err = sqlite.Save(dst, name, raw); err != nil {
+			return report, err
+		}
+		report.Config++
+	}
+
+	allUsers, err := bolt.NewUsersBackend(src).Gets()
+	if err != nil && err != errors.ErrNotExist {
+		return report, fmt.Errorf("failed to read users: %w", err)
+	}
+	for _, user := range allUsers {
+		if err = sqlite.PutUser(dst, user); err != nil {
+			return report, fmt.Errorf("failed to copy user %v: %w", user.Username, err)
+		}
+		report.Users++
+	}
+
+	links, err := bolt.NewShareBackend(src).All()
+	if err != nil && err != errors.ErrNotExist {
+		return report, fmt.Errorf("failed to read shares: %w", err)
+	}
+	shareDst := sqlite.NewShareBackend(dst)
+	for _, link := range links {
+		if err = shareDst.Save(link); err != nil {
+			return report, fmt.Errorf("failed to copy share %v: %w", link.Hash, err)
+		}
+		report.Shares++
+	}
+
+	invitations, err := bolt.NewInvitationBackend(src).All()
+	if err != nil && err != errors.ErrNotExist {
+		return report, fmt.Errorf("failed to read invitations: %w", err)
+	}
+	invitationDst := sqlite.NewInvitationBackend(dst)
+	for _, inv := range invitations {
+		if err = invitationDst.Save(inv); err != nil {
+			return report, fmt.Errorf("failed to copy invitation: %w", err)
+		}
+		report.Invitations++
+	}
+
+	entries, err := bolt.NewTagsBackend(src).All()
+	if err != nil && err != errors.ErrNotExist {
+		return report, fmt.Errorf("failed to read tags: %w", err)
+	}
+	tagsDst := sqlite.NewTagsBackend(dst)
+	for _, entry := range entries {
+		if err = tagsDst.Save(entry); err != nil {
+			return report, fmt.Errorf("failed to copy tags of %v: %w", entry.Path, err)
+		}
+		report.Tags++
+	}
+
+	lists, err := bolt.NewFavoritesBackend(src).All()
+	if err != nil && err != errors.ErrNotExist {
+		return report, fmt.Errorf("failed to read favorites: %w", err)
+	}
+	favoritesDst := sqlite.NewFavoritesBackend(dst)
+	for _, list := range lists {
+		if err = favoritesDst.Save(list); err != nil {
+			return report, fmt.Errorf("failed to copy favorites of %v: %w", list.Username, err)
+		}
+		report.Favorites++
+	}
+
+	// queued jobs run once the server starts on the new database
+	jobList, err := bolt.NewJobsBackend(src).All()
+	if err != nil && err != errors.ErrNotExist {
+		return report, fmt.Errorf("failed to read jobs: %w", err)
+	}
+	jobsDst := sqlite.NewJobsBackend(dst)
+	for _, job := range jobList {
+		if err = jobsDst.Save(job); err != nil {
+			return report, fmt.Errorf("failed to copy job %v: %w", job.ID, err)
+		}
+		report.Jobs++
+	}
+
+	rules, err := bolt.NewAccessBackend(src).GetRules()
+	if err != nil && err != errors.ErrNotExist {
+		return report, fmt.Errorf("failed to read access rules: %w", err)
+	}
+	if len(rules) > 0 {
+		if err = sqlite.NewAccessBackend(dst).SaveRules(rules); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gtsteffaniak/go-logger/logger"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+	"github.com/SlepoyShaman/FileStorage/backend/database/share"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+// baseVersion is the schema version of databases created before migrations
+// were introduced.
+const baseVersion = 2
+
+// SchemaVersion is the version of the stored data written by this build.
+var SchemaVersion = migrations[len(migrations)-1].Version
+
+// Records gives migrations raw access to the stored records of a database,
+// bypassing the validation done by the regular backends.
+type Records interface {
+	Users() ([]*users.User, error)
+	PutUser(user *users.User) error
+	Shares() ([]*share.Link, error)
+	PutShare(link *share.Link) error
+	// Version returns errors.ErrNotExist if no version was stored yet.
+	Version() (int, error)
+	SetVersion(version int) error
+}
+
+// Migration upgrades the stored records to Version. Up must be idempotent,
+// a step interrupted before its version was stored is run again.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(r Records) error
+}
+
+// migrations must be ordered by version, new steps are appended.
+var migrations = []Migration{
+	{Version: baseVersion, Description: "baseline"},
+	{Version: 3, Description: "move legacy perm to permissions", Up: migrateLegacyPerm},
+	{Version: 4, Description: "start password age for existing users", Up: migratePasswordChangedAt},
+}
+
+// Migrate runs all migrations newer than the stored version up to target.
+// backup is called before each step. New databases without records are
+// stamped with target directly.
+func Migrate(r Records, target int, backup func() (string, error)) error {
+	current, err := r.Version()
+	if err == errors.ErrNotExist {
+		all, err := r.Users()
+		if err != nil {
+			return err
+		}
+		if len(all) == 0 {
+			return r.SetVersion(target)
+		}
+		current = baseVersion
+	} else if err != nil {
+		return fmt.Errorf("could not read schema version: %w", err)
+	}
+	if current > SchemaVersion {
+		return fmt.Errorf("database schema version %d is newer than version %d supported by this build, please upgrade FileStorage", current, SchemaVersion)
+	}
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > target {
+			continue
+		}
+		path, err := backup()
+		if err != nil {
+			return fmt.Errorf("could not back up database before migration %d: %w", m.Version, err)
+		}
+		logger.Infof("migrating database to version %d (%v), backup written to %v", m.Version, m.Description, path)
+		if err = m.Up(r); err != nil {
+			return fmt.Errorf("migration %d failed, the database can be restored from %v: %w", m.Version, path, err)
+		}
+		if err = r.SetVersion(m.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateDatabase brings a freshly opened database up to SchemaVersion,
+// backups are written into the configured backup directory or a backups
+// directory next to the database.
+func migrateDatabase(b Backends, path string) error {
+	dir := settings.Config.Server.Backup.Directory
+	if dir == "" {
+		dir = filepath.Join(filepath.Dir(path), "backups")
+	}
+	return Migrate(b.Records, SchemaVersion, func() (string, error) {
+		if b.Snapshot == nil {
+			return "", fmt.Errorf("backups are not supported by the %v engine", b.Engine)
+		}
+		name := backupFileName(b.Engine, time.Now())
+		return writeBackupFile(dir, name, b.Snapshot.Snapshot)
+	})
+}
+
+// migrateLegacyPerm copies permissions of users created by the original
+// FileStorage, which stored them in perm.
+func migrateLegacyPerm(r Records) error {
+	all, err := r.Users()
+	if err != nil {
+		return err
+	}
+	for _, user := range all {
+		if user.Perm == (users.Permissions{}) {
+			continue
+		}
+		if user.Permissions == (users.Permissions{}) {
+			user.Permissions = user.Perm
+		}
+		user.Perm = users.Permissions{}
+		if err = r.PutUser(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migratePasswordChangedAt starts the password age of password users that
+// never changed their password, so a maximum age applies to them too.
+func migratePasswordChangedAt(r Records) error {
+	all, err := r.Users()
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, user := range all {
+		passwordUser := user.LoginMethod == "" || user.LoginMethod == users.LoginMethodPassword
+		if !passwordUser || user.PasswordChangedAt != 0 {
+			continue
+		}
+		user.PasswordChangedAt = now
+		if err = r.PutUser(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
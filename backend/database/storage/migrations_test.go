@@ -0,0 +1,85 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/migrationtest"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+func TestMigrateFromBaseline(t *testing.T) {
+	for _, engine := range migrationtest.Engines {
+		t.Run(engine, func(t *testing.T) {
+			fixture := migrationtest.LoadFixture(t, "testdata/v2.json")
+			records := migrationtest.Open(t, engine, fixture)
+			backups := migrationtest.Migrate(t, records, storage.SchemaVersion)
+			if backups != storage.SchemaVersion-fixture.Version {
+				t.Errorf("expected a backup before each of %d steps, got %d", storage.SchemaVersion-fixture.Version, backups)
+			}
+			version, err := records.Version()
+			if err != nil || version != storage.SchemaVersion {
+				t.Fatalf("expected version %d, got %d (%v)", storage.SchemaVersion, version, err)
+			}
+
+			legacy := migrationtest.User(t, records, "legacy")
+			if !legacy.Permissions.Admin || !legacy.Permissions.Share || legacy.Perm != (users.Permissions{}) {
+				t.Errorf("legacy perm not moved to permissions: %+v", legacy)
+			}
+			if legacy.PasswordChangedAt == 0 {
+				t.Error("expected password age to start for legacy user")
+			}
+			current := migrationtest.User(t, records, "current")
+			if current.Permissions.Admin || !current.Permissions.Download {
+				t.Errorf("existing permissions must not be replaced: %+v", current.Permissions)
+			}
+			if current.PasswordChangedAt != 1700000000 {
+				t.Errorf("password change time was overwritten: %v", current.PasswordChangedAt)
+			}
+			if proxy := migrationtest.User(t, records, "proxy"); proxy.PasswordChangedAt != 0 {
+				t.Error("password age must not start for proxy users")
+			}
+		})
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	fixture := migrationtest.LoadFixture(t, "testdata/v2.json")
+	records := migrationtest.Open(t, storage.EngineSQLite, fixture)
+	migrationtest.Migrate(t, records, storage.SchemaVersion)
+	first := migrationtest.User(t, records, "legacy")
+
+	// an interrupted run starts again from the last stored version
+	if err := records.SetVersion(fixture.Version); err != nil {
+		t.Fatal(err)
+	}
+	migrationtest.Migrate(t, records, storage.SchemaVersion)
+	second := migrationtest.User(t, records, "legacy")
+	if first.Permissions != second.Permissions || first.PasswordChangedAt != second.PasswordChangedAt {
+		t.Errorf("second run changed records: %+v, %+v", first, second)
+	}
+	if backups := migrationtest.Migrate(t, records, storage.SchemaVersion); backups != 0 {
+		t.Errorf("expected no steps on an up to date database, got %d", backups)
+	}
+}
+
+func TestMigrateNewDatabase(t *testing.T) {
+	records := migrationtest.Open(t, storage.EngineBolt, migrationtest.Fixture{})
+	if backups := migrationtest.Migrate(t, records, storage.SchemaVersion); backups != 0 {
+		t.Errorf("expected no steps for a new database, got %d", backups)
+	}
+	if version, _ := records.Version(); version != storage.SchemaVersion {
+		t.Errorf("expected new database to get version %d, got %d", storage.SchemaVersion, version)
+	}
+}
+
+func TestMigrateRejectsNewerDatabase(t *testing.T) {
+	records := migrationtest.Open(t, storage.EngineBolt, migrationtest.Fixture{Version: storage.SchemaVersion + 1})
+	err := storage.Migrate(records, storage.SchemaVersion, func() (string, error) {
+		t.Fatal("no backup expected")
+		return "", nil
+	})
+	if err == nil {
+		t.Error("expected a database newer than the build to be rejected")
+	}
+}
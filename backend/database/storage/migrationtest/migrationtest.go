@@ -0,0 +1,115 @@
+// Package migrationtest helps writing schema migration tests against
+// fixture databases of every engine.
+package migrationtest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/share"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/bolt"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/sqlite"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+// Engines lists the database engines migrations have to support.
+var Engines = []string{storage.EngineBolt, storage.EngineSQLite}
+
+// Fixture holds the records of a database before it is migrated.
+type Fixture struct {
+	Version int           `json:"version"` // 0 leaves the version unset
+	Users   []*users.User `json:"users"`
+	Shares  []*share.Link `json:"shares"`
+}
+
+// LoadFixture reads a json encoded Fixture, usually from testdata.
+func LoadFixture(t testing.TB, path string) Fixture {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	var fixture Fixture
+	if err = json.Unmarshal(data, &fixture); err != nil {
+		t.Fatalf("failed to parse fixture %v: %v", path, err)
+	}
+	return fixture
+}
+
+// Open creates a temporary database of engine holding the fixture records
+// exactly as given. It is closed when the test finishes.
+func Open(t testing.TB, engine string, fixture Fixture) storage.Records {
+	t.Helper()
+	var records storage.Records
+	dir := t.TempDir()
+	switch engine {
+	case storage.EngineBolt:
+		db, err := storm.Open(filepath.Join(dir, "database.db"))
+		if err != nil {
+			t.Fatalf("failed to open bolt database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		records = bolt.NewRecords(db)
+	case storage.EngineSQLite:
+		db, err := sqlite.Open(filepath.Join(dir, "database.sqlite"))
+		if err != nil {
+			t.Fatalf("failed to open sqlite database: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		records = sqlite.NewRecords(db)
+	default:
+		t.Fatalf("unknown engine %v", engine)
+	}
+	for _, user := range fixture.Users {
+		if err := records.PutUser(user); err != nil {
+			t.Fatalf("failed to store fixture user %v: %v", user.Username, err)
+		}
+	}
+	for _, link := range fixture.Shares {
+		if err := records.PutShare(link); err != nil {
+			t.Fatalf("failed to store fixture share %v: %v", link.Hash, err)
+		}
+	}
+	if fixture.Version != 0 {
+		if err := records.SetVersion(fixture.Version); err != nil {
+			t.Fatalf("failed to store fixture version: %v", err)
+		}
+	}
+	return records
+}
+
+// Migrate runs the migrations up to target and returns the number of
+// backups that were requested.
+func Migrate(t testing.TB, records storage.Records, target int) int {
+	t.Helper()
+	backups := 0
+	err := storage.Migrate(records, target, func() (string, error) {
+		backups++
+		return "backup", nil
+	})
+	if err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	return backups
+}
+
+// User returns the stored user with username.
+func User(t testing.TB, records storage.Records, username string) *users.User {
+	t.Helper()
+	all, err := records.Users()
+	if err != nil {
+		t.Fatalf("failed to read users: %v", err)
+	}
+	for _, user := range all {
+		if user.Username == username {
+			return user
+		}
+	}
+	t.Fatalf("user %v not found", username)
+	return nil
+}
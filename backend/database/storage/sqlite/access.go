@@ -0,0 +1,34 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/access"
+)
+
+const accessRulesKey = "rules"
+
+type accessBackend struct {
+	db *DB
+}
+
+// NewAccessBackend returns a access.RulesBackend backed by sqlite.
+func NewAccessBackend(db *DB) access.RulesBackend {
+	return accessBackend{db: db}
+}
+
+func (s accessBackend) GetRules() ([]byte, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM access_rules WHERE name = ?`, accessRulesKey).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotExist
+	}
+	return data, err
+}
+
+func (s accessBackend) SaveRules(data []byte) error {
+	_, err := s.db.Exec(`INSERT INTO access_rules (name, data) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET data = excluded.data`, accessRulesKey, data)
+	return err
+}
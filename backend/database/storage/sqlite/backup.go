@@ -0,0 +1,56 @@
+package sqlite
+
+import (
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Snapshotter writes consistent copies of the database while it is in use.
+type Snapshotter struct {
+	db *DB
+}
+
+// NewSnapshotter creates a Snapshotter for a sqlite DB.
+func NewSnapshotter(db *DB) *Snapshotter {
+	return &Snapshotter{db: db}
+}
+
+// Snapshot writes a consistent copy of the database. VACUUM INTO creates
+// the copy from a read transaction, so the server keeps running.
+func (s *Snapshotter) Snapshot(w io.Writer) (int64, error) {
+	dir, err := os.MkdirTemp("", "filebrowser-backup-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot.sqlite")
+	if _, err = s.db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.Copy(w, f)
+}
+
+// OpenExclusive opens the database at path with an exclusive lock, held
+// until the DB is closed. It fails while another connection has the
+// database open, such as a running server.
+func OpenExclusive(path string) (*DB, error) {
+	dsn := "file:" + path + "?mode=rw&_pragma=busy_timeout(0)&_pragma=locking_mode(EXCLUSIVE)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// the lock belongs to a connection, so keep a single one
+	db.SetMaxOpenConns(1)
+	if _, err = db.Exec(`BEGIN EXCLUSIVE; COMMIT`); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{DB: db}, nil
+}
@@ -0,0 +1,35 @@
+package sqlite
+
+import (
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+)
+
+type settingsBackend struct {
+	db *DB
+}
+
+// NewSettingsBackend returns a settings.StorageBackend backed by sqlite.
+func NewSettingsBackend(db *DB) settings.StorageBackend {
+	return settingsBackend{db: db}
+}
+
+func (s settingsBackend) Get() (*settings.Settings, error) {
+	set := &settings.Settings{}
+	return set, get(s.db, "settings", set)
+}
+
+func (s settingsBackend) Save(set *settings.Settings) error {
+	return Save(s.db, "settings", set)
+}
+
+func (s settingsBackend) GetServer() (*settings.Server, error) {
+	server := &settings.Server{
+		Port:               80,
+		NumImageProcessors: 1,
+	}
+	return server, get(s.db, "server", server)
+}
+
+func (s settingsBackend) SaveServer(server *settings.Server) error {
+	return Save(s.db, "server", server)
+}
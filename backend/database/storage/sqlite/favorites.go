@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/favorites"
+)
+
+type favoritesBackend struct {
+	db *DB
+}
+
+// NewFavoritesBackend returns a favorites.StorageBackend backed by sqlite.
+func NewFavoritesBackend(db *DB) favorites.StorageBackend {
+	return favoritesBackend{db: db}
+}
+
+func (s favoritesBackend) All() ([]*favorites.List, error) {
+	rows, err := s.db.Query(`SELECT data FROM favorites ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var v []*favorites.List
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		list := &favorites.List{}
+		if err = json.Unmarshal([]byte(data), list); err != nil {
+			return nil, err
+		}
+		v = append(v, list)
+	}
+	return v, rows.Err()
+}
+
+func (s favoritesBackend) Get(username string) (*favorites.List, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM favorites WHERE username = ?`, username).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := &favorites.List{}
+	return list, json.Unmarshal([]byte(data), list)
+}
+
+func (s favoritesBackend) Save(l *favorites.List) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO favorites (username, data) VALUES (?, ?)
+		ON CONFLICT (username) DO UPDATE SET data = excluded.data`, l.Username, string(data))
+	return err
+}
+
+func (s favoritesBackend) Delete(username string) error {
+	_, err := s.db.Exec(`DELETE FROM favorites WHERE username = ?`, username)
+	return err
+}
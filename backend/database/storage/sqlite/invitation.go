@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/invitation"
+)
+
+type invitationBackend struct {
+	db *DB
+}
+
+// NewInvitationBackend returns a invitation.StorageBackend backed by sqlite.
+func NewInvitationBackend(db *DB) invitation.StorageBackend {
+	return invitationBackend{db: db}
+}
+
+func (s invitationBackend) All() ([]*invitation.Invitation, error) {
+	rows, err := s.db.Query(`SELECT data FROM invitations ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var v []*invitation.Invitation
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		inv := &invitation.Invitation{}
+		if err = json.Unmarshal([]byte(data), inv); err != nil {
+			return nil, err
+		}
+		v = append(v, inv)
+	}
+	return v, rows.Err()
+}
+
+func (s invitationBackend) Get(id string) (*invitation.Invitation, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM invitations WHERE id = ?`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	inv := &invitation.Invitation{}
+	return inv, json.Unmarshal([]byte(data), inv)
+}
+
+func (s invitationBackend) Save(i *invitation.Invitation) error {
+	data, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO invitations (id, data) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`, i.ID, string(data))
+	return err
+}
+
+func (s invitationBackend) Delete(id string) error {
+	_, err := s.db.Exec(`DELETE FROM invitations WHERE id = ?`, id)
+	return err
+}
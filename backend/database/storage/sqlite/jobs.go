@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/jobs"
+)
+
+type jobsBackend struct {
+	db *DB
+}
+
+// NewJobsBackend returns a jobs.StorageBackend backed by sqlite.
+func NewJobsBackend(db *DB) jobs.StorageBackend {
+	return jobsBackend{db: db}
+}
+
+func (s jobsBackend) All() ([]*jobs.Job, error) {
+	rows, err := s.db.Query(`SELECT data FROM jobs ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var v []*jobs.Job
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		job := &jobs.Job{}
+		if err = json.Unmarshal([]byte(data), job); err != nil {
+			return nil, err
+		}
+		v = append(v, job)
+	}
+	return v, rows.Err()
+}
+
+func (s jobsBackend) Get(id string) (*jobs.Job, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM jobs WHERE id = ?`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	job := &jobs.Job{}
+	return job, json.Unmarshal([]byte(data), job)
+}
+
+func (s jobsBackend) Save(j *jobs.Job) error {
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO jobs (id, owner, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET owner = excluded.owner, data = excluded.data`, j.ID, j.Owner, string(data))
+	return err
+}
+
+func (s jobsBackend) Delete(id string) error {
+	_, err := s.db.Exec(`DELETE FROM jobs WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"github.com/SlepoyShaman/FileStorage/backend/database/share"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+// Records gives schema migrations raw access to the stored records,
+// without the validation done by the regular backends.
+type Records struct {
+	db *DB
+}
+
+// NewRecords creates Records for a sqlite database.
+func NewRecords(db *DB) *Records {
+	return &Records{db: db}
+}
+
+func (r *Records) Users() ([]*users.User, error) {
+	return usersBackend{db: r.db}.Gets()
+}
+
+func (r *Records) PutUser(user *users.User) error {
+	return putUser(r.db, user)
+}
+
+func (r *Records) Shares() ([]*share.Link, error) {
+	return shareBackend{db: r.db}.All()
+}
+
+func (r *Records) PutShare(link *share.Link) error {
+	return shareBackend{db: r.db}.Save(link)
+}
+
+// Version returns the stored schema version, or errors.ErrNotExist if the
+// database has none.
+func (r *Records) Version() (int, error) {
+	var version int
+	return version, get(r.db, "version", &version)
+}
+
+func (r *Records) SetVersion(version int) error {
+	return Save(r.db, "version", version)
+}
@@ -0,0 +1,131 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/gtsteffaniak/go-logger/logger"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/share"
+)
+
+type shareBackend struct {
+	db *DB
+}
+
+// NewShareBackend returns a share.StorageBackend backed by sqlite.
+func NewShareBackend(db *DB) share.StorageBackend {
+	return shareBackend{db: db}
+}
+
+func (s shareBackend) find(query string, args ...any) ([]*share.Link, error) {
+	rows, err := s.db.Query(`SELECT data FROM shares `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var v []*share.Link
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		link := &share.Link{}
+		if err = json.Unmarshal([]byte(data), link); err != nil {
+			return nil, err
+		}
+		v = append(v, link)
+	}
+	return v, rows.Err()
+}
+
+func (s shareBackend) All() ([]*share.Link, error) {
+	return s.find(`ORDER BY rowid`)
+}
+
+func (s shareBackend) FindByUserID(id uint) ([]*share.Link, error) {
+	return s.find(`WHERE user_id = ? ORDER BY rowid`, id)
+}
+
+func (s shareBackend) GetByHash(hash string) (*share.Link, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM shares WHERE hash = ?`, hash).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	link := &share.Link{}
+	return link, json.Unmarshal([]byte(data), link)
+}
+
+func (s shareBackend) GetCommonShareByHash(hash string) (*share.CommonShare, error) {
+	link, err := s.GetByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &link.CommonShare, nil
+}
+
+func (s shareBackend) GetPermanent(path, source string, id uint) (*share.Link, error) {
+	v, err := s.find(`WHERE path = ? AND source = ? AND expire = 0 AND user_id = ? LIMIT 1`, path, source, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return &share.Link{}, nil
+	}
+	return v[0], nil
+}
+
+// GetBySourcePath returns all shares that exactly match Path and Source across users.
+func (s shareBackend) GetBySourcePath(path, source string) ([]*share.Link, error) {
+	v, err := s.find(`WHERE path = ? AND source = ? ORDER BY rowid`, path, source)
+	if err != nil {
+		return nil, err
+	}
+	if len(v) == 0 {
+		return nil, errors.ErrNotExist
+	}
+	return v, nil
+}
+
+func (s shareBackend) Gets(path, sourcePath string, id uint) ([]*share.Link, error) {
+	v, err := s.find(`WHERE path = ? AND source = ? AND user_id = ? ORDER BY rowid`, path, sourcePath, id)
+	if err != nil {
+		return nil, err
+	}
+	filteredList := []*share.Link{}
+	// through and filter out expired share
+	for i := range v {
+		if v[i].Expire < time.Now().Unix() && v[i].Expire != 0 {
+			err = s.Delete(v[i].Hash)
+			if err != nil {
+				logger.Errorf("expired share could not be deleted: %v", err.Error())
+			}
+		} else {
+			filteredList = append(filteredList, v[i])
+		}
+	}
+	return filteredList, err
+}
+
+func (s shareBackend) Save(l *share.Link) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO shares (hash, user_id, source, path, expire, data) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (hash) DO UPDATE SET user_id = excluded.user_id, source = excluded.source,
+		path = excluded.path, expire = excluded.expire, data = excluded.data`,
+		l.Hash, l.UserID, l.Source, l.Path, l.Expire, string(data))
+	return err
+}
+
+func (s shareBackend) Delete(hash string) error {
+	_, err := s.db.Exec(`DELETE FROM shares WHERE hash = ?`, hash)
+	return err
+}
@@ -0,0 +1,124 @@
+// Package sqlite implements the storage backends on top of a SQLite
+// database. Records are stored as json documents next to indexed columns,
+// so the database can be queried by external tools with json_extract.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	_ "modernc.org/sqlite" // pure go sqlite driver
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS config (
+	name TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS users (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT NOT NULL UNIQUE,
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS password_history (
+	user_id INTEGER PRIMARY KEY,
+	data    TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS shares (
+	hash    TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	source  TEXT NOT NULL,
+	path    TEXT NOT NULL,
+	expire  INTEGER NOT NULL,
+	data    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS shares_user_id ON shares (user_id);
+CREATE INDEX IF NOT EXISTS shares_source_path ON shares (source, path);
+CREATE TABLE IF NOT EXISTS invitations (
+	id   TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS access_rules (
+	name TEXT PRIMARY KEY,
+	data BLOB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS tags (
+	id     TEXT PRIMARY KEY,
+	source TEXT NOT NULL,
+	path   TEXT NOT NULL,
+	data   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tags_source_path ON tags (source, path);
+CREATE TABLE IF NOT EXISTS favorites (
+	username TEXT PRIMARY KEY,
+	data     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS jobs (
+	id    TEXT PRIMARY KEY,
+	owner TEXT NOT NULL,
+	data  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_owner ON jobs (owner);
+`
+
+// DB is a SQLite database holding all storage tables.
+type DB struct {
+	*sql.DB
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Open opens or creates a SQLite database and makes sure all tables exist.
+// WAL mode is used so readers are not blocked by the server.
+func Open(path string) (*DB, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &DB{DB: db}, nil
+}
+
+// Get reads a json encoded value from the config table.
+func Get(db *DB, name string, to interface{}) error {
+	return get(db, name, to)
+}
+
+func get(q querier, name string, to interface{}) error {
+	var data string
+	err := q.QueryRow(`SELECT data FROM config WHERE name = ?`, name).Scan(&data)
+	if err == sql.ErrNoRows {
+		return errors.ErrNotExist
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), to)
+}
+
+// Save stores a json encoded value in the config table.
+func Save(db *DB, name string, from interface{}) error {
+	data, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO config (name, data) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET data = excluded.data`, name, string(data))
+	return err
+}
+
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
@@ -0,0 +1,149 @@
+package sqlite
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+	"github.com/SlepoyShaman/FileStorage/backend/database/share"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+func createTestDB(t *testing.T) *DB {
+	db, err := Open(filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatalf("failed to open sqlite db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUsersBackend(t *testing.T) {
+	backend := NewUsersBackend(createTestDB(t))
+	user := &users.User{
+		Username:         "alice",
+		LoginMethod:      users.LoginMethodPassword,
+		NonAdminEditable: users.NonAdminEditable{Password: "testpass123"},
+	}
+	if err := backend.Save(user, true, false); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	if user.ID == 0 {
+		t.Fatal("expected user id to be assigned")
+	}
+	if err := backend.Save(&users.User{Username: "alice"}, false, false); err == nil {
+		t.Error("expected duplicate username to be rejected")
+	}
+
+	update := *user
+	update.Locale = "ru"
+	if err := backend.Update(&update, false, "Locale"); err != nil {
+		t.Fatalf("failed to update user: %v", err)
+	}
+	if err := backend.SetLoginAttempts(user.ID, 2, 1234); err != nil {
+		t.Fatalf("failed to set login attempts: %v", err)
+	}
+	got, err := backend.GetBy("alice")
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if got.Locale != "ru" || got.FailedLoginAttempts != 2 || got.LockedUntil != 1234 {
+		t.Errorf("unexpected user: %+v", got)
+	}
+	if users.CheckPwd("testpass123", got.Password) != nil {
+		t.Error("expected stored password to be hashed")
+	}
+
+	if err := backend.DeleteByID(user.ID); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if _, err := backend.GetBy(user.ID); err != errors.ErrNotExist {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestPasswordHistoryStoredApart(t *testing.T) {
+	settings.Config.Auth.Methods.PasswordAuth.Policy.HistoryCount = 3
+	t.Cleanup(func() { settings.Config.Auth.Methods.PasswordAuth.Policy.HistoryCount = 0 })
+	db := createTestDB(t)
+	backend := NewUsersBackend(db)
+	user := &users.User{
+		Username:         "alice",
+		LoginMethod:      users.LoginMethodPassword,
+		NonAdminEditable: users.NonAdminEditable{Password: "firstpass123"},
+	}
+	if err := backend.Save(user, true, false); err != nil {
+		t.Fatalf("failed to save user: %v", err)
+	}
+	for _, password := range []string{"secondpass123", "thirdpass123"} {
+		update := users.User{ID: user.ID, Username: "alice", LoginMethod: users.LoginMethodPassword}
+		update.Password = password
+		if err := backend.Update(&update, true, "Password"); err != nil {
+			t.Fatalf("failed to change password: %v", err)
+		}
+	}
+	got, err := backend.GetBy(user.ID)
+	if err != nil {
+		t.Fatalf("failed to get user: %v", err)
+	}
+	if len(got.PasswordHistory) != 2 || users.CheckPwd("secondpass123", got.PasswordHistory[0]) != nil {
+		t.Fatalf("unexpected password history: %v", got.PasswordHistory)
+	}
+	var data string
+	if err = db.QueryRow(`SELECT data FROM users WHERE id = ?`, user.ID).Scan(&data); err != nil {
+		t.Fatal(err)
+	}
+	encoded, _ := json.Marshal(got)
+	for _, hash := range got.PasswordHistory {
+		if strings.Contains(data, hash) || strings.Contains(string(encoded), hash) {
+			t.Error("expected password history to be kept out of the user record")
+		}
+	}
+
+	if err = backend.DeleteByUsername("alice"); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	var count int
+	if err = db.QueryRow(`SELECT COUNT(*) FROM password_history`).Scan(&count); err != nil || count != 0 {
+		t.Errorf("expected password history to be deleted with the user, got %d rows (%v)", count, err)
+	}
+}
+
+func TestShareBackend(t *testing.T) {
+	backend := NewShareBackend(createTestDB(t))
+	link := &share.Link{Hash: "abc", UserID: 1, CommonShare: share.CommonShare{Source: "/srv", Path: "/docs/"}}
+	if err := backend.Save(link); err != nil {
+		t.Fatalf("failed to save share: %v", err)
+	}
+	got, err := backend.GetByHash("abc")
+	if err != nil || got.Path != "/docs/" {
+		t.Fatalf("unexpected share: %+v, %v", got, err)
+	}
+	links, err := backend.Gets("/docs/", "/srv", 1)
+	if err != nil || len(links) != 1 {
+		t.Fatalf("expected one share, got %v, %v", links, err)
+	}
+	if err = backend.Delete("abc"); err != nil {
+		t.Fatalf("failed to delete share: %v", err)
+	}
+	if _, err = backend.GetByHash("abc"); err != errors.ErrNotExist {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+}
+
+func TestAccessBackend(t *testing.T) {
+	backend := NewAccessBackend(createTestDB(t))
+	if _, err := backend.GetRules(); err != errors.ErrNotExist {
+		t.Errorf("expected ErrNotExist, got %v", err)
+	}
+	if err := backend.SaveRules([]byte(`{"groups":{}}`)); err != nil {
+		t.Fatalf("failed to save rules: %v", err)
+	}
+	data, err := backend.GetRules()
+	if err != nil || string(data) != `{"groups":{}}` {
+		t.Errorf("unexpected rules: %s, %v", data, err)
+	}
+}
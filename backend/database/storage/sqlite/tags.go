@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"encoding/json"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/tags"
+)
+
+type tagsBackend struct {
+	db *DB
+}
+
+// NewTagsBackend returns a tags.StorageBackend backed by sqlite.
+func NewTagsBackend(db *DB) tags.StorageBackend {
+	return tagsBackend{db: db}
+}
+
+func (s tagsBackend) All() ([]*tags.Entry, error) {
+	return s.query(`SELECT data FROM tags ORDER BY source, path`)
+}
+
+func (s tagsBackend) BySource(source string) ([]*tags.Entry, error) {
+	return s.query(`SELECT data FROM tags WHERE source = ?`, source)
+}
+
+func (s tagsBackend) query(query string, args ...any) ([]*tags.Entry, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var v []*tags.Entry
+	for rows.Next() {
+		var data string
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		entry := &tags.Entry{}
+		if err = json.Unmarshal([]byte(data), entry); err != nil {
+			return nil, err
+		}
+		entry.ID = tags.EntryID(entry.Source, entry.Path)
+		v = append(v, entry)
+	}
+	return v, rows.Err()
+}
+
+func (s tagsBackend) Save(e *tags.Entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO tags (id, source, path, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET source = excluded.source, path = excluded.path, data = excluded.data`,
+		e.ID, e.Source, e.Path, string(data))
+	return err
+}
+
+func (s tagsBackend) Delete(id string) error {
+	_, err := s.db.Exec(`DELETE FROM tags WHERE id = ?`, id)
+	return err
+}
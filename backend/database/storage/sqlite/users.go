@@ -0,0 +1,240 @@
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/userfields"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+type usersBackend struct {
+	db *DB
+}
+
+// NewUsersBackend returns a users.StorageBackend backed by sqlite.
+func NewUsersBackend(db *DB) users.StorageBackend {
+	return &usersBackend{db: db}
+}
+
+func getUser(q querier, i interface{}) (*users.User, error) {
+	var row *sql.Row
+	switch i := i.(type) {
+	case uint:
+		row = q.QueryRow(`SELECT id, data FROM users WHERE id = ?`, i)
+	case int:
+		row = q.QueryRow(`SELECT id, data FROM users WHERE id = ?`, uint(i))
+	case string:
+		row = q.QueryRow(`SELECT id, data FROM users WHERE username = ?`, i)
+	default:
+		return nil, errors.ErrInvalidDataType
+	}
+	user, err := scanUser(row)
+	if err != nil {
+		return nil, err
+	}
+	user.PasswordHistory, err = getPasswordHistory(q, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// getPasswordHistory reads the previous password hashes of a user, they
+// are kept apart from the user so they never end up in serialized users.
+func getPasswordHistory(q querier, id uint) ([]string, error) {
+	var data string
+	err := q.QueryRow(`SELECT data FROM password_history WHERE user_id = ?`, id).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var history []string
+	return history, json.Unmarshal([]byte(data), &history)
+}
+
+func setPasswordHistory(q querier, id uint, history []string) error {
+	if len(history) == 0 {
+		_, err := q.Exec(`DELETE FROM password_history WHERE user_id = ?`, id)
+		return err
+	}
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO password_history (user_id, data) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET data = excluded.data`, id, string(data))
+	return err
+}
+
+func scanUser(row interface{ Scan(dest ...any) error }) (*users.User, error) {
+	var id uint
+	var data string
+	err := row.Scan(&id, &data)
+	if err == sql.ErrNoRows {
+		return nil, errors.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	user := &users.User{}
+	if err = json.Unmarshal([]byte(data), user); err != nil {
+		return nil, err
+	}
+	user.ID = id
+	return user, nil
+}
+
+func putUser(q querier, user *users.User) error {
+	if user.ID == 0 {
+		res, err := q.Exec(`INSERT INTO users (username, data) VALUES (?, '{}')`, user.Username)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		user.ID = uint(id)
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT INTO users (id, username, data) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET username = excluded.username, data = excluded.data`,
+		user.ID, user.Username, string(data))
+	if err != nil {
+		return err
+	}
+	return setPasswordHistory(q, user.ID, user.PasswordHistory)
+}
+
+// PutUser stores a user exactly as given, without validation or password
+// hashing. It is used to copy users from another database.
+func PutUser(db *DB, user *users.User) error {
+	return putUser(db, user)
+}
+
+func (st usersBackend) GetBy(i interface{}) (*users.User, error) {
+	return getUser(st.db, i)
+}
+
+func (st usersBackend) Gets() ([]*users.User, error) {
+	rows, err := st.db.Query(`SELECT id, data FROM users ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	var allUsers []*users.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		allUsers = append(allUsers, user)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, user := range allUsers {
+		if user.PasswordHistory, err = getPasswordHistory(st.db, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return allUsers, nil
+}
+
+func (st usersBackend) Update(user *users.User, actorIsAdmin bool, fields ...string) error {
+	existingUser, err := st.GetBy(user.ID)
+	if err != nil {
+		return err
+	}
+	fields, err = userfields.PrepareUpdate(user, existingUser, actorIsAdmin, fields)
+	if err != nil {
+		return err
+	}
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	// re-read inside the transaction so concurrent single field updates are kept
+	current, err := getUser(tx, user.ID)
+	if err != nil {
+		return err
+	}
+	target := reflect.ValueOf(current).Elem()
+	for _, field := range fields {
+		name, val, err := userfields.FieldValue(user, field)
+		if err != nil {
+			return err
+		}
+		target.FieldByName(name).Set(reflect.ValueOf(val))
+	}
+	if err = putUser(tx, current); err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	// last revoke api keys if needed.
+	userfields.RevokeRemovedApiKeys(user, existingUser, fields)
+	return nil
+}
+
+func (st usersBackend) Save(user *users.User, changePass, disableScopeChange bool) error {
+	err := userfields.PrepareSave(user, changePass, disableScopeChange)
+	if err != nil {
+		return err
+	}
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	err = putUser(tx, user)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("user with provided username already exists")
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (st usersBackend) DeleteByID(id uint) error {
+	if _, err := st.db.Exec(`DELETE FROM users WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return setPasswordHistory(st.db, id, nil)
+}
+
+func (st usersBackend) DeleteByUsername(username string) error {
+	user, err := getUser(st.db, username)
+	if err != nil {
+		return err
+	}
+	return st.DeleteByID(user.ID)
+}
+
+// SetPasswordHash stores an already hashed password without running the
+// password policy, used to upgrade hashes transparently on login.
+func (st usersBackend) SetPasswordHash(id uint, hash string) error {
+	_, err := st.db.Exec(`UPDATE users SET data = json_set(data, '$.password', ?) WHERE id = ?`, hash, id)
+	return err
+}
+
+// SetLoginAttempts stores the failed login counter and lockout time of a user.
+func (st usersBackend) SetLoginAttempts(id uint, failedAttempts int, lockedUntil int64) error {
+	_, err := st.db.Exec(`UPDATE users SET data = json_set(data, '$.failedLoginAttempts', ?, '$.lockedUntil', ?) WHERE id = ?`,
+		failedAttempts, lockedUntil, id)
+	return err
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/SlepoyShaman/FileStorage/backend/adapters/fs/fileutils"
 	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
 	"github.com/SlepoyShaman/FileStorage/backend/common/utils"
-	"github.com/SlepoyShaman/FileStorage/backend/database/storage/bolt"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/sqlite"
 	"github.com/SlepoyShaman/FileStorage/backend/database/users"
 	storm "github.com/asdine/storm/v3"
 	"github.com/gtsteffaniak/go-logger/logger"
@@ -17,19 +17,21 @@ import (
 
 var userStore *users.Storage
 
-func InitializeDb(path string) (*bolt.BoltStore, bool, error) {
+func InitializeDb(path string) (*Store, bool, error) {
 	exists, err := dbExists(path)
 	if err != nil {
 		panic(err)
 	}
-	db, err := storm.Open(path)
-	if err != nil {
-		if strings.Contains(err.Error(), "timeout") {
-			logger.Fatal("the database is locked, please close all other instances of FileStorage before starting.")
-		}
-		logger.Fatalf("could not open database: %v", err)
+	var backends Backends
+	if DatabaseEngine(path) == EngineSQLite {
+		backends = openSQLite(path)
+	} else {
+		backends = openBolt(path)
 	}
-	store, err := bolt.NewStorage(db)
+	if err = migrateDatabase(backends, path); err != nil {
+		return nil, exists, err
+	}
+	store, err := NewStore(backends)
 	if err != nil {
 		return nil, exists, err
 	}
@@ -37,10 +39,6 @@ func InitializeDb(path string) (*bolt.BoltStore, bool, error) {
 	// ignoring errors because
 	_ = store.Access.LoadFromDB()
 	userStore = store.Users
-	err = bolt.Save(db, "version", 2)
-	if err != nil {
-		return nil, exists, err
-	}
 	if !exists {
 		if settings.Config.Env.IsPlaywright || settings.Config.Env.IsDevMode {
 			settings.Config.Env.IsFirstLoad = false
@@ -53,6 +51,25 @@ func InitializeDb(path string) (*bolt.BoltStore, bool, error) {
 	return store, exists, err
 }
 
+func openBolt(path string) Backends {
+	db, err := storm.Open(path)
+	if err != nil {
+		if strings.Contains(err.Error(), "timeout") {
+			logger.Fatal("the database is locked, please close all other instances of FileStorage before starting.")
+		}
+		logger.Fatalf("could not open database: %v", err)
+	}
+	return BoltBackends(db)
+}
+
+func openSQLite(path string) Backends {
+	db, err := sqlite.Open(path)
+	if err != nil {
+		logger.Fatalf("could not open database: %v", err)
+	}
+	return SQLiteBackends(db)
+}
+
 func dbExists(path string) (bool, error) {
 	stat, err := os.Stat(path)
 	if err == nil {
@@ -73,7 +90,7 @@ func dbExists(path string) (bool, error) {
 	return false, err
 }
 
-func quickSetup(store *bolt.BoltStore) {
+func quickSetup(store *Store) {
 	settings.Config.Auth.Key = utils.GenerateKey()
 	err := store.Settings.Save(&settings.Config)
 	utils.CheckErr("store.Settings.Save", err)
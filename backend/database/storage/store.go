@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/auth"
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+	"github.com/SlepoyShaman/FileStorage/backend/database/access"
+	"github.com/SlepoyShaman/FileStorage/backend/database/favorites"
+	"github.com/SlepoyShaman/FileStorage/backend/database/invitation"
+	"github.com/SlepoyShaman/FileStorage/backend/database/jobs"
+	"github.com/SlepoyShaman/FileStorage/backend/database/share"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/bolt"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/sqlite"
+	"github.com/SlepoyShaman/FileStorage/backend/database/tags"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+const (
+	EngineBolt   = "bolt"
+	EngineSQLite = "sqlite"
+)
+
+// Store is a storage powered by a database engine which makes the
+// necessary verifications when fetching and saving data to ensure
+// consistency.
+type Store struct {
+	Users       *users.Storage
+	Share       *share.Storage
+	Auth        *auth.Storage
+	Settings    *settings.Storage
+	Access      *access.Storage
+	Invitations *invitation.Storage
+	Tags        *tags.Storage
+	Favorites   *favorites.Storage
+	Jobs        *jobs.Storage
+	Engine      string
+	snapshot    Snapshotter
+}
+
+// Snapshotter writes a consistent copy of a database while it is in use.
+type Snapshotter interface {
+	Snapshot(w io.Writer) (int64, error)
+}
+
+// Backends are the engine specific implementations a Store is built from.
+type Backends struct {
+	Users       users.StorageBackend
+	Share       share.StorageBackend
+	Auth        auth.StorageBackend
+	Settings    settings.StorageBackend
+	Access      access.RulesBackend
+	Invitations invitation.StorageBackend
+	Tags        tags.StorageBackend
+	Favorites   favorites.StorageBackend
+	Jobs        jobs.StorageBackend
+	Engine      string
+	Snapshot    Snapshotter
+	Records     Records
+}
+
+// NewStore creates a Store from engine backends.
+func NewStore(b Backends) (*Store, error) {
+	userStore := users.NewStorage(b.Users)
+	authStore, err := auth.NewStorage(b.Auth, userStore)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		Users:       userStore,
+		Share:       share.NewStorage(b.Share, userStore),
+		Auth:        authStore,
+		Settings:    settings.NewStorage(b.Settings),
+		Access:      access.NewStorage(b.Access, userStore),
+		Invitations: invitation.NewStorage(b.Invitations),
+		Tags:        tags.NewStorage(b.Tags),
+		Favorites:   favorites.NewStorage(b.Favorites),
+		Jobs:        jobs.NewStorage(b.Jobs),
+		Engine:      b.Engine,
+		snapshot:    b.Snapshot,
+	}, nil
+}
+
+// DatabaseEngine returns the engine used for a database path.
+func DatabaseEngine(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".sqlite", ".sqlite3":
+		return EngineSQLite
+	default:
+		return EngineBolt
+	}
+}
+
+// BoltBackends returns the backends of a bolt database.
+func BoltBackends(db *storm.DB) Backends {
+	return Backends{
+		Users:       bolt.NewUsersBackend(db),
+		Share:       bolt.NewShareBackend(db),
+		Auth:        bolt.NewAuthBackend(db),
+		Settings:    bolt.NewSettingsBackend(db),
+		Access:      bolt.NewAccessBackend(db),
+		Invitations: bolt.NewInvitationBackend(db),
+		Tags:        bolt.NewTagsBackend(db),
+		Favorites:   bolt.NewFavoritesBackend(db),
+		Jobs:        bolt.NewJobsBackend(db),
+		Engine:      EngineBolt,
+		Snapshot:    bolt.NewSnapshotter(db),
+		Records:     bolt.NewRecords(db),
+	}
+}
+
+// SQLiteBackends returns the backends of a sqlite database.
+func SQLiteBackends(db *sqlite.DB) Backends {
+	return Backends{
+		Users:       sqlite.NewUsersBackend(db),
+		Share:       sqlite.NewShareBackend(db),
+		Auth:        sqlite.NewAuthBackend(db),
+		Settings:    sqlite.NewSettingsBackend(db),
+		Access:      sqlite.NewAccessBackend(db),
+		Invitations: sqlite.NewInvitationBackend(db),
+		Tags:        sqlite.NewTagsBackend(db),
+		Favorites:   sqlite.NewFavoritesBackend(db),
+		Jobs:        sqlite.NewJobsBackend(db),
+		Engine:      EngineSQLite,
+		Snapshot:    sqlite.NewSnapshotter(db),
+		Records:     sqlite.NewRecords(db),
+	}
+}
@@ -0,0 +1,254 @@
+// Package userfields contains the user validation and field handling that is
+// common to all database engines, so bolt and sqlite behave the same.
+package userfields
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gtsteffaniak/go-logger/logger"
+
+	"github.com/SlepoyShaman/FileStorage/backend/adapters/fs/files"
+	"github.com/SlepoyShaman/FileStorage/backend/auth"
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+	"github.com/SlepoyShaman/FileStorage/backend/common/utils"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+// PrepareSave validates a user and hashes its password before a backend
+// stores it.
+func PrepareSave(user *users.User, changePass, disableScopeChange bool) error {
+	if user.LoginMethod == "" {
+		user.LoginMethod = users.LoginMethodPassword
+	}
+	if user.Username == "anonymous" {
+		return fmt.Errorf("username cannot be 'anonymous'")
+	}
+	logger.Debugf("Saving user [%s] changepass: %v", user.Username, changePass)
+	if user.LoginMethod == users.LoginMethodPassword && changePass {
+		err := CheckPassword(user.Password)
+		if err != nil {
+			return err
+		}
+		pass, err := users.HashPwd(user.Password)
+		if err != nil {
+			return err
+		}
+		user.Password = pass
+		user.PasswordChangedAt = time.Now().Unix()
+	}
+
+	// converting scopes to map of paths intead of names (names can change)
+	adjustedScopes, err := settings.ConvertToBackendScopes(user.Scopes)
+	if err != nil {
+		return err
+	}
+	user.Scopes = adjustedScopes
+	err = files.MakeUserDirs(user, disableScopeChange)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	return nil
+}
+
+// PrepareUpdate validates an update of an existing user and returns the
+// fields that should be written. The values to write are read from user.
+func PrepareUpdate(user, existingUser *users.User, actorIsAdmin bool, fields []string) ([]string, error) {
+	passwordUser := existingUser.LoginMethod == users.LoginMethodPassword
+	enforcedOtp := settings.Config.Auth.Methods.PasswordAuth.EnforcedOtp
+	if passwordUser && enforcedOtp && !user.OtpEnabled {
+		return nil, errors.ErrNoTotpConfigured
+	}
+	plainPassword := user.Password
+	fields, err := parseFields(user, fields, actorIsAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	passwordChanged := slices.Contains(fields, "Password")
+	if !passwordChanged {
+		user.Password = existingUser.Password
+	} else {
+		// a reset forced by an admin overrides lockPassword
+		forced := existingUser.ForcePasswordChange
+		if existingUser.LockPassword && !actorIsAdmin && !forced {
+			return nil, fmt.Errorf("password cannot be changed when lock password is enabled")
+		}
+		historyCount := settings.Config.Auth.Methods.PasswordAuth.Policy.HistoryCount
+		err = users.CheckPasswordHistory(plainPassword, existingUser, historyCount)
+		if err != nil {
+			return nil, err
+		}
+		users.RecordPasswordChange(user, existingUser, historyCount)
+	}
+
+	if !actorIsAdmin {
+		fields = FilterRestrictedFields(fields)
+	}
+	if passwordChanged {
+		// bookkeeping fields are not user editable but always follow a password change
+		fields = append(fields, "PasswordHistory", "PasswordChangedAt", "ForcePasswordChange")
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields to update")
+	}
+
+	// converting scopes to map of paths intead of names (names can change)
+	if slices.Contains(fields, "Scopes") {
+		adjustedScopes, err := settings.ConvertToBackendScopes(user.Scopes)
+		if err != nil {
+			return nil, err
+		}
+		user.Scopes = adjustedScopes
+		err = files.MakeUserDirs(user, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fields, nil
+}
+
+// FieldValue returns the name and value of a field to store for a user.
+// Disabling OTP clears the TOTP secret instead.
+func FieldValue(user *users.User, field string) (string, interface{}, error) {
+	// Use reflection to access struct fields
+	fieldValue := reflect.ValueOf(user).Elem().FieldByName(field)
+	if !fieldValue.IsValid() {
+		return "", nil, fmt.Errorf("invalid field: %s", field)
+	}
+
+	// Ensure the field is settable
+	if !fieldValue.CanSet() {
+		return "", nil, fmt.Errorf("cannot set value of field: %s", field)
+	}
+
+	val := fieldValue.Interface()
+	if field == "OtpEnabled" {
+		otpEnabled, _ := val.(bool)
+		if !otpEnabled {
+			// if otp is disabled, we also want to clear the TOTPSecret
+			return "TOTPSecret", "", nil
+		}
+	}
+	return field, val, nil
+}
+
+// RevokeRemovedApiKeys blacklists the api keys of a user that lost the api
+// permission with this update.
+func RevokeRemovedApiKeys(user, existingUser *users.User, fields []string) {
+	if existingUser.Permissions.Api && !user.Permissions.Api && slices.Contains(fields, "Permissions") {
+		for _, key := range existingUser.ApiKeys {
+			auth.RevokeAPIKey(key.Key) // add to blacklist
+		}
+	}
+}
+
+// CheckPassword validates a password against the configured policy.
+func CheckPassword(password string) error {
+	passwordAuth := settings.Config.Auth.Methods.PasswordAuth
+	return users.CheckPasswordPolicy(password, passwordAuth.MinLength, passwordAuth.Policy)
+}
+
+// FilterRestrictedFields filters out fields that non-admin users may not change.
+func FilterRestrictedFields(fields []string) []string {
+	// Get a list of allowed fields from NonAdminEditable
+	allowed := getNonAdminEditableFieldNames()
+	var filteredFields []string
+
+	for _, field := range fields {
+		if slices.Contains(allowed, field) {
+			filteredFields = append(filteredFields, field)
+		}
+	}
+
+	return filteredFields
+}
+
+// Helper to return list of field names from NonAdminEditable struct
+func getNonAdminEditableFieldNames() []string {
+	var names []string
+	t := reflect.TypeOf(users.NonAdminEditable{})
+	for i := 0; i < t.NumField(); i++ {
+		names = append(names, t.Field(i).Name)
+	}
+	return names
+}
+
+func parseFields(user *users.User, fields []string, actorIsAdmin bool) ([]string, error) {
+	// If `Which` is not specified, default to updating all fields
+	if len(fields) == 0 || fields[0] == "all" {
+		fields = []string{}
+		v := reflect.ValueOf(user)
+		if v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		t := v.Type()
+
+		// Dynamically populate fields to update
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			// which=all can't update password
+			switch strings.ToLower(field.Name) {
+			case "id", "username", "password", "apikeys", "totpsecret", "totpnonce",
+				"passwordhistory", "passwordchangedat", "forcepasswordchange",
+				"failedloginattempts", "lockeduntil":
+				// Skip these fields
+				continue
+			}
+
+			// Handle embedded structs (like NonAdminEditable)
+			if field.Anonymous {
+				// Get the embedded struct type
+				embeddedType := field.Type
+				if embeddedType.Kind() == reflect.Ptr {
+					embeddedType = embeddedType.Elem()
+				}
+
+				// Add all fields from the embedded struct
+				for j := 0; j < embeddedType.NumField(); j++ {
+					embeddedField := embeddedType.Field(j)
+					fields = append(fields, embeddedField.Name)
+				}
+			} else {
+				fields = append(fields, field.Name)
+			}
+		}
+	}
+	newfields := []string{}
+	for _, field := range fields {
+		capitalField := utils.CapitalizeFirst(field)
+		if capitalField == "Scopes" {
+			if !actorIsAdmin {
+				continue
+			}
+		}
+		if capitalField == "Password" {
+			// Only process password if it's actually being updated (not empty)
+			if user.Password != "" {
+				if user.LoginMethod != users.LoginMethodPassword {
+					return nil, fmt.Errorf("password cannot be changed when login method is not password")
+				}
+				err := CheckPassword(user.Password)
+				if err != nil {
+					return nil, err
+				}
+				value, err := users.HashPwd(user.Password)
+				if err != nil {
+					logger.Error(err.Error())
+				}
+				user.Password = value
+			} else {
+				// Skip password field if it's empty
+				continue
+			}
+		}
+		newfields = append(newfields, capitalField)
+	}
+
+	return newfields, nil
+}
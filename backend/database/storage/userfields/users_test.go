@@ -0,0 +1,80 @@
+package userfields
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+)
+
+func TestFilterRestrictedFields(t *testing.T) {
+	// Test the FilterRestrictedFields function directly
+	testCases := []struct {
+		name     string
+		fields   []string
+		expected []string
+	}{
+		{
+			name:     "all allowed fields",
+			fields:   []string{"DarkMode", "OtpEnabled", "Locale", "ViewMode"},
+			expected: []string{"DarkMode", "OtpEnabled", "Locale", "ViewMode"},
+		},
+		{
+			name:     "mixed allowed and restricted",
+			fields:   []string{"DarkMode", "Permissions", "Scopes", "OtpEnabled"},
+			expected: []string{"DarkMode", "OtpEnabled"},
+		},
+		{
+			name:     "all restricted fields",
+			fields:   []string{"Permissions", "Scopes", "Username", "ID"},
+			expected: []string{},
+		},
+		{
+			name:     "empty fields",
+			fields:   []string{},
+			expected: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := FilterRestrictedFields(tc.fields)
+
+			if len(result) != len(tc.expected) {
+				t.Errorf("Expected %d fields, got %d", len(tc.expected), len(result))
+			}
+
+			for i, field := range result {
+				if field != tc.expected[i] {
+					t.Errorf("Expected field %s at position %d, got %s", tc.expected[i], i, field)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareUpdateLockedPassword(t *testing.T) {
+	existing := &users.User{ID: 1, Username: "bob", LoginMethod: users.LoginMethodPassword, LockPassword: true}
+	update := func() *users.User {
+		user := &users.User{ID: 1, Username: "bob", LoginMethod: users.LoginMethodPassword}
+		user.Password = "newpass123"
+		user.Permissions.Admin = true
+		return user
+	}
+	if _, err := PrepareUpdate(update(), existing, false, []string{"Password"}); err == nil {
+		t.Error("expected a locked password to be rejected")
+	}
+
+	// a reset forced by an admin lets the user change it, without admin rights
+	existing.ForcePasswordChange = true
+	fields, err := PrepareUpdate(update(), existing, false, []string{"Password", "Permissions"})
+	if err != nil {
+		t.Fatalf("expected a forced password change to be allowed: %v", err)
+	}
+	if slices.Contains(fields, "Permissions") {
+		t.Errorf("expected restricted fields to be filtered, got %v", fields)
+	}
+	if !slices.Contains(fields, "Password") {
+		t.Errorf("expected the password to be updated, got %v", fields)
+	}
+}
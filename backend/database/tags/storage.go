@@ -0,0 +1,240 @@
+package tags
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+)
+
+type StorageBackend interface {
+	All() ([]*Entry, error)
+	BySource(source string) ([]*Entry, error)
+	Save(e *Entry) error
+	Delete(id string) error
+}
+
+// Storage is the tag storage. The entries of a source are loaded on first
+// use and kept in memory, so listings can show tags without a query per
+// item. Writes go to the backend right away.
+type Storage struct {
+	back    StorageBackend
+	mu      sync.Mutex
+	sources map[string]map[string]*Entry // source -> path -> entry
+}
+
+// NewStorage creates a tag storage from a backend.
+func NewStorage(back StorageBackend) *Storage {
+	return &Storage{
+		back:    back,
+		sources: map[string]map[string]*Entry{},
+	}
+}
+
+// entries returns the entries of a source by path, s.mu must be held.
+func (s *Storage) entries(source string) (map[string]*Entry, error) {
+	if entries, ok := s.sources[source]; ok {
+		return entries, nil
+	}
+	list, err := s.back.BySource(source)
+	if err != nil && err != errors.ErrNotExist {
+		return nil, err
+	}
+	entries := make(map[string]*Entry, len(list))
+	for _, entry := range list {
+		entries[entry.Path] = entry
+	}
+	s.sources[source] = entries
+	return entries, nil
+}
+
+// Get returns the entry of a path, or errors.ErrNotExist if it has no tags
+// or metadata.
+func (s *Storage) Get(source, path string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.entries(source)
+	if err != nil {
+		return nil, err
+	}
+	entry, ok := entries[path]
+	if !ok {
+		return nil, errors.ErrNotExist
+	}
+	return entry.clone(), nil
+}
+
+// Children returns the entries of the items directly inside the folder dir
+// by item name.
+func (s *Storage) Children(source, dir string) (map[string]*Entry, error) {
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.entries(source)
+	if err != nil {
+		return nil, err
+	}
+	children := map[string]*Entry{}
+	for path, entry := range entries {
+		if !strings.HasPrefix(path, dir) {
+			continue
+		}
+		name := strings.TrimSuffix(path[len(dir):], "/")
+		if name != "" && !strings.Contains(name, "/") {
+			children[name] = entry.clone()
+		}
+	}
+	return children, nil
+}
+
+// Update applies a change to the entries of the given paths. Paths without
+// tags and metadata left are removed. All paths are validated before any
+// of them is changed.
+func (s *Storage) Update(source string, paths []string, change Change, username string) ([]*Entry, error) {
+	if err := change.normalize(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.entries(source)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := make([]*Entry, 0, len(paths))
+	for _, path := range paths {
+		entry := &Entry{ID: EntryID(source, path), Source: source, Path: path}
+		if existing, ok := entries[path]; ok {
+			entry = existing.clone()
+		}
+		if err = entry.apply(change); err != nil {
+			return nil, err
+		}
+		entry.UpdatedAt = time.Now().Unix()
+		entry.UpdatedBy = username
+		updated = append(updated, entry)
+	}
+	for _, entry := range updated {
+		if entry.empty() {
+			err = s.back.Delete(entry.ID)
+			delete(entries, entry.Path)
+		} else {
+			err = s.back.Save(entry)
+			entries[entry.Path] = entry
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := make([]*Entry, len(updated))
+	for i, entry := range updated {
+		result[i] = entry.clone()
+	}
+	return result, nil
+}
+
+// below reports whether the entry at path belongs to the item at target,
+// which is either the item itself or, for folders, anything inside it.
+func below(path, target string) bool {
+	target = strings.TrimSuffix(target, "/")
+	return path == target || strings.HasPrefix(path, target+"/")
+}
+
+// Remove drops the entries of a deleted file or folder, including all
+// items inside the folder.
+func (s *Storage) Remove(source, path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.entries(source)
+	if err != nil {
+		return err
+	}
+	for entryPath, entry := range entries {
+		if !below(entryPath, path) {
+			continue
+		}
+		if err = s.back.Delete(entry.ID); err != nil {
+			return err
+		}
+		delete(entries, entryPath)
+	}
+	return nil
+}
+
+// Move moves the entries of a file or folder, including the items inside
+// the folder, to their new location. The new location may be on another
+// source.
+func (s *Storage) Move(fromSource, from, toSource, to string) error {
+	return s.transfer(fromSource, from, toSource, to, true)
+}
+
+// Copy copies the entries of a file or folder to a copy of it.
+func (s *Storage) Copy(fromSource, from, toSource, to string) error {
+	return s.transfer(fromSource, from, toSource, to, false)
+}
+
+func (s *Storage) transfer(fromSource, from, toSource, to string, move bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, err := s.entries(fromSource)
+	if err != nil {
+		return err
+	}
+	dst, err := s.entries(toSource)
+	if err != nil {
+		return err
+	}
+	from = strings.TrimSuffix(from, "/")
+	to = strings.TrimSuffix(to, "/")
+	if fromSource == toSource && from == to {
+		return nil
+	}
+	var matched []*Entry
+	for path, entry := range src {
+		if below(path, from) {
+			matched = append(matched, entry)
+		}
+	}
+	for _, entry := range matched {
+		path := entry.Path
+		moved := entry.clone()
+		moved.Source = toSource
+		moved.Path = to + path[len(from):]
+		moved.ID = EntryID(toSource, moved.Path)
+		if err = s.back.Save(moved); err != nil {
+			return err
+		}
+		if move {
+			if err = s.back.Delete(entry.ID); err != nil {
+				return err
+			}
+			delete(src, path)
+		}
+		dst[moved.Path] = moved
+	}
+	return nil
+}
+
+// Find returns the entries below scope that have all of the given tags,
+// sorted by path.
+func (s *Storage) Find(source, scope string, tags []string) ([]*Entry, error) {
+	scope = strings.TrimSuffix(scope, "/") + "/"
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.entries(source)
+	if err != nil {
+		return nil, err
+	}
+	found := []*Entry{}
+	for path, entry := range entries {
+		if strings.HasPrefix(path, scope) && entry.HasTags(tags) {
+			found = append(found, entry.clone())
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].Path < found[j].Path
+	})
+	return found, nil
+}
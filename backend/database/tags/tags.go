@@ -0,0 +1,182 @@
+// Package tags stores user defined tags and key/value metadata of files
+// and folders, keyed by source and index path.
+package tags
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+)
+
+const (
+	maxTagLength     = 64
+	maxMetadataKey   = 64
+	maxMetadataValue = 1024
+	maxTagsPerItem   = 100
+	maxMetadataKeys  = 100
+)
+
+// Entry holds the tags and metadata of one file or folder. Folder paths end
+// with a slash.
+type Entry struct {
+	ID        string            `json:"-" storm:"id"`         // derived from source and path, see EntryID
+	Source    string            `json:"source" storm:"index"` // path of the source
+	Path      string            `json:"path"`
+	Tags      []string          `json:"tags"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	UpdatedAt int64             `json:"updatedAt"`
+	UpdatedBy string            `json:"updatedBy,omitempty"`
+}
+
+// Change describes an update of the tags and metadata of items.
+type Change struct {
+	ClearTags      bool              `json:"clearTags"`      // remove all tags before adding
+	AddTags        []string          `json:"addTags"`        // tags to add
+	RemoveTags     []string          `json:"removeTags"`     // tags to remove
+	ClearMetadata  bool              `json:"clearMetadata"`  // remove all metadata before setting
+	Metadata       map[string]string `json:"metadata"`       // metadata to set
+	RemoveMetadata []string          `json:"removeMetadata"` // metadata keys to remove
+}
+
+// EntryID returns the id an entry is stored under.
+func EntryID(source, path string) string {
+	sum := sha256.Sum256([]byte(source + "\x00" + path))
+	return hex.EncodeToString(sum[:16])
+}
+
+// HasTags reports whether the entry has all of the given tags.
+func (e *Entry) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !e.hasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Entry) hasTag(tag string) bool {
+	i := sort.SearchStrings(e.Tags, tag)
+	return i < len(e.Tags) && e.Tags[i] == tag
+}
+
+func (e *Entry) empty() bool {
+	return len(e.Tags) == 0 && len(e.Metadata) == 0
+}
+
+func (e *Entry) clone() *Entry {
+	c := *e
+	c.Tags = append([]string{}, e.Tags...)
+	if e.Metadata != nil {
+		c.Metadata = make(map[string]string, len(e.Metadata))
+		for key, value := range e.Metadata {
+			c.Metadata[key] = value
+		}
+	}
+	return &c
+}
+
+// apply changes the entry, the change must be normalized.
+func (e *Entry) apply(change Change) error {
+	set := map[string]bool{}
+	if !change.ClearTags {
+		for _, tag := range e.Tags {
+			set[tag] = true
+		}
+	}
+	for _, tag := range change.AddTags {
+		set[tag] = true
+	}
+	for _, tag := range change.RemoveTags {
+		delete(set, tag)
+	}
+	if len(set) > maxTagsPerItem {
+		return fmt.Errorf("%w: more than %d tags", errors.ErrInvalidTag, maxTagsPerItem)
+	}
+	e.Tags = make([]string, 0, len(set))
+	for tag := range set {
+		e.Tags = append(e.Tags, tag)
+	}
+	sort.Strings(e.Tags)
+
+	if change.ClearMetadata || e.Metadata == nil {
+		e.Metadata = map[string]string{}
+	}
+	for key, value := range change.Metadata {
+		e.Metadata[key] = value
+	}
+	for _, key := range change.RemoveMetadata {
+		delete(e.Metadata, key)
+	}
+	if len(e.Metadata) > maxMetadataKeys {
+		return fmt.Errorf("%w: more than %d metadata keys", errors.ErrInvalidTag, maxMetadataKeys)
+	}
+	if len(e.Metadata) == 0 {
+		e.Metadata = nil
+	}
+	return nil
+}
+
+// NormalizeTag trims and lowercases a tag, so "Approved" and "approved "
+// are the same tag.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || len(tag) > maxTagLength || strings.ContainsAny(tag, ",") || strings.IndexFunc(tag, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("%w: %q", errors.ErrInvalidTag, tag)
+	}
+	return tag, nil
+}
+
+// ParseTags splits a comma separated list of tags, as used in query
+// parameters.
+func ParseTags(list string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(list, ",") {
+		if strings.TrimSpace(tag) == "" {
+			continue
+		}
+		tag, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+func (c *Change) normalize() error {
+	for _, list := range []*[]string{&c.AddTags, &c.RemoveTags} {
+		for i, tag := range *list {
+			tag, err := NormalizeTag(tag)
+			if err != nil {
+				return err
+			}
+			(*list)[i] = tag
+		}
+	}
+	for key, value := range c.Metadata {
+		if err := validateMetadata(key, value); err != nil {
+			return err
+		}
+	}
+	for _, key := range c.RemoveMetadata {
+		if err := validateMetadata(key, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateMetadata(key, value string) error {
+	if strings.TrimSpace(key) != key || key == "" || len(key) > maxMetadataKey || strings.IndexFunc(key, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: invalid metadata key %q", errors.ErrInvalidTag, key)
+	}
+	if len(value) > maxMetadataValue {
+		return fmt.Errorf("%w: metadata value of %q is longer than %d bytes", errors.ErrInvalidTag, key, maxMetadataValue)
+	}
+	return nil
+}
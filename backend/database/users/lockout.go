@@ -0,0 +1,81 @@
+package users
+
+import (
+	"time"
+)
+
+// LockoutPolicy describes when repeated failed logins lock an account.
+type LockoutPolicy struct {
+	Threshold       int `json:"threshold"`       // failed password or OTP attempts before the account is locked, 0 disables lockout
+	DurationMinutes int `json:"durationMinutes"` // minutes the account stays locked (default: 15)
+}
+
+// Duration returns how long an account stays locked.
+func (p LockoutPolicy) Duration() time.Duration {
+	if p.DurationMinutes <= 0 {
+		return 15 * time.Minute
+	}
+	return time.Duration(p.DurationMinutes) * time.Minute
+}
+
+// IsLocked reports whether the account is currently locked out.
+func (u *User) IsLocked() bool {
+	return u.LockedUntil > time.Now().Unix()
+}
+
+// RegisterFailedLogin increments the failed attempt counter of a user and
+// locks the account once the threshold is reached. It returns true if the
+// account is locked after this attempt.
+func (s *Storage) RegisterFailedLogin(user *User, policy LockoutPolicy) (bool, error) {
+	if policy.Threshold <= 0 {
+		return false, nil
+	}
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	// re-read so concurrent attempts are counted against the stored value
+	current, err := s.back.GetBy(user.ID)
+	if err != nil {
+		return false, err
+	}
+	attempts := current.FailedLoginAttempts
+	if current.LockedUntil != 0 && !current.IsLocked() {
+		// previous lock has expired, start counting again
+		attempts = 0
+	}
+	attempts++
+	lockedUntil := int64(0)
+	if attempts >= policy.Threshold {
+		lockedUntil = time.Now().Add(policy.Duration()).Unix()
+		attempts = 0
+	}
+	err = s.back.SetLoginAttempts(user.ID, attempts, lockedUntil)
+	if err != nil {
+		return false, err
+	}
+	user.FailedLoginAttempts = attempts
+	user.LockedUntil = lockedUntil
+	return lockedUntil != 0, nil
+}
+
+// ResetFailedLogins clears the failed attempt counter after a successful login.
+func (s *Storage) ResetFailedLogins(user *User) error {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == 0 {
+		return nil
+	}
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	err := s.back.SetLoginAttempts(user.ID, 0, 0)
+	if err != nil {
+		return err
+	}
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = 0
+	return nil
+}
+
+// Unlock removes a lockout from an account.
+func (s *Storage) Unlock(id uint) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	return s.back.SetLoginAttempts(id, 0, 0)
+}
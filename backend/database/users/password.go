@@ -1,16 +1,45 @@
 package users
 
 import (
-	"golang.org/x/crypto/bcrypt"
+	"sync"
+
+	"github.com/SlepoyShaman/FileStorage/backend/sevices/password_hash"
+)
+
+var (
+	hasherMu sync.RWMutex
+	hasher   password_hash.PasswordHasher = password_hash.NewStrategy(password_hash.NewBcryptHasher(0))
 )
 
+// SetPasswordHasher replaces the strategy used by HashPwd and CheckPwd.
+// Called once at startup with the configured algorithm.
+func SetPasswordHasher(h password_hash.PasswordHasher) {
+	hasherMu.Lock()
+	defer hasherMu.Unlock()
+	hasher = h
+}
+
+func getPasswordHasher() password_hash.PasswordHasher {
+	hasherMu.RLock()
+	defer hasherMu.RUnlock()
+	return hasher
+}
+
 // HashPwd hashes a password.
 func HashPwd(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(bytes), err
+	return getPasswordHasher().Hash(password)
 }
 
 // CheckPwd checks if a password is correct.
 func CheckPwd(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if !getPasswordHasher().Verify(password, hash) {
+		return password_hash.ErrMismatchedHashAndPassword
+	}
+	return nil
+}
+
+// NeedsRehash reports whether a stored hash was made with an outdated
+// algorithm or cost and should be replaced on the next successful login.
+func NeedsRehash(hash string) bool {
+	return getPasswordHasher().NeedsRehash(hash)
 }
@@ -0,0 +1,145 @@
+package users
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+)
+
+//go:embed commonPasswords.txt
+var commonPasswordsRaw string
+
+// loaded once on first use, keys are lower case
+var commonPasswords = sync.OnceValue(func() map[string]struct{} {
+	list := map[string]struct{}{}
+	for _, line := range strings.Split(commonPasswordsRaw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		list[strings.ToLower(line)] = struct{}{}
+	}
+	return list
+})
+
+// PasswordPolicy describes the rules new passwords must satisfy.
+type PasswordPolicy struct {
+	RequireUppercase bool `json:"requireUppercase"` // require at least one uppercase letter
+	RequireLowercase bool `json:"requireLowercase"` // require at least one lowercase letter
+	RequireNumber    bool `json:"requireNumber"`    // require at least one digit
+	RequireSymbol    bool `json:"requireSymbol"`    // require at least one symbol or punctuation character
+	DenyCommon       bool `json:"denyCommon"`       // reject passwords found in the bundled list of common passwords
+	HistoryCount     int  `json:"historyCount"`     // number of previous passwords that cannot be reused, 0 disables the check
+	MaxAgeDays       int  `json:"maxAgeDays"`       // days before a password must be changed at next login, 0 disables expiry
+}
+
+// CheckPasswordPolicy validates a plaintext password against the minimum length and policy.
+// The returned error is an *errors.LocalizedError describing the first violation.
+func CheckPasswordPolicy(password string, minLength int, policy PasswordPolicy) error {
+	if utf8.RuneCountInString(password) < minLength {
+		return policyError("tooShort", fmt.Sprintf("password must be at least %d characters long", minLength), map[string]any{"min": minLength})
+	}
+	var upper, lower, number, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			number = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+	if policy.RequireUppercase && !upper {
+		return policyError("missingUppercase", "password must contain at least one uppercase letter", nil)
+	}
+	if policy.RequireLowercase && !lower {
+		return policyError("missingLowercase", "password must contain at least one lowercase letter", nil)
+	}
+	if policy.RequireNumber && !number {
+		return policyError("missingNumber", "password must contain at least one number", nil)
+	}
+	if policy.RequireSymbol && !symbol {
+		return policyError("missingSymbol", "password must contain at least one symbol", nil)
+	}
+	if policy.DenyCommon && IsCommonPassword(password) {
+		return policyError("tooCommon", "password is too common, please choose a different one", nil)
+	}
+	return nil
+}
+
+// IsCommonPassword reports whether the password appears in the bundled denylist.
+func IsCommonPassword(password string) bool {
+	_, ok := commonPasswords()[strings.ToLower(password)]
+	return ok
+}
+
+// CheckPasswordHistory returns an error if the plaintext password matches the
+// current hash or one of the last historyCount hashes of the user.
+func CheckPasswordHistory(password string, existing *User, historyCount int) error {
+	if historyCount <= 0 || existing == nil {
+		return nil
+	}
+	hashes := []string{existing.Password}
+	hashes = append(hashes, existing.PasswordHistory...)
+	if len(hashes) > historyCount {
+		hashes = hashes[:historyCount]
+	}
+	for _, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+		if CheckPwd(password, hash) == nil {
+			return policyError("reused", fmt.Sprintf("password was used recently, the last %d passwords cannot be reused", historyCount), map[string]any{"count": historyCount})
+		}
+	}
+	return nil
+}
+
+// RecordPasswordChange updates the password bookkeeping fields on user after a
+// password change. The previous hash of existing is pushed onto the history.
+func RecordPasswordChange(user, existing *User, historyCount int) {
+	user.PasswordHistory = nil
+	if historyCount > 0 && existing != nil {
+		history := []string{}
+		if existing.Password != "" {
+			history = append(history, existing.Password)
+		}
+		history = append(history, existing.PasswordHistory...)
+		if len(history) > historyCount {
+			history = history[:historyCount]
+		}
+		user.PasswordHistory = history
+	}
+	user.PasswordChangedAt = time.Now().Unix()
+	user.ForcePasswordChange = false
+}
+
+// PasswordChangeRequired reports whether a password user must change their
+// password before logging in, either because an admin forced a reset or the
+// password is older than maxAgeDays.
+func PasswordChangeRequired(user *User, maxAgeDays int) bool {
+	if user.LoginMethod != LoginMethodPassword {
+		return false
+	}
+	if user.ForcePasswordChange {
+		return true
+	}
+	if maxAgeDays <= 0 || user.PasswordChangedAt == 0 {
+		return false
+	}
+	expires := time.Unix(user.PasswordChangedAt, 0).Add(time.Duration(maxAgeDays) * 24 * time.Hour)
+	return time.Now().After(expires)
+}
+
+func policyError(key, message string, params map[string]any) error {
+	return errors.NewLocalized(errors.ErrPasswordPolicyViolation, "passwordPolicy."+key, message, params)
+}
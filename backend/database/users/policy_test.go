@@ -0,0 +1,127 @@
+package users
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	fberrors "github.com/SlepoyShaman/FileStorage/backend/common/errors"
+)
+
+func TestCheckPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{
+		RequireUppercase: true,
+		RequireLowercase: true,
+		RequireNumber:    true,
+		RequireSymbol:    true,
+		DenyCommon:       true,
+	}
+	tests := []struct {
+		password string
+		key      string
+	}{
+		{"Ab1!", "passwordPolicy.tooShort"},
+		{"Äb1!", "passwordPolicy.tooShort"}, // 5 bytes, but only 4 characters
+		{"abcdef1!", "passwordPolicy.missingUppercase"},
+		{"ABCDEF1!", "passwordPolicy.missingLowercase"},
+		{"Abcdefg!", "passwordPolicy.missingNumber"},
+		{"Abcdefg1", "passwordPolicy.missingSymbol"},
+		{"Correct-Horse-9", ""},
+	}
+	for _, tt := range tests {
+		err := CheckPasswordPolicy(tt.password, 5, policy)
+		if tt.key == "" {
+			if err != nil {
+				t.Errorf("password %q: expected no error, got %v", tt.password, err)
+			}
+			continue
+		}
+		var localized *fberrors.LocalizedError
+		if !errors.As(err, &localized) {
+			t.Fatalf("password %q: expected localized error, got %v", tt.password, err)
+		}
+		if localized.Key != tt.key {
+			t.Errorf("password %q: expected key %s, got %s", tt.password, tt.key, localized.Key)
+		}
+		if !errors.Is(err, fberrors.ErrPasswordPolicyViolation) {
+			t.Errorf("password %q: expected error to wrap ErrPasswordPolicyViolation", tt.password)
+		}
+	}
+}
+
+func TestCheckPasswordPolicyDenyCommon(t *testing.T) {
+	err := CheckPasswordPolicy("Password123", 5, PasswordPolicy{DenyCommon: true})
+	if err == nil {
+		t.Fatal("expected common password to be rejected")
+	}
+	err = CheckPasswordPolicy("Password123", 5, PasswordPolicy{})
+	if err != nil {
+		t.Errorf("expected common password to be allowed when denyCommon is disabled: %v", err)
+	}
+}
+
+func TestCheckPasswordHistory(t *testing.T) {
+	hash := func(p string) string {
+		h, err := HashPwd(p)
+		if err != nil {
+			t.Fatalf("failed to hash password: %v", err)
+		}
+		return h
+	}
+	existing := &User{
+		NonAdminEditable: NonAdminEditable{Password: hash("current")},
+		PasswordHistory:  []string{hash("previous"), hash("oldest")},
+	}
+	if err := CheckPasswordHistory("current", existing, 2); err == nil {
+		t.Error("expected current password to be rejected")
+	}
+	if err := CheckPasswordHistory("previous", existing, 2); err == nil {
+		t.Error("expected previous password to be rejected")
+	}
+	if err := CheckPasswordHistory("oldest", existing, 2); err != nil {
+		t.Errorf("expected password outside of history window to be allowed: %v", err)
+	}
+	if err := CheckPasswordHistory("current", existing, 0); err != nil {
+		t.Errorf("expected history check to be disabled: %v", err)
+	}
+}
+
+func TestRecordPasswordChange(t *testing.T) {
+	existing := &User{
+		NonAdminEditable: NonAdminEditable{Password: "hash-2"},
+		PasswordHistory:  []string{"hash-1", "hash-0"},
+	}
+	user := &User{ForcePasswordChange: true}
+	RecordPasswordChange(user, existing, 2)
+	if len(user.PasswordHistory) != 2 || user.PasswordHistory[0] != "hash-2" || user.PasswordHistory[1] != "hash-1" {
+		t.Errorf("unexpected password history: %v", user.PasswordHistory)
+	}
+	if user.ForcePasswordChange {
+		t.Error("expected forced password change to be cleared")
+	}
+	if user.PasswordChangedAt == 0 {
+		t.Error("expected password change time to be set")
+	}
+}
+
+func TestPasswordChangeRequired(t *testing.T) {
+	user := &User{LoginMethod: LoginMethodPassword, PasswordChangedAt: time.Now().Add(-48 * time.Hour).Unix()}
+	if !PasswordChangeRequired(user, 1) {
+		t.Error("expected password older than max age to require a change")
+	}
+	if PasswordChangeRequired(user, 0) {
+		t.Error("expected expiry to be disabled when max age is 0")
+	}
+	user.PasswordChangedAt = time.Now().Unix()
+	if PasswordChangeRequired(user, 1) {
+		t.Error("expected recently changed password to be valid")
+	}
+	user.ForcePasswordChange = true
+	if !PasswordChangeRequired(user, 0) {
+		t.Error("expected forced reset to require a change")
+	}
+	proxyUser := &User{LoginMethod: LoginMethodProxy, ForcePasswordChange: true}
+	if PasswordChangeRequired(proxyUser, 0) {
+		t.Error("expected non password users to never require a change")
+	}
+}
@@ -16,6 +16,8 @@ type StorageBackend interface {
 	Update(u *User, adminActor bool, fields ...string) error
 	DeleteByID(uint) error
 	DeleteByUsername(string) error
+	SetPasswordHash(id uint, hash string) error
+	SetLoginAttempts(id uint, failedAttempts int, lockedUntil int64) error
 }
 
 // Store is an interface for user storage.
@@ -70,6 +72,7 @@ type Storage struct {
 	back    StorageBackend
 	updated map[uint]int64
 	mux     sync.RWMutex
+	loginMu sync.Mutex // serializes failed login bookkeeping
 }
 
 // NewStorage creates a users storage from a backend.
@@ -150,6 +153,21 @@ func (s *Storage) DeleteApiKey(userID uint, name string) error {
 	return nil
 }
 
+// RehashPassword replaces the stored hash of user with a hash of password made
+// with the current algorithm. The password must already have been verified.
+func (s *Storage) RehashPassword(user *User, password string) error {
+	hash, err := HashPwd(password)
+	if err != nil {
+		return err
+	}
+	err = s.back.SetPasswordHash(user.ID, hash)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	return nil
+}
+
 // Save saves the user in a storage.
 func (s *Storage) Save(user *User, changePass, disableScopeChange bool) error {
 	return s.back.Save(user, changePass, disableScopeChange)
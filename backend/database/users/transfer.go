@@ -0,0 +1,241 @@
+package users
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TransferRecord is the portable representation of a user used by bulk
+// import and export. Exports never contain passwords or other secrets such
+// as TOTP secrets and api keys.
+//
+// On import, nil fields keep the current value of an existing user or use
+// the user defaults for a new one.
+type TransferRecord struct {
+	Username     string        `json:"username"`
+	LoginMethod  LoginMethod   `json:"loginMethod,omitempty"`
+	Password     string        `json:"password,omitempty"` // plaintext password, import only
+	Scopes       []SourceScope `json:"scopes,omitempty"`
+	Permissions  *Permissions  `json:"permissions,omitempty"`
+	Groups       []string      `json:"groups,omitempty"`
+	LockPassword *bool         `json:"lockPassword,omitempty"`
+	// Line is where the record starts in the import file, the csv file line
+	// or the position in the json array, starting at 1.
+	Line int `json:"-"`
+}
+
+// TransferColumns are the csv columns used by bulk import and export.
+// Lists are separated by ";" and scopes are written as "source:path".
+var TransferColumns = []string{"username", "loginMethod", "password", "scopes", "permissions", "groups", "lockPassword"}
+
+// NewTransferRecord creates an export record for a user. Scopes are
+// expected to already be converted to source names.
+func NewTransferRecord(user *User, groups []string) TransferRecord {
+	perms := user.Permissions
+	lockPassword := user.LockPassword
+	return TransferRecord{
+		Username:     user.Username,
+		LoginMethod:  user.LoginMethod,
+		Scopes:       user.Scopes,
+		Permissions:  &perms,
+		Groups:       groups,
+		LockPassword: &lockPassword,
+	}
+}
+
+// ParseTransferJSON reads import records from a json array.
+func ParseTransferJSON(r io.Reader) ([]TransferRecord, error) {
+	var records []TransferRecord
+	if err := json.NewDecoder(r).Decode(&records); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+	for i := range records {
+		records[i].Line = i + 1
+	}
+	return records, nil
+}
+
+// ParseTransferCSV reads import records from csv. The first row must be a
+// header naming a subset of TransferColumns, "username" is required. Empty
+// cells are treated as not set.
+func ParseTransferCSV(r io.Reader) ([]TransferRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		known := false
+		for _, col := range TransferColumns {
+			if strings.EqualFold(name, col) {
+				columns[col] = i
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown csv column: %q", name)
+		}
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, fmt.Errorf("csv is missing the username column")
+	}
+
+	records := []TransferRecord{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// quoted cells can span lines, so ask the reader where the row starts
+		line, _ := reader.FieldPos(0)
+		cell := func(col string) string {
+			i, ok := columns[col]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		record := TransferRecord{
+			Username:    cell("username"),
+			LoginMethod: LoginMethod(cell("loginMethod")),
+			Password:    cell("password"),
+			Scopes:      parseScopeList(cell("scopes")),
+			Groups:      splitList(cell("groups")),
+			Line:        line,
+		}
+		if v := cell("permissions"); v != "" {
+			perms, err := ParsePermissionList(v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			record.Permissions = &perms
+		}
+		if v := cell("lockPassword"); v != "" {
+			lock, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid lockPassword value %q", line, v)
+			}
+			record.LockPassword = &lock
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// WriteTransferCSV writes export records as csv. The password column is
+// never written.
+func WriteTransferCSV(w io.Writer, records []TransferRecord) error {
+	writer := csv.NewWriter(w)
+	columns := []string{}
+	for _, col := range TransferColumns {
+		if col != "password" {
+			columns = append(columns, col)
+		}
+	}
+	if err := writer.Write(columns); err != nil {
+		return err
+	}
+	for _, record := range records {
+		scopes := make([]string, 0, len(record.Scopes))
+		for _, scope := range record.Scopes {
+			scopes = append(scopes, scope.Name+":"+scope.Scope)
+		}
+		perms, lock := "", ""
+		if record.Permissions != nil {
+			perms = strings.Join(record.Permissions.Names(), ";")
+		}
+		if record.LockPassword != nil {
+			lock = strconv.FormatBool(*record.LockPassword)
+		}
+		err := writer.Write([]string{
+			record.Username,
+			string(record.LoginMethod),
+			strings.Join(scopes, ";"),
+			perms,
+			strings.Join(record.Groups, ";"),
+			lock,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (p *Permissions) byName() map[string]*bool {
+	return map[string]*bool{
+		"api":      &p.Api,
+		"admin":    &p.Admin,
+		"modify":   &p.Modify,
+		"share":    &p.Share,
+		"realtime": &p.Realtime,
+		"delete":   &p.Delete,
+		"create":   &p.Create,
+		"download": &p.Download,
+	}
+}
+
+// Names returns the sorted names of the granted permissions.
+func (p Permissions) Names() []string {
+	names := []string{}
+	for name, granted := range p.byName() {
+		if *granted {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParsePermissionList parses a ";" separated list of permission names,
+// eg. "modify;share;download". Permissions not listed are not granted.
+func ParsePermissionList(list string) (Permissions, error) {
+	var perms Permissions
+	byName := perms.byName()
+	for _, name := range splitList(list) {
+		granted, ok := byName[strings.ToLower(name)]
+		if !ok {
+			return perms, fmt.Errorf("unknown permission %q", name)
+		}
+		*granted = true
+	}
+	return perms, nil
+}
+
+func parseScopeList(list string) []SourceScope {
+	items := splitList(list)
+	if items == nil {
+		return nil
+	}
+	scopes := make([]SourceScope, 0, len(items))
+	for _, item := range items {
+		name, scope, _ := strings.Cut(item, ":")
+		scopes = append(scopes, SourceScope{Name: name, Scope: scope})
+	}
+	return scopes
+}
+
+func splitList(list string) []string {
+	if list == "" {
+		return nil
+	}
+	items := []string{}
+	for _, item := range strings.Split(list, ";") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
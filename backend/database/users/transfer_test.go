@@ -0,0 +1,110 @@
+package users
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseTransferCSV(t *testing.T) {
+	input := `username,loginMethod,password,scopes,permissions,groups,lockPassword
+alice,password,Secret-123,default:/alice;media:,modify;share,staff;editors,true
+bob,proxy,,,,,
+`
+	records, err := ParseTransferCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("failed to parse csv: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	alice := records[0]
+	if alice.Username != "alice" || alice.Password != "Secret-123" || alice.LoginMethod != LoginMethodPassword {
+		t.Errorf("unexpected record: %+v", alice)
+	}
+	if len(alice.Scopes) != 2 || alice.Scopes[0] != (SourceScope{Name: "default", Scope: "/alice"}) || alice.Scopes[1] != (SourceScope{Name: "media"}) {
+		t.Errorf("unexpected scopes: %v", alice.Scopes)
+	}
+	if alice.Permissions == nil || !alice.Permissions.Modify || !alice.Permissions.Share || alice.Permissions.Admin {
+		t.Errorf("unexpected permissions: %+v", alice.Permissions)
+	}
+	if len(alice.Groups) != 2 || alice.LockPassword == nil || !*alice.LockPassword {
+		t.Errorf("unexpected groups or lockPassword: %v %v", alice.Groups, alice.LockPassword)
+	}
+	bob := records[1]
+	if bob.Scopes != nil || bob.Permissions != nil || bob.Groups != nil || bob.LockPassword != nil {
+		t.Errorf("expected empty cells to be unset: %+v", bob)
+	}
+}
+
+func TestParseTransferCSVErrors(t *testing.T) {
+	if _, err := ParseTransferCSV(strings.NewReader("name,password\nalice,x\n")); err == nil {
+		t.Error("expected unknown column to be rejected")
+	}
+	if _, err := ParseTransferCSV(strings.NewReader("password\nx\n")); err == nil {
+		t.Error("expected missing username column to be rejected")
+	}
+	if _, err := ParseTransferCSV(strings.NewReader("username,permissions\nalice,fly\n")); err == nil {
+		t.Error("expected unknown permission to be rejected")
+	}
+}
+
+func TestTransferRecordLines(t *testing.T) {
+	input := "username,groups\nalice,\"staff;\neditors\"\nbob,\n"
+	records, err := ParseTransferCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("failed to parse csv: %v", err)
+	}
+	if len(records) != 2 || records[0].Line != 2 || records[1].Line != 4 {
+		t.Errorf("expected csv records on file lines 2 and 4, got %+v", records)
+	}
+	_, err = ParseTransferCSV(strings.NewReader("username,lockPassword\nalice,true\nbob,maybe\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected the error on line 3, got %v", err)
+	}
+
+	records, err = ParseTransferJSON(strings.NewReader(`[{"username":"alice"},{"username":"bob"}]`))
+	if err != nil {
+		t.Fatalf("failed to parse json: %v", err)
+	}
+	if len(records) != 2 || records[0].Line != 1 || records[1].Line != 2 {
+		t.Errorf("expected json records at positions 1 and 2, got %+v", records)
+	}
+}
+
+func TestExportHasNoSecrets(t *testing.T) {
+	user := &User{
+		Username:    "alice",
+		LoginMethod: LoginMethodPassword,
+		Permissions: Permissions{Admin: true, Download: true},
+		TOTPSecret:  "totp-secret",
+		ApiKeys:     map[string]AuthToken{"key": {Key: "api-secret"}},
+		NonAdminEditable: NonAdminEditable{
+			Password: "password-hash",
+		},
+	}
+	var buf bytes.Buffer
+	err := WriteTransferCSV(&buf, []TransferRecord{NewTransferRecord(user, []string{"staff"})})
+	if err != nil {
+		t.Fatalf("failed to write csv: %v", err)
+	}
+	out := buf.String()
+	for _, secret := range []string{"password-hash", "totp-secret", "api-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("export contains %q: %s", secret, out)
+		}
+	}
+	header, _, _ := strings.Cut(out, "\n")
+	for _, col := range strings.Split(header, ",") {
+		if col == "password" {
+			t.Errorf("export contains a password column: %s", header)
+		}
+	}
+	records, err := ParseTransferCSV(&buf)
+	if err != nil {
+		t.Fatalf("failed to parse exported csv: %v", err)
+	}
+	if len(records) != 1 || records[0].Username != "alice" || !records[0].Permissions.Admin || records[0].Groups[0] != "staff" {
+		t.Errorf("export did not round trip: %+v", records)
+	}
+}
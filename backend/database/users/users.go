@@ -72,9 +72,14 @@ type User struct {
 	LoginMethod     LoginMethod          `json:"loginMethod"`
 	OtpEnabled      bool                 `json:"otpEnabled"` // true if TOTP is enabled, false otherwise
 	// legacy for migration purposes... og FileStorage has perm attribute
-	Perm           Permissions `json:"perm,omitzero"`
-	Version        int         `json:"version"`
-	ShowFirstLogin bool        `json:"showFirstLogin"`
+	Perm                Permissions `json:"perm,omitzero"`
+	Version             int         `json:"version"`
+	ShowFirstLogin      bool        `json:"showFirstLogin"`
+	PasswordHistory     []string    `json:"-"`                   // previous password hashes, newest first, stored apart from the user by the backends
+	PasswordChangedAt   int64       `json:"passwordChangedAt"`   // unix time of the last password change
+	ForcePasswordChange bool        `json:"forcePasswordChange"` // require a password change at next login
+	FailedLoginAttempts int         `json:"failedLoginAttempts"` // consecutive failed password or OTP attempts
+	LockedUntil         int64       `json:"lockedUntil"`         // unix time until which the account is locked, 0 if not locked
 }
 
 type SourceScope struct {
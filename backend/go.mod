@@ -9,8 +9,15 @@ require (
 	github.com/go-playground/universal-translator v0.18.1 // indirect
 	github.com/go-playground/validator/v10 v10.28.0 // indirect
 	github.com/goccy/go-yaml v1.18.0 // indirect
+	github.com/johannesboyne/gofakes3 v1.2.0
+	github.com/klauspost/compress v1.18.0
 	github.com/leodido/go-urn v1.4.0 // indirect
-	golang.org/x/crypto v0.43.0 // indirect
-	golang.org/x/sys v0.37.0 // indirect
+	github.com/minio/minio-go/v7 v7.0.95
+	github.com/pkg/sftp v1.13.9
+	github.com/rwcarlsen/goexif v0.0.0-20190401172101-9e8deecbddbd
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/crypto v0.43.0
+	golang.org/x/sys v0.37.0
 	golang.org/x/text v0.30.0 // indirect
+	modernc.org/sqlite v1.60.1
 )
@@ -0,0 +1,301 @@
+package http
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Archive formats.
+const (
+	archiveZip   = "zip"
+	archiveTarGz = "tar.gz"
+)
+
+// archiveOptions controls how files are archived.
+type archiveOptions struct {
+	format  string   // zip or tar.gz
+	level   int      // compression level from 0 to 9, flate.DefaultCompression for the default
+	exclude []string // glob patterns of names or paths inside the archive to leave out
+}
+
+// parseArchiveOptions reads the algo, compression and exclude parameters of
+// an archive request. exclude is a comma separated list of glob patterns.
+func parseArchiveOptions(algo, compression, exclude string) (archiveOptions, error) {
+	opts := archiveOptions{level: flate.DefaultCompression}
+	switch algo {
+	case "zip", "true", "":
+		opts.format = archiveZip
+	case "tar.gz":
+		opts.format = archiveTarGz
+	default:
+		return opts, fmt.Errorf("format %s not implemented", algo)
+	}
+	if compression != "" {
+		level, err := strconv.Atoi(compression)
+		if err != nil || level < flate.NoCompression || level > flate.BestCompression {
+			return opts, fmt.Errorf("compression must be between %d and %d", flate.NoCompression, flate.BestCompression)
+		}
+		opts.level = level
+	}
+	for _, pattern := range strings.Split(exclude, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return opts, fmt.Errorf("invalid exclude pattern %q", pattern)
+		}
+		opts.exclude = append(opts.exclude, pattern)
+	}
+	return opts, nil
+}
+
+// extension returns the file extension of the archive.
+func (o archiveOptions) extension() string {
+	return "." + o.format
+}
+
+// stored reports whether zip entries are stored without compression, which
+// makes the size of the archive known before it is written.
+func (o archiveOptions) stored() bool {
+	return o.format == archiveZip && o.level == flate.NoCompression
+}
+
+// excluded reports whether an item matches an exclude pattern, by its name
+// or by its path inside the archive.
+func (o archiveOptions) excluded(archivePath string) bool {
+	name := path.Base(archivePath)
+	for _, pattern := range o.exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, archivePath); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveWriter writes the entries of a zip or tar archive.
+type archiveWriter struct {
+	opts   archiveOptions
+	zip    *zip.Writer
+	tar    *tar.Writer
+	gzip   *gzip.Writer
+	dryRun bool // file contents are not read, only the size of a stored zip is counted
+}
+
+func newArchiveWriter(w io.Writer, opts archiveOptions) (*archiveWriter, error) {
+	aw := &archiveWriter{opts: opts}
+	if opts.format == archiveZip {
+		aw.zip = zip.NewWriter(w)
+		if opts.level != flate.DefaultCompression && !opts.stored() {
+			aw.zip.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+				return flate.NewWriter(out, opts.level)
+			})
+		}
+		return aw, nil
+	}
+	gz, err := gzip.NewWriterLevel(w, opts.level)
+	if err != nil {
+		return nil, err
+	}
+	aw.gzip = gz
+	aw.tar = tar.NewWriter(gz)
+	return aw, nil
+}
+
+// Close writes the end of the archive.
+func (aw *archiveWriter) Close() error {
+	if aw.zip != nil {
+		return aw.zip.Close()
+	}
+	if err := aw.tar.Close(); err != nil {
+		return err
+	}
+	return aw.gzip.Close()
+}
+
+// writeDir adds a folder entry.
+func (aw *archiveWriter) writeDir(archivePath string, info os.FileInfo) error {
+	if aw.tar != nil {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = archivePath + "/"
+		return aw.tar.WriteHeader(header)
+	}
+	header := &zip.FileHeader{Name: archivePath + "/"}
+	if aw.opts.stored() {
+		header.SetModTime(info.ModTime())
+		_, err := aw.zip.CreateRaw(header)
+		return err
+	}
+	header.Modified = info.ModTime()
+	_, err := aw.zip.CreateHeader(header)
+	return err
+}
+
+// writeFile adds a file entry with the contents of r.
+func (aw *archiveWriter) writeFile(archivePath string, info os.FileInfo, r io.Reader) error {
+	if aw.tar != nil {
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = archivePath
+		if err = aw.tar.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err = io.Copy(aw.tar, r)
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = archivePath
+	if !aw.opts.stored() {
+		header.Method = zip.Deflate
+		writer, err := aw.zip.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, r)
+		return err
+	}
+	return aw.writeStoredFile(header, info.Size(), r)
+}
+
+// writeStoredFile writes an uncompressed zip entry. Its sizes go into the
+// header up front and the checksum only into the data descriptor and the
+// central directory, so the layout of the archive doesn't depend on the
+// contents and a dry run gives its exact size.
+func (aw *archiveWriter) writeStoredFile(header *zip.FileHeader, size int64, r io.Reader) error {
+	header.Method = zip.Store
+	header.Flags |= 0x8 // data descriptor
+	if !isASCII(header.Name) && utf8.ValidString(header.Name) {
+		header.Flags |= 0x800 // utf-8 name
+	}
+	header.SetModTime(header.Modified)
+	header.Extra = nil
+	header.CompressedSize64 = uint64(size)
+	header.UncompressedSize64 = uint64(size)
+	writer, err := aw.zip.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	if aw.dryRun {
+		return writeZeros(writer, size)
+	}
+	hash := crc32.NewIEEE()
+	n, err := io.Copy(io.MultiWriter(writer, hash), r)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("%s changed while it was archived", header.Name)
+	}
+	// the writer reads the checksum from the header when the entry is closed
+	header.CRC32 = hash.Sum32()
+	return nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+var zeros = make([]byte, 1<<20)
+
+func writeZeros(w io.Writer, size int64) error {
+	for size > 0 {
+		n := min(size, int64(len(zeros)))
+		if _, err := w.Write(zeros[:n]); err != nil {
+			return err
+		}
+		size -= n
+	}
+	return nil
+}
+
+// writeArchive streams the files to w. progress, if not nil, is called after
+// each of the files with the number done.
+func writeArchive(ctx context.Context, d *requestContext, w io.Writer, opts archiveOptions, progress func(done int), filenames ...string) error {
+	aw, err := newArchiveWriter(w, opts)
+	if err != nil {
+		return err
+	}
+	if err = addFiles(ctx, d, aw, progress, filenames); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+func addFiles(ctx context.Context, d *requestContext, aw *archiveWriter, progress func(done int), filenames []string) error {
+	for i, fname := range filenames {
+		if err := addFile(ctx, fname, d, aw, false); err != nil {
+			return fmt.Errorf("failed to add %s to archive: %v", fname, err)
+		}
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	return nil
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// storedArchiveSize returns the exact size of a stored zip of the files,
+// without reading them.
+func storedArchiveSize(ctx context.Context, d *requestContext, opts archiveOptions, filenames ...string) (int64, error) {
+	counter := &countingWriter{}
+	aw, err := newArchiveWriter(counter, opts)
+	if err != nil {
+		return 0, err
+	}
+	aw.dryRun = true
+	if err = addFiles(ctx, d, aw, nil, filenames); err != nil {
+		return 0, err
+	}
+	if err = aw.Close(); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// createArchive writes the files to an archive at archivePath.
+func createArchive(ctx context.Context, d *requestContext, archivePath string, opts archiveOptions, progress func(done int), filenames ...string) error {
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err = writeArchive(ctx, d, file, opts, progress, filenames...); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,136 @@
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+)
+
+// downloadTestArchive requests an archive of the files through the raw
+// handler.
+func downloadTestArchive(t *testing.T, d *requestContext, query url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	config = &settings.Config
+	r := httptest.NewRequest(http.MethodGet, "/api/raw?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	if status, err := rawHandler(w, r, d); err != nil || (status != 0 && status != http.StatusOK) {
+		t.Fatalf("failed to download %v: %d %v", query.Get("files"), status, err)
+	}
+	return w
+}
+
+// readTestZip returns the contents of the files in a zip by name, with
+// folders as names ending with a slash.
+func readTestZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	entries := map[string]string{}
+	for _, file := range reader.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("failed to open %v: %v", file.Name, err)
+		}
+		// reading to the end checks the CRC
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("failed to read %v: %v", file.Name, err)
+		}
+		entries[file.Name] = string(content)
+	}
+	return entries
+}
+
+func zipNames(entries map[string]string) []string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestStoredZipHasExactLength(t *testing.T) {
+	d, root := setupResourceTest(t)
+	writeTestFiles(t, root, map[string]string{
+		"docs/a.txt":          "a",
+		"docs/sub/b.txt":      strings.Repeat("b", 70000),
+		"docs/sub/deep/c.txt": "",
+		"docs/ünïcode.txt":    "utf-8 name",
+		"d.txt":               "d",
+	})
+
+	w := downloadTestArchive(t, d, url.Values{"files": {"test::/docs||test::/d.txt"}, "compression": {"0"}})
+	body := w.Body.Bytes()
+	length, err := strconv.Atoi(w.Header().Get("Content-Length"))
+	if err != nil {
+		t.Fatalf("expected a Content-Length, got %q", w.Header().Get("Content-Length"))
+	}
+	if len(body) != length {
+		t.Errorf("expected %d bytes as announced, got %d", length, len(body))
+	}
+	entries := readTestZip(t, body)
+	want := map[string]string{
+		"docs/a.txt":          "a",
+		"docs/sub/":           "",
+		"docs/sub/b.txt":      strings.Repeat("b", 70000),
+		"docs/sub/deep/":      "",
+		"docs/sub/deep/c.txt": "",
+		"docs/ünïcode.txt":    "utf-8 name",
+		"d.txt":               "d",
+	}
+	if strings.Join(zipNames(entries), ",") != strings.Join(zipNames(want), ",") {
+		t.Fatalf("expected entries %v, got %v", zipNames(want), zipNames(entries))
+	}
+	for name, content := range want {
+		if entries[name] != content {
+			t.Errorf("unexpected content of %v: %d bytes", name, len(entries[name]))
+		}
+	}
+}
+
+func TestArchiveExcludes(t *testing.T) {
+	d, root := setupResourceTest(t)
+	writeTestFiles(t, root, map[string]string{
+		"docs/a.txt":                 "a",
+		"docs/a.tmp":                 "tmp",
+		"docs/node_modules/x.js":     "x",
+		"docs/sub/b.txt":             "b",
+		"docs/sub/node_modules/y.js": "y",
+		"docs/sub/c.txt":             "c",
+		"skip.tmp":                   "tmp",
+	})
+
+	for _, compression := range []string{"0", "6"} {
+		w := downloadTestArchive(t, d, url.Values{
+			"files":       {"test::/docs||test::/skip.tmp"},
+			"compression": {compression},
+			"exclude":     {"*.tmp, node_modules ,docs/sub/c.txt"},
+		})
+		if compression == "0" && w.Header().Get("Content-Length") != strconv.Itoa(w.Body.Len()) {
+			t.Errorf("expected the Content-Length to leave out excluded items, got %v for %d bytes", w.Header().Get("Content-Length"), w.Body.Len())
+		}
+		got := strings.Join(zipNames(readTestZip(t, w.Body.Bytes())), ",")
+		if want := "docs/a.txt,docs/sub/,docs/sub/b.txt"; got != want {
+			t.Errorf("compression %v: expected %v, got %v", compression, want, got)
+		}
+	}
+
+	// a top level item is matched by its name
+	w := downloadTestArchive(t, d, url.Values{"files": {"test::/docs||test::/skip.tmp"}, "exclude": {"docs"}})
+	if got := strings.Join(zipNames(readTestZip(t, w.Body.Bytes())), ","); got != "skip.tmp" {
+		t.Errorf("expected only skip.tmp, got %v", got)
+	}
+}
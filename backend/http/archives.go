@@ -0,0 +1,120 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/files"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+)
+
+// ArchiveListing is a folder inside an archive.
+type ArchiveListing struct {
+	Format string               `json:"format"`
+	Dir    string               `json:"dir"` // folder inside the archive, empty for the root
+	Items  []files.ArchiveEntry `json:"items"`
+}
+
+// archiveStatus maps errors of reading an archive to status codes.
+func archiveStatus(err error) int {
+	switch err {
+	case errors.ErrUnsupportedArchive:
+		return http.StatusBadRequest
+	case errors.ErrNotExist:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// resolveArchive resolves the archive file of a request.
+func resolveArchive(d *requestContext, r *http.Request) (itemTarget, int, error) {
+	target, status, err := resolveItem(d, r.URL.Query().Get("source"), r.URL.Query().Get("path"))
+	if err != nil {
+		return target, status, err
+	}
+	if strings.HasSuffix(target.path, "/") || files.ArchiveFormat(target.path) == "" {
+		return target, http.StatusBadRequest, errors.ErrUnsupportedArchive
+	}
+	return target, http.StatusOK, nil
+}
+
+// archiveGetHandler lists a folder inside an archive.
+// @Summary List archive contents
+// @Description Lists the files and folders inside a zip, tar, tar.gz, tar.xz or tar.zst archive like a folder. The entries are read once and then served from the cache.
+// @Tags Archives
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the archive"
+// @Param dir query string false "Folder inside the archive, defaults to the root"
+// @Success 200 {object} ArchiveListing "Entries of the folder"
+// @Failure 400 {object} map[string]string "Not a supported archive"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Archive or folder not found"
+// @Router /api/archives [get]
+func archiveGetHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, status, err := resolveArchive(d, r)
+	if err != nil {
+		return status, err
+	}
+	dir := strings.Trim(r.URL.Query().Get("dir"), "/")
+	items, err := files.ListArchive(target.idx.Name, target.path, dir)
+	if err != nil {
+		return archiveStatus(err), err
+	}
+	return renderJSON(w, r, ArchiveListing{
+		Format: files.ArchiveFormat(target.path),
+		Dir:    dir,
+		Items:  items,
+	})
+}
+
+// archiveRawHandler downloads a single file out of an archive.
+// @Summary Download a file from an archive
+// @Description Streams one file inside an archive without extracting the rest. Entries of tar.gz, tar.xz and tar.zst archives are found by decompressing the archive up to the entry.
+// @Tags Archives
+// @Produce octet-stream
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the archive"
+// @Param entry query string true "Path of the file inside the archive"
+// @Param inline query bool false "If true, sets 'Content-Disposition' to 'inline'. Otherwise, defaults to 'attachment'."
+// @Success 200 {file} file "Content of the file"
+// @Failure 400 {object} map[string]string "Not a supported archive"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Archive or entry not found"
+// @Router /api/archives/raw [get]
+func archiveRawHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if !d.user.Permissions.Download {
+		return http.StatusForbidden, fmt.Errorf("user is not allowed to download")
+	}
+	target, status, err := resolveArchive(d, r)
+	if err != nil {
+		return status, err
+	}
+	reader, entry, err := files.OpenArchiveEntry(target.idx.Name, target.path, r.URL.Query().Get("entry"))
+	if err != nil {
+		return archiveStatus(err), err
+	}
+	defer reader.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(entry.Name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	setContentDisposition(w, r, entry.Name)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", entry.Size))
+	w.Header().Set("Cache-Control", "private")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// the response has started, so errors can only end it early
+	if _, err = io.Copy(w, reader); err != nil {
+		slog.Debug("could not stream archive entry", "entry", entry.Path, "archive", target.path, "err", err)
+	}
+	return 0, nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -232,6 +233,131 @@ func signupHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (i
 	return 201, nil
 }
 
+// passwordChangeHandler sets a new password for a user that must change it before logging in.
+// @Summary Change expired password
+// @Description Change the password of a password user with their current credentials. Used when the password has expired or an admin forced a reset. Returns a new token on success.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param username query string true "Username"
+// @Param X-Password header string true "Current password"
+// @Param X-New-Password header string true "New password"
+// @Param X-Secret header string false "TOTP code, required if OTP is enabled for the user"
+// @Success 200 {string} string "JWT token for authentication"
+// @Failure 400 {object} map[string]string "Bad request - password does not meet the password policy"
+// @Failure 401 {object} map[string]string "Unauthorized - invalid credentials"
+// @Failure 403 {object} map[string]string "Forbidden - password is locked"
+// @Router /api/auth/password [put]
+func passwordChangeHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if !config.Auth.Methods.PasswordAuth.Enabled {
+		return http.StatusUnauthorized, errors.ErrUnauthorized
+	}
+	newPassword := r.Header.Get("X-New-Password")
+	if newPassword == "" {
+		return http.StatusBadRequest, fmt.Errorf("new password is required")
+	}
+	auther, err := store.Auth.Get("password")
+	if err != nil {
+		return http.StatusUnauthorized, errors.ErrUnauthorized
+	}
+	jsonAuth, ok := auther.(*auth.JSONAuth)
+	if !ok {
+		return http.StatusUnauthorized, errors.ErrUnauthorized
+	}
+	user, err := jsonAuth.VerifyCredentials(r, store.Users)
+	if err != nil {
+		if err == errors.ErrNoTotpProvided {
+			return http.StatusForbidden, err
+		}
+		if err == errors.ErrAccountLocked {
+			return http.StatusLocked, accountLockedError(r.URL.Query().Get("username"))
+		}
+		return http.StatusUnauthorized, errors.ErrUnauthorized
+	}
+	// a reset forced by an admin overrides lockPassword
+	if user.LockPassword && !user.ForcePasswordChange {
+		return http.StatusForbidden, fmt.Errorf("password cannot be changed when lock password is enabled")
+	}
+	if users.CheckPwd(newPassword, user.Password) == nil {
+		return http.StatusBadRequest, errors.NewLocalized(errors.ErrPasswordPolicyViolation, "passwordPolicy.sameAsCurrent", "new password must be different from the current password", nil)
+	}
+	user.Password = newPassword
+	err = store.Users.Update(user, false, "Password")
+	if err != nil {
+		if libError.Is(err, errors.ErrPasswordPolicyViolation) {
+			return http.StatusBadRequest, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	user, err = store.Users.Get(user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return printToken(w, r, user)
+}
+
+// forcePasswordResetHandler requires a user to change their password at next login.
+// @Summary Force password reset
+// @Description Mark a password user so they must choose a new password at their next login. Existing sessions are rejected until the password is changed.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id query int true "User ID"
+// @Success 200 "Password reset required"
+// @Failure 400 {object} map[string]string "Bad request - invalid user id or login method"
+// @Failure 404 {object} map[string]string "User not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/users/password/reset [post]
+func forcePasswordResetHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid user id: %v", err)
+	}
+	user, err := store.Users.Get(uint(id))
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	if user.LoginMethod != users.LoginMethodPassword {
+		return http.StatusBadRequest, fmt.Errorf("password reset is only available for password login users")
+	}
+	user.ForcePasswordChange = true
+	err = store.Users.Update(user, true, "ForcePasswordChange")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	logger.Infof("admin %v forced a password reset for user %v", d.user.Username, user.Username)
+	return http.StatusOK, nil
+}
+
+// unlockUserHandler removes a lockout caused by repeated failed logins.
+// @Summary Unlock user
+// @Description Clear the failed login counter and lockout of a user account.
+// @Tags Users
+// @Accept json
+// @Produce json
+// @Param id query int true "User ID"
+// @Success 200 "User unlocked"
+// @Failure 400 {object} map[string]string "Bad request - invalid user id"
+// @Failure 404 {object} map[string]string "User not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/users/unlock [post]
+func unlockUserHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 32)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid user id: %v", err)
+	}
+	user, err := store.Users.Get(uint(id))
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	err = store.Users.Unlock(user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	logger.Infof("admin %v unlocked user %v", d.user.Username, user.Username)
+	return http.StatusOK, nil
+}
+
 // renewHandler refreshes the authentication token for a logged-in user.
 // @Summary Renew authentication token
 // @Description Refresh the authentication token for a logged-in user.
@@ -0,0 +1,35 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gtsteffaniak/go-logger/logger"
+)
+
+// backupHandler streams a consistent snapshot of the database.
+// @Summary Download database backup
+// @Description Flush share and access state and stream a consistent snapshot of the database while the server keeps running. Restore it with the dbbackup restore command while the server is stopped.
+// @Tags Database
+// @Produce octet-stream
+// @Success 200 {file} file "Database snapshot"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/database/backup [get]
+func backupHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	name := store.BackupFileName(time.Now())
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	n, err := store.Backup(w)
+	if err != nil {
+		if n == 0 {
+			w.Header().Del("Content-Disposition")
+			return http.StatusInternalServerError, err
+		}
+		// the response has already started, it can only be aborted
+		logger.Errorf("database backup failed after %d bytes: %v", n, err)
+		panic(http.ErrAbortHandler)
+	}
+	logger.Infof("admin %v downloaded a database backup (%d bytes)", d.user.Username, n)
+	return 0, nil
+}
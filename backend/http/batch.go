@@ -0,0 +1,383 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/files"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/common/utils"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+)
+
+const maxBatchOperations = 1000
+
+// Batch actions.
+const (
+	batchCopy   = "copy"
+	batchMove   = "move"
+	batchDelete = "delete"
+	batchMkdir  = "mkdir"
+)
+
+// BatchOperation is a single operation of a batch request.
+type BatchOperation struct {
+	Action    string `json:"action"`    // copy, move, delete or mkdir
+	Source    string `json:"source"`    // source name of path
+	Path      string `json:"path"`      // item to copy, move or delete, or folder to create
+	ToSource  string `json:"toSource"`  // source name of the destination, defaults to source
+	To        string `json:"to"`        // destination path for copy and move
+	Overwrite bool   `json:"overwrite"` // replace an existing item at the destination
+}
+
+// BatchRequest is a list of operations executed in order.
+type BatchRequest struct {
+	Operations  []BatchOperation `json:"operations"`
+	StopOnError bool             `json:"stopOnError"` // skip the remaining operations after the first failure
+	Async       bool             `json:"async"`       // run as a background job and return the job instead of the results
+}
+
+// BatchResult is the outcome of one operation.
+type BatchResult struct {
+	Index   int    `json:"index"`
+	Action  string `json:"action"`
+	Status  int    `json:"status"` // http status of the operation, 0 if skipped
+	Error   string `json:"error,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// BatchResponse holds the results of all operations.
+type BatchResponse struct {
+	Results   []BatchResult `json:"results"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Skipped   int           `json:"skipped"`
+}
+
+// batchPath is a path of an operation, resolved against the user scope.
+type batchPath struct {
+	idx  *indexing.Index
+	path string // index path without trailing slash
+}
+
+// batchItem is a validated operation.
+type batchItem struct {
+	action    string
+	from      batchPath // item to copy, move or delete
+	to        batchPath // destination or folder to create
+	overwrite bool
+}
+
+// refreshSet collects the directories to refresh after a batch, so each is
+// refreshed once.
+type refreshSet map[*indexing.Index]map[string]bool // dir -> recursive
+
+func (s refreshSet) add(idx *indexing.Index, dir string, recursive bool) {
+	if s[idx] == nil {
+		s[idx] = map[string]bool{}
+	}
+	dir = strings.TrimSuffix(dir, "/") + "/"
+	s[idx][dir] = s[idx][dir] || recursive
+}
+
+// addItem adds a changed item: its parent directory and, for folders, the
+// folder itself with everything inside.
+func (s refreshSet) addItem(p batchPath, isDir bool) {
+	s.add(p.idx, utils.GetParentDirectoryPath(p.path), false)
+	if isDir {
+		s.add(p.idx, p.path, true)
+	}
+}
+
+// refresh refreshes the collected directories, skipping those inside a
+// directory that is refreshed recursively.
+func (s refreshSet) refresh() {
+	for idx, dirs := range s {
+		paths := make([]string, 0, len(dirs))
+		for dir := range dirs {
+			paths = append(paths, dir)
+		}
+		sort.Strings(paths)
+		var recursiveDirs []string
+		for _, dir := range paths {
+			covered := false
+			for _, parent := range recursiveDirs {
+				if strings.HasPrefix(dir, parent) {
+					covered = true
+					break
+				}
+			}
+			if covered {
+				continue
+			}
+			if dirs[dir] {
+				recursiveDirs = append(recursiveDirs, dir)
+			}
+			if err := files.RefreshIndex(idx.Name, dir, true, dirs[dir]); err != nil {
+				slog.Debug("could not refresh index", "path", dir, "err", err)
+			}
+		}
+	}
+}
+
+// resolveBatchPath resolves a path of an operation and checks the access
+// rules. The item doesn't need to exist.
+func resolveBatchPath(d *requestContext, source, path string) (batchPath, int, error) {
+	userscope, err := settings.GetScopeFromSourceName(d.user.Scopes, source)
+	if err != nil {
+		return batchPath{}, http.StatusForbidden, err
+	}
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return batchPath{}, http.StatusNotFound, fmt.Errorf("source %s not found", source)
+	}
+	fullPath := strings.TrimSuffix(utils.JoinPathAsUnix(userscope, path), "/")
+	userscope = strings.TrimRight(userscope, "/")
+	// ".." must not leave the user scope
+	if fullPath != userscope && !strings.HasPrefix(fullPath, userscope+"/") {
+		return batchPath{}, http.StatusForbidden, fmt.Errorf("path %s is outside of the user scope", path)
+	}
+	if fullPath == userscope || fullPath == "" {
+		return batchPath{}, http.StatusForbidden, fmt.Errorf("the root of the user scope can't be changed")
+	}
+	if store.Access != nil && !store.Access.Permitted(idx.Path, fullPath, d.user.Username) {
+		return batchPath{}, http.StatusForbidden, fmt.Errorf("access denied to path %s", path)
+	}
+	return batchPath{idx: idx, path: fullPath}, http.StatusOK, nil
+}
+
+// validateBatchOperation checks permissions, access rules and locks of an
+// operation without touching any file.
+func validateBatchOperation(d *requestContext, op BatchOperation) (batchItem, int, error) {
+	item := batchItem{action: op.Action, overwrite: op.Overwrite}
+	perms := d.user.Permissions
+	allowed := map[string]bool{
+		batchCopy:   perms.Create,
+		batchMove:   perms.Modify,
+		batchDelete: perms.Delete,
+		batchMkdir:  perms.Create,
+	}
+	permitted, known := allowed[op.Action]
+	if !known {
+		return item, http.StatusBadRequest, fmt.Errorf("unknown action %q", op.Action)
+	}
+	if !permitted {
+		return item, http.StatusForbidden, fmt.Errorf("user is not allowed to %s", op.Action)
+	}
+
+	var status int
+	var err error
+	switch op.Action {
+	case batchMkdir:
+		item.to, status, err = resolveBatchPath(d, op.Source, op.Path)
+		return item, status, err
+	case batchDelete:
+		if item.from, status, err = resolveBatchPath(d, op.Source, op.Path); err != nil {
+			return item, status, err
+		}
+		if err = fileLocks.CheckTree(item.from.idx.Path, item.from.path, d.user.Username); err != nil {
+			return item, http.StatusLocked, err
+		}
+		if err = files.CheckTreeAccess(item.from.idx.Name, item.from.path, d.user.Username, store.Access); err != nil {
+			return item, http.StatusForbidden, err
+		}
+		return item, http.StatusOK, nil
+	}
+
+	if item.from, status, err = resolveBatchPath(d, op.Source, op.Path); err != nil {
+		return item, status, err
+	}
+	toSource := op.ToSource
+	if toSource == "" {
+		toSource = op.Source
+	}
+	if item.to, status, err = resolveBatchPath(d, toSource, op.To); err != nil {
+		return item, status, err
+	}
+	if item.from.idx == item.to.idx && (item.to.path == item.from.path || strings.HasPrefix(item.to.path, item.from.path+"/")) {
+		return item, http.StatusBadRequest, fmt.Errorf("can't %s %s into itself", op.Action, op.Path)
+	}
+	if op.Action == batchMove {
+		if err = fileLocks.CheckTree(item.from.idx.Path, item.from.path, d.user.Username); err != nil {
+			return item, http.StatusLocked, err
+		}
+	}
+	// the items inside a folder go along with it
+	if err = files.CheckTreeAccess(item.from.idx.Name, item.from.path, d.user.Username, store.Access); err != nil {
+		return item, http.StatusForbidden, err
+	}
+	if op.Overwrite {
+		if err = fileLocks.CheckTree(item.to.idx.Path, item.to.path, d.user.Username); err != nil {
+			return item, http.StatusLocked, err
+		}
+		if err = files.CheckTreeAccess(item.to.idx.Name, item.to.path, d.user.Username, store.Access); err != nil {
+			return item, http.StatusForbidden, err
+		}
+	}
+	return item, http.StatusOK, nil
+}
+
+// executeBatchItem runs a validated operation and records the directories
+// to refresh.
+func executeBatchItem(item batchItem, refresh refreshSet) (int, error) {
+	if item.action == batchMkdir {
+		if stat, err := item.to.idx.FS.Stat(item.to.path); err == nil && !stat.IsDir() {
+			return http.StatusConflict, fmt.Errorf("a file exists at %s", item.to.path)
+		}
+		if err := item.to.idx.FS.MkdirAll(item.to.path); err != nil {
+			return errToStatus(err), err
+		}
+		refresh.addItem(item.to, true)
+		return http.StatusOK, nil
+	}
+
+	stat, err := item.from.idx.FS.Stat(item.from.path)
+	if err != nil {
+		return http.StatusNotFound, fmt.Errorf("path %s not found", item.from.path)
+	}
+	isDir := stat.IsDir()
+	if item.action == batchDelete {
+		if err = files.DeleteItem(item.from.idx.Name, item.from.path); err != nil {
+			return errToStatus(err), err
+		}
+		refresh.addItem(item.from, isDir)
+		removeItemState(item.from)
+		return http.StatusOK, nil
+	}
+
+	existing, statErr := item.to.idx.FS.Stat(item.to.path)
+	replace := statErr == nil
+	if replace && !item.overwrite {
+		return http.StatusConflict, fmt.Errorf("%s already exists", item.to.path)
+	}
+	switch {
+	case replace:
+		// the existing item is kept if the transfer fails
+		err = files.ReplaceItem(item.from.idx.Name, item.from.path, item.to.idx.Name, item.to.path, item.action == batchMove)
+	case item.action == batchCopy:
+		err = files.CopyItem(item.from.idx.Name, item.from.path, item.to.idx.Name, item.to.path)
+	default:
+		err = files.MoveItem(item.from.idx.Name, item.from.path, item.to.idx.Name, item.to.path)
+	}
+	if err != nil {
+		return errToStatus(err), err
+	}
+	if replace {
+		refresh.addItem(item.to, existing.IsDir())
+		removeItemState(item.to)
+	}
+	refresh.addItem(item.to, isDir)
+	if item.action == batchCopy {
+		if err = store.Tags.Copy(item.from.idx.Path, item.from.path, item.to.idx.Path, item.to.path); err != nil {
+			slog.Debug("could not copy tags", "path", item.from.path, "err", err)
+		}
+		return http.StatusOK, nil
+	}
+	refresh.addItem(item.from, isDir)
+	moveItemState(item.from, item.to)
+	return http.StatusOK, nil
+}
+
+// removeItemState drops the tags, favorites and locks of a deleted item.
+func removeItemState(p batchPath) {
+	if err := store.Tags.Remove(p.idx.Path, p.path); err != nil {
+		slog.Debug("could not remove tags", "path", p.path, "err", err)
+	}
+	if err := store.Favorites.Remove(p.idx.Path, p.path); err != nil {
+		slog.Debug("could not remove favorites", "path", p.path, "err", err)
+	}
+	fileLocks.Remove(p.idx.Path, p.path)
+}
+
+// moveItemState moves the tags, favorites and locks of a moved item.
+func moveItemState(from, to batchPath) {
+	if err := store.Tags.Move(from.idx.Path, from.path, to.idx.Path, to.path); err != nil {
+		slog.Debug("could not move tags", "path", from.path, "err", err)
+	}
+	if err := store.Favorites.Move(from.idx.Path, from.path, to.idx.Path, to.path); err != nil {
+		slog.Debug("could not move favorites", "path", from.path, "err", err)
+	}
+	fileLocks.Move(from.idx.Path, from.path, to.idx.Path, to.path)
+}
+
+// batchHandler executes a list of file operations.
+// @Summary Execute file operations in batch
+// @Description Copies, moves, deletes and creates folders for up to 1000 items, also across sources. All operations are checked against permissions, access rules, also of every item inside a folder, and locks before any of them runs; if one is not allowed the request fails without changes. Operations then run in order and report their own result. With overwrite the existing item is only removed once the new one took its place. The index of each affected directory is refreshed once at the end. With async the batch runs as a background job, see /api/jobs.
+// @Tags Resources
+// @Accept json
+// @Produce json
+// @Param body body BatchRequest true "Operations to execute"
+// @Success 200 {object} BatchResponse "Result of each operation, or the queued job for async batches"
+// @Failure 400 {object} map[string]string "Invalid operation"
+// @Failure 403 {object} map[string]string "An operation is not allowed"
+// @Failure 423 {object} map[string]string "An item is locked by another user"
+// @Router /api/resources/batch [post]
+func batchHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	var body BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err)
+	}
+	if len(body.Operations) == 0 || len(body.Operations) > maxBatchOperations {
+		return http.StatusBadRequest, fmt.Errorf("between 1 and %d operations are required", maxBatchOperations)
+	}
+	items, status, err := validateBatch(d, body.Operations)
+	if err != nil {
+		return status, err
+	}
+	if body.Async {
+		return submitBatchJob(w, r, d, body)
+	}
+	return renderJSON(w, r, runBatch(context.Background(), items, body.StopOnError, nil))
+}
+
+// validateBatch validates all operations of a batch, failing on the first
+// invalid one.
+func validateBatch(d *requestContext, operations []BatchOperation) ([]batchItem, int, error) {
+	items := make([]batchItem, len(operations))
+	for i, op := range operations {
+		item, status, err := validateBatchOperation(d, op)
+		if err != nil {
+			return nil, status, fmt.Errorf("operation %d: %v", i, err)
+		}
+		items[i] = item
+	}
+	return items, http.StatusOK, nil
+}
+
+// runBatch executes validated operations in order. Once ctx is canceled the
+// remaining operations are skipped. progress, if not nil, is called after
+// each operation with the number done.
+func runBatch(ctx context.Context, items []batchItem, stopOnError bool, progress func(done int)) BatchResponse {
+	refresh := refreshSet{}
+	response := BatchResponse{Results: make([]BatchResult, len(items))}
+	failed := false
+	for i, item := range items {
+		result := BatchResult{Index: i, Action: item.action}
+		if (failed && stopOnError) || ctx.Err() != nil {
+			result.Skipped = true
+			response.Skipped++
+			response.Results[i] = result
+			continue
+		}
+		status, err := executeBatchItem(item, refresh)
+		result.Status = status
+		if err != nil {
+			result.Error = err.Error()
+			response.Failed++
+			failed = true
+		} else {
+			response.Succeeded++
+		}
+		response.Results[i] = result
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	refresh.refresh()
+	return response
+}
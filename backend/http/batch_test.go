@@ -0,0 +1,183 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func runTestBatch(t *testing.T, d *requestContext, body BatchRequest) (BatchResponse, int, error) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/resources/batch", bytes.NewReader(data))
+	w := httptest.NewRecorder()
+	status, err := batchHandler(w, r, d)
+	var response BatchResponse
+	if err == nil {
+		if decodeErr := json.Unmarshal(w.Body.Bytes(), &response); decodeErr != nil {
+			t.Fatalf("invalid response %q: %v", w.Body.String(), decodeErr)
+		}
+	}
+	return response, status, err
+}
+
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBatchOverwrite(t *testing.T) {
+	d, root := setupResourceTest(t)
+	writeTestFiles(t, root, map[string]string{"a.txt": "new", "b.txt": "old", "docs/c.txt": "c", "target/old.txt": "old"})
+
+	response, status, err := runTestBatch(t, d, BatchRequest{Operations: []BatchOperation{
+		{Action: batchCopy, Source: "test", Path: "/a.txt", To: "/b.txt"},
+	}})
+	if status != http.StatusOK || err != nil {
+		t.Fatalf("batch failed: %d %v", status, err)
+	}
+	if result := response.Results[0]; result.Status != http.StatusConflict {
+		t.Errorf("expected a conflict without overwrite, got %+v", result)
+	}
+	if got := readTestFile(t, filepath.Join(root, "b.txt")); got != "old" {
+		t.Errorf("expected the existing file to be kept, got %q", got)
+	}
+
+	response, _, err = runTestBatch(t, d, BatchRequest{Operations: []BatchOperation{
+		{Action: batchCopy, Source: "test", Path: "/a.txt", To: "/b.txt", Overwrite: true},
+		{Action: batchMove, Source: "test", Path: "/docs", To: "/target", Overwrite: true},
+	}})
+	if err != nil || response.Succeeded != 2 {
+		t.Fatalf("expected both operations to succeed, got %+v %v", response, err)
+	}
+	if got := readTestFile(t, filepath.Join(root, "b.txt")); got != "new" {
+		t.Errorf("expected the file to be replaced, got %q", got)
+	}
+	if got := readTestFile(t, filepath.Join(root, "target", "c.txt")); got != "c" {
+		t.Errorf("expected the folder to be replaced, got %q", got)
+	}
+	for _, name := range []string{"docs", filepath.Join("target", "old.txt")} {
+		if _, err = os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %v to be gone, got %v", name, err)
+		}
+	}
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 3 {
+		t.Errorf("expected no temporary items to be left, got %v", entries)
+	}
+}
+
+func TestBatchRejectsDeniedChildren(t *testing.T) {
+	d, root := setupResourceTest(t)
+	writeTestFiles(t, root, map[string]string{"docs/a.txt": "a", "docs/private/b.txt": "b", "dst/c.txt": "c"})
+	if err := store.Access.DenyUser(root, "/docs/private/", d.user.Username); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	for _, op := range []BatchOperation{
+		{Action: batchCopy, Source: "test", Path: "/docs", To: "/copy"},
+		{Action: batchMove, Source: "test", Path: "/docs", To: "/moved"},
+		{Action: batchDelete, Source: "test", Path: "/docs"},
+		// the denied folder would be removed by the overwrite
+		{Action: batchCopy, Source: "test", Path: "/dst", To: "/docs", Overwrite: true},
+	} {
+		if _, status, err := runTestBatch(t, d, BatchRequest{Operations: []BatchOperation{op}}); status != http.StatusForbidden {
+			t.Errorf("expected %s of %s to %s to be forbidden, got %d %v", op.Action, op.Path, op.To, status, err)
+		}
+	}
+	if got := readTestFile(t, filepath.Join(root, "docs", "private", "b.txt")); got != "b" {
+		t.Errorf("expected the denied file to be unchanged, got %q", got)
+	}
+	for _, name := range []string{"copy", "moved"} {
+		if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %v not to be created, got %v", name, err)
+		}
+	}
+
+	// other folders can still be copied
+	if response, _, err := runTestBatch(t, d, BatchRequest{Operations: []BatchOperation{
+		{Action: batchCopy, Source: "test", Path: "/dst", To: "/copy"},
+	}}); err != nil || response.Succeeded != 1 {
+		t.Errorf("expected the copy to succeed, got %+v %v", response, err)
+	}
+}
+
+func TestBatchPartialFailure(t *testing.T) {
+	d, root := setupResourceTest(t)
+	writeTestFiles(t, root, map[string]string{"a.txt": "a"})
+	operations := []BatchOperation{
+		{Action: batchCopy, Source: "test", Path: "/a.txt", To: "/b.txt"},
+		{Action: batchCopy, Source: "test", Path: "/missing.txt", To: "/c.txt"},
+		{Action: batchMkdir, Source: "test", Path: "/new"},
+	}
+
+	response, _, err := runTestBatch(t, d, BatchRequest{Operations: operations})
+	if err != nil {
+		t.Fatalf("batch failed: %v", err)
+	}
+	if response.Succeeded != 2 || response.Failed != 1 || response.Results[1].Status != http.StatusNotFound || response.Results[1].Error == "" {
+		t.Errorf("expected only the copy of the missing file to fail, got %+v", response)
+	}
+	if _, err = os.Stat(filepath.Join(root, "new")); err != nil {
+		t.Errorf("expected the operations after the failure to run: %v", err)
+	}
+
+	operations[0].To = "/d.txt"
+	operations[2].Path = "/other"
+	response, _, _ = runTestBatch(t, d, BatchRequest{Operations: operations, StopOnError: true})
+	if response.Succeeded != 1 || response.Failed != 1 || response.Skipped != 1 || !response.Results[2].Skipped {
+		t.Errorf("expected the operations after the failure to be skipped, got %+v", response)
+	}
+	if _, err = os.Stat(filepath.Join(root, "other")); !os.IsNotExist(err) {
+		t.Errorf("expected the skipped folder not to be created, got %v", err)
+	}
+}
+
+func TestBatchStaysInScope(t *testing.T) {
+	d, root := setupResourceTest(t)
+	writeTestFiles(t, root, map[string]string{"alice/a.txt": "a", "bob/b.txt": "b"})
+	d.user.Scopes[0].Scope = "/alice"
+
+	for _, op := range []BatchOperation{
+		{Action: batchDelete, Source: "test", Path: "../bob/b.txt"},
+		{Action: batchMove, Source: "test", Path: "/../bob/b.txt", To: "/b.txt"},
+		{Action: batchCopy, Source: "test", Path: "/a.txt", To: "../bob/a.txt"},
+		{Action: batchMkdir, Source: "test", Path: "../alice-old"},
+	} {
+		if _, status, err := runTestBatch(t, d, BatchRequest{Operations: []BatchOperation{op}}); status != http.StatusForbidden {
+			t.Errorf("expected %s of %s to %s to be forbidden, got %d %v", op.Action, op.Path, op.To, status, err)
+		}
+	}
+	if got := readTestFile(t, filepath.Join(root, "bob", "b.txt")); got != "b" {
+		t.Errorf("expected the file of the other user to be unchanged, got %q", got)
+	}
+	for _, name := range []string{"bob/a.txt", "alice-old"} {
+		if _, err := os.Stat(filepath.Join(root, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %v not to be created, got %v", name, err)
+		}
+	}
+
+	if response, _, err := runTestBatch(t, d, BatchRequest{Operations: []BatchOperation{
+		{Action: batchCopy, Source: "test", Path: "/a.txt", To: "sub/../b.txt"},
+	}}); err != nil || response.Succeeded != 1 {
+		t.Errorf("expected the copy inside the scope to succeed, got %+v %v", response, err)
+	}
+	if got := readTestFile(t, filepath.Join(root, "alice", "b.txt")); got != "a" {
+		t.Errorf("expected the copy in the scope, got %q", got)
+	}
+}
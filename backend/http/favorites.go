@@ -0,0 +1,207 @@
+package http
+
+import (
+	libErrors "errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/favorites"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+)
+
+// FavoriteItem is a favorite or recently used file or folder.
+type FavoriteItem struct {
+	iteminfo.ItemInfo
+	Source string `json:"source"`           // source name
+	Path   string `json:"path"`             // path within the user scope
+	Time   int64  `json:"time"`             // when the item was added or last used
+	Action string `json:"action,omitempty"` // "opened" or "edited" for recent items
+}
+
+// favoriteItems returns the items that still exist and that the user can
+// access. The others are pruned from the lists of the user. Items of
+// sources that are unavailable right now are skipped but kept.
+func favoriteItems(d *requestContext, items []favorites.Item) []FavoriteItem {
+	result := []FavoriteItem{}
+	pruned := map[favorites.Item]bool{}
+	for _, item := range items {
+		info, keep, ok := favoriteItem(d, item)
+		if !keep {
+			pruned[item] = true
+		}
+		if ok {
+			result = append(result, info)
+		}
+	}
+	if len(pruned) > 0 {
+		err := store.Favorites.Prune(d.user.Username, func(item favorites.Item) bool {
+			return !pruned[item]
+		})
+		if err != nil {
+			slog.Debug("could not prune favorites", "user", d.user.Username, "err", err)
+		}
+	}
+	return result
+}
+
+// favoriteItem resolves an item of a list. keep is false if the item was
+// deleted or became inaccessible, ok is false if it can't be listed.
+func favoriteItem(d *requestContext, item favorites.Item) (info FavoriteItem, keep, ok bool) {
+	source, exists := settings.Config.Server.SourceMap[item.Source]
+	if !exists {
+		return info, true, false
+	}
+	userscope, err := settings.GetScopeFromSourcePath(d.user.Scopes, item.Source)
+	if err != nil {
+		return info, false, false
+	}
+	userscope = strings.TrimRight(userscope, "/")
+	if !strings.HasPrefix(item.Path, userscope+"/") {
+		return info, false, false
+	}
+	if store.Access != nil && !store.Access.Permitted(item.Source, item.Path, d.user.Username) {
+		return info, false, false
+	}
+	idx := indexing.GetIndex(source.Name)
+	if idx == nil {
+		return info, true, false
+	}
+	stat, err := idx.FS.Stat(item.Path)
+	if libErrors.Is(err, fs.ErrNotExist) {
+		return info, false, false
+	}
+	if err != nil {
+		return info, true, false
+	}
+
+	info = FavoriteItem{
+		ItemInfo: iteminfo.ItemInfo{
+			Name:    stat.Name(),
+			Size:    stat.Size(),
+			ModTime: stat.ModTime(),
+			Hidden:  strings.HasPrefix(stat.Name(), "."),
+		},
+		Source: source.Name,
+		Path:   strings.TrimPrefix(item.Path, userscope),
+		Time:   item.Time,
+		Action: item.Action,
+	}
+	if stat.IsDir() {
+		info.Type = "directory"
+		if dirInfo, exists := idx.GetMetadataInfo(item.Path, true); exists {
+			info.Size = dirInfo.Size
+		}
+	} else {
+		realPath, _, _ := idx.GetRealPath(item.Path)
+		info.DetectType(realPath, false)
+	}
+	return info, true, true
+}
+
+// favoritesGetHandler lists the favorites of the current user.
+// @Summary List favorites
+// @Description Returns the favorite files and folders of the current user in the order they were added. Favorites that were deleted or became inaccessible are removed.
+// @Tags Favorites
+// @Accept json
+// @Produce json
+// @Success 200 {array} FavoriteItem "Favorite items"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/favorites [get]
+func favoritesGetHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	list, err := store.Favorites.Get(d.user.Username)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, favoriteItems(d, list.Favorites))
+}
+
+// favoritesPostHandler adds a favorite.
+// @Summary Add a favorite
+// @Description Adds a file or folder to the favorites of the current user.
+// @Tags Favorites
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the file or folder"
+// @Success 200 "Favorite added"
+// @Failure 400 {object} map[string]string "Favorites limit reached"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /api/favorites [post]
+func favoritesPostHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, status, err := resolveItem(d, r.URL.Query().Get("source"), r.URL.Query().Get("path"))
+	if err != nil {
+		return status, err
+	}
+	err = store.Favorites.AddFavorite(d.user.Username, target.idx.Path, target.path)
+	if err == errors.ErrFavoritesLimit {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// favoritesDeleteHandler removes a favorite.
+// @Summary Remove a favorite
+// @Description Removes a file or folder from the favorites of the current user.
+// @Tags Favorites
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the file or folder"
+// @Success 200 "Favorite removed"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Source not found"
+// @Router /api/favorites [delete]
+func favoritesDeleteHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	source := r.URL.Query().Get("source")
+	userscope, err := settings.GetScopeFromSourceName(d.user.Scopes, source)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return http.StatusNotFound, fmt.Errorf("source %s not found", source)
+	}
+	// the item may be gone already, so it isn't resolved like for adding
+	path := strings.TrimRight(userscope, "/") + "/" + strings.TrimLeft(r.URL.Query().Get("path"), "/")
+	if err = store.Favorites.RemoveFavorite(d.user.Username, idx.Path, path); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// recentsGetHandler lists the recently used files of the current user.
+// @Summary List recent files
+// @Description Returns the files the current user recently opened or edited, most recent first. Files that were deleted or became inaccessible are removed.
+// @Tags Favorites
+// @Accept json
+// @Produce json
+// @Success 200 {array} FavoriteItem "Recent items"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/recents [get]
+func recentsGetHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	list, err := store.Favorites.Get(d.user.Username)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, favoriteItems(d, list.Recents))
+}
+
+// touchRecent records that the user opened or edited a file.
+func touchRecent(d *requestContext, sourcePath, path, action string) {
+	if d.user == nil || d.share != nil {
+		return
+	}
+	if err := store.Favorites.Touch(d.user.Username, sourcePath, path, action); err != nil {
+		slog.Debug("could not update recent files", "path", path, "err", err)
+	}
+}
@@ -14,7 +14,8 @@ import (
 	"time"
 
 	"github.com/SlepoyShaman/FileStorage/common/settings"
-	"github.com/SlepoyShaman/FileStorage/database/storage/bolt"
+	"github.com/SlepoyShaman/FileStorage/database/storage"
+	"github.com/SlepoyShaman/FileStorage/indexing"
 )
 
 // Embed the files in the frontend/dist directory
@@ -33,14 +34,16 @@ func (d dirFS) Open(name string) (fs.File, error) {
 }
 
 var (
-	store   *bolt.BoltStore
+	store   *storage.Store
 	config  *settings.Settings
 	assetFs fs.FS
 )
 
-func StartHttp(ctx context.Context, storage *bolt.BoltStore, shutdownComplete chan struct{}) {
-	store = storage
+func StartHttp(ctx context.Context, db *storage.Store, shutdownComplete chan struct{}) {
+	store = db
 	config = &settings.Config
+	go storage.ScheduleBackups(ctx, store, config.Server.Backup)
+	startJobs(ctx)
 	var err error
 	// Determine filesystem mode and set asset paths
 	if settings.Env.EmbeddedFs {
@@ -79,6 +82,74 @@ func StartHttp(ctx context.Context, storage *bolt.BoltStore, shutdownComplete ch
 	// Resources routes
 	api.HandleFunc("GET /resources", withUser(resourceGetHandler))
 	api.HandleFunc("POST /resources", withUser(resourcePostHandler))
+	api.HandleFunc("POST /resources/batch", withUser(batchHandler))
+
+	// Archives routes
+	api.HandleFunc("GET /archives", withUser(archiveGetHandler))
+	api.HandleFunc("GET /archives/raw", withUser(archiveRawHandler))
+
+	// Search routes
+	api.HandleFunc("GET /search/content", withUser(contentSearchHandler))
+
+	// Timeline routes
+	api.HandleFunc("GET /timeline", withUser(timelineHandler))
+
+	// Music library routes
+	api.HandleFunc("GET /library/artists", withUser(libraryArtistsHandler))
+	api.HandleFunc("GET /library/albums", withUser(libraryAlbumsHandler))
+	api.HandleFunc("GET /library/tracks", withUser(libraryTracksHandler))
+	api.HandleFunc("GET /library/genres", withUser(libraryGenresHandler))
+	api.HandleFunc("GET /library/art", withUser(libraryArtHandler))
+	api.HandleFunc("GET /library/playlist", withUser(libraryPlaylistHandler))
+
+	// Tags routes
+	api.HandleFunc("GET /tags", withUser(tagsGetHandler))
+	api.HandleFunc("PUT /tags", withUser(tagsPutHandler))
+	api.HandleFunc("PATCH /tags", withUser(tagsPatchHandler))
+	api.HandleFunc("DELETE /tags", withUser(tagsDeleteHandler))
+	api.HandleFunc("GET /tags/search", withUser(tagsSearchHandler))
+	api.HandleFunc("GET /tags/list", withUser(tagsListHandler))
+
+	// Favorites routes
+	api.HandleFunc("GET /favorites", withUser(favoritesGetHandler))
+	api.HandleFunc("POST /favorites", withUser(favoritesPostHandler))
+	api.HandleFunc("DELETE /favorites", withUser(favoritesDeleteHandler))
+	api.HandleFunc("GET /recents", withUser(recentsGetHandler))
+
+	// Locks routes
+	api.HandleFunc("GET /locks", withUser(locksGetHandler))
+	api.HandleFunc("POST /locks", withUser(lockPostHandler))
+	api.HandleFunc("PUT /locks", withUser(lockPutHandler))
+	api.HandleFunc("DELETE /locks", withUser(lockDeleteHandler))
+	api.HandleFunc("DELETE /locks/force", withAdmin(lockBreakHandler))
+
+	// Jobs routes
+	api.HandleFunc("GET /jobs", withUser(jobsGetHandler))
+	api.HandleFunc("DELETE /jobs", withUser(jobDeleteHandler))
+	api.HandleFunc("POST /jobs/cancel", withUser(jobCancelHandler))
+	api.HandleFunc("GET /jobs/download", withUser(jobDownloadHandler))
+	api.HandleFunc("GET /jobs/events", withUser(jobEventsHandler))
+	api.HandleFunc("POST /jobs/archive", withUser(jobArchivePostHandler))
+	api.HandleFunc("POST /jobs/convert", withUser(jobConvertPostHandler))
+
+	// Auth routes
+	api.HandleFunc("PUT /auth/password", withoutUser(passwordChangeHandler))
+
+	// Users routes
+	api.HandleFunc("POST /users/password/reset", withAdmin(forcePasswordResetHandler))
+	api.HandleFunc("POST /users/unlock", withAdmin(unlockUserHandler))
+	api.HandleFunc("POST /users/import", withAdmin(usersImportHandler))
+	api.HandleFunc("GET /users/export", withAdmin(usersExportHandler))
+
+	// Database routes
+	api.HandleFunc("GET /database/backup", withAdmin(backupHandler))
+
+	// Invitations routes
+	api.HandleFunc("GET /invitations", withAdmin(invitationListHandler))
+	api.HandleFunc("POST /invitations", withAdmin(invitationPostHandler))
+	api.HandleFunc("DELETE /invitations", withAdmin(invitationDeleteHandler))
+	publicRoutes.HandleFunc("GET /api/invitations", withoutUser(invitationInfoHandler))
+	publicRoutes.HandleFunc("POST /api/invitations/accept", withoutUser(invitationAcceptHandler))
 
 	// Mount the route groups
 	apiPath := config.Server.BaseURL + "api"
@@ -175,6 +246,8 @@ func StartHttp(ctx context.Context, storage *bolt.BoltStore, shutdownComplete ch
 			}
 		}
 	}
+	// Snapshot the indexes so the next start doesn't index from scratch
+	indexing.SaveSnapshots()
 
 	// Graceful shutdown with a timeout - 30 seconds, in case downloads are happening
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -0,0 +1,239 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+	"github.com/SlepoyShaman/FileStorage/backend/common/utils"
+	"github.com/SlepoyShaman/FileStorage/backend/database/invitation"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+	"github.com/gtsteffaniak/go-logger/logger"
+)
+
+type InvitationResponse struct {
+	*invitation.Invitation
+	Status string `json:"status"`
+	Token  string `json:"token,omitempty"` // only returned once, when the invitation is created
+	URL    string `json:"url,omitempty"`
+}
+
+// invitationListHandler lists all invitations.
+// @Summary List invitations
+// @Description Returns all invitations including accepted, revoked and expired ones, which serve as an audit of who invited whom.
+// @Tags Invitations
+// @Accept json
+// @Produce json
+// @Success 200 {array} InvitationResponse "List of invitations"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/invitations [get]
+func invitationListHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	invitations, err := store.Invitations.All()
+	if err != nil && err != errors.ErrNotExist {
+		return http.StatusInternalServerError, err
+	}
+	invitations = utils.NonNilSlice(invitations)
+	response := make([]*InvitationResponse, 0, len(invitations))
+	for _, inv := range invitations {
+		response = append(response, &InvitationResponse{Invitation: inv, Status: inv.Status()})
+	}
+	return renderJSON(w, r, response)
+}
+
+// invitationPostHandler creates a new invitation.
+// @Summary Create invitation
+// @Description Create a single use invitation link with preset scopes, permissions and groups. The token is only returned in this response.
+// @Tags Invitations
+// @Accept json
+// @Produce json
+// @Param body body invitation.CreateBody true "Invitation settings"
+// @Success 200 {object} InvitationResponse "Created invitation with token and link"
+// @Failure 400 {object} map[string]string "Bad request - invalid body or expiry"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/invitations [post]
+func invitationPostHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	var body invitation.CreateBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("failed to decode body: %w", err)
+	}
+	defer r.Body.Close()
+
+	var expire int64 = 0
+	if body.Expires != "" {
+		num, err := strconv.Atoi(body.Expires)
+		if err != nil || num < 0 {
+			return http.StatusBadRequest, fmt.Errorf("invalid expires value: %v", body.Expires)
+		}
+		var add time.Duration
+		switch body.Unit {
+		case "seconds":
+			add = time.Second * time.Duration(num)
+		case "minutes":
+			add = time.Minute * time.Duration(num)
+		case "days":
+			add = time.Hour * 24 * time.Duration(num)
+		default:
+			add = time.Hour * time.Duration(num)
+		}
+		expire = time.Now().Add(add).Unix()
+	}
+	// validate scopes before handing them out
+	if _, err := settings.ConvertToBackendScopes(body.Scopes); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	inv := &invitation.Invitation{
+		Scopes:      body.Scopes,
+		Permissions: body.Permissions,
+		Groups:      body.Groups,
+		Note:        body.Note,
+		Expires:     expire,
+		CreatedBy:   d.user.Username,
+		CreatedByID: d.user.ID,
+	}
+	token, err := store.Invitations.Create(inv)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	logger.Infof("admin %v created invitation %v", d.user.Username, inv.ID[:8])
+	return renderJSON(w, r, &InvitationResponse{
+		Invitation: inv,
+		Status:     inv.Status(),
+		Token:      token,
+		URL:        getInvitationURL(r, token),
+	})
+}
+
+// invitationDeleteHandler revokes a pending invitation.
+// @Summary Revoke invitation
+// @Description Revoke a pending invitation so its link can no longer be used. The record is kept for auditing.
+// @Tags Invitations
+// @Accept json
+// @Produce json
+// @Param id query string true "Invitation ID"
+// @Success 200 {object} InvitationResponse "Revoked invitation"
+// @Failure 400 {object} map[string]string "Bad request - invitation was already accepted or revoked"
+// @Failure 404 {object} map[string]string "Invitation not found"
+// @Router /api/invitations [delete]
+func invitationDeleteHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		return http.StatusBadRequest, fmt.Errorf("invitation id is required")
+	}
+	inv, err := store.Invitations.Revoke(id, d.user.Username)
+	if err != nil {
+		if err == errors.ErrNotExist {
+			return http.StatusNotFound, err
+		}
+		if err == errors.ErrInvitationInvalid {
+			return http.StatusBadRequest, err
+		}
+		return http.StatusInternalServerError, err
+	}
+	logger.Infof("admin %v revoked invitation %v", d.user.Username, inv.ID[:8])
+	return renderJSON(w, r, &InvitationResponse{Invitation: inv, Status: inv.Status()})
+}
+
+// invitationInfoHandler returns the public details of an invitation.
+// @Summary Get invitation info
+// @Description Check that an invitation token is valid before the invitee chooses a username and password.
+// @Tags Invitations
+// @Accept json
+// @Produce json
+// @Param token query string true "Invitation token"
+// @Success 200 {object} map[string]any "Invitation details"
+// @Failure 404 {object} map[string]string "Invitation is invalid, expired or already used"
+// @Router /public/api/invitations [get]
+func invitationInfoHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	inv, err := store.Invitations.GetByToken(r.URL.Query().Get("token"))
+	if err != nil {
+		return http.StatusNotFound, errors.ErrInvitationInvalid
+	}
+	return renderJSON(w, r, map[string]any{
+		"invitedBy": inv.CreatedBy,
+		"expires":   inv.Expires,
+		"note":      inv.Note,
+	})
+}
+
+// invitationAcceptHandler creates a user from an invitation.
+// @Summary Accept invitation
+// @Description Create a password user with the scopes, permissions and groups of the invitation. The invitation is consumed and a token for the new user is returned.
+// @Tags Invitations
+// @Accept json
+// @Produce json
+// @Param token query string true "Invitation token"
+// @Param username query string true "Username for the new account"
+// @Param X-Password header string true "Password for the new account"
+// @Success 200 {string} string "JWT token for authentication"
+// @Failure 400 {object} map[string]string "Bad request - invalid username or password"
+// @Failure 404 {object} map[string]string "Invitation is invalid, expired or already used"
+// @Failure 409 {object} map[string]string "Conflict - user already exists"
+// @Router /public/api/invitations/accept [post]
+func invitationAcceptHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if !config.Auth.Methods.PasswordAuth.Enabled {
+		return http.StatusMethodNotAllowed, fmt.Errorf("password authentication is disabled")
+	}
+	username := r.URL.Query().Get("username")
+	password := r.Header.Get("X-Password")
+	if username == "" || password == "" {
+		return http.StatusBadRequest, fmt.Errorf("username and password are required")
+	}
+	if _, err := store.Users.Get(username); err == nil {
+		return http.StatusConflict, fmt.Errorf("user with provided username already exists")
+	}
+	inv, err := store.Invitations.Consume(r.URL.Query().Get("token"), func(inv *invitation.Invitation) (*users.User, error) {
+		user := &users.User{}
+		settings.ApplyUserDefaults(user)
+		user.Username = username
+		user.Password = password
+		user.LoginMethod = users.LoginMethodPassword
+		user.Permissions = inv.Permissions
+		if len(inv.Scopes) > 0 {
+			user.Scopes = inv.Scopes
+		}
+		err := store.Users.Save(user, true, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(inv.Groups) > 0 {
+			err = store.Access.SyncUserGroups(user.Username, inv.Groups)
+			if err != nil {
+				logger.Errorf("failed to add invited user %v to groups: %v", user.Username, err)
+			}
+		}
+		return user, nil
+	})
+	if err != nil {
+		if err == errors.ErrInvitationInvalid {
+			return http.StatusNotFound, err
+		}
+		return http.StatusBadRequest, err
+	}
+	logger.Infof("user %v accepted invitation %v from %v", inv.AcceptedBy, inv.ID[:8], inv.CreatedBy)
+	user, err := store.Users.Get(inv.AcceptedUserID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return printToken(w, r, user)
+}
+
+func getInvitationURL(r *http.Request, token string) string {
+	if config.Server.ExternalUrl != "" {
+		return fmt.Sprintf("%s%sinvite/%s", config.Server.ExternalUrl, config.Server.BaseURL, token)
+	}
+	host := r.Host
+	scheme := getScheme(r)
+	if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
+		host = forwardedHost
+		scheme = "https"
+		if forwardedProto := r.Header.Get("X-Forwarded-Proto"); forwardedProto != "" {
+			scheme = forwardedProto
+		}
+	}
+	return fmt.Sprintf("%s://%s%sinvite/%s", scheme, host, config.Server.BaseURL, token)
+}
@@ -0,0 +1,562 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/ffmpeg"
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/files"
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/backend/database/jobs"
+	"github.com/SlepoyShaman/FileStorage/backend/sevices/job_service"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+)
+
+// Job types.
+const (
+	jobArchive = "archive"
+	jobConvert = "convert"
+	jobBatch   = "batch"
+)
+
+const (
+	jobEventsKeepAlive = 30 * time.Second
+	// finished jobs and their results are removed after this time
+	jobRetention     = 7 * 24 * time.Hour
+	jobPruneInterval = time.Hour
+)
+
+// jobService runs archives, video conversions and batches in the
+// background.
+var jobService *job_service.JobService
+
+// ArchiveJobBody is the request body to create an archive in the
+// background.
+type ArchiveJobBody struct {
+	Files       []string `json:"files"`       // items as source::path, like the files parameter of /api/raw
+	Algo        string   `json:"algo"`        // zip or tar.gz, zip by default
+	Compression string   `json:"compression"` // compression level from 0 to 9, empty for the default
+	Exclude     string   `json:"exclude"`     // comma separated glob patterns of items to leave out
+}
+
+// ConvertJobBody is the request body to convert a video in the background.
+type ConvertJobBody struct {
+	Source  string `json:"source"`
+	Path    string `json:"path"`
+	Format  string `json:"format"`  // container of the output, mp4 by default
+	Width   int    `json:"width"`   // scale to this width, keeping the aspect ratio
+	Crf     int    `json:"crf"`     // constant rate factor, lower is better quality
+	Bitrate string `json:"bitrate"` // video bitrate, eg. 2M
+	Preset  string `json:"preset"`  // ffmpeg preset, eg. fast
+}
+
+// startJobs registers the job types and starts the workers.
+func startJobs(ctx context.Context) {
+	jobService = job_service.NewJobService(store.Jobs)
+	jobService.Register(jobArchive, runArchiveJob, true)
+	jobService.Register(jobConvert, runConvertJob, true)
+	// operations of a batch may have run already, so it is not repeated
+	jobService.Register(jobBatch, runBatchJob, false)
+	if err := jobService.Start(ctx, config.Server.JobWorkers); err != nil {
+		slog.Error("could not start background jobs", "err", err)
+		return
+	}
+	go pruneJobs(ctx)
+}
+
+// pruneJobs removes old finished jobs with their results, until ctx is done.
+func pruneJobs(ctx context.Context) {
+	ticker := time.NewTicker(jobPruneInterval)
+	defer ticker.Stop()
+	for {
+		count, err := jobService.Prune(time.Now().Add(-jobRetention), removeJobResult)
+		if err != nil {
+			slog.Error("could not remove old jobs", "err", err)
+		} else if count > 0 {
+			slog.Debug("removed old jobs", "count", count)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// removeJobResult removes the result file of a job, if it has one.
+func removeJobResult(job jobs.Job) {
+	if job.Params["ext"] == "" {
+		return
+	}
+	if err := os.Remove(jobResultPath(&job)); err != nil && !os.IsNotExist(err) {
+		slog.Debug("could not remove result of job", "job", job.ID, "err", err)
+	}
+}
+
+// jobResultPath is where the result file of a job is written.
+func jobResultPath(job *jobs.Job) string {
+	return filepath.Join(config.Server.CacheDir, "jobs", job.ID+job.Params["ext"])
+}
+
+// jobRequestContext loads the owner of a job, so it runs with their current
+// scopes and permissions.
+func jobRequestContext(job *jobs.Job) (*requestContext, error) {
+	user, err := store.Users.Get(job.Owner)
+	if err != nil {
+		return nil, fmt.Errorf("could not load user %s: %v", job.Owner, err)
+	}
+	return &requestContext{user: user}, nil
+}
+
+// createJobResultDir creates the directory of the result file of a job.
+func createJobResultDir() error {
+	return os.MkdirAll(filepath.Join(config.Server.CacheDir, "jobs"), fileutils.PermDir)
+}
+
+func runArchiveJob(ctx context.Context, job *jobs.Job, progress func(float64, string)) (string, error) {
+	d, err := jobRequestContext(job)
+	if err != nil {
+		return "", err
+	}
+	if !d.user.Permissions.Download {
+		return "", fmt.Errorf("user is not allowed to download")
+	}
+	if err = createJobResultDir(); err != nil {
+		return "", err
+	}
+	opts, err := parseArchiveOptions(job.Params["algo"], job.Params["compression"], job.Params["exclude"])
+	if err != nil {
+		return "", err
+	}
+	fileList := strings.Split(job.Params["files"], "||")
+	report := func(done int) {
+		progress(float64(done)/float64(len(fileList)), fmt.Sprintf("%d of %d items archived", done, len(fileList)))
+	}
+	resultPath := jobResultPath(job)
+	if err = createArchive(ctx, d, resultPath, opts, report, fileList...); err != nil {
+		os.Remove(resultPath)
+		return "", err
+	}
+	return "api/jobs/download?id=" + job.ID, nil
+}
+
+func runConvertJob(ctx context.Context, job *jobs.Job, progress func(float64, string)) (string, error) {
+	d, err := jobRequestContext(job)
+	if err != nil {
+		return "", err
+	}
+	if !d.user.Permissions.Create {
+		return "", fmt.Errorf("user is not allowed to create")
+	}
+	target, _, err := resolveItem(d, job.Params["source"], job.Params["path"])
+	if err != nil {
+		return "", err
+	}
+	// the output may have been created or locked while the job was queued
+	if _, err = checkConvertOutput(d, target, job.Params["format"]); err != nil {
+		return "", err
+	}
+	inputPath, _, err := target.idx.GetRealPath(target.path)
+	if err != nil {
+		return "", err
+	}
+	outputPath := strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + ".converted." + job.Params["format"]
+	options := map[string]interface{}{}
+	if width, err := strconv.Atoi(job.Params["width"]); err == nil && width > 0 {
+		options["width"] = width
+	}
+	if crf, err := strconv.Atoi(job.Params["crf"]); err == nil && crf > 0 {
+		options["crf"] = crf
+	}
+	if job.Params["bitrate"] != "" {
+		options["bitrate"] = job.Params["bitrate"]
+	}
+	if job.Params["preset"] != "" {
+		options["preset"] = job.Params["preset"]
+	}
+	converter := ffmpeg.NewVideoConverter(inputPath, outputPath, options, func(message string, value float64) {
+		progress(value, message)
+	}).WithContext(ctx)
+	if err = converter.Execute(); err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+	dir := path.Dir(target.path)
+	if err = files.RefreshIndex(target.idx.Name, dir, true, false); err != nil {
+		slog.Debug("could not refresh index", "dir", dir, "err", err)
+	}
+	return "", nil
+}
+
+// checkConvertOutput checks that the user may create the output of a video
+// conversion. A conversion never replaces an existing file.
+func checkConvertOutput(d *requestContext, target itemTarget, format string) (int, error) {
+	output := strings.TrimSuffix(target.path, path.Ext(target.path)) + ".converted." + format
+	if store.Access != nil && !store.Access.Permitted(target.idx.Path, output, d.user.Username) {
+		return http.StatusForbidden, fmt.Errorf("access denied to path %s", target.scoped(output))
+	}
+	if err := fileLocks.Check(target.idx.Path, output, d.user.Username); err != nil {
+		return http.StatusLocked, err
+	}
+	if _, err := target.idx.FS.Stat(output); err == nil {
+		return http.StatusConflict, fmt.Errorf("%s already exists", target.scoped(output))
+	}
+	return http.StatusOK, nil
+}
+
+func runBatchJob(ctx context.Context, job *jobs.Job, progress func(float64, string)) (string, error) {
+	d, err := jobRequestContext(job)
+	if err != nil {
+		return "", err
+	}
+	var operations []BatchOperation
+	if err = json.Unmarshal([]byte(job.Params["operations"]), &operations); err != nil {
+		return "", err
+	}
+	// permissions may have changed while the job was queued
+	items, _, err := validateBatch(d, operations)
+	if err != nil {
+		return "", err
+	}
+	response := runBatch(ctx, items, job.Params["stopOnError"] == "true", func(done int) {
+		progress(float64(done)/float64(len(items)), fmt.Sprintf("%d of %d operations done", done, len(items)))
+	})
+	if err = createJobResultDir(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	if err = os.WriteFile(jobResultPath(job), data, fileutils.PermFile); err != nil {
+		return "", err
+	}
+	if response.Failed > 0 {
+		return "", fmt.Errorf("%d of %d operations failed, see api/jobs/download?id=%s", response.Failed, len(items), job.ID)
+	}
+	return "api/jobs/download?id=" + job.ID, nil
+}
+
+// submitBatchJob runs a validated batch request as a background job.
+func submitBatchJob(w http.ResponseWriter, r *http.Request, d *requestContext, body BatchRequest) (int, error) {
+	operations, err := json.Marshal(body.Operations)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return submitJob(w, r, d, jobBatch, map[string]string{
+		"operations":  string(operations),
+		"stopOnError": strconv.FormatBool(body.StopOnError),
+		"ext":         ".json",
+	})
+}
+
+func submitJob(w http.ResponseWriter, r *http.Request, d *requestContext, name string, params map[string]string) (int, error) {
+	job, err := jobService.Submit(name, d.user.Username, params)
+	if err == errors.ErrJobQueueFull {
+		return http.StatusServiceUnavailable, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, job)
+}
+
+// userJob returns a job of the current user, admins can access all jobs.
+func userJob(d *requestContext, id string) (jobs.Job, int, error) {
+	job, err := jobService.Get(id)
+	if err == errors.ErrNotExist {
+		return job, http.StatusNotFound, fmt.Errorf("job %s not found", id)
+	}
+	if err != nil {
+		return job, http.StatusInternalServerError, err
+	}
+	if job.Owner != d.user.Username && !d.user.Permissions.Admin {
+		return job, http.StatusNotFound, fmt.Errorf("job %s not found", id)
+	}
+	return job, http.StatusOK, nil
+}
+
+// jobsGetHandler lists jobs or returns one job.
+// @Summary List background jobs
+// @Description Returns the jobs of the current user, newest first, or the job with the given id. Admins can list the jobs of all users.
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param id query string false "Job id"
+// @Param all query bool false "List the jobs of all users, admin only"
+// @Success 200 {array} jobs.Job "Jobs, or a single job if id is given"
+// @Failure 404 {object} map[string]string "Job not found"
+// @Router /api/jobs [get]
+func jobsGetHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if id := r.URL.Query().Get("id"); id != "" {
+		job, status, err := userJob(d, id)
+		if err != nil {
+			return status, err
+		}
+		return renderJSON(w, r, job)
+	}
+	owner := d.user.Username
+	if r.URL.Query().Get("all") == "true" {
+		if !d.user.Permissions.Admin {
+			return http.StatusForbidden, fmt.Errorf("only admins can list the jobs of all users")
+		}
+		owner = ""
+	}
+	list, err := jobService.List(owner)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, list)
+}
+
+// jobCancelHandler cancels a job.
+// @Summary Cancel a background job
+// @Description Cancels a queued or running job. Running jobs stop at the next opportunity and are then marked canceled.
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param id query string true "Job id"
+// @Success 200 {object} jobs.Job "Canceled job"
+// @Failure 404 {object} map[string]string "Job not found"
+// @Failure 409 {object} map[string]string "Job has already finished"
+// @Router /api/jobs/cancel [post]
+func jobCancelHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	job, status, err := userJob(d, r.URL.Query().Get("id"))
+	if err != nil {
+		return status, err
+	}
+	job, err = jobService.Cancel(job.ID)
+	if err == errors.ErrJobFinished {
+		return http.StatusConflict, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return renderJSON(w, r, job)
+}
+
+// jobDeleteHandler removes a finished job.
+// @Summary Delete a background job
+// @Description Removes a finished job and its result file. Finished jobs are also removed automatically after a week.
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param id query string true "Job id"
+// @Success 200 "Job deleted"
+// @Failure 404 {object} map[string]string "Job not found"
+// @Failure 409 {object} map[string]string "Job has not finished"
+// @Router /api/jobs [delete]
+func jobDeleteHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	job, status, err := userJob(d, r.URL.Query().Get("id"))
+	if err != nil {
+		return status, err
+	}
+	if !job.Finished() {
+		return http.StatusConflict, fmt.Errorf("job %s has not finished yet", job.ID)
+	}
+	if err = jobService.Delete(job.ID); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	removeJobResult(job)
+	return http.StatusOK, nil
+}
+
+// jobDownloadHandler serves the result file of a job.
+// @Summary Download the result of a job
+// @Description Downloads the archive of an archive job or the results of a batch job.
+// @Tags Jobs
+// @Produce octet-stream
+// @Param id query string true "Job id"
+// @Success 200 {file} file "Result file"
+// @Failure 404 {object} map[string]string "Job or result not found"
+// @Router /api/jobs/download [get]
+func jobDownloadHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	job, status, err := userJob(d, r.URL.Query().Get("id"))
+	if err != nil {
+		return status, err
+	}
+	if !job.Finished() || job.Params["ext"] == "" {
+		return http.StatusNotFound, fmt.Errorf("job %s has no result", job.ID)
+	}
+	fd, err := os.Open(jobResultPath(&job))
+	if os.IsNotExist(err) {
+		return http.StatusNotFound, fmt.Errorf("job %s has no result", job.ID)
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer fd.Close()
+	stat, err := fd.Stat()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	name := job.Params["name"]
+	if name == "" {
+		name = job.ID + job.Params["ext"]
+	}
+	setContentDisposition(w, r, name)
+	w.Header().Set("Cache-Control", "private")
+	http.ServeContent(w, r, name, stat.ModTime(), fd)
+	return 0, nil
+}
+
+// jobEventsHandler streams job updates.
+// @Summary Follow background jobs
+// @Description Streams updates of the jobs of the current user as server-sent events, each with a job as JSON. Admins can follow all jobs.
+// @Tags Jobs
+// @Produce text/event-stream
+// @Param all query bool false "Follow the jobs of all users, admin only"
+// @Success 200 {object} jobs.Job "Stream of job updates"
+// @Router /api/jobs/events [get]
+func jobEventsHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return http.StatusInternalServerError, fmt.Errorf("streaming is not supported")
+	}
+	owner := d.user.Username
+	if r.URL.Query().Get("all") == "true" {
+		if !d.user.Permissions.Admin {
+			return http.StatusForbidden, fmt.Errorf("only admins can follow the jobs of all users")
+		}
+		owner = ""
+	}
+	updates, unsubscribe := jobService.Subscribe(owner)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(jobEventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return 0, nil
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case job := <-updates:
+			data, err := json.Marshal(job)
+			if err != nil {
+				return 0, nil
+			}
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
+
+// jobArchivePostHandler starts creating an archive.
+// @Summary Create an archive in the background
+// @Description Queues a job that archives files and folders. Once done, the archive is downloaded from the result link of the job.
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param body body ArchiveJobBody true "Items to archive"
+// @Success 200 {object} jobs.Job "Queued job"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 413 {object} map[string]string "Archive too large"
+// @Router /api/jobs/archive [post]
+func jobArchivePostHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if !d.user.Permissions.Download {
+		return http.StatusForbidden, fmt.Errorf("user is not allowed to download")
+	}
+	var body ArchiveJobBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err)
+	}
+	if len(body.Files) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("no files to archive")
+	}
+	opts, err := parseArchiveOptions(body.Algo, body.Compression, body.Exclude)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	size, err := computeArchiveSize(body.Files, d)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if config.Server.MaxArchiveSizeGB > 0 && size > config.Server.MaxArchiveSizeGB*1024*1024*1024 {
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("pre-archive combined size of files exceeds maximum limit of %d GB", config.Server.MaxArchiveSizeGB)
+	}
+	name := "download"
+	if len(body.Files) == 1 {
+		if _, p, ok := strings.Cut(body.Files[0], "::"); ok && path.Base(p) != "/" && path.Base(p) != "." {
+			name = path.Base(p)
+		}
+	}
+	return submitJob(w, r, d, jobArchive, map[string]string{
+		"files":       strings.Join(body.Files, "||"),
+		"algo":        opts.format,
+		"compression": body.Compression,
+		"exclude":     body.Exclude,
+		"ext":         opts.extension(),
+		"name":        name + opts.extension(),
+	})
+}
+
+// jobConvertPostHandler starts converting a video.
+// @Summary Convert a video in the background
+// @Description Queues a job that converts a video with ffmpeg. The output is written next to the video as <name>.converted.<format>, an existing file is not replaced.
+// @Tags Jobs
+// @Accept json
+// @Produce json
+// @Param body body ConvertJobBody true "Video and conversion options"
+// @Success 200 {object} jobs.Job "Queued job"
+// @Failure 400 {object} map[string]string "Invalid request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Video not found"
+// @Failure 409 {object} map[string]string "The output file already exists"
+// @Failure 423 {object} map[string]string "The output file is locked by another user"
+// @Router /api/jobs/convert [post]
+func jobConvertPostHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if !d.user.Permissions.Create {
+		return http.StatusForbidden, fmt.Errorf("user is not allowed to create")
+	}
+	var body ConvertJobBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err)
+	}
+	target, status, err := resolveItem(d, body.Source, body.Path)
+	if err != nil {
+		return status, err
+	}
+	if strings.HasSuffix(target.path, "/") {
+		return http.StatusBadRequest, fmt.Errorf("only files can be converted")
+	}
+	if !target.idx.FS.IsLocal() {
+		return http.StatusBadRequest, fmt.Errorf("videos can only be converted on local sources")
+	}
+	if body.Format == "" {
+		body.Format = "mp4"
+	}
+	switch body.Format {
+	case "mp4", "webm", "mkv":
+	default:
+		return http.StatusBadRequest, fmt.Errorf("format %s not supported", body.Format)
+	}
+	if status, err = checkConvertOutput(d, target, body.Format); err != nil {
+		return status, err
+	}
+	return submitJob(w, r, d, jobConvert, map[string]string{
+		"source":  body.Source,
+		"path":    body.Path,
+		"format":  body.Format,
+		"width":   strconv.Itoa(body.Width),
+		"crf":     strconv.Itoa(body.Crf),
+		"bitrate": body.Bitrate,
+		"preset":  body.Preset,
+	})
+}
@@ -0,0 +1,291 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/files"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+)
+
+// libraryQuery resolves the scope and the filters of a music library
+// request.
+func libraryQuery(d *requestContext, r *http.Request) (itemTarget, files.LibraryQuery, int, error) {
+	query := r.URL.Query()
+	scope := query.Get("scope")
+	if scope == "" {
+		scope = "/"
+	}
+	target, status, err := resolveItem(d, query.Get("source"), scope)
+	if err != nil {
+		return target, files.LibraryQuery{}, status, err
+	}
+	if !strings.HasSuffix(target.path, "/") {
+		return target, files.LibraryQuery{}, http.StatusBadRequest, fmt.Errorf("scope %s is not a folder", scope)
+	}
+	filter := func(name string) *string {
+		if !query.Has(name) {
+			return nil
+		}
+		value := query.Get(name)
+		return &value
+	}
+	return target, files.LibraryQuery{
+		Scope:  target.path,
+		Artist: filter("artist"),
+		Album:  filter("album"),
+		Genre:  filter("genre"),
+		Allowed: func(path string) bool {
+			return store.Access == nil || store.Access.Permitted(target.idx.Path, path, d.user.Username)
+		},
+	}, http.StatusOK, nil
+}
+
+// libraryArtistsHandler lists the artists of the music library.
+// @Summary List artists
+// @Description Returns the artists of the audio files below a scope. Tracks are listed under their album artist, or their artist if they have none. The tags are read once per file version and cached.
+// @Tags Library
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param scope query string false "Folder within the user scope, defaults to the whole scope"
+// @Param genre query string false "Only artists with tracks of this genre"
+// @Success 200 {array} files.LibraryArtist "Artists sorted by name"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Source or scope not found"
+// @Router /api/library/artists [get]
+func libraryArtistsHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, query, status, err := libraryQuery(d, r)
+	if err != nil {
+		return status, err
+	}
+	return renderJSON(w, r, files.LibraryArtists(target.idx, query))
+}
+
+// libraryAlbumsHandler lists the albums of the music library.
+// @Summary List albums
+// @Description Returns the albums of the audio files below a scope, sorted by artist and name.
+// @Tags Library
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param scope query string false "Folder within the user scope, defaults to the whole scope"
+// @Param artist query string false "Only albums of this artist, empty for tracks without one"
+// @Param genre query string false "Only albums with tracks of this genre"
+// @Success 200 {array} files.LibraryAlbum "Albums"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Source or scope not found"
+// @Router /api/library/albums [get]
+func libraryAlbumsHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, query, status, err := libraryQuery(d, r)
+	if err != nil {
+		return status, err
+	}
+	albums := files.LibraryAlbums(target.idx, query)
+	for i := range albums {
+		if albums[i].Art != "" {
+			albums[i].Art = target.scoped(albums[i].Art)
+		}
+	}
+	return renderJSON(w, r, albums)
+}
+
+// libraryTracksHandler lists the tracks of the music library.
+// @Summary List tracks
+// @Description Returns the audio files below a scope with their tags, sorted by artist, album, disc and track number.
+// @Tags Library
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param scope query string false "Folder within the user scope, defaults to the whole scope"
+// @Param artist query string false "Only tracks of this artist, empty for tracks without one"
+// @Param album query string false "Only tracks of this album, empty for tracks without one"
+// @Param genre query string false "Only tracks of this genre, empty for tracks without one"
+// @Success 200 {array} files.Track "Tracks"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Source or scope not found"
+// @Router /api/library/tracks [get]
+func libraryTracksHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, query, status, err := libraryQuery(d, r)
+	if err != nil {
+		return status, err
+	}
+	tracks := files.LibraryTracks(target.idx, query)
+	for i := range tracks {
+		tracks[i].Path = target.scoped(tracks[i].Path)
+	}
+	return renderJSON(w, r, tracks)
+}
+
+// libraryGenresHandler lists the genres of the music library.
+// @Summary List genres
+// @Description Returns the genres of the audio files below a scope with their number of tracks.
+// @Tags Library
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param scope query string false "Folder within the user scope, defaults to the whole scope"
+// @Param artist query string false "Only genres of this artist"
+// @Success 200 {array} files.LibraryGenre "Genres sorted by name"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Source or scope not found"
+// @Router /api/library/genres [get]
+func libraryGenresHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, query, status, err := libraryQuery(d, r)
+	if err != nil {
+		return status, err
+	}
+	return renderJSON(w, r, files.LibraryGenres(target.idx, query))
+}
+
+// albumArtTypes are the detected mimetypes of album art that is shown as an
+// image, with their file extension.
+var albumArtTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// libraryArtHandler returns the album art embedded in an audio file.
+// @Summary Get album art
+// @Description Returns the picture embedded in the tags of an audio file, such as the art path of an album. The type is detected from the data, pictures other than JPEG, PNG, GIF and WebP are sent as an application/octet-stream attachment.
+// @Tags Library
+// @Produce image/jpeg,image/png,image/gif,image/webp,application/octet-stream
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the audio file"
+// @Success 200 {file} file "Album art"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "File not found or without album art"
+// @Router /api/library/art [get]
+func libraryArtHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, status, err := resolveItem(d, r.URL.Query().Get("source"), r.URL.Query().Get("path"))
+	if err != nil {
+		return status, err
+	}
+	if strings.HasSuffix(target.path, "/") {
+		return http.StatusBadRequest, fmt.Errorf("path %s is a folder", target.scoped(target.path))
+	}
+	data, err := files.AlbumArt(target.idx, target.path)
+	if err == errors.ErrNotExist {
+		return http.StatusNotFound, fmt.Errorf("no album art in %s", target.scoped(target.path))
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	mimeType, ext, ok := albumArtType(data)
+	disposition := "inline"
+	if !ok {
+		disposition = "attachment"
+	}
+	name := strings.TrimSuffix(path.Base(target.path), path.Ext(target.path)) + ext
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, toASCIIFilename(name)))
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	w.Header().Set("Cache-Control", "private")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, err = w.Write(data)
+	return 0, err
+}
+
+// albumArtType detects the mimetype of album art and returns it with a file
+// extension. ok is false for data that is not shown as an image, it is sent
+// as an octet stream then, as it could be a page run in the origin of the
+// server.
+func albumArtType(data []byte) (mimeType, ext string, ok bool) {
+	mimeType = http.DetectContentType(data)
+	if ext, ok = albumArtTypes[mimeType]; ok {
+		return mimeType, ext, true
+	}
+	return "application/octet-stream", ".bin", false
+}
+
+// libraryPlaylistHandler exports tracks of the music library as a playlist.
+// @Summary Export playlist
+// @Description Returns the matching tracks as an extended M3U playlist. Entries are relative to the scope, so the playlist plays when saved in the scope folder. M3U files are Latin-1 encoded, M3U8 files UTF-8.
+// @Tags Library
+// @Produce audio/x-mpegurl
+// @Param source query string true "Source name for the desired source"
+// @Param scope query string false "Folder within the user scope, defaults to the whole scope"
+// @Param artist query string false "Only tracks of this artist"
+// @Param album query string false "Only tracks of this album"
+// @Param genre query string false "Only tracks of this genre"
+// @Param format query string false "m3u or m3u8 (default m3u8)"
+// @Success 200 {file} file "Playlist"
+// @Failure 400 {object} map[string]string "Invalid format"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Source or scope not found"
+// @Router /api/library/playlist [get]
+func libraryPlaylistHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "m3u8"
+	}
+	if format != "m3u" && format != "m3u8" {
+		return http.StatusBadRequest, fmt.Errorf("invalid format: %v", format)
+	}
+	target, query, status, err := libraryQuery(d, r)
+	if err != nil {
+		return status, err
+	}
+	tracks := files.LibraryTracks(target.idx, query)
+
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	for _, t := range tracks {
+		title := t.Title
+		if title == "" {
+			title = strings.TrimSuffix(t.Name, path.Ext(t.Name))
+		}
+		if artist := t.Artist; artist != "" {
+			title = artist + " - " + title
+		}
+		fmt.Fprintf(&buf, "#EXTINF:-1,%s\n%s\n", playlistLine(title), playlistLine(strings.TrimPrefix(t.Path, target.path)))
+	}
+	data := buf.Bytes()
+	if format == "m3u" {
+		data = latin1(data)
+	}
+
+	name := "playlist"
+	switch {
+	case query.Album != nil && *query.Album != "":
+		name = *query.Album
+	case query.Artist != nil && *query.Artist != "":
+		name = *query.Artist
+	case query.Genre != nil && *query.Genre != "":
+		name = *query.Genre
+	case target.path != "/":
+		name = path.Base(strings.TrimSuffix(target.path, "/"))
+	}
+	setContentDisposition(w, r, name+"."+format)
+	if format == "m3u8" {
+		w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "audio/x-mpegurl")
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(data)))
+	_, err = w.Write(data)
+	return 0, err
+}
+
+// playlistLine keeps tags with line breaks from splitting playlist entries.
+func playlistLine(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
+
+// latin1 converts UTF-8 text to Latin-1, characters it can't represent
+// become question marks.
+func latin1(data []byte) []byte {
+	result := make([]byte, 0, len(data))
+	for _, r := range string(data) {
+		if r > 0xff {
+			r = '?'
+		}
+		result = append(result, byte(r))
+	}
+	return result
+}
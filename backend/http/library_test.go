@@ -0,0 +1,82 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+)
+
+func TestLibraryPlaylist(t *testing.T) {
+	d, root := setupResourceTest(t)
+	writeTestFiles(t, root, map[string]string{"music/Ünï €.mp3": "a", "music/sub/b.mp3": "b"})
+	// files without tags are listed by name
+	idx := indexing.GetIndex("test")
+	idx.Directories["/music/"] = &iteminfo.FileInfo{Files: []iteminfo.ExtendedItemInfo{
+		{ItemInfo: iteminfo.ItemInfo{Name: "Ünï €.mp3", Size: 1, Type: "audio/mpeg"}},
+	}}
+	idx.Directories["/music/sub/"] = &iteminfo.FileInfo{Files: []iteminfo.ExtendedItemInfo{
+		{ItemInfo: iteminfo.ItemInfo{Name: "b.mp3", Size: 1, Type: "audio/mpeg"}},
+	}}
+
+	for _, tc := range []struct {
+		format, contentType, disposition, body string
+	}{
+		{"", "audio/x-mpegurl; charset=utf-8", `filename="music.m3u8"`, "#EXTM3U\n#EXTINF:-1,b\nsub/b.mp3\n#EXTINF:-1,Ünï €\nÜnï €.mp3\n"},
+		{"m3u", "audio/x-mpegurl", `filename="music.m3u"`, "#EXTM3U\n#EXTINF:-1,b\nsub/b.mp3\n#EXTINF:-1,\xdcn\xef ?\n\xdcn\xef ?.mp3\n"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/library/playlist?source=test&scope=/music&format="+tc.format, nil)
+		w := httptest.NewRecorder()
+		if status, err := libraryPlaylistHandler(w, r, d); err != nil || status != 0 {
+			t.Fatalf("failed to export %q: %d %v", tc.format, status, err)
+		}
+		if got := w.Body.String(); got != tc.body {
+			t.Errorf("format %q: expected %q, got %q", tc.format, tc.body, got)
+		}
+		if got := w.Header().Get("Content-Type"); got != tc.contentType {
+			t.Errorf("format %q: expected content type %v, got %v", tc.format, tc.contentType, got)
+		}
+		if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, tc.disposition) {
+			t.Errorf("format %q: expected %v in %v", tc.format, tc.disposition, got)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/library/playlist?source=test&format=pls", nil)
+	if status, _ := libraryPlaylistHandler(httptest.NewRecorder(), r, d); status != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", status)
+	}
+}
+
+func TestPlaylistText(t *testing.T) {
+	if got := playlistLine("a\r\nb\nc"); got != "a  b c" {
+		t.Errorf("expected line breaks to be replaced, got %q", got)
+	}
+	if got := string(latin1([]byte("aé€ÿ日"))); got != "a\xe9?\xff?" {
+		t.Errorf("expected latin-1 with question marks, got %q", got)
+	}
+}
+
+func TestAlbumArtType(t *testing.T) {
+	for _, tc := range []struct {
+		data     string
+		mimeType string
+		ext      string
+		ok       bool
+	}{
+		{"\xff\xd8\xff\xe0 jpeg", "image/jpeg", ".jpg", true},
+		{"\x89PNG\r\n\x1a\n png", "image/png", ".png", true},
+		{"GIF89a gif", "image/gif", ".gif", true},
+		{"RIFF\x00\x00\x00\x00WEBPVP8 ", "image/webp", ".webp", true},
+		// types from the tags are not trusted, pages are never sent as such
+		{"<html><script>alert(1)</script>", "application/octet-stream", ".bin", false},
+		{"<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>", "application/octet-stream", ".bin", false},
+	} {
+		mimeType, ext, ok := albumArtType([]byte(tc.data))
+		if mimeType != tc.mimeType || ext != tc.ext || ok != tc.ok {
+			t.Errorf("%q: expected %v %v %v, got %v %v %v", tc.data, tc.mimeType, tc.ext, tc.ok, mimeType, ext, ok)
+		}
+	}
+}
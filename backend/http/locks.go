@@ -0,0 +1,196 @@
+package http
+
+import (
+	"encoding/json"
+	libErrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/sevices/lock_service"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+)
+
+// fileLocks holds the advisory edit locks of all sources.
+var fileLocks = lock_service.NewLockService()
+
+// LockBody is the request body to acquire or renew a lock.
+type LockBody struct {
+	Note    string `json:"note"`
+	Timeout int    `json:"timeout"` // seconds until the lock expires, 300 by default and at most 3600
+}
+
+// lockStatus maps errors of the lock service to status codes.
+func lockStatus(err error) int {
+	switch {
+	case libErrors.Is(err, errors.ErrLocked):
+		return http.StatusLocked
+	case err == errors.ErrNotLocked:
+		return http.StatusNotFound
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// resolveLockTarget resolves the file of a lock request. Only files can be
+// locked.
+func resolveLockTarget(d *requestContext, r *http.Request) (itemTarget, int, error) {
+	target, status, err := resolveItem(d, r.URL.Query().Get("source"), r.URL.Query().Get("path"))
+	if err != nil {
+		return target, status, err
+	}
+	if strings.HasSuffix(target.path, "/") {
+		return target, http.StatusBadRequest, fmt.Errorf("only files can be locked")
+	}
+	return target, http.StatusOK, nil
+}
+
+// decodeLockBody reads an optional lock request body.
+func decodeLockBody(r *http.Request) (LockBody, error) {
+	var body LockBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		return body, fmt.Errorf("invalid request body: %v", err)
+	}
+	return body, nil
+}
+
+// scopedLock returns a lock with its path relative to the user scope.
+func scopedLock(target itemTarget, lock lock_service.Lock) lock_service.Lock {
+	lock.Path = target.scoped(lock.Path)
+	return lock
+}
+
+// locksGetHandler lists locks.
+// @Summary List locks
+// @Description Returns the active locks of the file at path or, for folders, of the files inside it.
+// @Tags Locks
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string false "Path of a file or folder, defaults to the whole user scope"
+// @Success 200 {array} lock_service.Lock "Active locks"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /api/locks [get]
+func locksGetHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, status, err := resolveItem(d, r.URL.Query().Get("source"), r.URL.Query().Get("path"))
+	if err != nil {
+		return status, err
+	}
+	locks := fileLocks.List(target.idx.Path, target.path)
+	for i := range locks {
+		locks[i] = scopedLock(target, locks[i])
+	}
+	return renderJSON(w, r, locks)
+}
+
+// lockPostHandler acquires a lock.
+// @Summary Lock a file
+// @Description Locks a file for editing by the current user. Uploads that overwrite a file locked by another user fail with 423. Locking a file the user already holds renews the lock.
+// @Tags Locks
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the file"
+// @Param body body LockBody false "Note and timeout of the lock"
+// @Success 200 {object} lock_service.Lock "Acquired lock"
+// @Failure 400 {object} map[string]string "Invalid request or not a file"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "File not found"
+// @Failure 423 {object} map[string]string "File is locked by another user"
+// @Router /api/locks [post]
+func lockPostHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if !d.user.Permissions.Modify {
+		return http.StatusForbidden, fmt.Errorf("user is not allowed to modify")
+	}
+	body, err := decodeLockBody(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	target, status, err := resolveLockTarget(d, r)
+	if err != nil {
+		return status, err
+	}
+	lock, err := fileLocks.Acquire(target.idx.Path, target.path, d.user.Username, body.Note, time.Duration(body.Timeout)*time.Second)
+	if err != nil {
+		return lockStatus(err), err
+	}
+	return renderJSON(w, r, scopedLock(target, lock))
+}
+
+// lockPutHandler renews a lock.
+// @Summary Renew a lock
+// @Description Extends a lock held by the current user.
+// @Tags Locks
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the file"
+// @Param body body LockBody false "Timeout of the lock, the note is ignored"
+// @Success 200 {object} lock_service.Lock "Renewed lock"
+// @Failure 404 {object} map[string]string "File or lock not found"
+// @Failure 423 {object} map[string]string "File is locked by another user"
+// @Router /api/locks [put]
+func lockPutHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	body, err := decodeLockBody(r)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	target, status, err := resolveLockTarget(d, r)
+	if err != nil {
+		return status, err
+	}
+	lock, err := fileLocks.Renew(target.idx.Path, target.path, d.user.Username, time.Duration(body.Timeout)*time.Second)
+	if err != nil {
+		return lockStatus(err), err
+	}
+	return renderJSON(w, r, scopedLock(target, lock))
+}
+
+// lockDeleteHandler releases a lock.
+// @Summary Release a lock
+// @Description Releases a lock held by the current user.
+// @Tags Locks
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the file"
+// @Success 200 "Lock released"
+// @Failure 404 {object} map[string]string "File or lock not found"
+// @Failure 423 {object} map[string]string "File is locked by another user"
+// @Router /api/locks [delete]
+func lockDeleteHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, status, err := resolveLockTarget(d, r)
+	if err != nil {
+		return status, err
+	}
+	if err = fileLocks.Release(target.idx.Path, target.path, d.user.Username); err != nil {
+		return lockStatus(err), err
+	}
+	return http.StatusOK, nil
+}
+
+// lockBreakHandler breaks the lock of another user.
+// @Summary Break a lock
+// @Description Removes the lock of a file regardless of its owner. Admin only.
+// @Tags Locks
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the file"
+// @Success 200 {object} lock_service.Lock "Removed lock"
+// @Failure 404 {object} map[string]string "File or lock not found"
+// @Router /api/locks/force [delete]
+func lockBreakHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, status, err := resolveLockTarget(d, r)
+	if err != nil {
+		return status, err
+	}
+	lock, err := fileLocks.Break(target.idx.Path, target.path)
+	if err != nil {
+		return lockStatus(err), err
+	}
+	return renderJSON(w, r, scopedLock(target, lock))
+}
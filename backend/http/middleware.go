@@ -4,7 +4,9 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	libErrors "errors"
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"runtime"
@@ -35,9 +37,11 @@ type requestContext struct {
 }
 
 type HttpResponse struct {
-	Status  int    `json:"status,omitempty"`
-	Message string `json:"message,omitempty"`
-	Token   string `json:"token,omitempty"`
+	Status  int            `json:"status,omitempty"`
+	Message string         `json:"message,omitempty"`
+	Token   string         `json:"token,omitempty"`
+	Key     string         `json:"key,omitempty"`    // i18n key for localized errors
+	Params  map[string]any `json:"params,omitempty"` // values for the localized message
 }
 
 var FileInfoFasterFunc = files.FileInfoFaster
@@ -312,6 +316,12 @@ func userWithoutOTPhelper(fn handleFunc) handleFunc {
 				if err == errors.ErrNoTotpProvided {
 					return 403, err
 				}
+				if err == errors.ErrPasswordChangeRequired {
+					return 403, passwordChangeRequiredError()
+				}
+				if err == errors.ErrAccountLocked {
+					return http.StatusLocked, accountLockedError(username)
+				}
 				return 401, errors.ErrUnauthorized
 			}
 			d.user = user
@@ -376,6 +386,9 @@ func withUserHelper(fn handleFunc) handleFunc {
 		if data.user.Username == "" {
 			return http.StatusForbidden, errors.ErrUnauthorized
 		}
+		if users.PasswordChangeRequired(data.user, config.Auth.Methods.PasswordAuth.Policy.MaxAgeDays) {
+			return http.StatusForbidden, passwordChangeRequiredError()
+		}
 		// Call the handler function, passing in the context (or return OK if no handler)
 		if fn == nil {
 			return http.StatusOK, nil
@@ -384,6 +397,20 @@ func withUserHelper(fn handleFunc) handleFunc {
 	}
 }
 
+// passwordChangeRequiredError wraps ErrPasswordChangeRequired so the frontend can prompt for a new password.
+func passwordChangeRequiredError() error {
+	return errors.NewLocalized(errors.ErrPasswordChangeRequired, "passwordPolicy.changeRequired", errors.ErrPasswordChangeRequired.Error(), nil)
+}
+
+// accountLockedError reports a locked account with the remaining lock time in minutes.
+func accountLockedError(username string) error {
+	params := map[string]any{}
+	if user, err := store.Users.Get(username); err == nil && user.IsLocked() {
+		params["minutes"] = int(math.Ceil(time.Until(time.Unix(user.LockedUntil, 0)).Minutes()))
+	}
+	return errors.NewLocalized(errors.ErrAccountLocked, "accountLockout.locked", errors.ErrAccountLocked.Error(), params)
+}
+
 func getProxyUser(w http.ResponseWriter, r *http.Request, data *requestContext, fn handleFunc, proxyUser string) (int, error) {
 	// proxy user logic
 	user, err := setupProxyUser(r, data, proxyUser)
@@ -437,6 +464,11 @@ func wrapHandler(fn handleFunc) http.HandlerFunc {
 				Status:  status, // Use the status code from the middleware
 				Message: err.Error(),
 			}
+			var localized *errors.LocalizedError
+			if libErrors.As(err, &localized) {
+				response.Key = localized.Key
+				response.Params = localized.Params
+			}
 
 			// Set the content type to JSON and status code
 			w.Header().Set("Content-Type", "application/json; charset=utf-8")
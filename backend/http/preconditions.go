@@ -0,0 +1,88 @@
+package http
+
+import (
+	libErrors "errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/files"
+)
+
+// errPreconditionFailed is returned when a file changed since the client
+// loaded it.
+var errPreconditionFailed = libErrors.New("file was changed since it was loaded")
+
+// errPreconditionRequired is returned when a merge is requested without the
+// version the changes are based on.
+var errPreconditionRequired = libErrors.New("merging requires the If-Match header")
+
+// checkPreconditions evaluates the If-Match and If-Unmodified-Since headers
+// of a save against the current version of the file at path.
+func checkPreconditions(r *http.Request, source, path string) (int, error) {
+	ifMatch := r.Header.Get("If-Match")
+	ifUnmodifiedSince := r.Header.Get("If-Unmodified-Since")
+	if ifMatch == "" && r.URL.Query().Get("merge") == "true" {
+		return http.StatusPreconditionRequired, errPreconditionRequired
+	}
+	if ifMatch == "" && ifUnmodifiedSince == "" {
+		return http.StatusOK, nil
+	}
+	version, info, err := files.FileVersion(source, path)
+	if os.IsNotExist(err) {
+		// a missing file matches no version
+		if ifMatch != "" {
+			return http.StatusPreconditionFailed, errPreconditionFailed
+		}
+		return http.StatusOK, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if ifMatch != "" {
+		// If-Unmodified-Since is ignored when If-Match is given
+		if !versionMatches(ifMatch, version) {
+			return http.StatusPreconditionFailed, errPreconditionFailed
+		}
+		return http.StatusOK, nil
+	}
+	since, err := http.ParseTime(ifUnmodifiedSince)
+	if err != nil {
+		// invalid dates are ignored
+		return http.StatusOK, nil
+	}
+	if info.ModTime().Truncate(time.Second).After(since) {
+		return http.StatusPreconditionFailed, errPreconditionFailed
+	}
+	return http.StatusOK, nil
+}
+
+// versionMatches reports whether an If-Match header matches version. Weak
+// tags never match, the comparison is strong.
+func versionMatches(header, version string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == version {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeBaseVersion returns the version a save can be merged from: the
+// single tag of its If-Match header, if merging was requested.
+func mergeBaseVersion(r *http.Request) string {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if r.URL.Query().Get("merge") != "true" || tag == "*" || strings.Contains(tag, ",") || strings.HasPrefix(tag, "W/") {
+		return ""
+	}
+	return tag
+}
+
+// setVersionHeader sends the version of a saved file as ETag.
+func setVersionHeader(w http.ResponseWriter, source, path string) {
+	if version, _, err := files.FileVersion(source, path); err == nil {
+		w.Header().Set("ETag", version)
+	}
+}
@@ -0,0 +1,196 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/access"
+	"github.com/SlepoyShaman/FileStorage/backend/database/favorites"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/bolt"
+	"github.com/SlepoyShaman/FileStorage/backend/database/tags"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+)
+
+// setupResourceTest creates a source without indexing in a temp dir and a
+// user that may change and download files in it.
+func setupResourceTest(t *testing.T) (*requestContext, string) {
+	t.Helper()
+	root := t.TempDir()
+	settings.Config.Server.CacheDir = t.TempDir()
+	source := &settings.Source{Name: "test", Path: root, Config: settings.SourceConfig{DisableIndexing: true}}
+	settings.Config.Server.NameToSource = map[string]*settings.Source{source.Name: source}
+	settings.Config.Server.SourceMap = map[string]*settings.Source{source.Path: source}
+	indexing.Initialize(source, true)
+
+	db, err := storm.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open storm db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store = &storage.Store{
+		Access:    access.NewStorage(bolt.NewAccessBackend(db), nil),
+		Tags:      tags.NewStorage(bolt.NewTagsBackend(db)),
+		Favorites: favorites.NewStorage(bolt.NewFavoritesBackend(db)),
+	}
+	d := &requestContext{user: &users.User{
+		Username:    "alice",
+		Scopes:      []users.SourceScope{{Name: root, Scope: "/"}},
+		Permissions: users.Permissions{Create: true, Modify: true, Delete: true, Download: true},
+	}}
+	return d, root
+}
+
+// loadForEdit gets a file with its content like the editor does and returns
+// its version.
+func loadForEdit(t *testing.T, d *requestContext, name string) string {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/api/resources?source=test&content=true&path="+url.QueryEscape(name), nil)
+	w := httptest.NewRecorder()
+	if status, err := resourceGetHandler(w, r, d); status != http.StatusOK {
+		t.Fatalf("failed to get %v: %d %v", name, status, err)
+	}
+	version := w.Header().Get("ETag")
+	if version == "" {
+		t.Fatalf("expected an ETag for %v", name)
+	}
+	return version
+}
+
+func saveTestFile(d *requestContext, name, content, ifMatch string, merge bool) (*httptest.ResponseRecorder, int, error) {
+	query := "/api/resources?source=test&override=true&path=" + url.QueryEscape(name)
+	if merge {
+		query += "&merge=true"
+	}
+	r := httptest.NewRequest(http.MethodPost, query, strings.NewReader(content))
+	if ifMatch != "" {
+		r.Header.Set("If-Match", ifMatch)
+	}
+	w := httptest.NewRecorder()
+	status, err := resourcePostHandler(w, r, d)
+	return w, status, err
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSaveRejectsOutdatedVersion(t *testing.T) {
+	d, root := setupResourceTest(t)
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	version := loadForEdit(t, d, "/a.txt")
+
+	w, status, err := saveTestFile(d, "/a.txt", "two\n", version, false)
+	if status != http.StatusOK {
+		t.Fatalf("expected the save of the loaded version to succeed, got %d %v", status, err)
+	}
+	newVersion := w.Header().Get("ETag")
+	if newVersion == "" || newVersion == version {
+		t.Errorf("expected a new version after saving, got %q", newVersion)
+	}
+	if _, status, _ = saveTestFile(d, "/a.txt", "three\n", version, false); status != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for a save of an outdated version, got %d", status)
+	}
+	if got := readTestFile(t, filepath.Join(root, "a.txt")); got != "two\n" {
+		t.Errorf("expected the rejected save not to be written, got %q", got)
+	}
+	if _, status, _ = saveTestFile(d, "/missing.txt", "new\n", version, false); status != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for If-Match on a missing file, got %d", status)
+	}
+}
+
+func TestMergeRequiresVersion(t *testing.T) {
+	d, root := setupResourceTest(t)
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, status, err := saveTestFile(d, "/a.txt", "two\n", "", true); status != http.StatusPreconditionRequired || err != errPreconditionRequired {
+		t.Errorf("expected 428 for a merge without If-Match, got %d %v", status, err)
+	}
+	if got := readTestFile(t, filepath.Join(root, "a.txt")); got != "one\n" {
+		t.Errorf("expected the file not to be written, got %q", got)
+	}
+}
+
+func TestSaveMergesOutdatedVersion(t *testing.T) {
+	d, root := setupResourceTest(t)
+	path := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(path, []byte("a\nb\nc\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	version := loadForEdit(t, d, "/a.txt")
+	// someone else changes the last line meanwhile
+	if _, status, err := saveTestFile(d, "/a.txt", "a\nb\nC\n", version, false); status != http.StatusOK {
+		t.Fatalf("failed to save: %d %v", status, err)
+	}
+
+	w, status, err := saveTestFile(d, "/a.txt", "A\nb\nc\n", version, true)
+	if status != http.StatusOK {
+		t.Fatalf("expected the changes to be merged, got %d %v", status, err)
+	}
+	if w.Header().Get("X-Merged") != "true" {
+		t.Error("expected the X-Merged header")
+	}
+	if got := readTestFile(t, path); got != "A\nb\nC\n" {
+		t.Errorf("expected both changes, got %q", got)
+	}
+
+	// a conflicting change of the same line can't be merged
+	if _, status, _ = saveTestFile(d, "/a.txt", "a\nb\nX\n", version, true); status != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for conflicting changes, got %d", status)
+	}
+	if got := readTestFile(t, path); got != "A\nb\nC\n" {
+		t.Errorf("expected the conflicting save not to be written, got %q", got)
+	}
+}
+
+func TestConcurrentSavesOfSameVersion(t *testing.T) {
+	d, root := setupResourceTest(t)
+	if err := os.WriteFile(filepath.Join(root, "a.txt"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	version := loadForEdit(t, d, "/a.txt")
+
+	const saves = 8
+	statuses := make(chan int, saves)
+	var wg sync.WaitGroup
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// contents differ in size, so every save changes the version
+			_, status, _ := saveTestFile(d, "/a.txt", strings.Repeat("x", i+1), version, false)
+			statuses <- status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+	succeeded := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			succeeded++
+		} else if status != http.StatusPreconditionFailed {
+			t.Errorf("unexpected status %d", status)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("expected exactly one save of the version to succeed, got %d", succeeded)
+	}
+}
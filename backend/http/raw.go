@@ -1,11 +1,7 @@
 package http
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"compress/gzip"
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,7 +11,7 @@ import (
 	"strings"
 
 	"github.com/SlepoyShaman/filebrowser/backend/adapters/fs/files"
-	"github.com/SlepoyShaman/filebrowser/backend/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/filebrowser/backend/adapters/fs/sources"
 	"github.com/SlepoyShaman/filebrowser/backend/common/settings"
 	"github.com/SlepoyShaman/filebrowser/backend/common/utils"
 	"github.com/SlepoyShaman/filebrowser/backend/indexing"
@@ -54,6 +50,37 @@ func (r *throttledReadSeeker) Seek(offset int64, whence int) (int64, error) {
 	return r.rs.Seek(offset, whence)
 }
 
+type throttledWriter struct {
+	w       io.Writer
+	limiter *rate.Limiter
+	ctx     context.Context
+}
+
+func newThrottledWriter(w io.Writer, limit rate.Limit, burst int, ctx context.Context) *throttledWriter {
+	return &throttledWriter{
+		w:       w,
+		limiter: rate.NewLimiter(limit, burst),
+		ctx:     ctx,
+	}
+}
+
+func (t *throttledWriter) Write(p []byte) (n int, err error) {
+	// write in chunks of at most the burst size, which WaitN can't exceed
+	for len(p) > 0 {
+		chunk := p[:min(len(p), t.limiter.Burst())]
+		if err = t.limiter.WaitN(t.ctx, len(chunk)); err != nil {
+			return n, err
+		}
+		written, err := t.w.Write(chunk)
+		n += written
+		if err != nil {
+			return n, err
+		}
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
 func toASCIIFilename(fileName string) string {
 	var result strings.Builder
 	for _, r := range fileName {
@@ -83,6 +110,8 @@ func setContentDisposition(w http.ResponseWriter, r *http.Request, fileName stri
 // @Param files query string true "a list of files in the following format 'source::filename' and separated by '||' with additional items in the list. (required)"
 // @Param inline query bool false "If true, sets 'Content-Disposition' to 'inline'. Otherwise, defaults to 'attachment'."
 // @Param algo query string false "Compression algorithm for archiving multiple files or directories. Options: 'zip' and 'tar.gz'. Default is 'zip'."
+// @Param compression query int false "Compression level from 0 to 9 for archives. Zips with level 0 are stored uncompressed and sent with a Content-Length."
+// @Param exclude query string false "Comma separated glob patterns of names or paths inside the archive to leave out, eg. '*.tmp,node_modules'."
 // @Success 200 {file} file "Raw file or directory content, or archive for multiple files"
 // @Failure 202 {object} map[string]string "Modify permissions required"
 // @Failure 400 {object} map[string]string "Invalid request path"
@@ -95,7 +124,7 @@ func rawHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int,
 	return rawFilesHandler(w, r, d, fileList)
 }
 
-func addFile(path string, d *requestContext, tarWriter *tar.Writer, zipWriter *zip.Writer, flatten bool) error {
+func addFile(ctx context.Context, path string, d *requestContext, aw *archiveWriter, flatten bool) error {
 	splitFile := strings.Split(path, "::")
 	if len(splitFile) != 2 {
 		return fmt.Errorf("invalid file in files requested: %v", splitFile)
@@ -132,36 +161,29 @@ func addFile(path string, d *requestContext, tarWriter *tar.Writer, zipWriter *z
 	if err != nil {
 		return err
 	}
-	realPath, _, _ := idx.GetRealPath(path)
-	info, err := os.Stat(realPath)
+	info, err := idx.FS.Stat(path)
 	if err != nil {
 		return err
 	}
 
-	baseName := filepath.Base(realPath)
+	baseName := info.Name()
+	root := strings.TrimSuffix(path, "/")
+	if aw.opts.excluded(baseName) {
+		return nil
+	}
 
 	if info.IsDir() {
-		return filepath.Walk(realPath, func(filePath string, fileInfo os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-
-			relPath, err := filepath.Rel(realPath, filePath)
-			if err != nil {
+		return sources.Walk(idx.FS, root, func(name string, fileInfo os.FileInfo) error {
+			if err := ctx.Err(); err != nil {
 				return err
 			}
-
-			relPath = filepath.ToSlash(relPath)
-
-			if relPath == "." {
+			relPath := strings.TrimPrefix(strings.TrimPrefix(name, root), "/")
+			if relPath == "" {
 				return nil
 			}
 
 			if d.share == nil {
-				indexRelPath := filepath.Join(path, relPath)
-				indexRelPath = filepath.ToSlash(indexRelPath)
-
-				if !store.Access.Permitted(idx.Path, indexRelPath, d.user.Username) {
+				if !store.Access.Permitted(idx.Path, name, d.user.Username) {
 					if fileInfo.IsDir() {
 						return filepath.SkipDir
 					}
@@ -170,35 +192,27 @@ func addFile(path string, d *requestContext, tarWriter *tar.Writer, zipWriter *z
 			}
 
 			if !flatten {
-				relPath = filepath.Join(baseName, relPath)
-				relPath = filepath.ToSlash(relPath)
+				relPath = baseName + "/" + relPath
 			}
-
-			if fileInfo.IsDir() {
-				if tarWriter != nil {
-					header := &tar.Header{
-						Name:     relPath + "/",
-						Mode:     int64(fileutils.PermDir),
-						Typeflag: tar.TypeDir,
-						ModTime:  fileInfo.ModTime(),
-					}
-					return tarWriter.WriteHeader(header)
-				}
-				if zipWriter != nil {
-					_, err := zipWriter.Create(relPath + "/")
-					return err
+			if aw.opts.excluded(relPath) {
+				if fileInfo.IsDir() {
+					return filepath.SkipDir
 				}
 				return nil
 			}
-			return addSingleFile(filePath, relPath, zipWriter, tarWriter)
+
+			if fileInfo.IsDir() {
+				return aw.writeDir(relPath, fileInfo)
+			}
+			return addSingleFile(idx.FS, name, relPath, aw)
 		})
 	} else {
-		return addSingleFile(realPath, baseName, zipWriter, tarWriter)
+		return addSingleFile(idx.FS, root, baseName, aw)
 	}
 }
 
-func addSingleFile(realPath, archivePath string, zipWriter *zip.Writer, tarWriter *tar.Writer) error {
-	file, err := os.Open(realPath)
+func addSingleFile(fsys sources.FS, name, archivePath string, aw *archiveWriter) error {
+	file, err := fsys.Open(name)
 	if err != nil {
 		if strings.Contains(err.Error(), "is a directory") {
 			return nil
@@ -216,34 +230,7 @@ func addSingleFile(realPath, archivePath string, zipWriter *zip.Writer, tarWrite
 		return nil
 	}
 
-	if tarWriter != nil {
-		header, err := tar.FileInfoHeader(info, "")
-		if err != nil {
-			return err
-		}
-		header.Name = filepath.ToSlash(archivePath)
-		if err = tarWriter.WriteHeader(header); err != nil {
-			return err
-		}
-		_, err = io.Copy(tarWriter, file)
-		return err
-	}
-
-	if zipWriter != nil {
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
-		}
-		header.Name = archivePath
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(writer, file)
-		return err
-	}
-
-	return nil
+	return aw.writeFile(filepath.ToSlash(archivePath), info, file)
 }
 
 func rawFilesHandler(w http.ResponseWriter, r *http.Request, d *requestContext, fileList []string) (int, error) {
@@ -332,7 +319,7 @@ func rawFilesHandler(w http.ResponseWriter, r *http.Request, d *requestContext,
 			}
 		}
 
-		fd, err2 := os.Open(realPath)
+		fd, err2 := idx.FS.Open(firstFilePath)
 		if err2 != nil {
 			if isOnlyOffice && logContext != nil {
 				sendOnlyOfficeLogEvent(logContext, "ERROR", "download",
@@ -383,15 +370,9 @@ func rawFilesHandler(w http.ResponseWriter, r *http.Request, d *requestContext,
 			return http.StatusRequestEntityTooLarge, fmt.Errorf("pre-archive combined size of files exceeds maximum limit of %d GB", config.Server.MaxArchiveSizeGB)
 		}
 	}
-	algo := r.URL.Query().Get("algo")
-	var extension string
-	switch algo {
-	case "zip", "true", "":
-		extension = ".zip"
-	case "tar.gz":
-		extension = ".tar.gz"
-	default:
-		return http.StatusInternalServerError, errors.New("format not implemented")
+	opts, err := parseArchiveOptions(r.URL.Query().Get("algo"), r.URL.Query().Get("compression"), r.URL.Query().Get("exclude"))
+	if err != nil {
+		return http.StatusBadRequest, err
 	}
 
 	baseDirName := filepath.Base(filepath.Dir(firstFilePath))
@@ -401,52 +382,35 @@ func rawFilesHandler(w http.ResponseWriter, r *http.Request, d *requestContext,
 	if len(fileList) == 1 && isDir {
 		baseDirName = filepath.Base(realPath)
 	}
-	originalFileName := baseDirName + extension
-
-	archiveData := filepath.Join(config.Server.CacheDir, utils.InsecureRandomIdentifier(10))
-	if extension == ".zip" {
-		archiveData = archiveData + ".zip"
-		err = createZip(d, archiveData, fileList...)
-	} else {
-		archiveData = archiveData + ".tar.gz"
-		err = createTarGz(d, archiveData, fileList...)
-	}
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-
-	fd, err := os.Open(archiveData)
-	if err != nil {
-		return http.StatusInternalServerError, err
-	}
-	defer fd.Close()
+	originalFileName := baseDirName + opts.extension()
 
-	fileInfo, err := fd.Stat()
-	if err != nil {
-		os.Remove(archiveData)
-		return http.StatusInternalServerError, err
+	// stored zips have a known size, so clients can show the progress
+	if opts.stored() {
+		size, err := storedArchiveSize(r.Context(), d, opts, fileList...)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
 	}
 
-	sizeInMB := fileInfo.Size() / 1024 / 1024
+	sizeInMB := estimatedSize / 1024 / 1024
 	if sizeInMB > 500 {
 		logger.Debugf("User %v is downloading large (%d MB) file: %v", d.user.Username, sizeInMB, originalFileName)
 	}
 
 	setContentDisposition(w, r, originalFileName)
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
 	w.Header().Set("Content-Type", "application/octet-stream")
 
-	var reader io.Reader = fd
+	var writer io.Writer = w
 	if d.share != nil && d.share.MaxBandwidth > 0 {
 		limit := rate.Limit(d.share.MaxBandwidth * 1024)
 		burst := d.share.MaxBandwidth * 1024
-		reader = newThrottledReadSeeker(fd, limit, burst, r.Context())
+		writer = newThrottledWriter(w, limit, burst, r.Context())
 	}
-	_, err = io.Copy(w, reader)
-	os.Remove(archiveData)
-	if err != nil {
-		logger.Errorf("Failed to copy archive data to response: %v", err)
-		return http.StatusInternalServerError, err
+	// the archive is streamed while the files are walked, so errors can
+	// only end the response early
+	if err = writeArchive(r.Context(), d, writer, opts, nil, fileList...); err != nil {
+		logger.Errorf("Failed to stream archive: %v", err)
 	}
 
 	return 0, nil
@@ -495,50 +459,6 @@ func computeArchiveSize(fileList []string, d *requestContext) (int64, error) {
 	return estimatedSize, nil
 }
 
-func createZip(d *requestContext, tmpDirPath string, filenames ...string) error {
-	file, err := os.Create(tmpDirPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	zipWriter := zip.NewWriter(file)
-	defer zipWriter.Close()
-
-	for _, fname := range filenames {
-		err := addFile(fname, d, nil, zipWriter, false)
-		if err != nil {
-			logger.Errorf("Failed to add %s to ZIP: %v", fname, err)
-			return err
-		}
-	}
-
-	return nil
-}
-
-func createTarGz(d *requestContext, tmpDirPath string, filenames ...string) error {
-	file, err := os.Create(tmpDirPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	gzWriter := gzip.NewWriter(file)
-	defer gzWriter.Close()
-	tarWriter := tar.NewWriter(gzWriter)
-	defer tarWriter.Close()
-
-	for _, fname := range filenames {
-		err := addFile(fname, d, tarWriter, nil, false)
-		if err != nil {
-			logger.Errorf("Failed to add %s to TAR.GZ: %v", fname, err)
-			return err
-		}
-	}
-
-	return nil
-}
-
 func isOnlyOfficeCompatibleFile(fileName string) bool {
 	return iteminfo.IsOnlyOffice(fileName)
 }
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
@@ -15,6 +16,9 @@ import (
 
 	"github.com/SlepoyShaman/FileStorage/adapters/fs/files"
 	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
+	"github.com/SlepoyShaman/FileStorage/backend/database/favorites"
+	"github.com/SlepoyShaman/FileStorage/backend/database/tags"
 	"github.com/SlepoyShaman/FileStorage/common/errors"
 	"github.com/SlepoyShaman/FileStorage/common/settings"
 	"github.com/SlepoyShaman/FileStorage/common/utils"
@@ -33,7 +37,8 @@ import (
 // @Param source query string true "Source name for the desired source, default is used if not provided"
 // @Param content query string false "Include file content if true"
 // @Param checksum query string false "Optional checksum validation"
-// @Success 200 {object} iteminfo.FileInfo "Resource metadata"
+// @Param tags query string false "Comma separated tags, only items of a folder with all of them are listed"
+// @Success 200 {object} iteminfo.FileInfo "Resource metadata, files include their version, also sent as ETag header"
 // @Failure 404 {object} map[string]string "Resource not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/resources [get]
@@ -55,6 +60,10 @@ func resourceGetHandler(w http.ResponseWriter, r *http.Request, d *requestContex
 	}
 	userscope = strings.TrimRight(userscope, "/")
 	scopePath := utils.JoinPathAsUnix(userscope, path)
+	tagFilter, err := tags.ParseTags(r.URL.Query().Get("tags"))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
 	getContent := r.URL.Query().Get("content") == "true"
 	fileInfo, err := files.FileInfoFaster(utils.FileOptions{
 		Username:                 d.user.Username,
@@ -71,6 +80,14 @@ func resourceGetHandler(w http.ResponseWriter, r *http.Request, d *requestContex
 	if !d.user.Permissions.Download && fileInfo.Content != "" {
 		return http.StatusForbidden, fmt.Errorf("user is not allowed to get content, requires download permission")
 	}
+	if idx := indexing.GetIndex(source); idx != nil {
+		if err = addResourceTags(fileInfo, idx.Path, tagFilter); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if fileInfo.Type != "directory" {
+			touchRecent(d, idx.Path, fileInfo.Path, favorites.ActionOpened)
+		}
+	}
 	if userscope != "/" {
 		fileInfo.Path = strings.TrimPrefix(fileInfo.Path, userscope)
 	}
@@ -80,6 +97,13 @@ func resourceGetHandler(w http.ResponseWriter, r *http.Request, d *requestContex
 	if fileInfo.Type == "directory" {
 		return renderJSON(w, r, fileInfo)
 	}
+	if version, _, versionErr := files.FileVersion(source, scopePath); versionErr == nil {
+		fileInfo.Version = version
+		w.Header().Set("ETag", version)
+		if fileInfo.Content != "" {
+			files.SaveMergeBase(source, scopePath, version, fileInfo.Content)
+		}
+	}
 	if algo := r.URL.Query().Get("checksum"); algo != "" {
 		idx := indexing.GetIndex(source)
 		if idx == nil {
@@ -99,6 +123,18 @@ func resourceGetHandler(w http.ResponseWriter, r *http.Request, d *requestContex
 
 }
 
+// uploadTempFile copies a completed chunked upload to a remote source and
+// removes the temporary file.
+func uploadTempFile(fsys sources.FS, tempFilePath, path string) error {
+	file, err := os.Open(tempFilePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFilePath)
+	defer file.Close()
+	return fsys.WriteFile(path, file)
+}
+
 // resourcePostHandler creates or uploads a new resource.
 // @Summary Create or upload a resource
 // @Description Creates a new resource or uploads a file at the specified path. Supports file uploads and directory creation.
@@ -109,10 +145,16 @@ func resourceGetHandler(w http.ResponseWriter, r *http.Request, d *requestContex
 // @Param source query string true "Name for the desired filebrowser destination source name, default is used if not provided"
 // @Param override query bool false "Override existing file if true"
 // @Param isDir query bool false "Explicitly specify if the resource is a directory"
-// @Success 200 "Resource created successfully"
+// @Param merge query bool false "Merge the changes with the current file if If-Match doesn't match, only for text files loaded with content"
+// @Param If-Match header string false "Version the change is based on, as returned in the ETag header"
+// @Param If-Unmodified-Since header string false "Only save if the file wasn't changed since this time"
+// @Success 200 "Resource created successfully, the ETag header holds the new version and X-Merged is true if the changes were merged"
 // @Failure 403 {object} map[string]string "Forbidden"
 // @Failure 404 {object} map[string]string "Resource not found"
 // @Failure 409 {object} map[string]string "Conflict - Resource already exists"
+// @Failure 412 {object} map[string]string "File was changed since it was loaded and the changes could not be merged"
+// @Failure 428 {object} map[string]string "Merge requested without If-Match"
+// @Failure 423 {object} map[string]string "File is locked by another user"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /api/resources [post]
 func resourcePostHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
@@ -172,8 +214,25 @@ func resourcePostHandler(w http.ResponseWriter, r *http.Request, d *requestConte
 		return http.StatusForbidden, fmt.Errorf("access denied to path %s", path)
 	}
 
+	// Files locked for editing by someone else can't be overwritten
+	if err = fileLocks.CheckTree(idx.Path, path, d.user.Username); err != nil {
+		return http.StatusLocked, err
+	}
+
+	// Saves based on an outdated version fail, unless they can be merged below.
+	// Other saves of the file wait until this one is written, so they are
+	// checked against its version.
+	defer fileLocks.LockWrite(idx.Path, path)()
+	mergeBase := ""
+	if status, preconditionErr := checkPreconditions(r, source, path); preconditionErr != nil {
+		mergeBase = mergeBaseVersion(r)
+		if status != http.StatusPreconditionFailed || mergeBase == "" || isDir || r.Header.Get("X-File-Chunk-Offset") != "" {
+			return status, preconditionErr
+		}
+	}
+
 	// Check for file/folder conflicts before creation
-	if stat, statErr := os.Stat(realPath); statErr == nil {
+	if stat, statErr := idx.FS.Stat(path); statErr == nil {
 		// Path exists, check for type conflicts
 		existingIsDir := stat.IsDir()
 		requestingDir := isDir
@@ -183,6 +242,15 @@ func resourcePostHandler(w http.ResponseWriter, r *http.Request, d *requestConte
 			slog.Debug("Type conflict detected in chunked: existing is dir=%v, requesting dir=%v at path=%v", existingIsDir, requestingDir, realPath)
 			return http.StatusConflict, nil
 		}
+		// the existing item is replaced by one of the other type, its tags don't carry over
+		if existingIsDir != requestingDir {
+			if err = store.Tags.Remove(idx.Path, path); err != nil {
+				slog.Debug("could not remove tags of replaced item", "path", path, "err", err)
+			}
+			if err = store.Favorites.Remove(idx.Path, path); err != nil {
+				slog.Debug("could not remove favorites of replaced item", "path", path, "err", err)
+			}
+		}
 	}
 
 	// Directories creation on POST.
@@ -215,7 +283,7 @@ func resourcePostHandler(w http.ResponseWriter, r *http.Request, d *requestConte
 		// On the first chunk, check for conflicts or handle override
 		if offset == 0 {
 			// Check for file/folder conflicts for chunked uploads
-			if stat, statErr := os.Stat(realPath); statErr == nil {
+			if stat, statErr := idx.FS.Stat(path); statErr == nil {
 				existingIsDir := stat.IsDir()
 				requestingDir := false // Files are never directories
 
@@ -277,12 +345,18 @@ func resourcePostHandler(w http.ResponseWriter, r *http.Request, d *requestConte
 			// close file before moving
 			outFile.Close()
 			// Move the completed file from the temp location to the final destination
-			err = fileutils.MoveFile(tempFilePath, realPath)
+			if idx.FS.IsLocal() {
+				err = fileutils.MoveFile(tempFilePath, realPath)
+			} else {
+				err = uploadTempFile(idx.FS, tempFilePath, path)
+			}
 			if err != nil {
 				slog.Debug("could not move file from %v to %v: %v", tempFilePath, realPath, err)
 				return http.StatusInternalServerError, fmt.Errorf("could not move file from chunked folder to destination: %v", err)
 			}
 			go files.RefreshIndex(source, realPath, false, false) //nolint:errcheck
+			touchRecent(d, idx.Path, path, favorites.ActionEdited)
+			setVersionHeader(w, source, path)
 		}
 
 		return http.StatusOK, nil
@@ -297,10 +371,76 @@ func resourcePostHandler(w http.ResponseWriter, r *http.Request, d *requestConte
 		// If overriding, delete existing thumbnails
 		preview.DelThumbs(r.Context(), *fileInfo)
 	}
-	err = files.WriteFile(fileOpts.Source, fileOpts.Path, r.Body)
+	var content io.Reader = r.Body
+	if mergeBase != "" {
+		var ours []byte
+		ours, err = io.ReadAll(r.Body)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("could not read request body: %v", err)
+		}
+		merged, ok, mergeErr := files.MergeFile(source, path, mergeBase, ours)
+		if mergeErr != nil {
+			return http.StatusInternalServerError, mergeErr
+		}
+		if !ok {
+			return http.StatusPreconditionFailed, fmt.Errorf("%v and the changes could not be merged", errPreconditionFailed)
+		}
+		content = bytes.NewReader(merged)
+		w.Header().Set("X-Merged", "true")
+	}
+	err = files.WriteFile(fileOpts.Source, fileOpts.Path, content)
 	if err != nil {
 		slog.Debug("error writing file: %v", err)
 		return errToStatus(err), err
 	}
+	touchRecent(d, idx.Path, path, favorites.ActionEdited)
+	setVersionHeader(w, source, path)
 	return http.StatusOK, nil
 }
+
+// itemTarget is an item of a request, resolved against the user scope.
+type itemTarget struct {
+	idx       *indexing.Index
+	userscope string
+	path      string // index path, folders end with a slash
+}
+
+// resolveItem checks that the user may access an existing item and
+// returns its index path, with a trailing slash for folders.
+func resolveItem(d *requestContext, source, path string) (itemTarget, int, error) {
+	userscope, err := settings.GetScopeFromSourceName(d.user.Scopes, source)
+	if err != nil {
+		return itemTarget{}, http.StatusForbidden, err
+	}
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return itemTarget{}, http.StatusNotFound, fmt.Errorf("source %s not found", source)
+	}
+	target := itemTarget{idx: idx, userscope: strings.TrimRight(userscope, "/")}
+	target.path = utils.JoinPathAsUnix(userscope, path)
+	// ".." must not leave the user scope
+	if target.path != target.userscope && !strings.HasPrefix(target.path, target.userscope+"/") {
+		return itemTarget{}, http.StatusForbidden, fmt.Errorf("path %s is outside of the user scope", path)
+	}
+	if store.Access != nil && !store.Access.Permitted(idx.Path, target.path, d.user.Username) {
+		return itemTarget{}, http.StatusForbidden, fmt.Errorf("access denied to path %s", path)
+	}
+	stat, err := idx.FS.Stat(target.path)
+	if err != nil {
+		return itemTarget{}, http.StatusNotFound, fmt.Errorf("path %s not found", path)
+	}
+	target.path = strings.TrimSuffix(target.path, "/")
+	if stat.IsDir() {
+		target.path += "/"
+	}
+	return target, http.StatusOK, nil
+}
+
+// scoped returns an index path relative to the user scope.
+func (t itemTarget) scoped(path string) string {
+	path = strings.TrimPrefix(path, t.userscope)
+	if path == "" {
+		path = "/"
+	}
+	return path
+}
@@ -0,0 +1,39 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResolveItemScope(t *testing.T) {
+	d, root := setupResourceTest(t)
+	writeTestFiles(t, root, map[string]string{"alice/a.txt": "a", "bob/b.txt": "b", "top.txt": "t"})
+	d.user.Scopes[0].Scope = "/alice"
+
+	for path, want := range map[string]string{
+		"/":             "/alice/",
+		"a.txt":         "/alice/a.txt",
+		"/x/../a.txt":   "/alice/a.txt",
+		"..":            "",
+		"../bob/b.txt":  "",
+		"/../top.txt":   "",
+		"../alice-old/": "",
+	} {
+		target, status, err := resolveItem(d, "test", path)
+		if want == "" {
+			if status != http.StatusForbidden {
+				t.Errorf("%q: expected 403, got %d %v", path, status, err)
+			}
+			continue
+		}
+		if err != nil || target.path != want {
+			t.Errorf("%q: expected %v, got %v %v", path, want, target.path, err)
+		}
+	}
+
+	// a root scope still can't reach outside of the source
+	d.user.Scopes[0].Scope = "/"
+	if target, _, err := resolveItem(d, "test", "../top.txt"); err != nil || target.path != "/top.txt" {
+		t.Errorf("expected the path to stay in the source, got %v %v", target.path, err)
+	}
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/backend/database/tags"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/common/utils"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/SlepoyShaman/FileStorage/indexing/fulltext"
+)
+
+const (
+	defaultContentSearchLimit = 50
+	maxContentSearchLimit     = 500
+)
+
+// contentSearchHandler searches the contents of files.
+// @Summary Search file contents
+// @Description Returns files whose contents match the query, best matches first. Words and "quoted phrases" must all match, a trailing * matches words by prefix. Requires fullText to be enabled for the source.
+// @Tags Search
+// @Accept json
+// @Produce json
+// @Param query query string true "Search query"
+// @Param source query string true "Source name for the desired source"
+// @Param scope query string false "Path within the user scope to search below, defaults to the whole scope"
+// @Param limit query int false "Maximum number of results (default 50, max 500)"
+// @Param tags query string false "Comma separated tags, only files with all of them are returned"
+// @Success 200 {array} fulltext.Result "Matching files with highlighted snippets"
+// @Failure 400 {object} map[string]string "Empty query or full-text search not enabled"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Source not found"
+// @Router /api/search/content [get]
+func contentSearchHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	query := r.URL.Query().Get("query")
+	source := r.URL.Query().Get("source")
+	limit := defaultContentSearchLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return http.StatusBadRequest, fmt.Errorf("invalid limit: %v", value)
+		}
+		limit = min(limit, maxContentSearchLimit)
+	}
+	tagFilter, err := tags.ParseTags(r.URL.Query().Get("tags"))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	userscope, err := settings.GetScopeFromSourceName(d.user.Scopes, source)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return http.StatusNotFound, fmt.Errorf("source %s not found", source)
+	}
+	scopePath := utils.JoinPathAsUnix(userscope, r.URL.Query().Get("scope"))
+	userscope = strings.TrimRight(userscope, "/")
+	// ".." must not leave the user scope
+	if scopePath != userscope && !strings.HasPrefix(scopePath, userscope+"/") {
+		return http.StatusForbidden, fmt.Errorf("scope %s is outside of the user scope", r.URL.Query().Get("scope"))
+	}
+	scope := idx.MakeIndexPath(scopePath)
+
+	results, err := idx.SearchContent(query, scope, limit, func(path string) bool {
+		if store.Access != nil && !store.Access.Permitted(idx.Path, path, d.user.Username) {
+			return false
+		}
+		if len(tagFilter) == 0 {
+			return true
+		}
+		entry, err := store.Tags.Get(idx.Path, path)
+		return err == nil && entry.HasTags(tagFilter)
+	})
+	if err == fulltext.ErrEmptyQuery || err == errors.ErrFullTextDisabled {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for i := range results {
+		results[i].Path = strings.TrimPrefix(results[i].Path, userscope)
+	}
+	return renderJSON(w, r, results)
+}
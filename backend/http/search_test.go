@@ -0,0 +1,30 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestContentSearchScope(t *testing.T) {
+	d, _ := setupResourceTest(t)
+	d.user.Scopes[0].Scope = "/alice"
+
+	// the test source has no full-text index, scopes inside the user scope
+	// get as far as the search
+	for scope, want := range map[string]int{
+		"":               http.StatusBadRequest,
+		"/docs":          http.StatusBadRequest,
+		"docs/../notes":  http.StatusBadRequest,
+		"..":             http.StatusForbidden,
+		"../bob":         http.StatusForbidden,
+		"/../alice-old":  http.StatusForbidden,
+		"docs/../../bob": http.StatusForbidden,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/search/content?source=test&query=secret&scope="+url.QueryEscape(scope), nil)
+		if status, err := contentSearchHandler(httptest.NewRecorder(), r, d); status != want {
+			t.Errorf("scope %q: expected %d, got %d %v", scope, want, status, err)
+		}
+	}
+}
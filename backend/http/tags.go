@@ -0,0 +1,327 @@
+package http
+
+import (
+	"encoding/json"
+	libErrors "errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/files"
+	"github.com/SlepoyShaman/FileStorage/backend/database/tags"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/common/utils"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+)
+
+// maxBulkTagItems limits the items of a single bulk tagging request.
+const maxBulkTagItems = 1000
+
+// TagsBody replaces the tags and metadata of an item.
+type TagsBody struct {
+	Tags     []string          `json:"tags"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// BulkTagsBody changes the tags and metadata of many items at once.
+type BulkTagsBody struct {
+	tags.Change
+	Source string   `json:"source"`
+	Items  []string `json:"items"` // paths within the user scope
+}
+
+// TagCount is a tag and the number of items it is used on.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// updateTags applies a change to the targets and mirrors the result to
+// extended attributes when the source enables it.
+func updateTags(d *requestContext, targets []itemTarget, change tags.Change) (int, []*tags.Entry, error) {
+	paths := make([]string, len(targets))
+	for i, target := range targets {
+		paths[i] = target.path
+	}
+	entries, err := store.Tags.Update(targets[0].idx.Path, paths, change, d.user.Username)
+	if libErrors.Is(err, errors.ErrInvalidTag) {
+		return http.StatusBadRequest, nil, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	for i, entry := range entries {
+		mirrored := entry
+		if len(entry.Tags) == 0 && len(entry.Metadata) == 0 {
+			mirrored = nil
+		}
+		if err = files.MirrorTags(targets[i].idx.Name, targets[i].path, mirrored); err != nil {
+			slog.Warn("could not mirror tags to extended attributes", "path", targets[i].path, "err", err)
+		}
+		entry.Path = targets[i].scoped(entry.Path)
+	}
+	return http.StatusOK, entries, nil
+}
+
+// tagsGetHandler returns the tags and metadata of an item.
+// @Summary Get tags of an item
+// @Description Returns the tags and custom metadata of a file or folder.
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the file or folder"
+// @Success 200 {object} tags.Entry "Tags and metadata of the item"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /api/tags [get]
+func tagsGetHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	target, status, err := resolveItem(d, r.URL.Query().Get("source"), r.URL.Query().Get("path"))
+	if err != nil {
+		return status, err
+	}
+	entry, err := store.Tags.Get(target.idx.Path, target.path)
+	if err == errors.ErrNotExist {
+		entry = &tags.Entry{Source: target.idx.Path, Path: target.path, Tags: []string{}}
+	} else if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	entry.Path = target.scoped(entry.Path)
+	return renderJSON(w, r, entry)
+}
+
+// tagsPutHandler replaces the tags and metadata of an item.
+// @Summary Set tags of an item
+// @Description Replaces the tags and custom metadata of a file or folder. Tags are case insensitive and may not contain commas.
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the file or folder"
+// @Param body body TagsBody true "New tags and metadata"
+// @Success 200 {object} tags.Entry "Tags and metadata of the item"
+// @Failure 400 {object} map[string]string "Invalid tag or metadata"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /api/tags [put]
+func tagsPutHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if !d.user.Permissions.Modify {
+		return http.StatusForbidden, fmt.Errorf("user is not allowed to modify")
+	}
+	var body TagsBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err)
+	}
+	target, status, err := resolveItem(d, r.URL.Query().Get("source"), r.URL.Query().Get("path"))
+	if err != nil {
+		return status, err
+	}
+	status, entries, err := updateTags(d, []itemTarget{target}, tags.Change{
+		ClearTags:     true,
+		AddTags:       body.Tags,
+		ClearMetadata: true,
+		Metadata:      body.Metadata,
+	})
+	if err != nil {
+		return status, err
+	}
+	return renderJSON(w, r, entries[0])
+}
+
+// tagsPatchHandler changes the tags and metadata of many items.
+// @Summary Tag items in bulk
+// @Description Adds and removes tags and metadata of up to 1000 items. All items are checked before any of them is changed.
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param body body BulkTagsBody true "Items and the change to apply"
+// @Success 200 {array} tags.Entry "Tags and metadata of the changed items"
+// @Failure 400 {object} map[string]string "Invalid tag, metadata or item list"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /api/tags [patch]
+func tagsPatchHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if !d.user.Permissions.Modify {
+		return http.StatusForbidden, fmt.Errorf("user is not allowed to modify")
+	}
+	var body BulkTagsBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err)
+	}
+	if len(body.Items) == 0 || len(body.Items) > maxBulkTagItems {
+		return http.StatusBadRequest, fmt.Errorf("between 1 and %d items are required", maxBulkTagItems)
+	}
+	targets := make([]itemTarget, 0, len(body.Items))
+	for _, item := range body.Items {
+		target, status, err := resolveItem(d, body.Source, item)
+		if err != nil {
+			return status, err
+		}
+		targets = append(targets, target)
+	}
+	status, entries, err := updateTags(d, targets, body.Change)
+	if err != nil {
+		return status, err
+	}
+	return renderJSON(w, r, entries)
+}
+
+// tagsDeleteHandler removes all tags and metadata of an item.
+// @Summary Remove tags of an item
+// @Description Removes all tags and custom metadata of a file or folder.
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param path query string true "Path of the file or folder"
+// @Success 200 "Tags removed"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Item not found"
+// @Router /api/tags [delete]
+func tagsDeleteHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	if !d.user.Permissions.Modify {
+		return http.StatusForbidden, fmt.Errorf("user is not allowed to modify")
+	}
+	target, status, err := resolveItem(d, r.URL.Query().Get("source"), r.URL.Query().Get("path"))
+	if err != nil {
+		return status, err
+	}
+	status, _, err = updateTags(d, []itemTarget{target}, tags.Change{ClearTags: true, ClearMetadata: true})
+	return status, err
+}
+
+// visibleTagEntries returns the entries below scope the user may access.
+func visibleTagEntries(d *requestContext, source, scope string, filter []string) (itemTarget, []*tags.Entry, int, error) {
+	target, status, err := resolveItem(d, source, scope)
+	if err != nil {
+		return target, nil, status, err
+	}
+	entries, err := store.Tags.Find(target.idx.Path, target.path, filter)
+	if err != nil {
+		return target, nil, http.StatusInternalServerError, err
+	}
+	visible := entries[:0]
+	for _, entry := range entries {
+		if store.Access == nil || store.Access.Permitted(target.idx.Path, entry.Path, d.user.Username) {
+			entry.Path = target.scoped(entry.Path)
+			visible = append(visible, entry)
+		}
+	}
+	return target, visible, http.StatusOK, nil
+}
+
+// tagsSearchHandler finds items by tags.
+// @Summary Find items by tags
+// @Description Returns the items below a scope that have all of the given tags, sorted by path.
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param tags query string true "Comma separated tags the items must have"
+// @Param scope query string false "Path within the user scope to search below, defaults to the whole scope"
+// @Success 200 {array} tags.Entry "Matching items"
+// @Failure 400 {object} map[string]string "Invalid tags"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Router /api/tags/search [get]
+func tagsSearchHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	filter, err := tags.ParseTags(r.URL.Query().Get("tags"))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	if len(filter) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("at least one tag is required")
+	}
+	_, entries, status, err := visibleTagEntries(d, r.URL.Query().Get("source"), r.URL.Query().Get("scope"), filter)
+	if err != nil {
+		return status, err
+	}
+	return renderJSON(w, r, entries)
+}
+
+// tagsListHandler lists the tags in use.
+// @Summary List tags
+// @Description Returns the tags used on items the user can access in a source with the number of items, most used first.
+// @Tags Tags
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Success 200 {array} TagCount "Tags in use"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Router /api/tags/list [get]
+func tagsListHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	_, entries, status, err := visibleTagEntries(d, r.URL.Query().Get("source"), "/", nil)
+	if err != nil {
+		return status, err
+	}
+	counts := map[string]int{}
+	for _, entry := range entries {
+		for _, tag := range entry.Tags {
+			counts[tag]++
+		}
+	}
+	list := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		list = append(list, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Tag < list[j].Tag
+	})
+	return renderJSON(w, r, list)
+}
+
+// addResourceTags adds the tags of a resource and of the items in it to a
+// response. Items without all of the filter tags are left out.
+func addResourceTags(info *iteminfo.ExtendedFileInfo, sourcePath string, filter []string) error {
+	path := info.Path
+	if info.Type == "directory" {
+		path = strings.TrimSuffix(path, "/") + "/"
+	}
+	entry, err := store.Tags.Get(sourcePath, path)
+	if err == nil {
+		info.Tags = entry.Tags
+		info.CustomMetadata = entry.Metadata
+	} else if err != errors.ErrNotExist {
+		return err
+	}
+	if info.Type != "directory" {
+		return nil
+	}
+
+	children, err := store.Tags.Children(sourcePath, path)
+	if err != nil {
+		return err
+	}
+	info.ItemTags = map[string][]string{}
+	for name, child := range children {
+		info.ItemTags[name] = child.Tags
+	}
+	if len(filter) == 0 {
+		return nil
+	}
+	tagged := func(name string) bool {
+		child, ok := children[name]
+		return ok && child.HasTags(filter)
+	}
+	fileItems := info.Files[:0]
+	for _, item := range info.Files {
+		if tagged(item.Name) {
+			fileItems = append(fileItems, item)
+		}
+	}
+	info.Files = fileItems
+	folders := info.Folders[:0]
+	for _, item := range info.Folders {
+		if tagged(item.Name) {
+			folders = append(folders, item)
+		}
+	}
+	info.Folders = folders
+	return nil
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/files"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/common/utils"
+	"github.com/SlepoyShaman/FileStorage/indexing"
+)
+
+const (
+	defaultTimelineLimit = 200
+	maxTimelineLimit     = 1000
+)
+
+// parseTimelineDate parses a date of the timeline range, either a day like
+// 2024-05-17 or a RFC3339 time. Days given as the end of the range include
+// the whole day.
+func parseTimelineDate(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date: %v", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// timelineHandler lists images and videos by capture date.
+// @Summary Photo timeline
+// @Description Returns the images and videos below a scope, newest first and grouped by capture date. The capture date is read from the exif data, files without one use their modification time. Pages continue with the next cursor of the previous page.
+// @Tags Timeline
+// @Accept json
+// @Produce json
+// @Param source query string true "Source name for the desired source"
+// @Param scope query string false "Path within the user scope to list below, defaults to the whole scope"
+// @Param group query string false "Group by year, month or day (default day)"
+// @Param from query string false "Earliest capture date, as 2024-05-17 or RFC3339"
+// @Param to query string false "Latest capture date, as 2024-05-17 (inclusive) or RFC3339 (exclusive)"
+// @Param cursor query string false "Cursor of the next page, from the previous page"
+// @Param limit query int false "Maximum number of items per page (default 200, max 1000)"
+// @Success 200 {object} files.TimelinePage "Groups of images and videos"
+// @Failure 400 {object} map[string]string "Invalid parameters"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Source not found"
+// @Router /api/timeline [get]
+func timelineHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	source := r.URL.Query().Get("source")
+	limit := defaultTimelineLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return http.StatusBadRequest, fmt.Errorf("invalid limit: %v", value)
+		}
+		limit = min(limit, maxTimelineLimit)
+	}
+	groupBy := r.URL.Query().Get("group")
+	switch groupBy {
+	case "":
+		groupBy = files.TimelineDay
+	case files.TimelineYear, files.TimelineMonth, files.TimelineDay:
+	default:
+		return http.StatusBadRequest, fmt.Errorf("invalid group: %v", groupBy)
+	}
+	from, err := parseTimelineDate(r.URL.Query().Get("from"), false)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	to, err := parseTimelineDate(r.URL.Query().Get("to"), true)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	userscope, err := settings.GetScopeFromSourceName(d.user.Scopes, source)
+	if err != nil {
+		return http.StatusForbidden, err
+	}
+	idx := indexing.GetIndex(source)
+	if idx == nil {
+		return http.StatusNotFound, fmt.Errorf("source %s not found", source)
+	}
+	scopePath := utils.JoinPathAsUnix(userscope, r.URL.Query().Get("scope"))
+	userscope = strings.TrimRight(userscope, "/")
+	// the joined path is cleaned, so a scope with .. can point outside
+	if scopePath != userscope && !strings.HasPrefix(scopePath, userscope+"/") {
+		return http.StatusForbidden, fmt.Errorf("scope %v is outside of the user scope", r.URL.Query().Get("scope"))
+	}
+	scope := idx.MakeIndexPath(scopePath)
+
+	page, err := files.Timeline(idx, files.TimelineQuery{
+		Scope:   scope,
+		GroupBy: groupBy,
+		From:    from,
+		To:      to,
+		Cursor:  r.URL.Query().Get("cursor"),
+		Limit:   limit,
+		Allowed: func(path string) bool {
+			return store.Access == nil || store.Access.Permitted(idx.Path, path, d.user.Username)
+		},
+	})
+	if err == errors.ErrInvalidCursor {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for i := range page.Groups {
+		for j := range page.Groups[i].Items {
+			item := &page.Groups[i].Items[j]
+			item.Path = strings.TrimPrefix(item.Path, userscope)
+		}
+	}
+	return renderJSON(w, r, page)
+}
@@ -0,0 +1,31 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTimelineScope(t *testing.T) {
+	d, _ := setupResourceTest(t)
+	d.user.Scopes[0].Scope = "/alice"
+
+	for scope, want := range map[string]int{
+		"":               http.StatusOK,
+		"/photos":        http.StatusOK,
+		"photos/../2024": http.StatusOK,
+		"..":             http.StatusForbidden,
+		"../bob":         http.StatusForbidden,
+		"/../alice-old":  http.StatusForbidden,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/timeline?source=test&scope="+url.QueryEscape(scope), nil)
+		status, err := timelineHandler(httptest.NewRecorder(), r, d)
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status != want {
+			t.Errorf("scope %q: expected %d, got %d %v", scope, want, status, err)
+		}
+	}
+}
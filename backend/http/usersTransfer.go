@@ -0,0 +1,257 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/settings"
+	"github.com/SlepoyShaman/FileStorage/backend/common/utils"
+	"github.com/SlepoyShaman/FileStorage/backend/database/users"
+	"github.com/gtsteffaniak/go-logger/logger"
+)
+
+// maxImportSize limits the size of an uploaded import file.
+const maxImportSize = 10 << 20
+
+type UserImportResult struct {
+	Line     int    `json:"line"` // file line of a csv record, array position of a json record
+	Username string `json:"username"`
+	Action   string `json:"action"` // "create" or "update"
+	Error    string `json:"error,omitempty"`
+}
+
+type UserImportReport struct {
+	DryRun  bool                `json:"dryRun"`
+	Applied bool                `json:"applied"` // false if validation failed or dry run, nothing was changed
+	Created int                 `json:"created"`
+	Updated int                 `json:"updated"`
+	Failed  int                 `json:"failed"`
+	Results []*UserImportResult `json:"results"`
+}
+
+// usersImportHandler creates or updates users from a csv or json file.
+// @Summary Import users
+// @Description Create or update users with scopes, permissions, groups and login method. All records are validated first, nothing is changed if any record is invalid. Use dryRun to only get the validation report.
+// @Tags Users
+// @Accept json
+// @Accept text/csv
+// @Produce json
+// @Param format query string false "Import format: csv or json (default: json, or csv for text/csv content type)"
+// @Param dryRun query bool false "Only validate the records"
+// @Success 200 {object} UserImportReport "Import report"
+// @Failure 400 {object} map[string]string "Bad request - file could not be parsed"
+// @Router /api/users/import [post]
+func usersImportHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	format := r.URL.Query().Get("format")
+	if format == "" && strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		format = "csv"
+	}
+	body := io.LimitReader(r.Body, maxImportSize)
+	defer r.Body.Close()
+
+	var records []users.TransferRecord
+	var err error
+	switch format {
+	case "csv":
+		records, err = users.ParseTransferCSV(body)
+	case "", "json":
+		records, err = users.ParseTransferJSON(body)
+	default:
+		return http.StatusBadRequest, fmt.Errorf("unsupported import format: %v", format)
+	}
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	report := &UserImportReport{DryRun: dryRun, Results: []*UserImportResult{}}
+	seen := map[string]bool{}
+	existing := make([]*users.User, len(records))
+	for i := range records {
+		record := &records[i]
+		result := &UserImportResult{Line: record.Line, Username: record.Username, Action: "create"}
+		report.Results = append(report.Results, result)
+		if user, getErr := store.Users.Get(record.Username); getErr == nil {
+			existing[i] = user
+			result.Action = "update"
+		}
+		if err = validateImportRecord(record, existing[i]); err == nil && seen[record.Username] {
+			err = fmt.Errorf("duplicate username in import")
+		}
+		seen[record.Username] = true
+		if err != nil {
+			result.Error = err.Error()
+			report.Failed++
+		}
+	}
+	if dryRun || report.Failed > 0 {
+		return renderJSON(w, r, report)
+	}
+
+	report.Applied = true
+	for i, result := range report.Results {
+		err = applyImportRecord(&records[i], existing[i])
+		if err != nil {
+			// validation passed, so this is a storage error; earlier records stay applied
+			result.Error = err.Error()
+			report.Failed++
+			continue
+		}
+		if existing[i] == nil {
+			report.Created++
+		} else {
+			report.Updated++
+		}
+	}
+	logger.Infof("admin %v imported users: %d created, %d updated, %d failed", d.user.Username, report.Created, report.Updated, report.Failed)
+	return renderJSON(w, r, report)
+}
+
+func validateImportRecord(record *users.TransferRecord, existing *users.User) error {
+	if record.Username == "" {
+		return fmt.Errorf("username is required")
+	}
+	if record.Username == "anonymous" {
+		return fmt.Errorf("username cannot be 'anonymous'")
+	}
+	loginMethod := record.LoginMethod
+	if loginMethod == "" {
+		loginMethod = users.LoginMethodPassword
+		if existing != nil {
+			loginMethod = existing.LoginMethod
+		}
+	}
+	switch loginMethod {
+	case users.LoginMethodPassword, users.LoginMethodProxy, users.LoginMethodOidc:
+	default:
+		return fmt.Errorf("invalid login method: %v", record.LoginMethod)
+	}
+	if loginMethod == users.LoginMethodPassword {
+		if existing == nil && record.Password == "" {
+			return fmt.Errorf("password is required to create a password login user")
+		}
+		if record.Password != "" {
+			passwordAuth := config.Auth.Methods.PasswordAuth
+			err := users.CheckPasswordPolicy(record.Password, passwordAuth.MinLength, passwordAuth.Policy)
+			if err != nil {
+				return err
+			}
+		}
+	} else if record.Password != "" {
+		return fmt.Errorf("password can only be set for password login users")
+	}
+	if record.Scopes != nil {
+		if _, err := settings.ConvertToBackendScopes(record.Scopes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyImportRecord(record *users.TransferRecord, existing *users.User) error {
+	if existing == nil {
+		user := &users.User{}
+		settings.ApplyUserDefaults(user)
+		user.Username = record.Username
+		user.LoginMethod = users.LoginMethodPassword
+		if record.LoginMethod != "" {
+			user.LoginMethod = record.LoginMethod
+		}
+		if record.Scopes != nil {
+			user.Scopes = record.Scopes
+		}
+		if record.Permissions != nil {
+			user.Permissions = *record.Permissions
+		}
+		if record.LockPassword != nil {
+			user.LockPassword = *record.LockPassword
+		}
+		user.Password = record.Password
+		if user.LoginMethod != users.LoginMethodPassword {
+			// not used to log in, but users must always have a password hash
+			hash, err := users.HashPwd(utils.GenerateKey())
+			if err != nil {
+				return err
+			}
+			user.Password = hash
+		}
+		err := store.Users.Save(user, true, false)
+		if err != nil {
+			return err
+		}
+	} else {
+		user := existing
+		fields := []string{}
+		if record.LoginMethod != "" && record.LoginMethod != user.LoginMethod {
+			user.LoginMethod = record.LoginMethod
+			fields = append(fields, "LoginMethod")
+		}
+		if record.Scopes != nil {
+			user.Scopes = record.Scopes
+			fields = append(fields, "Scopes")
+		}
+		if record.Permissions != nil {
+			user.Permissions = *record.Permissions
+			fields = append(fields, "Permissions")
+		}
+		if record.LockPassword != nil {
+			user.LockPassword = *record.LockPassword
+			fields = append(fields, "LockPassword")
+		}
+		if record.Password != "" {
+			user.Password = record.Password
+			fields = append(fields, "Password")
+		}
+		if len(fields) > 0 {
+			err := store.Users.Update(user, true, fields...)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if record.Groups != nil {
+		return store.Access.SyncUserGroups(record.Username, record.Groups)
+	}
+	return nil
+}
+
+// usersExportHandler exports all users without secrets.
+// @Summary Export users
+// @Description Export all users with their scopes, permissions, groups and login method. Passwords, TOTP secrets and api keys are never included.
+// @Tags Users
+// @Produce json
+// @Produce text/csv
+// @Param format query string false "Export format: csv or json (default: json)"
+// @Success 200 {array} users.TransferRecord "Exported users"
+// @Failure 400 {object} map[string]string "Bad request - unsupported format"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api/users/export [get]
+func usersExportHandler(w http.ResponseWriter, r *http.Request, d *requestContext) (int, error) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		return http.StatusBadRequest, fmt.Errorf("unsupported export format: %v", format)
+	}
+	all, err := store.Users.Gets()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	records := make([]users.TransferRecord, 0, len(all))
+	for _, user := range all {
+		user.Scopes = settings.ConvertToFrontendScopes(user.Scopes)
+		records = append(records, users.NewTransferRecord(user, store.Access.GetUserGroups(user.Username)))
+	}
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="users.csv"`)
+		err = users.WriteTransferCSV(w, records)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		return 0, nil
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="users.json"`)
+	return renderJSON(w, r, records)
+}
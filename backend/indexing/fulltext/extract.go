@@ -0,0 +1,144 @@
+package fulltext
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+)
+
+// ErrUnsupported is returned by Extract for files without searchable text.
+var ErrUnsupported = errors.New("no text can be extracted from this file")
+
+// maxTextSize bounds the text indexed per file, so a huge spreadsheet or
+// log file can't blow up the index.
+const maxTextSize = 8 << 20
+
+// officeParts lists the archive members holding the text of office
+// documents by extension.
+var officeParts = map[string][]string{
+	".docx": {"word/document.xml"},
+	".xlsx": {"xl/sharedStrings.xml"},
+	".pptx": {"ppt/slides/slide*.xml"},
+	".odt":  {"content.xml"},
+	".ods":  {"content.xml"},
+	".odp":  {"content.xml"},
+}
+
+// breakElements end a line or cell in office xml, the text of other
+// elements is joined without spaces since runs can split words.
+var breakElements = map[string]bool{
+	"p": true, "h": true, "br": true, "tab": true, "si": true, "table-cell": true,
+}
+
+// Extractable reports whether Extract handles the file name.
+func Extractable(name string, documents bool) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	if iteminfo.IsText(ext) {
+		return true
+	}
+	if !documents {
+		return false
+	}
+	_, office := officeParts[ext]
+	return office || (ext == ".pdf" && pdfEnabled())
+}
+
+// Extract returns the searchable text of the file name with the given
+// size. Text files are indexed as they are, office documents and pdfs only
+// when documents is true.
+func Extract(name string, r io.ReaderAt, size int64, documents bool) (string, error) {
+	if !Extractable(name, documents) {
+		return "", ErrUnsupported
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	switch {
+	case iteminfo.IsText(ext):
+		return plainText(io.NewSectionReader(r, 0, size))
+	case ext == ".pdf":
+		return pdfText(r, size)
+	default:
+		return officeText(r, size, officeParts[ext])
+	}
+}
+
+func plainText(r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxTextSize))
+	if err != nil {
+		return "", err
+	}
+	// binary files sometimes carry a text extension
+	if bytes.IndexByte(data[:min(len(data), 8192)], 0) >= 0 {
+		return "", ErrUnsupported
+	}
+	if !utf8.Valid(data) {
+		return strings.ToValidUTF8(string(data), " "), nil
+	}
+	return string(data), nil
+}
+
+func officeText(r io.ReaderAt, size int64, patterns []string) (string, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return "", err
+	}
+	var members []*zip.File
+	for _, file := range archive.File {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, file.Name); ok {
+				members = append(members, file)
+			}
+		}
+	}
+	// slide10 sorts after slide9
+	sort.Slice(members, func(i, j int) bool {
+		a, b := members[i].Name, members[j].Name
+		return len(a) < len(b) || (len(a) == len(b) && a < b)
+	})
+
+	var text strings.Builder
+	for _, member := range members {
+		if err = xmlText(&text, member); err != nil {
+			return "", err
+		}
+		if text.Len() >= maxTextSize {
+			break
+		}
+	}
+	return text.String(), nil
+}
+
+func xmlText(text *strings.Builder, member *zip.File) error {
+	rc, err := member.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	decoder := xml.NewDecoder(io.LimitReader(rc, 8*maxTextSize))
+	for text.Len() < maxTextSize {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if breakElements[t.Name.Local] {
+				text.WriteByte('\n')
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+// Package fulltext keeps an inverted index of file contents in a SQLite
+// FTS5 table. Each source has its own database in the cache dir, documents
+// are keyed by their index path and replaced when their mod time changes.
+package fulltext
+
+import (
+	"database/sql"
+	"html"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure go sqlite driver with fts5
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS documents (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	path     TEXT NOT NULL UNIQUE,
+	mod_time INTEGER NOT NULL
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS contents USING fts5(
+	body,
+	tokenize = "unicode61 remove_diacritics 2 tokenchars '_'"
+);
+`
+
+// markers delimit matches in snippets, they can't appear in escaped html.
+const (
+	markStart = "\x02"
+	markEnd   = "\x03"
+)
+
+// Index is the full-text index of one source.
+type Index struct {
+	db *sql.DB
+}
+
+// Result is a file matching a query.
+type Result struct {
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"modified"`
+	Snippet string    `json:"snippet"` // html escaped text around the matches, which are wrapped in <mark>
+}
+
+// Open opens or creates the index stored at path.
+func Open(path string) (*Index, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Index{db: db}, nil
+}
+
+// Close closes the database.
+func (i *Index) Close() error {
+	return i.db.Close()
+}
+
+// Documents returns the mod times of all documents below prefix.
+func (i *Index) Documents(prefix string) (map[string]time.Time, error) {
+	rows, err := i.db.Query(`SELECT path, mod_time FROM documents WHERE substr(path, 1, length(?1)) = ?1`, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	docs := map[string]time.Time{}
+	for rows.Next() {
+		var path string
+		var modTime int64
+		if err = rows.Scan(&path, &modTime); err != nil {
+			return nil, err
+		}
+		docs[path] = time.Unix(0, modTime)
+	}
+	return docs, rows.Err()
+}
+
+// Update stores the text of the document at path, replacing a previous
+// version.
+func (i *Index) Update(path string, modTime time.Time, text string) error {
+	tx, err := i.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if err = remove(tx, path); err != nil {
+		return err
+	}
+	text = strings.NewReplacer(markStart, "", markEnd, "").Replace(text)
+	res, err := tx.Exec(`INSERT INTO documents (path, mod_time) VALUES (?, ?)`, path, modTime.UnixNano())
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`INSERT INTO contents (rowid, body) VALUES (?, ?)`, id, text); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Remove drops the documents at the given paths.
+func (i *Index) Remove(paths ...string) error {
+	tx, err := i.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	for _, path := range paths {
+		if err = remove(tx, path); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func remove(tx *sql.Tx, path string) error {
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM documents WHERE path = ?`, path).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM contents WHERE rowid = ?`, id); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM documents WHERE id = ?`, id)
+	return err
+}
+
+// Search returns up to limit documents below scope matching the query,
+// best matches first. Documents for which allowed returns false are left
+// out, so the access rules of the user apply to the results.
+func (i *Index) Search(query, scope string, limit int, allowed func(path string) bool) ([]Result, error) {
+	match, err := ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	results := []Result{}
+	// fetch in pages, results the user can't access don't count towards limit
+	pageSize := max(limit, 50)
+	for offset := 0; len(results) < limit; offset += pageSize {
+		page, err := i.search(match, scope, pageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range page {
+			if allowed == nil || allowed(result.Path) {
+				results = append(results, result)
+			}
+			if len(results) == limit {
+				break
+			}
+		}
+		if len(page) < pageSize {
+			break
+		}
+	}
+	return results, nil
+}
+
+func (i *Index) search(match, scope string, limit, offset int) ([]Result, error) {
+	rows, err := i.db.Query(`
+		SELECT d.path, d.mod_time, snippet(contents, 0, ?, ?, '…', 24)
+		FROM contents JOIN documents d ON d.id = contents.rowid
+		WHERE contents MATCH ? AND substr(d.path, 1, length(?4)) = ?4
+		ORDER BY rank LIMIT ? OFFSET ?`,
+		markStart, markEnd, match, scope, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []Result
+	for rows.Next() {
+		var result Result
+		var modTime int64
+		if err = rows.Scan(&result.Path, &modTime, &result.Snippet); err != nil {
+			return nil, err
+		}
+		result.ModTime = time.Unix(0, modTime)
+		result.Snippet = highlight(result.Snippet)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// highlight escapes a snippet and turns the match markers into <mark> tags.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(snippet)
+}
@@ -0,0 +1,164 @@
+package fulltext
+
+import (
+	"archive/zip"
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestIndex(t *testing.T) *Index {
+	t.Helper()
+	idx, err := Open(filepath.Join(t.TempDir(), "fulltext.db"))
+	if err != nil {
+		t.Fatalf("failed to open index: %v", err)
+	}
+	t.Cleanup(func() { idx.Close() })
+	return idx
+}
+
+func paths(results []Result) string {
+	list := make([]string, len(results))
+	for i, result := range results {
+		list[i] = result.Path
+	}
+	return strings.Join(list, ",")
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := map[string]string{
+		`quick fox`:            `"quick" AND "fox"`,
+		`"quick brown" fox`:    `"quick brown" AND "fox"`,
+		`brow*`:                `"brow"*`,
+		`"quick bro"*`:         `"quick bro"*`,
+		`NOT OR (x) "unclosed`: `"NOT" AND "OR" AND "(x)" AND "unclosed"`,
+		`a"b`:                  `"a b"`,
+		`  spaced   out  `:     `"spaced" AND "out"`,
+		`"" * "  "`:            ``,
+		`naïve café`:           `"naïve" AND "café"`,
+		`config_value snake_*`: `"config_value" AND "snake_"*`,
+	}
+	for query, want := range tests {
+		got, err := ParseQuery(query)
+		if want == "" {
+			if err != ErrEmptyQuery {
+				t.Errorf("ParseQuery(%q) expected ErrEmptyQuery, got %q (%v)", query, got, err)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("ParseQuery(%q) = %q (%v), want %q", query, got, err, want)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	idx := newTestIndex(t)
+	now := time.Now()
+	docs := map[string]string{
+		"/docs/fox.txt":        "The quick brown fox jumps over the lazy dog",
+		"/docs/brown.md":       "Brownian motion is not about foxes",
+		"/code/main.go":        "func handleRequest() { return <nil> }",
+		"/private/secrets.txt": "the quick brown fox knows the password",
+	}
+	for path, text := range docs {
+		if err := idx.Update(path, now, text); err != nil {
+			t.Fatalf("failed to index %v: %v", path, err)
+		}
+	}
+
+	search := func(query, scope string, allowed func(string) bool) []Result {
+		t.Helper()
+		results, err := idx.Search(query, scope, 10, allowed)
+		if err != nil {
+			t.Fatalf("search %q failed: %v", query, err)
+		}
+		return results
+	}
+	noPrivate := func(path string) bool { return !strings.HasPrefix(path, "/private/") }
+
+	if got := paths(search(`"quick brown"`, "/", noPrivate)); got != "/docs/fox.txt" {
+		t.Errorf("phrase search returned %v", got)
+	}
+	if got := paths(search(`"brown quick"`, "/", nil)); got != "" {
+		t.Errorf("phrase in wrong order returned %v", got)
+	}
+	if got := paths(search(`brown*`, "/docs/", nil)); got != "/docs/brown.md,/docs/fox.txt" && got != "/docs/fox.txt,/docs/brown.md" {
+		t.Errorf("prefix search returned %v", got)
+	}
+	if got := paths(search(`fox`, "/private/", noPrivate)); got != "" {
+		t.Errorf("expected denied paths to be filtered, got %v", got)
+	}
+	if got := paths(search(`fox`, "/private/", nil)); got != "/private/secrets.txt" {
+		t.Errorf("scoped search returned %v", got)
+	}
+
+	results := search(`lazy`, "/", nil)
+	if len(results) != 1 || !strings.Contains(results[0].Snippet, "the <mark>lazy</mark> dog") {
+		t.Errorf("unexpected snippet %+v", results)
+	}
+	results = search(`handleRequest`, "/", nil)
+	if len(results) != 1 || strings.Contains(results[0].Snippet, "<nil>") || !strings.Contains(results[0].Snippet, "&lt;nil&gt;") {
+		t.Errorf("expected escaped snippet, got %+v", results)
+	}
+
+	// updates replace the previous text, removed documents are gone
+	if err := idx.Update("/docs/fox.txt", now.Add(time.Minute), "a slow red cat"); err != nil {
+		t.Fatal(err)
+	}
+	if got := paths(search(`lazy`, "/", nil)); got != "" {
+		t.Errorf("expected old text to be replaced, got %v", got)
+	}
+	if err := idx.Remove("/docs/brown.md"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := idx.Documents("/docs/")
+	if err != nil || len(stored) != 1 || !stored["/docs/fox.txt"].Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected documents %v (%v)", stored, err)
+	}
+}
+
+func TestSearchLimit(t *testing.T) {
+	idx := newTestIndex(t)
+	for i := 0; i < 120; i++ {
+		path := "/denied/" + strings.Repeat("x", i+1)
+		if i%2 == 0 {
+			path = "/allowed/" + strings.Repeat("x", i+1)
+		}
+		if err := idx.Update(path, time.Now(), "common word"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	allowed := func(path string) bool { return strings.HasPrefix(path, "/allowed/") }
+	results, err := idx.Search("common", "/", 55, allowed)
+	if err != nil || len(results) != 55 {
+		t.Errorf("expected 55 allowed results across pages, got %d (%v)", len(results), err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	text, err := Extract("notes.txt", strings.NewReader("plain text"), 10, false)
+	if err != nil || text != "plain text" {
+		t.Errorf("unexpected text %q (%v)", text, err)
+	}
+	if _, err = Extract("blob.txt", strings.NewReader("bin\x00ary"), 7, false); err != ErrUnsupported {
+		t.Errorf("expected binary file to be skipped, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, _ := archive.Create("word/document.xml")
+	w.Write([]byte(`<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>Quar</w:t></w:r><w:r><w:t>terly</w:t></w:r></w:p><w:p><w:r><w:t>report</w:t></w:r></w:p></w:body></w:document>`)) //nolint:errcheck
+	archive.Close()
+	docx := bytes.NewReader(buf.Bytes())
+
+	if _, err = Extract("report.docx", docx, docx.Size(), false); err != ErrUnsupported {
+		t.Errorf("expected documents to be skipped unless enabled, got %v", err)
+	}
+	text, err = Extract("report.docx", docx, docx.Size(), true)
+	if err != nil || text != "Quarterly\nreport\n" {
+		t.Errorf("unexpected docx text %q (%v)", text, err)
+	}
+}
@@ -0,0 +1,32 @@
+//go:build mupdf
+
+package fulltext
+
+import (
+	"io"
+	"strings"
+
+	"github.com/gen2brain/go-fitz"
+)
+
+func pdfEnabled() bool {
+	return true
+}
+
+func pdfText(r io.ReaderAt, size int64) (string, error) {
+	doc, err := fitz.NewFromReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return "", err
+	}
+	defer doc.Close()
+	var text strings.Builder
+	for page := 0; page < doc.NumPage() && text.Len() < maxTextSize; page++ {
+		pageText, err := doc.Text(page)
+		if err != nil {
+			return "", err
+		}
+		text.WriteString(pageText)
+		text.WriteByte('\n')
+	}
+	return text.String(), nil
+}
@@ -0,0 +1,13 @@
+//go:build !mupdf
+
+package fulltext
+
+import "io"
+
+func pdfEnabled() bool {
+	return false
+}
+
+func pdfText(r io.ReaderAt, size int64) (string, error) {
+	return "", ErrUnsupported
+}
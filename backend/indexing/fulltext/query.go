@@ -0,0 +1,58 @@
+package fulltext
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrEmptyQuery is returned for queries without any terms.
+var ErrEmptyQuery = errors.New("query has no search terms")
+
+// ParseQuery turns a user query into an fts5 match expression. Words and
+// "quoted phrases" must all match, a trailing * matches words by prefix.
+// Everything else is quoted, so the fts5 query syntax can't be injected.
+func ParseQuery(query string) (string, error) {
+	var terms []string
+	for rest := strings.TrimSpace(query); rest != ""; rest = strings.TrimSpace(rest) {
+		var term string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				// an unterminated phrase runs to the end of the query
+				term, rest = rest[1:], ""
+			} else {
+				term, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(rest, isSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			term, rest = rest[:end], rest[end:]
+		}
+		prefix := false
+		if strings.HasPrefix(rest, "*") {
+			prefix, rest = true, rest[1:]
+		}
+		if strings.HasSuffix(term, "*") {
+			prefix, term = true, strings.TrimRight(term, "*")
+		}
+		term = strings.Join(strings.Fields(strings.ReplaceAll(term, `"`, " ")), " ")
+		if term == "" {
+			continue
+		}
+		term = `"` + term + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 0 {
+		return "", ErrEmptyQuery
+	}
+	return strings.Join(terms, " AND "), nil
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
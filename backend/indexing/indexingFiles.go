@@ -4,15 +4,18 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
 	"github.com/SlepoyShaman/FileStorage/common/errors"
 	"github.com/SlepoyShaman/FileStorage/common/settings"
 	"github.com/SlepoyShaman/FileStorage/common/utils"
+	"github.com/SlepoyShaman/FileStorage/indexing/fulltext"
 	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
 	"github.com/gtsteffaniak/go-cache/cache"
 )
@@ -62,6 +65,7 @@ type ReducedIndex struct {
 type Index struct {
 	ReducedIndex
 	settings.Source `json:"-"`
+	FS              sources.FS `json:"-"` // storage the source is read from
 
 	// Shared state (protected by mu)
 	Directories       map[string]*iteminfo.FileInfo `json:"-"`
@@ -71,13 +75,16 @@ type Index struct {
 	totalSize         uint64                        `json:"-"`
 
 	// Scanner management (new multi-scanner system)
-	scanners             map[string]*Scanner `json:"-"` // path -> scanner
-	scanMutex            sync.Mutex          `json:"-"` // Global scan mutex - only one scanner runs at a time
-	activeScannerPath    string              `json:"-"` // Which scanner is currently running (for logging/status)
-	runningScannerCount  int                 `json:"-"` // Tracks active scanners
-	lastRootScanTime     time.Time           `json:"-"` // Last time root scanner completed - child scanners wait for this
-	initialScanStartTime time.Time           `json:"-"` // When initial multi-scanner indexing started
-	hasLoggedInitialScan bool                `json:"-"` // Whether we've logged the first complete round
+	scanners             map[string]*Scanner     `json:"-"` // path -> scanner
+	scanMutex            sync.Mutex              `json:"-"` // Global scan mutex - only one scanner runs at a time
+	activeScannerPath    string                  `json:"-"` // Which scanner is currently running (for logging/status)
+	runningScannerCount  int                     `json:"-"` // Tracks active scanners
+	lastRootScanTime     time.Time               `json:"-"` // Last time root scanner completed - child scanners wait for this
+	initialScanStartTime time.Time               `json:"-"` // When initial multi-scanner indexing started
+	hasLoggedInitialScan bool                    `json:"-"` // Whether we've logged the first complete round
+	restoredScanners     map[string]*ScannerInfo `json:"-"` // scanner stats loaded from the index snapshot, taken over by the scanners on start
+	watcher              *watcher                `json:"-"` // applies filesystem changes as they happen, nil if the source is not watched
+	fullText             *fulltext.Index         `json:"-"` // contents of the files for full-text search, nil if not enabled
 
 	// Control
 	mock       bool
@@ -110,10 +117,16 @@ func init() {
 }
 
 func Initialize(source *settings.Source, mock bool) {
+	fsys, err := sources.For(source)
+	if err != nil {
+		slog.Error("source is not available: " + err.Error())
+		return
+	}
 	indexesMutex.Lock()
 	newIndex := Index{
 		mock:              mock,
 		Source:            *source,
+		FS:                fsys,
 		Directories:       make(map[string]*iteminfo.FileInfo),
 		DirectoriesLedger: make(map[string]struct{}),
 		processedInodes:   make(map[uint64]struct{}),
@@ -128,6 +141,17 @@ func Initialize(source *settings.Source, mock bool) {
 	indexesMutex.Unlock()
 	if !newIndex.Config.DisableIndexing {
 		slog.Info("initializing index: [%v]", newIndex.Name)
+		if interval := snapshotInterval(); interval > 0 {
+			// a snapshot makes the index ready now, scanners reconcile it in the background
+			newIndex.loadSnapshot()
+			go newIndex.snapshotLoop(interval)
+		}
+		if newIndex.Config.FullText.Enabled {
+			newIndex.openFullText()
+		}
+		if newIndex.Config.Watch {
+			newIndex.startWatcher()
+		}
 		// Start multi-scanner system (each scanner will do its own initial scan)
 		go newIndex.setupIndexingScanners()
 	} else {
@@ -146,18 +170,11 @@ func (idx *Index) indexDirectory(adjustedPath string, config actionConfig) error
 	// Normalize path to always have trailing slash
 	adjustedPath = utils.AddTrailingSlashIfNotExists(adjustedPath)
 	realPath := strings.TrimRight(idx.Path, "/") + adjustedPath
-	// Open the directory
-	dir, err := os.Open(realPath)
+	dirInfo, err := idx.FS.Stat(adjustedPath)
 	if err != nil {
 		// must have been deleted
 		return err
 	}
-	defer dir.Close()
-
-	dirInfo, err := dir.Stat()
-	if err != nil {
-		return err
-	}
 
 	// check if excluded from indexing
 	hidden := isHidden(dirInfo, idx.Path+adjustedPath)
@@ -205,7 +222,7 @@ func (idx *Index) indexDirectory(adjustedPath string, config actionConfig) error
 			return nil
 		}
 	}
-	dirFileInfo, err2 := idx.GetDirInfo(dir, dirInfo, realPath, adjustedPath, combinedPath, config)
+	dirFileInfo, err2 := idx.GetDirInfo(dirInfo, realPath, adjustedPath, combinedPath, config)
 	if err2 != nil {
 		return err2
 	}
@@ -221,13 +238,7 @@ func (idx *Index) GetFsDirInfo(adjustedPath string) (*iteminfo.FileInfo, error)
 	}
 	originalPath := realPath
 
-	dir, err := os.Open(realPath)
-	if err != nil {
-		return nil, err
-	}
-	defer dir.Close()
-
-	dirInfo, err := dir.Stat()
+	dirInfo, err := idx.FS.Stat(adjustedPath)
 	if err != nil {
 		return nil, err
 	}
@@ -258,7 +269,7 @@ func (idx *Index) GetFsDirInfo(adjustedPath string) (*iteminfo.FileInfo, error)
 	// adjustedPath is already normalized with trailing slash
 	combinedPath := adjustedPath
 	var response *iteminfo.FileInfo
-	response, err = idx.GetDirInfo(dir, dirInfo, realPath, adjustedPath, combinedPath, actionConfig{
+	response, err = idx.GetDirInfo(dirInfo, realPath, adjustedPath, combinedPath, actionConfig{
 		Quick:         false,
 		Recursive:     false,
 		CheckViewable: true,
@@ -291,11 +302,11 @@ func (idx *Index) GetFsDirInfo(adjustedPath string) (*iteminfo.FileInfo, error)
 
 }
 
-func (idx *Index) GetDirInfo(dirInfo *os.File, stat os.FileInfo, realPath, adjustedPath, combinedPath string, config actionConfig) (*iteminfo.FileInfo, error) {
+func (idx *Index) GetDirInfo(stat os.FileInfo, realPath, adjustedPath, combinedPath string, config actionConfig) (*iteminfo.FileInfo, error) {
 	// Ensure combinedPath has exactly one trailing slash to prevent double slashes in subdirectory paths
 	combinedPath = strings.TrimRight(combinedPath, "/") + "/"
 	// Read directory contents
-	files, err := dirInfo.Readdir(-1)
+	files, err := idx.FS.ReadDir(adjustedPath)
 	if err != nil {
 		return nil, err
 	}
@@ -442,7 +453,7 @@ func (idx *Index) GetDirInfo(dirInfo *os.File, stat os.FileInfo, realPath, adjus
 		Folders: dirInfos,
 	}
 	dirFileInfo.ItemInfo = iteminfo.ItemInfo{
-		Name:       filepath.Base(dirInfo.Name()),
+		Name:       filepath.Base(stat.Name()),
 		Type:       "directory",
 		Size:       totalSize,
 		ModTime:    stat.ModTime(),
@@ -476,6 +487,16 @@ func (idx *Index) RecursiveUpdateDirSizes(childInfo *iteminfo.FileInfo, previous
 }
 
 func (idx *Index) GetRealPath(relativePath ...string) (string, bool, error) {
+	if !idx.FS.IsLocal() {
+		// remote sources have no symlinks, the real path only identifies the item
+		name := path.Join(append([]string{"/"}, relativePath...)...)
+		realPath := strings.TrimRight(idx.Path, "/") + name
+		info, err := idx.FS.Stat(name)
+		if err != nil {
+			return realPath, false, err
+		}
+		return realPath, info.IsDir(), nil
+	}
 	combined := append([]string{idx.Path}, relativePath...)
 	joinedPath := filepath.Join(combined...)
 	isDir, _ := IsDirCache.Get(joinedPath + ":isdir")
@@ -0,0 +1,200 @@
+package indexing
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/common/errors"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/indexing/fulltext"
+	"github.com/gtsteffaniak/go-logger/logger"
+)
+
+// The full-text index follows the file index: files listed in the indexed
+// directories are extracted when their mod time changes and dropped when
+// they disappear. RefreshIndex updates it right away, a periodic sync picks
+// up what the scanners found.
+
+const (
+	fullTextSyncInterval   = 5 * time.Minute
+	defaultFullTextMaxSize = 10
+)
+
+// fullTextDoc is a file that belongs in the full-text index.
+type fullTextDoc struct {
+	modTime time.Time
+	size    int64
+}
+
+// openFullText opens the full-text index of the source and keeps it in
+// sync with the file index.
+func (idx *Index) openFullText() {
+	if settings.Config.Server.CacheDir == "" {
+		logger.Warningf("full-text search of [%v] requires a cache dir", idx.Name)
+		return
+	}
+	path := filepath.Join(settings.Config.Server.CacheDir, "fulltext", sourceHash(idx.Path)+".db")
+	if err := os.MkdirAll(filepath.Dir(path), fileutils.PermDir); err != nil {
+		logger.Errorf("could not create full-text index of [%v]: %v", idx.Name, err)
+		return
+	}
+	ft, err := fulltext.Open(path)
+	if err != nil {
+		logger.Errorf("could not open full-text index of [%v]: %v", idx.Name, err)
+		return
+	}
+	idx.mu.Lock()
+	idx.fullText = ft
+	idx.mu.Unlock()
+	go idx.fullTextLoop()
+}
+
+// fullTextLoop syncs the whole full-text index once the source was indexed
+// and then every fullTextSyncInterval.
+func (idx *Index) fullTextLoop() {
+	ticker := time.NewTicker(fullTextSyncInterval)
+	defer ticker.Stop()
+	for {
+		idx.mu.RLock()
+		indexed := idx.wasIndexed
+		idx.mu.RUnlock()
+		if indexed {
+			startTime := time.Now()
+			if err := idx.syncFullText("/", true); err != nil {
+				logger.Errorf("could not update full-text index of [%v]: %v", idx.Name, err)
+			} else {
+				logger.Debugf("synced full-text index of [%v] in %v", idx.Name, time.Since(startTime))
+			}
+			<-ticker.C
+			continue
+		}
+		// wait for the initial indexing to finish
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// UpdateFullText brings the full-text index of path in line with the file
+// index, it is called after the file index was refreshed for path.
+func (idx *Index) UpdateFullText(path string, isDir, recursive bool) {
+	idx.mu.RLock()
+	enabled := idx.fullText != nil
+	idx.mu.RUnlock()
+	if !enabled {
+		return
+	}
+	var err error
+	if isDir {
+		err = idx.syncFullText(path, recursive)
+	} else {
+		err = idx.syncFullTextFile(path)
+	}
+	if err != nil {
+		logger.Errorf("could not update full-text index of [%v] %v: %v", idx.Name, path, err)
+	}
+}
+
+// SearchContent searches the contents of the files below scope. Files for
+// which allowed returns false are left out of the results.
+func (idx *Index) SearchContent(query, scope string, limit int, allowed func(path string) bool) ([]fulltext.Result, error) {
+	idx.mu.RLock()
+	ft := idx.fullText
+	idx.mu.RUnlock()
+	if ft == nil {
+		return nil, errors.ErrFullTextDisabled
+	}
+	return ft.Search(query, scope, limit, allowed)
+}
+
+// fullTextDocs returns the files of the indexed directories that belong in
+// the full-text index, below dir or only in dir if not recursive.
+func (idx *Index) fullTextDocs(dir string, recursive bool) map[string]fullTextDoc {
+	config := idx.Config.FullText
+	maxSize := int64(config.MaxFileSizeMB)
+	if maxSize <= 0 {
+		maxSize = defaultFullTextMaxSize
+	}
+	maxSize <<= 20
+
+	docs := map[string]fullTextDoc{}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	for path, info := range idx.Directories {
+		if path != dir && (!recursive || !strings.HasPrefix(path, dir)) {
+			continue
+		}
+		for _, file := range info.Files {
+			if file.Size > maxSize || !fulltext.Extractable(file.Name, config.Documents) {
+				continue
+			}
+			docs[path+file.Name] = fullTextDoc{modTime: file.ModTime, size: file.Size}
+		}
+	}
+	return docs
+}
+
+// syncFullText extracts the changed files below dir and drops the ones that
+// are no longer indexed.
+func (idx *Index) syncFullText(dir string, recursive bool) error {
+	dir = idx.MakeIndexPath(dir)
+	docs := idx.fullTextDocs(dir, recursive)
+	stored, err := idx.fullText.Documents(dir)
+	if err != nil {
+		return err
+	}
+	var removed []string
+	for path := range stored {
+		if _, ok := docs[path]; ok {
+			continue
+		}
+		if recursive || parentDir(path) == dir {
+			removed = append(removed, path)
+		}
+	}
+	if err = idx.fullText.Remove(removed...); err != nil {
+		return err
+	}
+	for path, doc := range docs {
+		if modTime, ok := stored[path]; ok && modTime.Equal(doc.modTime) {
+			continue
+		}
+		if err = idx.extractFullText(path, doc); err != nil {
+			logger.Debugf("could not extract text of [%v] %v: %v", idx.Name, path, err)
+		}
+	}
+	return nil
+}
+
+// syncFullTextFile updates the full-text index of a single file.
+func (idx *Index) syncFullTextFile(path string) error {
+	path = "/" + strings.Trim(path, "/")
+	doc, ok := idx.fullTextDocs(parentDir(path), false)[path]
+	if !ok {
+		return idx.fullText.Remove(path)
+	}
+	return idx.extractFullText(path, doc)
+}
+
+func (idx *Index) extractFullText(path string, doc fullTextDoc) error {
+	file, err := idx.FS.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	text, err := fulltext.Extract(path, file, doc.size, idx.Config.FullText.Documents)
+	if err == fulltext.ErrUnsupported {
+		// keep the mod time, so the file isn't read again until it changes
+		text, err = "", nil
+	}
+	if err != nil {
+		return err
+	}
+	return idx.fullText.Update(path, doc.modTime, text)
+}
+
+// parentDir returns the index path of the directory containing the file.
+func parentDir(path string) string {
+	return path[:strings.LastIndex(path, "/")+1]
+}
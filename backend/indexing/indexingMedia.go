@@ -0,0 +1,61 @@
+package indexing
+
+import (
+	"strings"
+	"time"
+)
+
+// MediaFile is an image, video or audio file of the index.
+type MediaFile struct {
+	Path    string // index path of the file
+	Name    string
+	Type    string
+	Size    int64
+	ModTime time.Time
+}
+
+// IsMediaType reports whether a mimetype is an image or a video.
+func IsMediaType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "image/") || strings.HasPrefix(mimeType, "video/")
+}
+
+// IsAudioType reports whether a mimetype is an audio file.
+func IsAudioType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "audio/")
+}
+
+// MediaFiles returns the images and videos below scope, hidden files are
+// left out.
+func (idx *Index) MediaFiles(scope string) []MediaFile {
+	return idx.filesOfType(scope, IsMediaType)
+}
+
+// AudioFiles returns the audio files below scope, hidden files are left out.
+func (idx *Index) AudioFiles(scope string) []MediaFile {
+	return idx.filesOfType(scope, IsAudioType)
+}
+
+func (idx *Index) filesOfType(scope string, match func(mimeType string) bool) []MediaFile {
+	scope = idx.MakeIndexPath(scope)
+	var media []MediaFile
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	for path, info := range idx.Directories {
+		if !strings.HasPrefix(path, scope) {
+			continue
+		}
+		for _, file := range info.Files {
+			if file.Hidden || !match(file.Type) {
+				continue
+			}
+			media = append(media, MediaFile{
+				Path:    path + file.Name,
+				Name:    file.Name,
+				Type:    file.Type,
+				Size:    file.Size,
+				ModTime: file.ModTime,
+			})
+		}
+	}
+	return media
+}
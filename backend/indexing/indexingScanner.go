@@ -1,8 +1,6 @@
 package indexing
 
 import (
-	"os"
-	"strings"
 	"time"
 
 	"github.com/gtsteffaniak/go-logger/logger"
@@ -28,6 +26,9 @@ type Scanner struct {
 	numDirs       uint64 // Local count for this path
 	numFiles      uint64 // Local count for this path
 
+	// Stats of the last completed scan for readers of the index (protected by idx.mu)
+	published *ScannerInfo
+
 	// Reference back to parent index
 	idx *Index
 
@@ -99,8 +100,10 @@ func (s *Scanner) start() {
 	if s.scanPath != "/" {
 		time.Sleep(500 * time.Millisecond)
 	}
+	s.restore()
 	s.tryAcquireAndScan()
 
+	fallback := s.idx.watchFallback()
 	for {
 		// Check if directory still exists (for non-root scanners)
 		if s.scanPath != "/" && !s.directoryExists() {
@@ -117,6 +120,12 @@ func (s *Scanner) start() {
 			logger.Debugf("Scanner [%s] received stop signal", s.scanPath)
 			return
 
+		case <-fallback:
+			// the watcher stopped, a full scan picks up the changes it missed
+			fallback = nil
+			s.fullScanCounter = 0
+			s.tryAcquireAndScan()
+
 		case <-time.After(sleepTime):
 			// Time to scan! But must acquire mutex first
 			s.tryAcquireAndScan()
@@ -166,9 +175,10 @@ func (s *Scanner) tryAcquireAndScan() {
 		s.idx.mu.Unlock()
 	}
 
-	// Clear active scanner
+	// Clear active scanner and publish the stats of this scan
 	s.idx.mu.Lock()
 	s.idx.activeScannerPath = ""
+	s.published = s.info()
 	s.idx.mu.Unlock()
 
 	s.idx.scanMutex.Unlock()
@@ -306,16 +316,7 @@ func (s *Scanner) checkForNewChildDirectories() {
 // getTopLevelDirs returns a list of top-level directory paths in the root
 func (s *Scanner) getTopLevelDirs() []string {
 	dirs := []string{}
-	realPath := strings.TrimRight(s.idx.Path, "/") + "/"
-
-	dir, err := os.Open(realPath)
-	if err != nil {
-		logger.Errorf("Failed to open root directory: %v", err)
-		return dirs
-	}
-	defer dir.Close()
-
-	files, err := dir.Readdir(-1)
+	files, err := s.idx.FS.ReadDir("/")
 	if err != nil {
 		logger.Errorf("Failed to read root directory: %v", err)
 		return dirs
@@ -363,6 +364,11 @@ func (s *Scanner) calculateSleepTime() time.Duration {
 	// Get base schedule time and apply complexity modifier
 	sleepTime := scanSchedule[s.currentSchedule] + s.smartModifier
 
+	// A watched source only needs scans to catch up on missed changes
+	if s.idx.watched() {
+		sleepTime = scanSchedule[len(scanSchedule)-1] + s.smartModifier
+	}
+
 	// Allow manual override via config
 	if s.idx.Config.IndexingInterval > 0 {
 		sleepTime = time.Duration(s.idx.Config.IndexingInterval) * time.Minute
@@ -426,12 +432,52 @@ func (s *Scanner) updateComplexity() {
 	}
 }
 
+// restore takes over the schedule and stats saved in the index snapshot.
+// The first scan of a restored scanner is a quick scan, which only reads
+// directories that changed since the snapshot.
+func (s *Scanner) restore() {
+	s.idx.mu.Lock()
+	info, ok := s.idx.restoredScanners[s.scanPath]
+	delete(s.idx.restoredScanners, s.scanPath)
+	if ok {
+		s.published = info
+	}
+	s.idx.mu.Unlock()
+	if !ok {
+		return
+	}
+	s.currentSchedule = info.CurrentSchedule
+	s.complexity = info.Complexity
+	s.quickScanTime = info.QuickScanTime
+	s.fullScanTime = info.FullScanTime
+	s.numDirs = info.NumDirs
+	s.numFiles = info.NumFiles
+	s.fullScanCounter = 1
+	if modifier, ok := complexityModifier[s.complexity]; ok {
+		s.smartModifier = modifier
+	}
+	logger.Debugf("Scanner [%s] restored from index snapshot", s.scanPath)
+}
+
+// info returns the stats of the scanner. Only the scanner itself may call
+// it, others read the published stats.
+func (s *Scanner) info() *ScannerInfo {
+	return &ScannerInfo{
+		Path:            s.scanPath,
+		IsRoot:          s.scanPath == "/",
+		LastScanned:     s.lastScanned,
+		Complexity:      s.complexity,
+		CurrentSchedule: s.currentSchedule,
+		QuickScanTime:   s.quickScanTime,
+		FullScanTime:    s.fullScanTime,
+		NumDirs:         s.numDirs,
+		NumFiles:        s.numFiles,
+	}
+}
+
 // directoryExists checks if the scanner's directory still exists
 func (s *Scanner) directoryExists() bool {
-	realPath := strings.TrimRight(s.idx.Path, "/") + s.scanPath
-	realPath = strings.TrimSuffix(realPath, "/")
-
-	_, err := os.Stat(realPath)
+	_, err := s.idx.FS.Stat(s.scanPath)
 	return err == nil
 }
 
@@ -0,0 +1,227 @@
+package indexing
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/fileutils"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+	"github.com/gtsteffaniak/go-logger/logger"
+)
+
+// Snapshots of an index are written to the cache dir periodically and at
+// shutdown. A snapshot found at startup makes the index ready right away,
+// the scanners then reconcile it with the filesystem using quick scans.
+
+const (
+	snapshotVersion         = 1
+	defaultSnapshotInterval = 15 * time.Minute
+)
+
+// indexSnapshot is the persisted state of an index.
+type indexSnapshot struct {
+	Version         int
+	SourcePath      string
+	SavedAt         time.Time
+	Stats           ReducedIndex
+	Directories     map[string]*iteminfo.FileInfo
+	FoundHardLinks  map[string]uint64
+	ProcessedInodes []uint64
+	TotalSize       uint64
+}
+
+// snapshotInterval returns the time between snapshots, zero if snapshots
+// are disabled.
+func snapshotInterval() time.Duration {
+	minutes := settings.Config.Server.IndexSnapshotMinutes
+	if minutes < 0 || settings.Config.Server.CacheDir == "" {
+		return 0
+	}
+	if minutes == 0 {
+		return defaultSnapshotInterval
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// sourceHash names the files a source keeps in the cache dir.
+func sourceHash(sourcePath string) string {
+	sum := sha256.Sum256([]byte(sourcePath))
+	return hex.EncodeToString(sum[:8])
+}
+
+// snapshotPath returns the snapshot file of the source at sourcePath.
+func snapshotPath(sourcePath string) string {
+	return filepath.Join(settings.Config.Server.CacheDir, "index", sourceHash(sourcePath)+".gob")
+}
+
+// SaveSnapshot writes the index to its snapshot file. The file is replaced
+// atomically, so a crash while saving keeps the previous snapshot.
+func (idx *Index) SaveSnapshot() error {
+	path := snapshotPath(idx.Path)
+	if err := os.MkdirAll(filepath.Dir(path), fileutils.PermDir); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	// copy the state under the lock and encode it without holding it, so
+	// scans and file operations are not blocked while the file is written
+	idx.mu.RLock()
+	snapshot := indexSnapshot{
+		Version:         snapshotVersion,
+		SourcePath:      idx.Path,
+		SavedAt:         time.Now(),
+		Stats:           idx.ReducedIndex,
+		Directories:     make(map[string]*iteminfo.FileInfo, len(idx.Directories)),
+		FoundHardLinks:  maps.Clone(idx.FoundHardLinks),
+		ProcessedInodes: make([]uint64, 0, len(idx.processedInodes)),
+		TotalSize:       idx.totalSize,
+	}
+	for path, info := range idx.Directories {
+		// directory sizes are updated in place
+		dir := *info
+		snapshot.Directories[path] = &dir
+	}
+	for inode := range idx.processedInodes {
+		snapshot.ProcessedInodes = append(snapshot.ProcessedInodes, inode)
+	}
+	snapshot.Stats.Scanners = idx.scannerInfos()
+	idx.mu.RUnlock()
+
+	writer := bufio.NewWriter(tmp)
+	err = gob.NewEncoder(writer).Encode(&snapshot)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write index snapshot: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// scannerInfos returns the stats the scanners published after their last
+// scan, idx.mu must be held.
+func (idx *Index) scannerInfos() []*ScannerInfo {
+	infos := make([]*ScannerInfo, 0, len(idx.scanners))
+	for _, s := range idx.scanners {
+		if s.published != nil {
+			info := *s.published
+			infos = append(infos, &info)
+		}
+	}
+	return infos
+}
+
+// loadSnapshot restores the index from its snapshot file and reports
+// whether a usable snapshot was found.
+func (idx *Index) loadSnapshot() bool {
+	path := snapshotPath(idx.Path)
+	file, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warningf("could not open index snapshot of [%v]: %v", idx.Name, err)
+		}
+		return false
+	}
+	defer file.Close()
+
+	var snapshot indexSnapshot
+	if err = gob.NewDecoder(bufio.NewReader(file)).Decode(&snapshot); err != nil {
+		logger.Warningf("ignoring unreadable index snapshot of [%v]: %v", idx.Name, err)
+		return false
+	}
+	if snapshot.Version != snapshotVersion || snapshot.SourcePath != idx.Path {
+		logger.Infof("ignoring outdated index snapshot of [%v]", idx.Name)
+		return false
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if snapshot.Directories != nil {
+		idx.Directories = snapshot.Directories
+	}
+	if snapshot.FoundHardLinks != nil {
+		idx.FoundHardLinks = snapshot.FoundHardLinks
+	}
+	for _, inode := range snapshot.ProcessedInodes {
+		idx.processedInodes[inode] = struct{}{}
+	}
+	idx.totalSize = snapshot.TotalSize
+
+	stats := snapshot.Stats
+	stats.IdxName = idx.Name
+	stats.Status = READY
+	stats.DiskTotal = idx.DiskTotal
+	idx.ReducedIndex = stats
+	idx.restoredScanners = make(map[string]*ScannerInfo, len(stats.Scanners))
+	for _, info := range stats.Scanners {
+		idx.restoredScanners[info.Path] = info
+	}
+	// the snapshot was taken from a complete index
+	idx.wasIndexed = true
+
+	logger.Infof("loaded index snapshot of [%v] from %v: %d directories, %d files",
+		idx.Name, snapshot.SavedAt.Format(time.RFC3339), stats.NumDirs, stats.NumFiles)
+	return true
+}
+
+// snapshotLoop saves the index every interval once it was completely
+// indexed and scanned again since the last snapshot.
+func (idx *Index) snapshotLoop(interval time.Duration) {
+	var lastSaved time.Time
+	for range time.Tick(interval) {
+		idx.mu.RLock()
+		changed := idx.wasIndexed && idx.lastRootScanTime.After(lastSaved)
+		idx.mu.RUnlock()
+		if !changed {
+			continue
+		}
+		startTime := time.Now()
+		if err := idx.SaveSnapshot(); err != nil {
+			logger.Errorf("could not save index snapshot of [%v]: %v", idx.Name, err)
+			continue
+		}
+		lastSaved = startTime
+		logger.Debugf("saved index snapshot of [%v] in %v", idx.Name, time.Since(startTime))
+	}
+}
+
+// SaveSnapshots saves all completely indexed indexes, it is called at
+// shutdown so the next start does not index from scratch.
+func SaveSnapshots() {
+	if snapshotInterval() == 0 {
+		return
+	}
+	indexesMutex.RLock()
+	list := make([]*Index, 0, len(indexes))
+	for _, idx := range indexes {
+		list = append(list, idx)
+	}
+	indexesMutex.RUnlock()
+
+	for _, idx := range list {
+		idx.mu.RLock()
+		indexed := idx.wasIndexed && !idx.Config.DisableIndexing
+		idx.mu.RUnlock()
+		if !indexed {
+			continue
+		}
+		if err := idx.SaveSnapshot(); err != nil {
+			logger.Errorf("could not save index snapshot of [%v]: %v", idx.Name, err)
+		}
+	}
+}
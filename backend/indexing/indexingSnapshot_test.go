@@ -0,0 +1,129 @@
+package indexing
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+)
+
+// newSnapshotTestIndex creates an empty index, snapshots are written to
+// the cache dir set by the test.
+func newSnapshotTestIndex(sourcePath string) *Index {
+	return &Index{
+		Source:          settings.Source{Name: "test", Path: sourcePath},
+		ReducedIndex:    ReducedIndex{IdxName: "test", Status: INDEXING},
+		Directories:     make(map[string]*iteminfo.FileInfo),
+		FoundHardLinks:  make(map[string]uint64),
+		processedInodes: make(map[uint64]struct{}),
+		scanners:        make(map[string]*Scanner),
+	}
+}
+
+func writeTestSnapshot(t *testing.T, sourcePath string, snapshot indexSnapshot) {
+	t.Helper()
+	path := snapshotPath(sourcePath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err = gob.NewEncoder(file).Encode(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	settings.Config.Server.CacheDir = t.TempDir()
+	idx := newSnapshotTestIndex("/srv/media")
+	modTime := time.Date(2024, 5, 17, 10, 0, 0, 0, time.UTC)
+	idx.Directories["/"] = &iteminfo.FileInfo{
+		ItemInfo: iteminfo.ItemInfo{Name: "/", Size: 30, ModTime: modTime, Type: "directory"},
+		Folders:  []iteminfo.ItemInfo{{Name: "photos", Size: 20, ModTime: modTime, Type: "directory"}},
+		Files:    []iteminfo.ExtendedItemInfo{{ItemInfo: iteminfo.ItemInfo{Name: "notes.txt", Size: 10, ModTime: modTime, Type: "text/plain"}}},
+		Path:     "/",
+	}
+	idx.Directories["/photos/"] = &iteminfo.FileInfo{
+		ItemInfo: iteminfo.ItemInfo{Name: "photos", Size: 20, ModTime: modTime, Type: "directory"},
+		Files:    []iteminfo.ExtendedItemInfo{{ItemInfo: iteminfo.ItemInfo{Name: "a.jpg", Size: 20, ModTime: modTime, Type: "image/jpeg"}}},
+		Path:     "/photos/",
+	}
+	idx.FoundHardLinks["/photos/b.jpg"] = 20
+	idx.processedInodes[42] = struct{}{}
+	idx.totalSize = 30
+	idx.NumDirs, idx.NumFiles = 2, 2
+	idx.scanners["/"] = &Scanner{scanPath: "/", published: &ScannerInfo{Path: "/", IsRoot: true, Complexity: 3, NumDirs: 2, NumFiles: 2}}
+	// a scanner that did not finish a scan yet has nothing to save
+	idx.scanners["/photos/"] = &Scanner{scanPath: "/photos/"}
+
+	if err := idx.SaveSnapshot(); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+
+	loaded := newSnapshotTestIndex("/srv/media")
+	if !loaded.loadSnapshot() {
+		t.Fatal("expected the snapshot to be loaded")
+	}
+	if !reflect.DeepEqual(loaded.Directories, idx.Directories) {
+		t.Errorf("directories differ after loading:\n got %+v\nwant %+v", loaded.Directories, idx.Directories)
+	}
+	if !reflect.DeepEqual(loaded.FoundHardLinks, idx.FoundHardLinks) {
+		t.Errorf("expected hard links %v, got %v", idx.FoundHardLinks, loaded.FoundHardLinks)
+	}
+	if _, ok := loaded.processedInodes[42]; !ok || loaded.totalSize != 30 {
+		t.Errorf("expected inodes and total size to be restored, got %v %d", loaded.processedInodes, loaded.totalSize)
+	}
+	if loaded.Status != READY || loaded.NumDirs != 2 || loaded.NumFiles != 2 || !loaded.wasIndexed {
+		t.Errorf("expected a ready index with the saved stats, got %+v", loaded.ReducedIndex)
+	}
+	if len(loaded.restoredScanners) != 1 || loaded.restoredScanners["/"] == nil || loaded.restoredScanners["/"].Complexity != 3 {
+		t.Errorf("expected the root scanner stats to be restored, got %v", loaded.restoredScanners)
+	}
+}
+
+func TestSnapshotCopiesDirectories(t *testing.T) {
+	settings.Config.Server.CacheDir = t.TempDir()
+	idx := newSnapshotTestIndex("/srv/media")
+	dir := &iteminfo.FileInfo{ItemInfo: iteminfo.ItemInfo{Name: "/", Size: 10, Type: "directory"}, Path: "/"}
+	idx.Directories["/"] = dir
+	if err := idx.SaveSnapshot(); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+	dir.Size = 99
+	loaded := newSnapshotTestIndex("/srv/media")
+	if !loaded.loadSnapshot() || loaded.Directories["/"].Size != 10 {
+		t.Errorf("expected the saved size, got %+v", loaded.Directories["/"])
+	}
+}
+
+func TestSnapshotRejectsStale(t *testing.T) {
+	settings.Config.Server.CacheDir = t.TempDir()
+	idx := newSnapshotTestIndex("/srv/media")
+	dirs := map[string]*iteminfo.FileInfo{"/": {Path: "/"}}
+
+	writeTestSnapshot(t, idx.Path, indexSnapshot{Version: snapshotVersion + 1, SourcePath: idx.Path, Directories: dirs})
+	if idx.loadSnapshot() {
+		t.Error("expected a snapshot of another version to be ignored")
+	}
+	writeTestSnapshot(t, idx.Path, indexSnapshot{Version: snapshotVersion, SourcePath: "/srv/other", Directories: dirs})
+	if idx.loadSnapshot() {
+		t.Error("expected a snapshot of another source to be ignored")
+	}
+	if err := os.WriteFile(snapshotPath(idx.Path), []byte("not a snapshot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if idx.loadSnapshot() {
+		t.Error("expected an unreadable snapshot to be ignored")
+	}
+	if len(idx.Directories) != 0 || idx.Status != INDEXING || idx.wasIndexed {
+		t.Errorf("expected the index to be left unchanged, got %+v", idx.ReducedIndex)
+	}
+}
@@ -0,0 +1,279 @@
+package indexing
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/common/utils"
+	"github.com/gtsteffaniak/go-logger/logger"
+)
+
+// A watcher applies changes of a local source to the index as they happen.
+// Changed directories are collected for a short while and then indexed
+// again without recursion, new directories are indexed with their contents.
+// When the kernel drops events or runs out of watches the watcher stops and
+// the scanners go back to their normal schedule.
+
+var (
+	errWatchUnsupported = errors.New("watching is only supported on linux")
+	errWatchLimit       = errors.New("inotify watch limit reached, raise fs.inotify.max_user_watches")
+	errWatchOverflow    = errors.New("inotify event queue overflowed")
+)
+
+// watchDebounce is how long changes are collected before they are applied.
+const watchDebounce = time.Second
+
+type watchOp int
+
+const (
+	watchChanged    watchOp = iota // a file was created, written or removed
+	watchDirCreated                // a directory was created or moved in
+	watchDirRemoved                // a directory was removed or moved out
+)
+
+// watchEvent is a change of the item name in the directory dir, an index
+// path with trailing slash.
+type watchEvent struct {
+	dir  string
+	name string
+	op   watchOp
+}
+
+// notifier reports changes in watched directories, it is implemented per
+// platform.
+type notifier interface {
+	// Add watches the index path dir, not its subdirectories.
+	Add(dir string) error
+	// Remove stops watching dir and all directories below it.
+	Remove(dir string)
+	Events() <-chan watchEvent
+	Errors() <-chan error
+	Close() error
+}
+
+type watcher struct {
+	idx      *Index
+	notifier notifier
+	failed   chan struct{} // closed when the watcher stopped
+	failOnce sync.Once
+}
+
+// watchBatch holds the changes collected since the last apply.
+type watchBatch struct {
+	changed map[string]struct{} // directories whose listing changed
+	created map[string]struct{} // new directories to index with their contents
+	removed map[string]struct{} // directories to drop from the index
+}
+
+func newWatchBatch() watchBatch {
+	return watchBatch{
+		changed: map[string]struct{}{},
+		created: map[string]struct{}{},
+		removed: map[string]struct{}{},
+	}
+}
+
+// startWatcher watches the source for changes, it falls back to the
+// scanners alone when the source can't be watched.
+func (idx *Index) startWatcher() {
+	if !idx.FS.IsLocal() {
+		logger.Warningf("not watching [%v]: only local sources can be watched", idx.Name)
+		return
+	}
+	n, err := newNotifier(idx.Path)
+	if err != nil {
+		logger.Warningf("not watching [%v]: %v", idx.Name, err)
+		return
+	}
+	w := &watcher{idx: idx, notifier: n, failed: make(chan struct{})}
+	idx.mu.Lock()
+	idx.watcher = w
+	idx.mu.Unlock()
+	go w.run()
+}
+
+// watchFallback returns a channel that is closed when the watcher of the
+// index stops, nil if the index is not watched.
+func (idx *Index) watchFallback() <-chan struct{} {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if idx.watcher == nil {
+		return nil
+	}
+	return idx.watcher.failed
+}
+
+// watched reports whether changes are currently applied by a watcher.
+func (idx *Index) watched() bool {
+	fallback := idx.watchFallback()
+	if fallback == nil {
+		return false
+	}
+	select {
+	case <-fallback:
+		return false
+	default:
+		return true
+	}
+}
+
+// removeDirectories drops dir and all directories below it from the index.
+func (idx *Index) removeDirectories(dir string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for path := range idx.Directories {
+		if strings.HasPrefix(path, dir) {
+			delete(idx.Directories, path)
+			delete(idx.DirectoriesLedger, path)
+		}
+	}
+}
+
+func (w *watcher) run() {
+	if err := w.addTree("/"); err != nil {
+		w.fail(err)
+		return
+	}
+	logger.Infof("watching [%v] for changes", w.idx.Name)
+
+	batch := newWatchBatch()
+	var apply <-chan time.Time
+	for {
+		select {
+		case event := <-w.notifier.Events():
+			w.collect(batch, event)
+			if apply == nil {
+				apply = time.After(watchDebounce)
+			}
+		case err := <-w.notifier.Errors():
+			w.fail(err)
+			return
+		case <-apply:
+			apply = nil
+			if err := w.apply(batch); err != nil {
+				w.fail(err)
+				return
+			}
+			batch = newWatchBatch()
+		}
+	}
+}
+
+// skips reports whether the conditional rules exclude the item name in dir,
+// directories that are never watched are skipped as well.
+func (w *watcher) skips(dir, name string, isDir bool) bool {
+	if dir == "/" && !w.idx.shouldInclude(name) {
+		return true
+	}
+	if isDir && omitList[name] {
+		return true
+	}
+	hidden := strings.HasPrefix(name, ".")
+	return w.idx.shouldSkip(isDir, hidden, dir+name, name, actionConfig{IsRoutineScan: true})
+}
+
+// addTree watches dir and all directories below it that are not skipped.
+func (w *watcher) addTree(dir string) error {
+	if err := w.notifier.Add(dir); err != nil {
+		if errors.Is(err, errWatchLimit) {
+			return err
+		}
+		// removed in the meantime, the event of its parent covers it
+		logger.Debugf("could not watch [%v] %v: %v", w.idx.Name, dir, err)
+		return nil
+	}
+	entries, err := w.idx.FS.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || w.skips(dir, entry.Name(), true) {
+			continue
+		}
+		if err = w.addTree(dir + entry.Name() + "/"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *watcher) collect(batch watchBatch, event watchEvent) {
+	if w.skips(event.dir, event.name, event.op != watchChanged) {
+		return
+	}
+	batch.changed[event.dir] = struct{}{}
+	path := event.dir + event.name + "/"
+	switch event.op {
+	case watchDirCreated:
+		batch.created[path] = struct{}{}
+	case watchDirRemoved:
+		// a directory moved away and back within one batch is indexed again
+		delete(batch.created, path)
+		batch.removed[path] = struct{}{}
+	}
+}
+
+// apply updates the index and the full-text index with the collected
+// changes. Removed directories are dropped first, so a moved directory is
+// indexed again at its new path.
+func (w *watcher) apply(batch watchBatch) error {
+	for dir := range batch.removed {
+		w.notifier.Remove(dir)
+		w.idx.removeDirectories(dir)
+		w.idx.UpdateFullText(dir, true, true)
+	}
+	for dir := range batch.created {
+		if err := w.addTree(dir); err != nil {
+			return err
+		}
+		err := w.idx.indexDirectory(dir, actionConfig{Recursive: true})
+		if err != nil {
+			logger.Debugf("could not index new directory [%v] %v: %v", w.idx.Name, dir, err)
+			continue
+		}
+		w.idx.UpdateFullText(dir, true, true)
+	}
+
+	// deepest directories first, so parents pick up the new sizes directly
+	dirs := make([]string, 0, len(batch.changed))
+	for dir := range batch.changed {
+		if !batch.coversRemoved(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/")
+	})
+	for _, dir := range dirs {
+		err := w.idx.RefreshFileInfo(utils.FileOptions{Path: dir, IsDir: true})
+		if err != nil {
+			logger.Debugf("could not refresh [%v] %v: %v", w.idx.Name, dir, err)
+			continue
+		}
+		w.idx.UpdateFullText(dir, true, false)
+	}
+	return nil
+}
+
+// coversRemoved reports whether dir is a removed directory or below one.
+func (b watchBatch) coversRemoved(dir string) bool {
+	for removed := range b.removed {
+		if strings.HasPrefix(dir, removed) {
+			return true
+		}
+	}
+	return false
+}
+
+// fail stops the watcher. The scanners notice it through watchFallback and
+// catch up on the changes the watcher missed.
+func (w *watcher) fail(err error) {
+	w.failOnce.Do(func() {
+		logger.Warningf("stopped watching [%v], falling back to scanners: %v", w.idx.Name, err)
+		w.notifier.Close()
+		close(w.failed)
+	})
+}
@@ -0,0 +1,168 @@
+//go:build linux
+
+package indexing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+	unix.IN_CLOSE_WRITE | unix.IN_ATTRIB | unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW | unix.IN_EXCL_UNLINK
+
+// inotify is the linux notifier, it keeps one watch per directory.
+type inotify struct {
+	fd     int
+	file   *os.File // the same descriptor, read through the runtime poller so Close unblocks reads
+	root   string
+	mu     sync.Mutex
+	dirs   map[int]string // watch descriptor -> index path
+	wds    map[string]int // index path -> watch descriptor
+	events chan watchEvent
+	errors chan error
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newNotifier(root string) (notifier, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		if errors.Is(err, unix.EMFILE) {
+			return nil, errWatchLimit
+		}
+		return nil, err
+	}
+	n := &inotify{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		root:   root,
+		dirs:   map[int]string{},
+		wds:    map[string]int{},
+		events: make(chan watchEvent, 1024),
+		errors: make(chan error, 1),
+		done:   make(chan struct{}),
+	}
+	go n.read()
+	return n, nil
+}
+
+func (n *inotify) Add(dir string) error {
+	wd, err := unix.InotifyAddWatch(n.fd, filepath.Join(n.root, filepath.FromSlash(dir)), inotifyMask)
+	if errors.Is(err, unix.ENOSPC) {
+		return errWatchLimit
+	}
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	n.dirs[wd] = dir
+	n.wds[dir] = wd
+	n.mu.Unlock()
+	return nil
+}
+
+func (n *inotify) Remove(dir string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for path, wd := range n.wds {
+		if !strings.HasPrefix(path, dir) {
+			continue
+		}
+		// fails for deleted directories, the kernel removed their watch already
+		_, _ = unix.InotifyRmWatch(n.fd, uint32(wd))
+		delete(n.wds, path)
+		if n.dirs[wd] == path {
+			delete(n.dirs, wd)
+		}
+	}
+}
+
+func (n *inotify) Events() <-chan watchEvent {
+	return n.events
+}
+
+func (n *inotify) Errors() <-chan error {
+	return n.errors
+}
+
+func (n *inotify) Close() error {
+	var err error
+	n.once.Do(func() {
+		close(n.done)
+		err = n.file.Close()
+	})
+	return err
+}
+
+func (n *inotify) read() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				n.report(err)
+			}
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= count; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + unix.SizeofInotifyEvent
+			offset = start + int(raw.Len)
+			name := strings.TrimRight(string(buf[start:offset]), "\x00")
+			if !n.handle(int(raw.Wd), raw.Mask, name) {
+				return
+			}
+		}
+	}
+}
+
+// handle forwards a raw event, it reports false once the notifier stops.
+func (n *inotify) handle(wd int, mask uint32, name string) bool {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		n.report(errWatchOverflow)
+		return false
+	}
+	n.mu.Lock()
+	dir, ok := n.dirs[wd]
+	if mask&unix.IN_IGNORED != 0 {
+		delete(n.dirs, wd)
+		if n.wds[dir] == wd {
+			delete(n.wds, dir)
+		}
+	}
+	n.mu.Unlock()
+	// events about a watched directory itself are reported by its parent
+	if !ok || name == "" {
+		return true
+	}
+
+	op := watchChanged
+	if mask&unix.IN_ISDIR != 0 {
+		switch {
+		case mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+			op = watchDirCreated
+		case mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+			op = watchDirRemoved
+		}
+	}
+	select {
+	case n.events <- watchEvent{dir: dir, name: name, op: op}:
+		return true
+	case <-n.done:
+		return false
+	}
+}
+
+// report passes err to the watcher, which stops the notifier.
+func (n *inotify) report(err error) {
+	select {
+	case n.errors <- err:
+	default:
+	}
+}
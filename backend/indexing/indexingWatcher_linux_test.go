@@ -0,0 +1,95 @@
+//go:build linux
+
+package indexing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitEvent waits for want, other events such as writes of the same file
+// are skipped.
+func waitEvent(t *testing.T, n notifier, want watchEvent) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-n.Events():
+			if event == want {
+				return
+			}
+		case err := <-n.Errors():
+			t.Fatalf("notifier failed: %v", err)
+		case <-timeout:
+			t.Fatalf("no event %+v", want)
+		}
+	}
+}
+
+func TestInotifyEvents(t *testing.T) {
+	root := t.TempDir()
+	n, err := newNotifier(root)
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	defer n.Close()
+	if err = n.Add("/"); err != nil {
+		t.Fatalf("failed to watch root: %v", err)
+	}
+
+	if err = os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, n, watchEvent{dir: "/", name: "a.txt", op: watchChanged})
+
+	if err = os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, n, watchEvent{dir: "/", name: "sub", op: watchDirCreated})
+	if err = n.Add("/sub/"); err != nil {
+		t.Fatalf("failed to watch sub: %v", err)
+	}
+	if err = os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, n, watchEvent{dir: "/sub/", name: "b.txt", op: watchChanged})
+
+	if err = os.Rename(filepath.Join(root, "sub"), filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, n, watchEvent{dir: "/", name: "sub", op: watchDirRemoved})
+	waitEvent(t, n, watchEvent{dir: "/", name: "moved", op: watchDirCreated})
+
+	if err = os.Remove(filepath.Join(root, "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, n, watchEvent{dir: "/", name: "a.txt", op: watchChanged})
+	if err = os.RemoveAll(filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, n, watchEvent{dir: "/", name: "moved", op: watchDirRemoved})
+}
+
+func TestInotifyRemoveTree(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "a", "b"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	n, err := newNotifier(root)
+	if err != nil {
+		t.Fatalf("failed to create notifier: %v", err)
+	}
+	defer n.Close()
+	for _, dir := range []string{"/", "/a/", "/a/b/"} {
+		if err = n.Add(dir); err != nil {
+			t.Fatalf("failed to watch %v: %v", dir, err)
+		}
+	}
+	n.Remove("/a/")
+	watches := n.(*inotify).wds
+	if _, ok := watches["/a/b/"]; ok || len(watches) != 1 {
+		t.Errorf("expected only the root to stay watched, got %v", watches)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package indexing
+
+func newNotifier(root string) (notifier, error) {
+	return nil, errWatchUnsupported
+}
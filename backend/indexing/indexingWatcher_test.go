@@ -0,0 +1,140 @@
+package indexing
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/adapters/fs/sources"
+	"github.com/SlepoyShaman/FileStorage/common/settings"
+	"github.com/SlepoyShaman/FileStorage/indexing/iteminfo"
+)
+
+// fakeNotifier records the watched directories, events are sent by the test.
+type fakeNotifier struct {
+	mu      sync.Mutex
+	added   []string
+	removed []string
+	events  chan watchEvent
+	errors  chan error
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{events: make(chan watchEvent, 16), errors: make(chan error, 1)}
+}
+
+func (n *fakeNotifier) Add(dir string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.added = append(n.added, dir)
+	return nil
+}
+
+func (n *fakeNotifier) Remove(dir string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.removed = append(n.removed, dir)
+}
+
+func (n *fakeNotifier) watches() ([]string, []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.added...), append([]string(nil), n.removed...)
+}
+
+func (n *fakeNotifier) Events() <-chan watchEvent { return n.events }
+func (n *fakeNotifier) Errors() <-chan error      { return n.errors }
+func (n *fakeNotifier) Close() error              { return nil }
+
+func newWatchTestIndex(root string) *Index {
+	return &Index{
+		Source:            settings.Source{Name: "test", Path: root},
+		FS:                sources.NewLocal(root),
+		Directories:       make(map[string]*iteminfo.FileInfo),
+		DirectoriesLedger: make(map[string]struct{}),
+		FoundHardLinks:    make(map[string]uint64),
+		processedInodes:   make(map[uint64]struct{}),
+	}
+}
+
+func TestWatchBatchCollect(t *testing.T) {
+	w := &watcher{idx: newWatchTestIndex(t.TempDir())}
+	batch := newWatchBatch()
+	w.collect(batch, watchEvent{dir: "/docs/", name: "a.txt", op: watchChanged})
+	w.collect(batch, watchEvent{dir: "/docs/", name: "b.txt", op: watchChanged})
+	w.collect(batch, watchEvent{dir: "/", name: "new", op: watchDirCreated})
+	w.collect(batch, watchEvent{dir: "/", name: "old", op: watchDirRemoved})
+	// moved away again before the batch was applied
+	w.collect(batch, watchEvent{dir: "/", name: "new", op: watchDirRemoved})
+	w.collect(batch, watchEvent{dir: "/", name: ".hidden", op: watchDirCreated})
+	w.collect(batch, watchEvent{dir: "/photos/", name: "@eaDir", op: watchDirCreated})
+
+	if len(batch.changed) != 2 {
+		t.Errorf("expected the changes of a directory to be collected once and omitted directories to be skipped, got %v", batch.changed)
+	}
+	if _, ok := batch.created["/new/"]; ok {
+		t.Errorf("expected a directory removed within the batch not to be indexed, got %v", batch.created)
+	}
+	if _, ok := batch.created["/.hidden/"]; !ok {
+		t.Errorf("expected hidden directories to be indexed by default, got %v", batch.created)
+	}
+	if len(batch.removed) != 2 || !batch.coversRemoved("/old/sub/") || batch.coversRemoved("/docs/") {
+		t.Errorf("unexpected removed directories %v", batch.removed)
+	}
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	root := t.TempDir()
+	idx := newWatchTestIndex(root)
+	n := newFakeNotifier()
+	w := &watcher{idx: idx, notifier: n, failed: make(chan struct{})}
+	go w.run()
+	defer w.fail(os.ErrClosed)
+	waitFor(t, "the root to be watched", func() bool {
+		added, _ := n.watches()
+		return len(added) == 1
+	})
+
+	// all events arrive within one debounce period and are applied together
+	if err := os.Mkdir(filepath.Join(root, "kept"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	n.events <- watchEvent{dir: "/", name: "kept", op: watchDirCreated}
+	n.events <- watchEvent{dir: "/", name: "gone", op: watchDirCreated}
+	n.events <- watchEvent{dir: "/", name: "gone", op: watchDirRemoved}
+
+	time.Sleep(watchDebounce / 2)
+	if added, removed := n.watches(); len(added) != 1 || len(removed) != 0 {
+		t.Fatalf("expected nothing to be applied within the debounce period, got %v and %v", added, removed)
+	}
+	waitFor(t, "/kept/ to be indexed", func() bool {
+		idx.mu.RLock()
+		defer idx.mu.RUnlock()
+		_, ok := idx.Directories["/kept/"]
+		return ok
+	})
+	added, removed := n.watches()
+	if len(added) != 2 || added[1] != "/kept/" || len(removed) != 1 || removed[0] != "/gone/" {
+		t.Errorf("expected /kept/ to be watched and /gone/ removed, got %v and %v", added, removed)
+	}
+	idx.mu.RLock()
+	_, gone := idx.Directories["/gone/"]
+	idx.mu.RUnlock()
+	if gone {
+		t.Error("expected /gone/ not to be indexed")
+	}
+}
+
+// waitFor polls done until it reports true.
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * watchDebounce)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
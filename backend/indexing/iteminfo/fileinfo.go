@@ -19,7 +19,7 @@ type ItemInfo struct {
 // This avoids adding memory overhead to indexed items
 type ExtendedItemInfo struct {
 	ItemInfo
-	Metadata *MediaMetadata `json:"metadata,omitempty"` // optional media metadata (audio/video only)
+	Metadata *MediaMetadata `json:"metadata,omitempty"` // optional media metadata (audio, video and images)
 }
 
 // FileInfo describes a file.
@@ -31,7 +31,7 @@ type FileInfo struct {
 	Path    string             `json:"path,omitempty"`    // path scoped to the associated index
 }
 
-// MediaMetadata contains metadata extracted from audio and video files
+// MediaMetadata contains metadata extracted from audio, video and image files
 type MediaMetadata struct {
 	Title    string `json:"title,omitempty"`    // track/video title
 	Artist   string `json:"artist,omitempty"`   // track artist
@@ -41,19 +41,39 @@ type MediaMetadata struct {
 	Track    int    `json:"track,omitempty"`    // track number
 	Duration int    `json:"duration,omitempty"` // duration in seconds
 	AlbumArt string `json:"albumArt,omitempty"` // base64 encoded album art / video thumbnail
+	Exif     *Exif  `json:"exif,omitempty"`     // camera metadata of images
+}
+
+// Exif contains camera metadata extracted from images
+type Exif struct {
+	Make         string     `json:"make,omitempty"`         // camera manufacturer
+	Model        string     `json:"model,omitempty"`        // camera model
+	Lens         string     `json:"lens,omitempty"`         // lens model
+	ExposureTime string     `json:"exposureTime,omitempty"` // shutter speed in seconds, eg. "1/250"
+	FNumber      float64    `json:"fNumber,omitempty"`      // aperture
+	ISO          int        `json:"iso,omitempty"`          // sensitivity
+	FocalLength  float64    `json:"focalLength,omitempty"`  // focal length in mm
+	TakenAt      *time.Time `json:"takenAt,omitempty"`      // capture date
+	Orientation  int        `json:"orientation,omitempty"`  // exif orientation from 1 to 8, 1 is upright
+	Latitude     *float64   `json:"latitude,omitempty"`     // gps coordinates in degrees
+	Longitude    *float64   `json:"longitude,omitempty"`
 }
 
 // for efficiency, a response will be a pointer to the data
 // extra calculated fields can be added here
 type ExtendedFileInfo struct {
 	FileInfo
-	Content      string                 `json:"content,omitempty"`      // text content of a file, if requested
-	Subtitles    []ffmpeg.SubtitleTrack `json:"subtitles,omitempty"`    // subtitles for video files
-	Metadata     *MediaMetadata         `json:"metadata,omitempty"`     // media metadata for audio/video files (includes duration)
-	Checksums    map[string]string      `json:"checksums,omitempty"`    // checksums for the file
-	Token        string                 `json:"token,omitempty"`        // token for the file -- used for sharing
-	OnlyOfficeId string                 `json:"onlyOfficeId,omitempty"` // id for onlyoffice files
-	Source       string                 `json:"source,omitempty"`       // associated index source for the file
-	Hash         string                 `json:"hash,omitempty"`         // hash for the file -- used for sharing
-	RealPath     string                 `json:"-"`
+	Content        string                 `json:"content,omitempty"`        // text content of a file, if requested
+	Subtitles      []ffmpeg.SubtitleTrack `json:"subtitles,omitempty"`      // subtitles for video files
+	Metadata       *MediaMetadata         `json:"metadata,omitempty"`       // media metadata for audio, video and image files
+	Checksums      map[string]string      `json:"checksums,omitempty"`      // checksums for the file
+	Token          string                 `json:"token,omitempty"`          // token for the file -- used for sharing
+	OnlyOfficeId   string                 `json:"onlyOfficeId,omitempty"`   // id for onlyoffice files
+	Source         string                 `json:"source,omitempty"`         // associated index source for the file
+	Hash           string                 `json:"hash,omitempty"`           // hash for the file -- used for sharing
+	Version        string                 `json:"version,omitempty"`        // version tag of a file, also sent as ETag
+	Tags           []string               `json:"tags,omitempty"`           // user defined tags of the file or folder
+	CustomMetadata map[string]string      `json:"customMetadata,omitempty"` // user defined key/value metadata
+	ItemTags       map[string][]string    `json:"itemTags,omitempty"`       // tags of the items in a folder by name
+	RealPath       string                 `json:"-"`
 }
@@ -0,0 +1,344 @@
+package job_service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/jobs"
+)
+
+const (
+	DefaultWorkers       = 2
+	maxQueuedJobs        = 1000
+	progressSaveInterval = 2 * time.Second
+	subscriberBuffer     = 16
+)
+
+// Runner does the work of a job. It reports progress from 0 to 1 and
+// returns the link to the result, if the job has one. ctx is canceled when
+// the job is canceled.
+type Runner func(ctx context.Context, job *jobs.Job, progress func(value float64, message string)) (result string, err error)
+
+type jobType struct {
+	run       Runner
+	resumable bool
+}
+
+// activeJob is a queued or running job.
+type activeJob struct {
+	job      *jobs.Job
+	cancel   context.CancelFunc
+	lastSave time.Time
+}
+
+// JobService runs background jobs on a bounded pool of workers and keeps
+// their records up to date, so clients can follow and cancel them.
+type JobService struct {
+	store       *jobs.Storage
+	types       map[string]jobType
+	queue       chan string
+	mu          sync.Mutex
+	active      map[string]*activeJob
+	subscribers map[chan jobs.Job]string // channel -> owner, empty for all jobs
+}
+
+func NewJobService(store *jobs.Storage) *JobService {
+	return &JobService{
+		store:       store,
+		types:       make(map[string]jobType),
+		queue:       make(chan string, maxQueuedJobs),
+		active:      make(map[string]*activeJob),
+		subscribers: make(map[chan jobs.Job]string),
+	}
+}
+
+// Register adds a type of job. Resumable jobs that were interrupted by a
+// restart run again from the start, others are marked failed. Types must be
+// registered before Start.
+func (s *JobService) Register(name string, run Runner, resumable bool) {
+	s.types[name] = jobType{run: run, resumable: resumable}
+}
+
+// Start recovers the jobs interrupted by a restart and starts the workers,
+// which stop taking new jobs once ctx is done.
+func (s *JobService) Start(ctx context.Context, workers int) error {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	list, err := s.store.All()
+	if err != nil {
+		return err
+	}
+	// oldest first, so resumed jobs keep their order
+	for i := len(list) - 1; i >= 0; i-- {
+		job := list[i]
+		if job.Finished() {
+			continue
+		}
+		if t, ok := s.types[job.Type]; ok && t.resumable {
+			job.Status = jobs.StatusQueued
+			job.Progress = 0
+			job.Message = "resumed after a restart"
+			job.StartedAt = 0
+			if _, err = s.enqueue(job); err != nil {
+				return err
+			}
+			continue
+		}
+		job.Status = jobs.StatusFailed
+		job.Error = "interrupted by a restart"
+		job.FinishedAt = time.Now().Unix()
+		if err = s.store.Save(job); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < workers; i++ {
+		go s.work(ctx)
+	}
+	return nil
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Submit queues a new job.
+func (s *JobService) Submit(name, owner string, params map[string]string) (jobs.Job, error) {
+	if _, ok := s.types[name]; !ok {
+		return jobs.Job{}, fmt.Errorf("unknown job type %q", name)
+	}
+	id, err := newJobID()
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	job := &jobs.Job{
+		ID:        id,
+		Type:      name,
+		Owner:     owner,
+		Status:    jobs.StatusQueued,
+		Params:    params,
+		CreatedAt: time.Now().Unix(),
+	}
+	return s.enqueue(job)
+}
+
+// enqueue saves and queues a job. It returns a copy, as a worker may pick
+// up the job right away.
+func (s *JobService) enqueue(job *jobs.Job) (jobs.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == cap(s.queue) {
+		return jobs.Job{}, errors.ErrJobQueueFull
+	}
+	if err := s.store.Save(job); err != nil {
+		return jobs.Job{}, err
+	}
+	s.active[job.ID] = &activeJob{job: job}
+	s.queue <- job.ID
+	s.publish(*job)
+	return *job, nil
+}
+
+// Get returns a job by its id.
+func (s *JobService) Get(id string) (jobs.Job, error) {
+	s.mu.Lock()
+	if active, ok := s.active[id]; ok {
+		defer s.mu.Unlock()
+		return *active.job, nil
+	}
+	s.mu.Unlock()
+	job, err := s.store.Get(id)
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	return *job, nil
+}
+
+// List returns the jobs of owner, or of all users if owner is empty, newest
+// first.
+func (s *JobService) List(owner string) ([]jobs.Job, error) {
+	list, err := s.store.All()
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := []jobs.Job{}
+	for _, job := range list {
+		if owner != "" && job.Owner != owner {
+			continue
+		}
+		// active jobs have newer progress than their saved record
+		if active, ok := s.active[job.ID]; ok {
+			job = active.job
+		}
+		result = append(result, *job)
+	}
+	return result, nil
+}
+
+// Cancel stops a queued or running job.
+func (s *JobService) Cancel(id string) (jobs.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active, ok := s.active[id]
+	if !ok {
+		if _, err := s.store.Get(id); err != nil {
+			return jobs.Job{}, err
+		}
+		return jobs.Job{}, errors.ErrJobFinished
+	}
+	if active.cancel != nil {
+		// the worker records the cancellation once the runner returns
+		active.cancel()
+		return *active.job, nil
+	}
+	job := active.job
+	job.Status = jobs.StatusCanceled
+	job.FinishedAt = time.Now().Unix()
+	delete(s.active, id)
+	if err := s.store.Save(job); err != nil {
+		return jobs.Job{}, err
+	}
+	s.publish(*job)
+	return *job, nil
+}
+
+// Delete removes the record of a finished job.
+func (s *JobService) Delete(id string) error {
+	s.mu.Lock()
+	_, ok := s.active[id]
+	s.mu.Unlock()
+	if ok {
+		return fmt.Errorf("job %s has not finished yet", id)
+	}
+	return s.store.Delete(id)
+}
+
+// Prune removes the records of jobs that finished before cutoff and calls
+// removed with each of them, so their results can be removed too.
+func (s *JobService) Prune(cutoff time.Time, removed func(job jobs.Job)) (int, error) {
+	list, err := s.store.All()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, job := range list {
+		if !job.Finished() || job.FinishedAt >= cutoff.Unix() {
+			continue
+		}
+		if err = s.Delete(job.ID); err != nil {
+			return count, err
+		}
+		removed(*job)
+		count++
+	}
+	return count, nil
+}
+
+// Subscribe returns a channel receiving the updates of the jobs of owner,
+// or of all jobs if owner is empty. Updates are dropped while the channel
+// is full. The returned function ends the subscription.
+func (s *JobService) Subscribe(owner string) (<-chan jobs.Job, func()) {
+	ch := make(chan jobs.Job, subscriberBuffer)
+	s.mu.Lock()
+	s.subscribers[ch] = owner
+	s.mu.Unlock()
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}
+}
+
+// publish sends a job update to the subscribers, s.mu must be held.
+func (s *JobService) publish(job jobs.Job) {
+	for ch, owner := range s.subscribers {
+		if owner != "" && owner != job.Owner {
+			continue
+		}
+		select {
+		case ch <- job:
+		default:
+		}
+	}
+}
+
+func (s *JobService) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			s.run(id)
+		}
+	}
+}
+
+// run executes a queued job, unless it was canceled while waiting.
+func (s *JobService) run(id string) {
+	s.mu.Lock()
+	active, ok := s.active[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	active.cancel = cancel
+	job := active.job
+	job.Status = jobs.StatusRunning
+	job.StartedAt = time.Now().Unix()
+	s.save(active)
+	t := s.types[job.Type]
+	runJob := *job
+	s.mu.Unlock()
+
+	result, err := t.run(ctx, &runJob, func(value float64, message string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		job.Progress = min(max(value, 0), 1)
+		job.Message = message
+		if time.Since(active.lastSave) >= progressSaveInterval {
+			s.save(active)
+		} else {
+			s.publish(*job)
+		}
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.FinishedAt = time.Now().Unix()
+	switch {
+	case ctx.Err() != nil:
+		job.Status = jobs.StatusCanceled
+	case err != nil:
+		job.Status = jobs.StatusFailed
+		job.Error = err.Error()
+	default:
+		job.Status = jobs.StatusDone
+		job.Progress = 1
+		job.Result = result
+	}
+	s.save(active)
+	delete(s.active, id)
+}
+
+// save stores and publishes a job, s.mu must be held.
+func (s *JobService) save(active *activeJob) {
+	active.lastSave = time.Now()
+	if err := s.store.Save(active.job); err != nil {
+		slog.Error("could not save job", "job", active.job.ID, "err", err)
+	}
+	s.publish(*active.job)
+}
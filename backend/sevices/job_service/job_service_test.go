@@ -0,0 +1,165 @@
+package job_service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	storm "github.com/asdine/storm/v3"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+	"github.com/SlepoyShaman/FileStorage/backend/database/jobs"
+	"github.com/SlepoyShaman/FileStorage/backend/database/storage/bolt"
+)
+
+// newTestService creates a job service backed by a storm DB in a temp dir.
+func newTestService(t *testing.T) (*JobService, jobs.StorageBackend) {
+	t.Helper()
+	db, err := storm.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("failed to open storm db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	back := bolt.NewJobsBackend(db)
+	return NewJobService(jobs.NewStorage(back)), back
+}
+
+// waitFor waits for an update of the job with the given status.
+func waitFor(t *testing.T, updates <-chan jobs.Job, id, status string) jobs.Job {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case job := <-updates:
+			if job.ID == id && job.Status == status {
+				return job
+			}
+		case <-timeout:
+			t.Fatalf("job %s did not become %s", id, status)
+		}
+	}
+}
+
+func TestJobRunsToCompletion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, _ := newTestService(t)
+	s.Register("echo", func(ctx context.Context, job *jobs.Job, progress func(float64, string)) (string, error) {
+		progress(0.5, "halfway")
+		return "result/" + job.Params["name"], nil
+	}, false)
+	if err := s.Start(ctx, 1); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	updates, unsubscribe := s.Subscribe("alice")
+	defer unsubscribe()
+
+	job, err := s.Submit("echo", "alice", map[string]string{"name": "a"})
+	if err != nil {
+		t.Fatalf("failed to submit: %v", err)
+	}
+	done := waitFor(t, updates, job.ID, jobs.StatusDone)
+	if done.Result != "result/a" || done.Progress != 1 {
+		t.Errorf("unexpected finished job: %+v", done)
+	}
+	saved, err := s.Get(job.ID)
+	if err != nil || saved.Status != jobs.StatusDone {
+		t.Errorf("expected saved job to be done, got %+v, %v", saved, err)
+	}
+	if list, _ := s.List("bob"); len(list) != 0 {
+		t.Errorf("expected no jobs for another user, got %d", len(list))
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, _ := newTestService(t)
+	started := make(chan struct{})
+	s.Register("wait", func(ctx context.Context, job *jobs.Job, progress func(float64, string)) (string, error) {
+		close(started)
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, false)
+	if err := s.Start(ctx, 1); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	updates, unsubscribe := s.Subscribe("")
+	defer unsubscribe()
+
+	job, err := s.Submit("wait", "alice", nil)
+	if err != nil {
+		t.Fatalf("failed to submit: %v", err)
+	}
+	<-started
+	if _, err = s.Cancel(job.ID); err != nil {
+		t.Fatalf("failed to cancel: %v", err)
+	}
+	waitFor(t, updates, job.ID, jobs.StatusCanceled)
+	if _, err = s.Cancel(job.ID); err != errors.ErrJobFinished {
+		t.Errorf("expected ErrJobFinished, got %v", err)
+	}
+	if err = s.Delete(job.ID); err != nil {
+		t.Errorf("failed to delete finished job: %v", err)
+	}
+}
+
+func TestInterruptedJobsAfterRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, back := newTestService(t)
+	for _, job := range []*jobs.Job{
+		{ID: "resume", Type: "resumable", Owner: "alice", Status: jobs.StatusRunning, Progress: 0.4},
+		{ID: "fail", Type: "once", Owner: "alice", Status: jobs.StatusQueued},
+	} {
+		if err := back.Save(job); err != nil {
+			t.Fatalf("failed to save job: %v", err)
+		}
+	}
+	noop := func(ctx context.Context, job *jobs.Job, progress func(float64, string)) (string, error) {
+		return "", nil
+	}
+	s.Register("resumable", noop, true)
+	s.Register("once", noop, false)
+	updates, unsubscribe := s.Subscribe("")
+	defer unsubscribe()
+	if err := s.Start(ctx, 1); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	waitFor(t, updates, "resume", jobs.StatusDone)
+	failed, err := s.Get("fail")
+	if err != nil || failed.Status != jobs.StatusFailed || failed.Error == "" {
+		t.Errorf("expected interrupted job to fail, got %+v, %v", failed, err)
+	}
+}
+
+func TestPruneFinishedJobs(t *testing.T) {
+	s, back := newTestService(t)
+	now := time.Now()
+	for _, job := range []*jobs.Job{
+		{ID: "old", Owner: "alice", Status: jobs.StatusDone, FinishedAt: now.Add(-48 * time.Hour).Unix()},
+		{ID: "oldFailed", Owner: "alice", Status: jobs.StatusFailed, FinishedAt: now.Add(-48 * time.Hour).Unix()},
+		{ID: "recent", Owner: "alice", Status: jobs.StatusDone, FinishedAt: now.Unix()},
+		{ID: "queued", Owner: "alice", Status: jobs.StatusQueued, CreatedAt: now.Add(-48 * time.Hour).Unix()},
+	} {
+		if err := back.Save(job); err != nil {
+			t.Fatalf("failed to save job: %v", err)
+		}
+	}
+	var removed []string
+	count, err := s.Prune(now.Add(-24*time.Hour), func(job jobs.Job) {
+		removed = append(removed, job.ID)
+	})
+	if err != nil {
+		t.Fatalf("failed to prune: %v", err)
+	}
+	if count != 2 || len(removed) != 2 {
+		t.Errorf("expected the 2 old finished jobs to be removed, got %d %v", count, removed)
+	}
+	for id, kept := range map[string]bool{"old": false, "oldFailed": false, "recent": true, "queued": true} {
+		if _, err = s.Get(id); (err == nil) != kept {
+			t.Errorf("expected job %v to be kept: %v, got %v", id, kept, err)
+		}
+	}
+}
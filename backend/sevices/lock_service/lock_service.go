@@ -0,0 +1,254 @@
+package lock_service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+)
+
+const (
+	DefaultTimeout = 5 * time.Minute
+	MaxTimeout     = time.Hour
+	maxNoteLength  = 256
+)
+
+// Lock is an advisory lock on a file. Locks are kept in memory and expire
+// unless the owner renews them, so a closed editor can't block a file.
+type Lock struct {
+	Source    string    `json:"source"` // path of the source
+	Path      string    `json:"path"`   // index path of the file
+	Owner     string    `json:"owner"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// LockedError is returned when a file is locked by another user.
+type LockedError struct {
+	Lock Lock
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%v by %v until %v", errors.ErrLocked, e.Lock.Owner, e.Lock.ExpiresAt.Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error {
+	return errors.ErrLocked
+}
+
+// LockService holds the locks of all sources.
+type LockService struct {
+	mu      sync.Mutex
+	locks   map[string]*Lock   // source + path -> lock
+	writers map[string]*writer // source + path -> save in progress
+	now     func() time.Time
+}
+
+// writer serializes the saves of a file, it is dropped when no save of the
+// file is left.
+type writer struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func NewLockService() *LockService {
+	return &LockService{
+		locks:   make(map[string]*Lock),
+		writers: make(map[string]*writer),
+		now:     time.Now,
+	}
+}
+
+func lockKey(source, path string) string {
+	return source + "\x00" + path
+}
+
+// clampTimeout returns the default timeout for zero and limits the timeout
+// to MaxTimeout.
+func clampTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DefaultTimeout
+	}
+	return min(timeout, MaxTimeout)
+}
+
+// active returns the unexpired lock of a file, s.mu must be held.
+func (s *LockService) active(source, path string) *Lock {
+	key := lockKey(source, path)
+	lock, ok := s.locks[key]
+	if !ok {
+		return nil
+	}
+	if !s.now().Before(lock.ExpiresAt) {
+		delete(s.locks, key)
+		return nil
+	}
+	return lock
+}
+
+// Acquire locks a file for owner. Acquiring a lock the owner already holds
+// renews it and replaces the note.
+func (s *LockService) Acquire(source, path, owner, note string, timeout time.Duration) (Lock, error) {
+	if len(note) > maxNoteLength {
+		return Lock{}, fmt.Errorf("lock note is longer than %d characters", maxNoteLength)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	lock := s.active(source, path)
+	if lock != nil && lock.Owner != owner {
+		return Lock{}, &LockedError{Lock: *lock}
+	}
+	if lock == nil {
+		lock = &Lock{Source: source, Path: path, Owner: owner, CreatedAt: now}
+		s.locks[lockKey(source, path)] = lock
+	}
+	lock.Note = note
+	lock.ExpiresAt = now.Add(clampTimeout(timeout))
+	return *lock, nil
+}
+
+// LockWrite waits until no other save of a file is in progress and returns
+// the function that ends the save. A save holds it from checking the version
+// of the file until the file is written, so two saves based on the same
+// version can't both succeed.
+func (s *LockService) LockWrite(source, path string) (unlock func()) {
+	key := lockKey(source, strings.TrimSuffix(path, "/"))
+	s.mu.Lock()
+	w, ok := s.writers[key]
+	if !ok {
+		w = &writer{}
+		s.writers[key] = w
+	}
+	w.refs++
+	s.mu.Unlock()
+
+	w.mu.Lock()
+	return func() {
+		w.mu.Unlock()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if w.refs--; w.refs == 0 {
+			delete(s.writers, key)
+		}
+	}
+}
+
+// Renew extends a lock the owner holds.
+func (s *LockService) Renew(source, path, owner string, timeout time.Duration) (Lock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock := s.active(source, path)
+	if lock == nil {
+		return Lock{}, errors.ErrNotLocked
+	}
+	if lock.Owner != owner {
+		return Lock{}, &LockedError{Lock: *lock}
+	}
+	lock.ExpiresAt = s.now().Add(clampTimeout(timeout))
+	return *lock, nil
+}
+
+// Release removes a lock the owner holds.
+func (s *LockService) Release(source, path, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock := s.active(source, path)
+	if lock == nil {
+		return errors.ErrNotLocked
+	}
+	if lock.Owner != owner {
+		return &LockedError{Lock: *lock}
+	}
+	delete(s.locks, lockKey(source, path))
+	return nil
+}
+
+// Break removes a lock regardless of its owner and returns it.
+func (s *LockService) Break(source, path string) (Lock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lock := s.active(source, path)
+	if lock == nil {
+		return Lock{}, errors.ErrNotLocked
+	}
+	delete(s.locks, lockKey(source, path))
+	return *lock, nil
+}
+
+// Check returns a LockedError if the file is locked by someone other than
+// user.
+func (s *LockService) Check(source, path, user string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lock := s.active(source, path); lock != nil && lock.Owner != user {
+		return &LockedError{Lock: *lock}
+	}
+	return nil
+}
+
+// CheckTree returns a LockedError if the item or, for folders, any file
+// inside it is locked by someone other than user.
+func (s *LockService) CheckTree(source, path, user string) error {
+	path = strings.TrimSuffix(path, "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, lock := range s.list(source, path) {
+		if lock.Owner != user {
+			return &LockedError{Lock: lock}
+		}
+	}
+	return nil
+}
+
+// List returns the active locks of files below scope, sorted by path.
+func (s *LockService) List(source, scope string) []Lock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list(source, strings.TrimSuffix(scope, "/"))
+}
+
+func (s *LockService) list(source, scope string) []Lock {
+	locks := []Lock{}
+	for _, lock := range s.locks {
+		if lock.Source != source || (lock.Path != scope && !strings.HasPrefix(lock.Path, scope+"/")) {
+			continue
+		}
+		if s.active(source, lock.Path) != nil {
+			locks = append(locks, *lock)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].Path < locks[j].Path
+	})
+	return locks
+}
+
+// Move moves the locks of a file or the files inside a folder to their new
+// location.
+func (s *LockService) Move(fromSource, from, toSource, to string) {
+	from = strings.TrimSuffix(from, "/")
+	to = strings.TrimSuffix(to, "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, lock := range s.list(fromSource, from) {
+		delete(s.locks, lockKey(lock.Source, lock.Path))
+		lock.Source = toSource
+		lock.Path = to + lock.Path[len(from):]
+		s.locks[lockKey(lock.Source, lock.Path)] = &lock
+	}
+}
+
+// Remove drops the locks of a deleted file or the files inside a deleted
+// folder.
+func (s *LockService) Remove(source, path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, lock := range s.list(source, strings.TrimSuffix(path, "/")) {
+		delete(s.locks, lockKey(lock.Source, lock.Path))
+	}
+}
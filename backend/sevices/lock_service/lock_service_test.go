@@ -0,0 +1,124 @@
+package lock_service
+
+import (
+	stdErrors "errors"
+	"testing"
+	"time"
+
+	"github.com/SlepoyShaman/FileStorage/backend/common/errors"
+)
+
+func newTestService() (*LockService, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewLockService()
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestAcquireByOtherUserFails(t *testing.T) {
+	s, _ := newTestService()
+	if _, err := s.Acquire("/src", "/a.txt", "alice", "editing", 0); err != nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+	_, err := s.Acquire("/src", "/a.txt", "bob", "", 0)
+	var locked *LockedError
+	if !stdErrors.As(err, &locked) || !stdErrors.Is(err, errors.ErrLocked) {
+		t.Fatalf("expected LockedError, got %v", err)
+	}
+	if locked.Lock.Owner != "alice" || locked.Lock.Note != "editing" {
+		t.Errorf("unexpected lock in error: %+v", locked.Lock)
+	}
+	if err = s.Check("/src", "/a.txt", "alice"); err != nil {
+		t.Errorf("expected owner to pass check, got %v", err)
+	}
+	if err = s.CheckTree("/src", "/", "bob"); !stdErrors.Is(err, errors.ErrLocked) {
+		t.Errorf("expected lock inside folder to fail check, got %v", err)
+	}
+}
+
+func TestLockExpiresUnlessRenewed(t *testing.T) {
+	s, now := newTestService()
+	_, _ = s.Acquire("/src", "/a.txt", "alice", "", time.Minute)
+	*now = now.Add(50 * time.Second)
+	lock, err := s.Renew("/src", "/a.txt", "alice", time.Minute)
+	if err != nil {
+		t.Fatalf("failed to renew lock: %v", err)
+	}
+	if want := now.Add(time.Minute); !lock.ExpiresAt.Equal(want) {
+		t.Errorf("expected lock to expire at %v, got %v", want, lock.ExpiresAt)
+	}
+	*now = now.Add(time.Minute)
+	if err = s.Check("/src", "/a.txt", "bob"); err != nil {
+		t.Errorf("expected expired lock to be ignored, got %v", err)
+	}
+	if _, err = s.Renew("/src", "/a.txt", "alice", 0); err != errors.ErrNotLocked {
+		t.Errorf("expected ErrNotLocked for expired lock, got %v", err)
+	}
+}
+
+func TestTimeoutIsLimited(t *testing.T) {
+	s, now := newTestService()
+	lock, _ := s.Acquire("/src", "/a.txt", "alice", "", 24*time.Hour)
+	if want := now.Add(MaxTimeout); !lock.ExpiresAt.Equal(want) {
+		t.Errorf("expected lock to expire at %v, got %v", want, lock.ExpiresAt)
+	}
+}
+
+func TestReleaseAndBreak(t *testing.T) {
+	s, _ := newTestService()
+	_, _ = s.Acquire("/src", "/a.txt", "alice", "", 0)
+	if err := s.Release("/src", "/a.txt", "bob"); !stdErrors.Is(err, errors.ErrLocked) {
+		t.Errorf("expected release by other user to fail, got %v", err)
+	}
+	lock, err := s.Break("/src", "/a.txt")
+	if err != nil || lock.Owner != "alice" {
+		t.Fatalf("expected to break lock of alice, got %+v, %v", lock, err)
+	}
+	if err = s.Release("/src", "/a.txt", "alice"); err != errors.ErrNotLocked {
+		t.Errorf("expected ErrNotLocked after break, got %v", err)
+	}
+}
+
+func TestMoveFolder(t *testing.T) {
+	s, _ := newTestService()
+	_, _ = s.Acquire("/src", "/docs/a.txt", "alice", "", 0)
+	_, _ = s.Acquire("/src", "/docsother.txt", "alice", "", 0)
+	s.Move("/src", "/docs/", "/src", "/archive/")
+	locks := s.List("/src", "/")
+	if len(locks) != 2 || locks[0].Path != "/archive/a.txt" || locks[1].Path != "/docsother.txt" {
+		t.Errorf("unexpected locks after move: %+v", locks)
+	}
+	s.Remove("/src", "/archive")
+	if locks = s.List("/src", "/"); len(locks) != 1 {
+		t.Errorf("expected 1 lock after remove, got %+v", locks)
+	}
+}
+
+func TestLockWriteSerializesSaves(t *testing.T) {
+	s, _ := newTestService()
+	unlock := s.LockWrite("/src", "/a.txt")
+	// other files can be saved meanwhile
+	s.LockWrite("/src", "/b.txt")()
+
+	acquired := make(chan struct{})
+	go func() {
+		defer close(acquired)
+		s.LockWrite("/src", "/a.txt")()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("expected the second save to wait for the first one")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the second save to continue after the first one ended")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.writers) != 0 {
+		t.Errorf("expected no writers to be left, got %d", len(s.writers))
+	}
+}
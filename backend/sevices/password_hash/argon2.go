@@ -0,0 +1,110 @@
+package password_hash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Предельные параметры argon2id. Параметры из сохраненных хешей выше них
+// отклоняются, чтобы подложенный хеш не мог занять всю память и процессор.
+const (
+	maxArgon2Time    = 16
+	maxArgon2Memory  = 1024 * 1024 // 1 GiB в KiB
+	maxArgon2Threads = 16
+	maxArgon2KeyLen  = 64
+)
+
+// Argon2idHasher Конкретная стратегия - алгоритм argon2id
+type Argon2idHasher struct {
+	time    uint32
+	memory  uint32 // в KiB
+	threads uint8
+	keyLen  uint32
+	saltLen int
+}
+
+func NewArgon2idHasher(time, memoryKiB uint32, threads uint8) *Argon2idHasher {
+	if time == 0 {
+		time = 3
+	}
+	if memoryKiB == 0 {
+		memoryKiB = 64 * 1024
+	}
+	if threads == 0 {
+		threads = 2
+	}
+	time = min(time, maxArgon2Time)
+	memoryKiB = min(memoryKiB, maxArgon2Memory)
+	threads = min(threads, maxArgon2Threads)
+	return &Argon2idHasher{time: time, memory: memoryKiB, threads: threads, keyLen: 32, saltLen: 16}
+}
+
+// Hash Возвращает хеш в формате $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (a *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, a.time, a.memory, a.threads, a.keyLen)
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id, argon2.Version, a.memory, a.time, a.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a *Argon2idHasher) Verify(password, hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false
+	}
+	other := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func (a *Argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+	return params.time != a.time || params.memory != a.memory || params.threads != a.threads
+}
+
+func (a *Argon2idHasher) Algorithm() string {
+	return AlgorithmArgon2id
+}
+
+func decodeArgon2id(hash string) (*Argon2idHasher, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	params := &Argon2idHasher{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	if params.time == 0 || params.time > maxArgon2Time ||
+		params.memory == 0 || params.memory > maxArgon2Memory ||
+		params.threads == 0 || params.threads > maxArgon2Threads {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 || len(key) > maxArgon2KeyLen {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	return params, salt, key, nil
+}
@@ -1,11 +1,32 @@
 package password_hash
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Имена алгоритмов, используемые в конфигурации и в закодированных хешах
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmScrypt   = "scrypt"
+)
+
+var (
+	ErrMismatchedHashAndPassword = errors.New("hashedPassword is not the hash of the given password")
+	ErrUnknownAlgorithm          = errors.New("unknown password hash algorithm")
+	ErrInvalidHash               = errors.New("invalid encoded password hash")
+)
 
 // PasswordHasher Интерфейс стратегии хеширования паролей
 type PasswordHasher interface {
 	Hash(password string) (string, error)
 	Verify(password, hash string) bool
+	// NeedsRehash сообщает, что хеш создан другим алгоритмом или с устаревшими параметрами
+	NeedsRehash(hash string) bool
+	Algorithm() string
 }
 
 // BcryptHasher Конкретная стратегия - алгоритм bcrypt
@@ -14,6 +35,9 @@ type BcryptHasher struct {
 }
 
 func NewBcryptHasher(cost int) *BcryptHasher {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
 	return &BcryptHasher{cost: cost}
 }
 
@@ -26,3 +50,29 @@ func (b *BcryptHasher) Verify(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
 }
+
+func (b *BcryptHasher) NeedsRehash(hash string) bool {
+	if DetectAlgorithm(hash) != AlgorithmBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != b.cost
+}
+
+func (b *BcryptHasher) Algorithm() string {
+	return AlgorithmBcrypt
+}
+
+// DetectAlgorithm Определяет алгоритм по префиксу закодированного хеша.
+// Хеши bcrypt хранятся в родном формате ($2a$, $2b$, $2y$), остальные в формате PHC.
+func DetectAlgorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return AlgorithmBcrypt
+	case strings.HasPrefix(hash, "$"+AlgorithmArgon2id+"$"):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(hash, "$"+AlgorithmScrypt+"$"):
+		return AlgorithmScrypt
+	}
+	return ""
+}
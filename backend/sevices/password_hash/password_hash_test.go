@@ -0,0 +1,108 @@
+package password_hash
+
+import (
+	"testing"
+)
+
+func TestHashersRoundTrip(t *testing.T) {
+	hashers := []PasswordHasher{
+		NewBcryptHasher(bcryptTestCost),
+		NewArgon2idHasher(1, 8*1024, 1),
+		NewScryptHasher(10, 8, 1),
+	}
+	for _, h := range hashers {
+		hash, err := h.Hash("secret")
+		if err != nil {
+			t.Fatalf("%s: hash failed: %v", h.Algorithm(), err)
+		}
+		if got := DetectAlgorithm(hash); got != h.Algorithm() {
+			t.Errorf("%s: detected algorithm %q", h.Algorithm(), got)
+		}
+		if !h.Verify("secret", hash) {
+			t.Errorf("%s: expected password to verify", h.Algorithm())
+		}
+		if h.Verify("wrong", hash) {
+			t.Errorf("%s: expected wrong password to fail", h.Algorithm())
+		}
+		if h.NeedsRehash(hash) {
+			t.Errorf("%s: fresh hash should not need a rehash", h.Algorithm())
+		}
+	}
+}
+
+func TestStrategyVerifiesAllAlgorithms(t *testing.T) {
+	bcryptHash, _ := NewBcryptHasher(bcryptTestCost).Hash("secret")
+	scryptHash, _ := NewScryptHasher(10, 8, 1).Hash("secret")
+	strategy := NewStrategy(NewArgon2idHasher(1, 8*1024, 1))
+	for _, hash := range []string{bcryptHash, scryptHash} {
+		if !strategy.Verify("secret", hash) {
+			t.Errorf("expected strategy to verify %s hash", DetectAlgorithm(hash))
+		}
+		if !strategy.NeedsRehash(hash) {
+			t.Errorf("expected %s hash to need a rehash to argon2id", DetectAlgorithm(hash))
+		}
+	}
+	if strategy.Verify("secret", "plaintext") {
+		t.Error("expected unknown hash format to fail verification")
+	}
+}
+
+func TestNeedsRehashOnParameterChange(t *testing.T) {
+	hash, _ := NewArgon2idHasher(1, 8*1024, 1).Hash("secret")
+	if !NewArgon2idHasher(2, 8*1024, 1).NeedsRehash(hash) {
+		t.Error("expected argon2id hash with t=1 to need a rehash for t=2")
+	}
+	if !NewArgon2idHasher(1, 16*1024, 1).NeedsRehash(hash) {
+		t.Error("expected argon2id hash with m=8192 to need a rehash for m=16384")
+	}
+	scryptHash, _ := NewScryptHasher(10, 8, 1).Hash("secret")
+	if !NewScryptHasher(11, 8, 1).NeedsRehash(scryptHash) {
+		t.Error("expected scrypt hash with ln=10 to need a rehash for ln=11")
+	}
+	bcryptHash, _ := NewBcryptHasher(bcryptTestCost).Hash("secret")
+	if !NewBcryptHasher(bcryptTestCost + 1).NeedsRehash(bcryptHash) {
+		t.Errorf("expected bcrypt hash with cost %d to need a rehash for cost %d", bcryptTestCost, bcryptTestCost+1)
+	}
+}
+
+func TestRejectsExcessiveParameters(t *testing.T) {
+	key := "$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	hashes := []string{
+		"$argon2id$v=19$m=4194304,t=1,p=1" + key,
+		"$argon2id$v=19$m=8192,t=1000,p=1" + key,
+		"$argon2id$v=19$m=8192,t=1,p=0" + key,
+		"$scrypt$ln=30,r=8,p=1" + key,
+		"$scrypt$ln=10,r=1024,p=1" + key,
+		"$scrypt$ln=10,r=8,p=64" + key,
+	}
+	strategy := NewStrategy(NewArgon2idHasher(1, 8*1024, 1))
+	for _, hash := range hashes {
+		if strategy.Verify("secret", hash) {
+			t.Errorf("expected %s to be rejected", hash)
+		}
+		if !strategy.NeedsRehash(hash) {
+			t.Errorf("expected %s to need a rehash", hash)
+		}
+	}
+
+	h := NewArgon2idHasher(1000, 1<<30, 255)
+	if h.time != maxArgon2Time || h.memory != maxArgon2Memory || h.threads != maxArgon2Threads {
+		t.Errorf("expected argon2id parameters to be clamped, got t=%d m=%d p=%d", h.time, h.memory, h.threads)
+	}
+	s := NewScryptHasher(31, 1024, 64)
+	if s.logN != maxScryptLogN || s.r != maxScryptR || s.p != maxScryptP {
+		t.Errorf("expected scrypt parameters to be clamped, got ln=%d r=%d p=%d", s.logN, s.r, s.p)
+	}
+}
+
+func TestNewStrategyFromConfig(t *testing.T) {
+	if _, err := NewStrategyFromConfig(Config{Algorithm: "md5"}); err != ErrUnknownAlgorithm {
+		t.Errorf("expected ErrUnknownAlgorithm, got %v", err)
+	}
+	s, err := NewStrategyFromConfig(Config{})
+	if err != nil || s.Algorithm() != AlgorithmBcrypt {
+		t.Errorf("expected bcrypt to be the default algorithm, got %v %v", s, err)
+	}
+}
+
+const bcryptTestCost = 4
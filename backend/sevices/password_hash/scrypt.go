@@ -0,0 +1,112 @@
+package password_hash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Предельные параметры scrypt. Параметры из сохраненных хешей выше них
+// отклоняются, чтобы подложенный хеш не мог занять всю память и процессор.
+const (
+	maxScryptLogN   = 20 // 1 GiB при r=8
+	maxScryptR      = 32
+	maxScryptP      = 16
+	maxScryptKeyLen = 64
+)
+
+// ScryptHasher Конкретная стратегия - алгоритм scrypt
+type ScryptHasher struct {
+	logN    uint8 // N = 2^logN
+	r       int
+	p       int
+	keyLen  int
+	saltLen int
+}
+
+func NewScryptHasher(logN uint8, r, p int) *ScryptHasher {
+	if logN == 0 {
+		logN = 15
+	}
+	if r <= 0 {
+		r = 8
+	}
+	if p <= 0 {
+		p = 1
+	}
+	logN = min(logN, maxScryptLogN)
+	r = min(r, maxScryptR)
+	p = min(p, maxScryptP)
+	return &ScryptHasher{logN: logN, r: r, p: p, keyLen: 32, saltLen: 16}
+}
+
+// Hash Возвращает хеш в формате $scrypt$ln=15,r=8,p=1$<salt>$<key>
+func (s *ScryptHasher) Hash(password string) (string, error) {
+	salt := make([]byte, s.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<s.logN, s.r, s.p, s.keyLen)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("$%s$ln=%d,r=%d,p=%d$%s$%s",
+		AlgorithmScrypt, s.logN, s.r, s.p,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (s *ScryptHasher) Verify(password, hash string) bool {
+	params, salt, key, err := decodeScrypt(hash)
+	if err != nil {
+		return false
+	}
+	other, err := scrypt.Key([]byte(password), salt, 1<<params.logN, params.r, params.p, len(key))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
+
+func (s *ScryptHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := decodeScrypt(hash)
+	if err != nil {
+		return true
+	}
+	return params.logN != s.logN || params.r != s.r || params.p != s.p
+}
+
+func (s *ScryptHasher) Algorithm() string {
+	return AlgorithmScrypt
+}
+
+func decodeScrypt(hash string) (*ScryptHasher, []byte, []byte, error) {
+	// "", "scrypt", "ln=..,r=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[1] != AlgorithmScrypt {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	params := &ScryptHasher{}
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.logN, &params.r, &params.p); err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	if params.logN == 0 || params.logN > maxScryptLogN ||
+		params.r <= 0 || params.r > maxScryptR ||
+		params.p <= 0 || params.p > maxScryptP {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil || len(key) == 0 || len(key) > maxScryptKeyLen {
+		return nil, nil, nil, ErrInvalidHash
+	}
+	return params, salt, key, nil
+}
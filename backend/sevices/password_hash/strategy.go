@@ -0,0 +1,66 @@
+package password_hash
+
+// Config Параметры хеширования паролей из конфигурации
+type Config struct {
+	Algorithm       string `json:"algorithm"`       // algorithm used for new hashes: bcrypt, argon2id or scrypt (default: bcrypt)
+	BcryptCost      int    `json:"bcryptCost"`      // bcrypt cost factor (default: 10)
+	Argon2Time      uint32 `json:"argon2Time"`      // argon2id number of passes (default: 3)
+	Argon2MemoryKiB uint32 `json:"argon2MemoryKiB"` // argon2id memory in KiB (default: 65536)
+	Argon2Threads   uint8  `json:"argon2Threads"`   // argon2id parallelism (default: 2)
+	ScryptLogN      uint8  `json:"scryptLogN"`      // scrypt cost as a power of two, N = 2^logN (default: 15)
+	ScryptR         int    `json:"scryptR"`         // scrypt block size (default: 8)
+	ScryptP         int    `json:"scryptP"`         // scrypt parallelism (default: 1)
+}
+
+// Strategy Хеширует предпочтительным алгоритмом и проверяет хеши любого известного алгоритма.
+// Параметры проверки берутся из самого хеша, поэтому старые хеши остаются рабочими.
+type Strategy struct {
+	preferred PasswordHasher
+	verifiers map[string]PasswordHasher
+}
+
+func NewStrategy(preferred PasswordHasher) *Strategy {
+	verifiers := map[string]PasswordHasher{
+		AlgorithmBcrypt:   NewBcryptHasher(0),
+		AlgorithmArgon2id: NewArgon2idHasher(0, 0, 0),
+		AlgorithmScrypt:   NewScryptHasher(0, 0, 0),
+	}
+	verifiers[preferred.Algorithm()] = preferred
+	return &Strategy{preferred: preferred, verifiers: verifiers}
+}
+
+// NewStrategyFromConfig Создает стратегию по настройкам
+func NewStrategyFromConfig(c Config) (*Strategy, error) {
+	var preferred PasswordHasher
+	switch c.Algorithm {
+	case "", AlgorithmBcrypt:
+		preferred = NewBcryptHasher(c.BcryptCost)
+	case AlgorithmArgon2id:
+		preferred = NewArgon2idHasher(c.Argon2Time, c.Argon2MemoryKiB, c.Argon2Threads)
+	case AlgorithmScrypt:
+		preferred = NewScryptHasher(c.ScryptLogN, c.ScryptR, c.ScryptP)
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+	return NewStrategy(preferred), nil
+}
+
+func (s *Strategy) Hash(password string) (string, error) {
+	return s.preferred.Hash(password)
+}
+
+func (s *Strategy) Verify(password, hash string) bool {
+	verifier, ok := s.verifiers[DetectAlgorithm(hash)]
+	if !ok {
+		return false
+	}
+	return verifier.Verify(password, hash)
+}
+
+func (s *Strategy) NeedsRehash(hash string) bool {
+	return s.preferred.NeedsRehash(hash)
+}
+
+func (s *Strategy) Algorithm() string {
+	return s.preferred.Algorithm()
+}
@@ -1,23 +1,43 @@
 package user_service
 
 import (
+	"log/slog"
 	"os"
+	"strconv"
 
-	"github.com/SlepoyShaman/FileStorage/services/password_hash"
+	"github.com/SlepoyShaman/FileStorage/backend/sevices/password_hash"
+	"golang.org/x/crypto/bcrypt"
 )
 
+// PasswordStore Хранилище пользователей, в которое сохраняется обновленный хеш
+type PasswordStore interface {
+	SetPasswordHash(id uint, hash string) error
+}
+
 // UserService Сервис, который использует стратегию хеширования
 type UserService struct {
 	hasher password_hash.PasswordHasher
+	store  PasswordStore
 }
 
 func NewUserService() *UserService {
+	// default_hash_cost задается строкой в окружении, при ошибке используется стоимость по умолчанию
+	cost, err := strconv.Atoi(os.Getenv("default_hash_cost"))
+	if err != nil {
+		cost = bcrypt.DefaultCost
+	}
 	return &UserService{
-		// Конкретная реализация выбрана здесь один раз и навсегда
-		hasher: password_hash.NewBcryptHasher(os.Getenv("default_hash_cost")),
+		// Новые хеши создаются bcrypt, но проверяются хеши любого известного алгоритма
+		hasher: password_hash.NewStrategy(password_hash.NewBcryptHasher(cost)),
 	}
 }
 
+// NewUserServiceWithHasher Сервис с заданной стратегией, например из настроек.
+// Обновленные при входе хеши сохраняются в store, если он задан.
+func NewUserServiceWithHasher(hasher password_hash.PasswordHasher, store PasswordStore) *UserService {
+	return &UserService{hasher: hasher, store: store}
+}
+
 func (s *UserService) SetPassword(user *User, plainPassword string) error {
 	hashed, err := s.hasher.Hash(plainPassword)
 	if err != nil {
@@ -27,6 +47,31 @@ func (s *UserService) SetPassword(user *User, plainPassword string) error {
 	return nil
 }
 
+// ValidatePassword Проверяет пароль и при успехе обновляет устаревший хеш
 func (s *UserService) ValidatePassword(user *User, plainPassword string) bool {
-	return s.hasher.Verify(plainPassword, user.PasswordHash)
+	if !s.hasher.Verify(plainPassword, user.PasswordHash) {
+		return false
+	}
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		// пароль верный, при ошибке старый хеш остается рабочим
+		if err := s.rehash(user, plainPassword); err != nil {
+			slog.Error("failed to upgrade password hash", "user", user.ID, "err", err)
+		}
+	}
+	return true
+}
+
+// rehash Заменяет хеш пользователя хешем текущего алгоритма и сохраняет его
+func (s *UserService) rehash(user *User, plainPassword string) error {
+	hashed, err := s.hasher.Hash(plainPassword)
+	if err != nil {
+		return err
+	}
+	if s.store != nil {
+		if err = s.store.SetPasswordHash(user.ID, hashed); err != nil {
+			return err
+		}
+	}
+	user.PasswordHash = hashed
+	return nil
 }